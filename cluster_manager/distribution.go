@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/manager_server"
+)
+
+func GetDistribution(server_address string, top_keys int) (*manager_server.DistributionResponse, error) {
+	client, err := rpc.Dial("tcp", server_address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	args := &manager_server.DistributionRequest{Top_keys: top_keys}
+	var reply manager_server.DistributionResponse
+
+	err = client.Call("ManagerServer.Distribution", args, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Collect_Distributions asks every physical node for its key counts and hot keys,
+// giving the addresses of the nodes that couldn't be reached
+func (manager *ClusterManager) Collect_Distributions(top_keys int) ([]*manager_server.DistributionResponse, []string) {
+	distributions := []*manager_server.DistributionResponse{}
+	unreachable := []string{}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, i := range manager.physical_node_indexes() {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			distribution, err := GetDistribution(address, top_keys)
+			defer lock.Unlock()
+			lock.Lock()
+			if err != nil {
+				unreachable = append(unreachable, address+": "+err.Error())
+			} else {
+				distributions = append(distributions, distribution)
+			}
+		}(manager.Nodes[i].Node_config_address)
+	}
+	wg.Wait()
+	sort.Strings(unreachable)
+	return distributions, unreachable
+}
+
+type Range_Entry struct {
+	//the virtual node ending the range, the first replica of its keys
+	Position    hash_ring.KeyHash
+	Physical_Id uint64
+	//the most any replica of the range holds, replicas missing writes hold fewer
+	Keys  int
+	Bytes int64
+	//fraction of the cluster's keys in the range
+	Key_share float64
+	//fraction of the ring the range covers
+	Ownership float64
+}
+
+type Key_Share_Entry struct {
+	Physical_Id uint64
+	Address     string
+	//keys in the ranges the physical node is the first replica for
+	Keys      int
+	Bytes     int64
+	Key_share float64
+	//fraction of the key space the weight entitles the physical node to
+	Expected_share float64
+}
+
+type Hot_Key_Entry struct {
+	Bucket string
+	Key    string
+	//accesses summed over every node coordinating them, over counting by at most Error
+	Count uint64
+	Error uint64
+}
+
+type Distribution_Report struct {
+	Nodes  []Key_Share_Entry
+	Ranges []Range_Entry
+	//the largest key share of a physical node over its expected share, 1 when keys are spread by weight
+	Imbalance float64
+	Hot_keys  []Hot_Key_Entry
+}
+
+// Distribution_Report combines the distributions reported by the nodes. Every replica reports the ranges it holds,
+// so a range is counted once, by the replica holding the most keys of it
+func (manager *ClusterManager) Distribution_Report(distributions []*manager_server.DistributionResponse, top_keys int) Distribution_Report {
+	owners := make(map[hash_ring.KeyHash]uint64)
+	positions := make([]hash_ring.KeyHash, len(manager.Nodes))
+	for i := range manager.Nodes {
+		owners[manager.Nodes[i].Position] = manager.Nodes[i].Physical_Id
+		positions[i] = manager.Nodes[i].Position
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	ranges := make(map[hash_ring.KeyHash]*Range_Entry)
+	hot_keys := make(map[string]*hash_ring.HotKey)
+	for _, distribution := range distributions {
+		for _, stats := range distribution.Ranges {
+			owner, exists := owners[stats.Position]
+			if !exists {
+				//counted under a config the cluster manager no longer has
+				continue
+			}
+			entry := ranges[stats.Position]
+			if entry == nil {
+				entry = &Range_Entry{Position: stats.Position, Physical_Id: owner}
+				ranges[stats.Position] = entry
+			}
+			if stats.Keys > entry.Keys {
+				entry.Keys = stats.Keys
+				entry.Bytes = stats.Bytes
+			}
+		}
+		for _, hot_key := range distribution.Hot_keys {
+			if hot_keys[hot_key.Key] == nil {
+				hot_keys[hot_key.Key] = &hash_ring.HotKey{Key: hot_key.Key}
+			}
+			hot_keys[hot_key.Key].Count += hot_key.Count
+			hot_keys[hot_key.Key].Error += hot_key.Error
+		}
+	}
+
+	report := Distribution_Report{}
+	total_keys := 0
+	for _, entry := range ranges {
+		total_keys += entry.Keys
+	}
+	for i, position := range positions {
+		entry, exists := ranges[position]
+		if !exists {
+			entry = &Range_Entry{Position: position, Physical_Id: owners[position]}
+		}
+		//each range runs from the previous virtual node, the first wrapping around from the last
+		if i == 0 {
+			entry.Ownership = (float64(position) + float64(hash_ring.MaxKeyHash-positions[len(positions)-1])) / float64(hash_ring.MaxKeyHash)
+		} else {
+			entry.Ownership = float64(position-positions[i-1]) / float64(hash_ring.MaxKeyHash)
+		}
+		if total_keys != 0 {
+			entry.Key_share = float64(entry.Keys) / float64(total_keys)
+		}
+		report.Ranges = append(report.Ranges, *entry)
+	}
+
+	for _, ownership := range manager.Ownership_Report() {
+		entry := Key_Share_Entry{
+			Physical_Id:    ownership.Physical_Id,
+			Address:        ownership.Address,
+			Expected_share: ownership.Expected_ownership,
+		}
+		for _, range_entry := range report.Ranges {
+			if range_entry.Physical_Id == entry.Physical_Id {
+				entry.Keys += range_entry.Keys
+				entry.Bytes += range_entry.Bytes
+			}
+		}
+		if total_keys != 0 {
+			entry.Key_share = float64(entry.Keys) / float64(total_keys)
+		}
+		if entry.Expected_share != 0 && entry.Key_share/entry.Expected_share > report.Imbalance {
+			report.Imbalance = entry.Key_share / entry.Expected_share
+		}
+		report.Nodes = append(report.Nodes, entry)
+	}
+
+	for _, hot_key := range hot_keys {
+		bucket, key := hash_ring.Split_Bucket_Key(hot_key.Key)
+		report.Hot_keys = append(report.Hot_keys, Hot_Key_Entry{bucket, key, hot_key.Count, hot_key.Error})
+	}
+	sort.Slice(report.Hot_keys, func(i, j int) bool {
+		if report.Hot_keys[i].Count != report.Hot_keys[j].Count {
+			return report.Hot_keys[i].Count > report.Hot_keys[j].Count
+		}
+		if report.Hot_keys[i].Bucket != report.Hot_keys[j].Bucket {
+			return report.Hot_keys[i].Bucket < report.Hot_keys[j].Bucket
+		}
+		return report.Hot_keys[i].Key < report.Hot_keys[j].Key
+	})
+	if len(report.Hot_keys) > top_keys {
+		report.Hot_keys = report.Hot_keys[:top_keys]
+	}
+	return report
+}
+
+func percent(fraction float64) string {
+	return fmt.Sprintf("%.2f%%", fraction*100)
+}
+
+func print_distribution_report(report Distribution_Report, top_ranges int) {
+	fmt.Printf("%-12s %-24s %-12s %-14s %-10s %-10s\n", "Physical Id", "Address", "Keys", "Bytes", "Share", "Expected")
+	for _, entry := range report.Nodes {
+		fmt.Printf("%-12d %-24s %-12d %-14d %-10s %-10s\n",
+			entry.Physical_Id, entry.Address, entry.Keys, entry.Bytes, percent(entry.Key_share), percent(entry.Expected_share))
+	}
+	fmt.Printf("Imbalance %.2f\n", report.Imbalance)
+
+	//the ranges holding the most keys for their size are the ones worth moving a virtual node into
+	ranges := append([]Range_Entry{}, report.Ranges...)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Keys > ranges[j].Keys
+	})
+	if len(ranges) > top_ranges {
+		ranges = ranges[:top_ranges]
+	}
+	fmt.Println()
+	fmt.Printf("%-22s %-12s %-12s %-14s %-10s %-10s\n", "Range End", "Physical Id", "Keys", "Bytes", "Share", "Of Ring")
+	for _, entry := range ranges {
+		fmt.Printf("%-22d %-12d %-12d %-14d %-10s %-10s\n",
+			entry.Position, entry.Physical_Id, entry.Keys, entry.Bytes, percent(entry.Key_share), percent(entry.Ownership))
+	}
+
+	fmt.Println()
+	fmt.Printf("%-16s %-32s %-12s %-12s\n", "Bucket", "Key", "Accesses", "Error")
+	for _, entry := range report.Hot_keys {
+		fmt.Printf("%-16s %-32s %-12d %-12d\n", entry.Bucket, strconv.Quote(entry.Key), entry.Count, entry.Error)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/manager_server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistributionReport(t *testing.T) {
+	manager := New_Weighted([]int{1, 1}, Node{}, 2, 2, 1, 1)
+	assert.Equal(t, 4, len(manager.Nodes))
+
+	//both physical nodes replicate every range, the second missed a write to one of them
+	keys := map[uint64]int{0: 30, 1: 10}
+	first := &manager_server.DistributionResponse{Physical_id: 0}
+	second := &manager_server.DistributionResponse{Physical_id: 1}
+	for _, node := range manager.Nodes {
+		keys_in_range := keys[node.Physical_Id] / 2
+		first.Ranges = append(first.Ranges, hash_ring.RangeStats{Position: node.Position, Keys: keys_in_range, Bytes: int64(keys_in_range * 10)})
+		second.Ranges = append(second.Ranges, hash_ring.RangeStats{Position: node.Position, Keys: keys_in_range - 1, Bytes: int64((keys_in_range - 1) * 10)})
+	}
+	//counted before a virtual node moved
+	second.Ranges = append(second.Ranges, hash_ring.RangeStats{Position: 12345, Keys: 100})
+
+	first.Hot_keys = []hash_ring.HotKey{
+		{Key: "bar", Count: 10},
+		{Key: hash_ring.Bucket_Key("users", "alice"), Count: 4, Error: 1},
+		{Key: "foo", Count: 2},
+	}
+	second.Hot_keys = []hash_ring.HotKey{{Key: "bar", Count: 5, Error: 2}, {Key: "foo", Count: 3}}
+
+	report := manager.Distribution_Report([]*manager_server.DistributionResponse{first, second}, 2)
+	assert.Equal(t, 2, len(report.Nodes))
+	assert.Equal(t, 30, report.Nodes[0].Keys)
+	assert.Equal(t, int64(300), report.Nodes[0].Bytes)
+	assert.InDelta(t, 0.75, report.Nodes[0].Key_share, 0.0001)
+	assert.InDelta(t, 0.5, report.Nodes[0].Expected_share, 0.0001)
+	assert.Equal(t, 10, report.Nodes[1].Keys)
+	assert.InDelta(t, 0.25, report.Nodes[1].Key_share, 0.0001)
+	assert.InDelta(t, 1.5, report.Imbalance, 0.0001)
+
+	assert.Equal(t, 4, len(report.Ranges))
+	ownership := 0.0
+	for i, entry := range report.Ranges {
+		if i > 0 {
+			assert.Less(t, report.Ranges[i-1].Position, entry.Position)
+		}
+		ownership += entry.Ownership
+	}
+	assert.InDelta(t, 1, ownership, 0.0001)
+
+	assert.Equal(t, []Hot_Key_Entry{{"", "bar", 15, 2}, {"", "foo", 5, 0}}, report.Hot_keys)
+
+	empty := manager.Distribution_Report(nil, 10)
+	assert.Equal(t, 4, len(empty.Ranges))
+	assert.Equal(t, 0, empty.Nodes[0].Keys)
+	assert.Equal(t, 0.0, empty.Imbalance)
+	assert.Equal(t, 0, len(empty.Hot_keys))
+}
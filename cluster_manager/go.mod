@@ -1,6 +1,6 @@
 module github.com/lucifer1662/distrokdb/cluster_manager
 
-go 1.19
+go 1.21
 
 require github.com/stretchr/testify v1.8.1
 
@@ -11,3 +11,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/lucifer1662/distrokdb/node => ../node
@@ -2,11 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/rpc"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
 	"github.com/lucifer1662/distrokdb/node/hash_ring"
@@ -15,7 +20,7 @@ import (
 )
 
 type SetConfig struct {
-	config *manager_server.Config
+	Config *manager_server.Config
 }
 
 type SetConfigResponse struct {
@@ -34,7 +39,24 @@ func SetConfigOnNode(config *manager_server.Config, server_address string) (*Set
 	var reply SetConfigResponse
 
 	//blocks for response
-	err = client.Call("DistributedHashRingServer.Get", args, &reply)
+	err = client.Call("ManagerServer.SetConfig", args, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func GetReplicationStatus(server_address string) (*manager_server.ReplicationStatusResponse, error) {
+	client, err := rpc.Dial("tcp", server_address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	args := &manager_server.ReplicationStatusRequest{}
+	var reply manager_server.ReplicationStatusResponse
+
+	err = client.Call("ManagerServer.ReplicationStatus", args, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +72,17 @@ type Node struct {
 	Physical_Id         uint64
 	Http_node_address   string
 	Node_config_address string
+	Zone                string
+	Rack                string
+	//capacity of the physical node, ownership of the ring is proportional to it, 0 is treated as 1
+	Weight int
+}
+
+func (node *Node) Capacity() int {
+	if node.Weight == 0 {
+		return 1
+	}
+	return node.Weight
 }
 
 type ClusterManager struct {
@@ -59,6 +92,14 @@ type ClusterManager struct {
 	Minimum_read          int
 	Next_physical_node_id uint64
 	Next_node_id          uint64
+	Epoch                 uint64
+	//non zero while new replicas are being back filled after raising the replication factor
+	Read_replication_factor int
+	//virtual nodes given to a physical node for each unit of weight
+	Virtual_nodes_per_weight int
+	//places keys on the ring, can only be chosen when the cluster is created
+	Partitioner string
+	Buckets     []hash_ring.Bucket `json:",omitempty"`
 }
 
 func insert(a []int, index int, value int) []int {
@@ -124,13 +165,106 @@ func New(
 	}
 
 	return ClusterManager{
-		Nodes:                 new_nodes,
-		Replication_factor:    replication_factor,
-		Minimum_writes:        minimum_writes,
-		Minimum_read:          minimum_read,
-		Next_physical_node_id: uint64(number_of_nodes),
-		Next_node_id:          uint64(len(new_nodes)),
+		Nodes:                    new_nodes,
+		Replication_factor:       replication_factor,
+		Minimum_writes:           minimum_writes,
+		Minimum_read:             minimum_read,
+		Next_physical_node_id:    uint64(number_of_nodes),
+		Next_node_id:             uint64(len(new_nodes)),
+		Virtual_nodes_per_weight: number_of_virtual_nodes,
+	}
+}
+
+// New_Weighted creates a cluster where each physical node gets virtual nodes in proportion to its weight,
+// interleaved around the ring so a physical node's virtual nodes are not adjacent
+func New_Weighted(
+	weights []int,
+	base_node Node,
+	virtual_nodes_per_weight int,
+	replication_factor int,
+	minimum_writes int,
+	minimum_read int) ClusterManager {
+
+	order := hash_ring.Weighted_Order(hash_ring.Virtual_Node_Counts(weights, virtual_nodes_per_weight))
+	ring_positions := hash_ring.Generate_Ring_Positions(len(order))
+
+	new_nodes := make([]Node, len(order))
+	for i := range order {
+		base_node.Id = uint64(i)
+		base_node.Physical_Id = uint64(order[i])
+		base_node.Weight = weights[order[i]]
+		base_node.Position = ring_positions[i]
+		new_nodes[i] = base_node
+	}
+
+	return ClusterManager{
+		Nodes:                    new_nodes,
+		Replication_factor:       replication_factor,
+		Minimum_writes:           minimum_writes,
+		Minimum_read:             minimum_read,
+		Next_physical_node_id:    uint64(len(weights)),
+		Next_node_id:             uint64(len(new_nodes)),
+		Virtual_nodes_per_weight: virtual_nodes_per_weight,
+	}
+}
+
+// Add_Weighted_Node adds a physical node with virtual nodes in proportion to its weight
+func (manager *ClusterManager) Add_Weighted_Node(base_node Node, weight int) {
+	virtual_nodes_per_weight := manager.Virtual_nodes_per_weight
+	if virtual_nodes_per_weight == 0 {
+		virtual_nodes_per_weight = 1
+	}
+	base_node.Weight = weight
+	manager.Add_Node(base_node, base_node.Capacity()*virtual_nodes_per_weight)
+}
+
+type Ownership_Entry struct {
+	Physical_Id   uint64
+	Address       string
+	Weight        int
+	Virtual_nodes int
+	//fraction of the key space the physical node is the first replica for
+	Ownership float64
+	//fraction of the key space the weight entitles the physical node to
+	Expected_ownership float64
+}
+
+// Ownership_Report gives the share of the ring owned by each physical node, ordered by physical id
+func (manager *ClusterManager) Ownership_Report() []Ownership_Entry {
+	positions := make([]hash_ring.KeyHash, len(manager.Nodes))
+	physical_ids := make([]uint64, len(manager.Nodes))
+	for i := range manager.Nodes {
+		positions[i] = manager.Nodes[i].Position
+		physical_ids[i] = manager.Nodes[i].Physical_Id
+	}
+	ownership := hash_ring.Ownership(positions, physical_ids)
+
+	total_weight := 0
+	report := []Ownership_Entry{}
+	for _, i := range manager.physical_node_indexes() {
+		node := &manager.Nodes[i]
+		total_weight += node.Capacity()
+		report = append(report, Ownership_Entry{
+			Physical_Id: node.Physical_Id,
+			Address:     node.Address,
+			Weight:      node.Capacity(),
+			Ownership:   ownership[node.Physical_Id],
+		})
 	}
+
+	for i := range report {
+		for j := range manager.Nodes {
+			if manager.Nodes[j].Physical_Id == report[i].Physical_Id {
+				report[i].Virtual_nodes++
+			}
+		}
+		report[i].Expected_ownership = float64(report[i].Weight) / float64(total_weight)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Physical_Id < report[j].Physical_Id
+	})
+	return report
 }
 
 /*
@@ -182,15 +316,201 @@ func (manager *ClusterManager) Add_Node(
 }
 */
 
-func (manager *ClusterManager) UpdateConfigs() {
+func (manager *ClusterManager) Number_of_physical_nodes() int {
+	physical_ids := make(map[uint64]bool)
+	for i := range manager.Nodes {
+		physical_ids[manager.Nodes[i].Physical_Id] = true
+	}
+	return len(physical_ids)
+}
+
+// Set_Replication validates a new replication factor and quorum sizes and moves to a new epoch.
+// Returns true if the replication factor was raised, in which case reads stay on the old replicas
+// until Finish_Backfill is called
+func (manager *ClusterManager) Set_Replication(replication_factor int, minimum_writes int, minimum_read int) ([]string, bool, error) {
+	warnings, err := hash_ring.Validate_Quorum(replication_factor, minimum_writes, minimum_read, manager.Number_of_physical_nodes())
+	if err != nil {
+		return nil, false, err
+	}
+	err = manager.Validate_Placement(replication_factor)
+	if err != nil {
+		return nil, false, err
+	}
+
+	//reads use the replicas that are already populated, a back fill still in progress keeps its old count
+	read_replication_factor := manager.Read_replication_factor
+	if read_replication_factor == 0 {
+		read_replication_factor = manager.Replication_factor
+	}
+	needs_backfill := replication_factor > read_replication_factor
+
+	manager.Replication_factor = replication_factor
+	manager.Minimum_writes = minimum_writes
+	manager.Minimum_read = minimum_read
+	manager.Read_replication_factor = 0
+	if needs_backfill {
+		manager.Read_replication_factor = read_replication_factor
+	}
+	manager.Epoch++
+
+	return warnings, needs_backfill, nil
+}
+
+// Finish_Backfill moves to a new epoch where reads use every replica
+func (manager *ClusterManager) Finish_Backfill() {
+	manager.Read_replication_factor = 0
+	manager.Epoch++
+}
+
+// Create_Bucket validates a new bucket's settings and moves to a new epoch including it
+func (manager *ClusterManager) Create_Bucket(bucket hash_ring.Bucket) ([]string, error) {
+	err := hash_ring.Validate_Bucket_Name(bucket.Name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range manager.Buckets {
+		if manager.Buckets[i].Name == bucket.Name {
+			return nil, fmt.Errorf("Bucket \"%s\" already exists", bucket.Name)
+		}
+	}
+	warnings, err := hash_ring.Validate_Quorum(bucket.Replication_factor, bucket.Minimum_writes, bucket.Minimum_read, manager.Number_of_physical_nodes())
+	if err != nil {
+		return nil, err
+	}
+	err = manager.Validate_Placement(bucket.Replication_factor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hash_ring.Conflict_Resolution_By_Name(bucket.Conflict_resolution); err != nil {
+		return nil, err
+	}
+	if bucket.Default_ttl < 0 {
+		return nil, errors.New("Default ttl must not be negative")
+	}
+
+	manager.Buckets = append(manager.Buckets, bucket)
+	manager.Epoch++
+	return warnings, nil
+}
+
+// Drop_Bucket moves to a new epoch without the bucket, its keys stay stored on the nodes
+func (manager *ClusterManager) Drop_Bucket(name string) error {
+	for i := range manager.Buckets {
+		if manager.Buckets[i].Name == name {
+			manager.Buckets = append(manager.Buckets[:i], manager.Buckets[i+1:]...)
+			manager.Epoch++
+			return nil
+		}
+	}
+	return fmt.Errorf("Bucket \"%s\" does not exist", name)
+}
+
+// Label_Physical_Node sets the zone and rack of every virtual node of a physical node
+func (manager *ClusterManager) Label_Physical_Node(physical_id uint64, zone string, rack string) {
+	for i := range manager.Nodes {
+		if manager.Nodes[i].Physical_Id == physical_id {
+			manager.Nodes[i].Zone = zone
+			manager.Nodes[i].Rack = rack
+		}
+	}
+}
+
+func split_labels(labels string) []string {
+	if labels == "" {
+		return []string{}
+	}
+	return strings.Split(labels, ",")
+}
+
+// Label_Physical_Nodes assigns zones and racks to the physical nodes in turn
+func (manager *ClusterManager) Label_Physical_Nodes(zones []string, racks []string) {
+	for physical_id := uint64(0); physical_id < manager.Next_physical_node_id; physical_id++ {
+		zone := ""
+		rack := ""
+		if len(zones) != 0 {
+			zone = zones[int(physical_id)%len(zones)]
+		}
+		if len(racks) != 0 {
+			rack = racks[int(physical_id)%len(racks)]
+		}
+		manager.Label_Physical_Node(physical_id, zone, rack)
+	}
+}
+
+// Validate_Placement checks the replicas of every key can be spread across distinct zones.
+// Clusters without zone labels are valid, replicas are then only spread across physical nodes
+func (manager *ClusterManager) Validate_Placement(replication_factor int) error {
+	zones := make(map[string]bool)
+	unlabelled := 0
+	for _, i := range manager.physical_node_indexes() {
+		if manager.Nodes[i].Zone == "" {
+			unlabelled++
+		} else {
+			zones[manager.Nodes[i].Zone] = true
+		}
+	}
+
+	if len(zones) == 0 {
+		return nil
+	}
+	if unlabelled != 0 {
+		return fmt.Errorf("%d physical nodes are missing a zone", unlabelled)
+	}
+	if len(zones) < replication_factor {
+		return fmt.Errorf("Replication factor (%d) needs at least as many zones, only %d zones exist", replication_factor, len(zones))
+	}
+	return nil
+}
+
+// config address of one virtual node of each physical node
+func (manager *ClusterManager) physical_node_indexes() []int {
+	visited := make(map[uint64]bool)
+	indexes := []int{}
+	for i := range manager.Nodes {
+		if !visited[manager.Nodes[i].Physical_Id] {
+			visited[manager.Nodes[i].Physical_Id] = true
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Wait_For_Backfill polls every physical node until they have all back filled the current epoch
+func (manager *ClusterManager) Wait_For_Backfill(poll_interval time.Duration, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := 0
+		for _, i := range manager.physical_node_indexes() {
+			status, err := GetReplicationStatus(manager.Nodes[i].Node_config_address)
+			if err != nil || status.Epoch != manager.Epoch || !status.Backfill_complete {
+				pending++
+			}
+		}
+
+		if pending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d nodes have not finished back filling epoch %d", pending, manager.Epoch)
+		}
+		time.Sleep(poll_interval)
+	}
+}
+
+func (manager *ClusterManager) UpdateConfigs() error {
 	wg := sync.WaitGroup{}
-	wg.Add(len(manager.Nodes))
+	physical_node_indexes := manager.physical_node_indexes()
+	wg.Add(len(physical_node_indexes))
 
 	shared_config := distributed_hash_ring.SharedConfig{
-		Replication_factor: manager.Replication_factor,
-		Minimum_writes:     manager.Minimum_writes,
-		Minimum_read:       manager.Minimum_read,
-		Nodes:              make([]distributed_hash_ring.Node, len(manager.Nodes)),
+		Replication_factor:      manager.Replication_factor,
+		Minimum_writes:          manager.Minimum_writes,
+		Minimum_read:            manager.Minimum_read,
+		Epoch:                   manager.Epoch,
+		Read_replication_factor: manager.Read_replication_factor,
+		Partitioner:             manager.Partitioner,
+		Buckets:                 manager.Buckets,
+		Nodes:                   make([]distributed_hash_ring.Node, len(manager.Nodes)),
 	}
 
 	for i := 0; i < len(shared_config.Nodes); i++ {
@@ -198,13 +518,19 @@ func (manager *ClusterManager) UpdateConfigs() {
 		shared_config.Nodes[i].Id = manager.Nodes[i].Id
 		shared_config.Nodes[i].Physical_Id = manager.Nodes[i].Physical_Id
 		shared_config.Nodes[i].Position = manager.Nodes[i].Position
+		shared_config.Nodes[i].Zone = manager.Nodes[i].Zone
+		shared_config.Nodes[i].Rack = manager.Nodes[i].Rack
+		shared_config.Nodes[i].Http_address = manager.Nodes[i].Http_node_address
 	}
 
-	for i := range manager.Nodes {
+	errors_lock := sync.Mutex{}
+	failed := []string{}
+
+	for _, i := range physical_node_indexes {
 		my_index := i
 		go func() {
 			defer wg.Done()
-			SetConfigOnNode(&manager_server.Config{
+			_, err := SetConfigOnNode(&manager_server.Config{
 				Http_config: &http_db_server.Config{
 					My_id:     manager.Nodes[my_index].Id,
 					Http_port: manager.Nodes[my_index].Http_port,
@@ -217,10 +543,20 @@ func (manager *ClusterManager) UpdateConfigs() {
 			},
 				manager.Nodes[my_index].Node_config_address,
 			)
+			if err != nil {
+				errors_lock.Lock()
+				failed = append(failed, manager.Nodes[my_index].Node_config_address+": "+err.Error())
+				errors_lock.Unlock()
+			}
 		}()
 	}
 
 	wg.Wait()
+
+	if len(failed) != 0 {
+		return fmt.Errorf("Failed to update %d nodes: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
 }
 
 func SaveClusterManagerState(path string, cluster_manager *ClusterManager) error {
@@ -252,15 +588,52 @@ func ReadClusterManager(path string) (*ClusterManager, error) {
 	return &config, nil
 }
 
+func parse_weights(weights string) ([]int, error) {
+	parsed := []int{}
+	for _, weight := range strings.Split(weights, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("Invalid weight \"%s\", weights must be positive integers", weight)
+		}
+		parsed = append(parsed, value)
+	}
+	return parsed, nil
+}
+
+func print_ownership_report(manager *ClusterManager) {
+	fmt.Printf("%-12s %-24s %-8s %-14s %-10s %-10s\n", "Physical Id", "Address", "Weight", "Virtual Nodes", "Owned", "Expected")
+	for _, entry := range manager.Ownership_Report() {
+		fmt.Printf("%-12d %-24s %-8d %-14d %-10s %-10s\n",
+			entry.Physical_Id, entry.Address, entry.Weight, entry.Virtual_nodes,
+			fmt.Sprintf("%.2f%%", entry.Ownership*100), fmt.Sprintf("%.2f%%", entry.Expected_ownership*100))
+	}
+}
+
 func main() {
 
 	switch os.Args[1] {
 	case "help":
 		println("Example of add:")
-		println("cluster_manager add --config_address=\"127.0.0.1:6500\" --public_address=\"127.0.0.1:6500\" --external_http_port=6443 --node_port=6023 --http_port=8080 --number_virtual_nodes 2")
+		println("cluster_manager add --config_address=\"127.0.0.1:6500\" --public_address=\"127.0.0.1:6500\" --external_http_port=6443 --node_port=6023 --http_port=8080 --number_virtual_nodes 2 --zone=zone-a --rack=rack-1")
 
 		println("Example of init:")
-		println("cluster_manager init --config_address=\"127.0.0.1:6500\" --public_address=\"127.0.0.1:6500\" --external_http_port=6443 --node_port=6023 --http_port=8080 --number_virtual_nodes 2 --number_physical_nodes=3 --replication_factor=2 --minimum_writes=2 --minimum_reads=2")
+		println("cluster_manager init --config_address=\"127.0.0.1:6500\" --public_address=\"127.0.0.1:6500\" --external_http_port=6443 --node_port=6023 --http_port=8080 --number_virtual_nodes 2 --number_physical_nodes=3 --replication_factor=2 --minimum_writes=2 --minimum_reads=2 --zones=zone-a,zone-b,zone-c")
+
+		println("Example of weighted init, each weight unit gets number_virtual_nodes virtual nodes:")
+		println("cluster_manager init --config_address=\"127.0.0.1:6500\" --public_address=\"127.0.0.1:6500\" --number_virtual_nodes 4 --weights=1,2,1 --partitioner=xxhash")
+
+		println("Example of report:")
+		println("cluster_manager report")
+
+		println("Example of the key distribution and hot keys reported by the nodes:")
+		println("cluster_manager distribution --top_keys=20 --top_ranges=10")
+
+		println("Example of replication:")
+		println("cluster_manager replication --replication_factor=3 --minimum_writes=2 --minimum_reads=2")
+
+		println("Example of creating and dropping a bucket:")
+		println("cluster_manager create_bucket --name=users --replication_factor=3 --minimum_writes=2 --minimum_reads=2 --conflict_resolution=largest_value --default_ttl=3600")
+		println("cluster_manager drop_bucket --name=users")
 
 	case "init":
 		var number_of_virtual_nodes int
@@ -268,6 +641,10 @@ func main() {
 		var replication_factor int
 		var minimum_writes int
 		var minimum_read int
+		var zones string
+		var racks string
+		var weights string
+		var partitioner string
 		base_node := Node{}
 
 		flag.StringVar(&base_node.Node_config_address, "config_address", "", "The external address that the node will listen on for management information")
@@ -281,6 +658,10 @@ func main() {
 		flag.IntVar(&replication_factor, "replication_factor", 3, "The number of physical nodes")
 		flag.IntVar(&minimum_writes, "minimum_writes", 1, "The minium number of writes before response is sent to client")
 		flag.IntVar(&minimum_read, "minimum_reads", 1, "The minimum number of reads before results are returned to client")
+		flag.StringVar(&zones, "zones", "", "Comma separated zones, assigned to the physical nodes in turn")
+		flag.StringVar(&racks, "racks", "", "Comma separated racks, assigned to the physical nodes in turn")
+		flag.StringVar(&weights, "weights", "", "Comma separated capacity weight of each physical node, replaces number_physical_nodes")
+		flag.StringVar(&partitioner, "partitioner", hash_ring.DefaultPartitioner, "How keys are placed on the ring: fnv, xxhash, murmur3, jump, rendezvous or order_preserving")
 
 		flag.CommandLine.Parse(os.Args[2:])
 
@@ -288,18 +669,45 @@ func main() {
 
 		fmt.Printf("Number of Physical Nodes %d\n", number_of_nodes)
 		fmt.Printf("Number of Virtual Nodes %d\n", number_of_virtual_nodes)
-		fmt.Printf("Total number of nodes %d\n", number_of_virtual_nodes*number_of_nodes)
+		if weights == "" {
+			fmt.Printf("Total number of nodes %d\n", number_of_virtual_nodes*number_of_nodes)
+		}
 
-		manager := New(number_of_nodes, base_node, number_of_virtual_nodes, replication_factor, minimum_writes, minimum_read)
+		var manager ClusterManager
+		if weights == "" {
+			manager = New(number_of_nodes, base_node, number_of_virtual_nodes, replication_factor, minimum_writes, minimum_read)
+		} else {
+			parsed_weights, err := parse_weights(weights)
+			if err != nil {
+				println(err.Error())
+				return
+			}
+			manager = New_Weighted(parsed_weights, base_node, number_of_virtual_nodes, replication_factor, minimum_writes, minimum_read)
+		}
+		manager.Label_Physical_Nodes(split_labels(zones), split_labels(racks))
+		err := manager.Validate_Placement(replication_factor)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		_, err = hash_ring.Partitioner_By_Name(partitioner)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		manager.Partitioner = partitioner
 		SaveClusterManagerState("cluster_manager.json", &manager)
+		print_ownership_report(&manager)
 
 	case "add":
 		manager, err := ReadClusterManager("cluster_manager.json")
 		if err != nil {
 			println(err.Error())
+			return
 		}
 
 		var number_of_virtual_nodes int
+		var weight int
 		base_node := Node{}
 
 		flag.StringVar(&base_node.Node_config_address, "config_address", "", "The external address that the node will listen on for management information")
@@ -309,9 +717,170 @@ func main() {
 		flag.IntVar(&base_node.Internal_port, "node_port", 6023, "The port the node will listen on for communication between nodes, may be different to the public_address if the system is using proxies or docker containers")
 		flag.IntVar(&base_node.Http_port, "http_port", 8080, "The port the node will listen on to accept http request from clients")
 		flag.IntVar(&number_of_virtual_nodes, "number_virtual_nodes", 1, "The number of virtual nodes for this physical node")
+		flag.StringVar(&base_node.Zone, "zone", "", "The zone the physical node is in")
+		flag.StringVar(&base_node.Rack, "rack", "", "The rack the physical node is in")
+		flag.IntVar(&weight, "weight", 0, "The capacity weight of this physical node, replaces number_virtual_nodes")
+
+		flag.CommandLine.Parse(os.Args[2:])
 
-		manager.Add_Node(base_node, number_of_virtual_nodes)
+		if weight == 0 {
+			manager.Add_Node(base_node, number_of_virtual_nodes)
+		} else {
+			manager.Add_Weighted_Node(base_node, weight)
+		}
+		err = manager.Validate_Placement(manager.Replication_factor)
+		if err != nil {
+			println(err.Error())
+			return
+		}
 		SaveClusterManagerState("cluster_manager.json", manager)
+		print_ownership_report(manager)
+
+	case "report":
+		manager, err := ReadClusterManager("cluster_manager.json")
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		print_ownership_report(manager)
+
+	case "distribution":
+		manager, err := ReadClusterManager("cluster_manager.json")
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		var top_keys int
+		var top_ranges int
+
+		flag.IntVar(&top_keys, "top_keys", 20, "The number of the most accessed keys to show")
+		flag.IntVar(&top_ranges, "top_ranges", 10, "The number of the ranges holding the most keys to show")
+
+		flag.CommandLine.Parse(os.Args[2:])
+
+		distributions, unreachable := manager.Collect_Distributions(top_keys)
+		for _, failure := range unreachable {
+			fmt.Printf("Warning: not counting %s\n", failure)
+		}
+		print_distribution_report(manager.Distribution_Report(distributions, top_keys), top_ranges)
+
+	case "replication":
+		manager, err := ReadClusterManager("cluster_manager.json")
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		var replication_factor int
+		var minimum_writes int
+		var minimum_read int
+		var timeout time.Duration
+
+		flag.IntVar(&replication_factor, "replication_factor", manager.Replication_factor, "The number of physical nodes each value is stored on")
+		flag.IntVar(&minimum_writes, "minimum_writes", manager.Minimum_writes, "The minium number of writes before response is sent to client")
+		flag.IntVar(&minimum_read, "minimum_reads", manager.Minimum_read, "The minimum number of reads before results are returned to client")
+		flag.DurationVar(&timeout, "timeout", 10*time.Minute, "How long to wait for new replicas to be back filled")
+
+		flag.CommandLine.Parse(os.Args[2:])
+
+		warnings, needs_backfill, err := manager.Set_Replication(replication_factor, minimum_writes, minimum_read)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+
+		fmt.Printf("Pushing epoch %d\n", manager.Epoch)
+		err = manager.UpdateConfigs()
+		SaveClusterManagerState("cluster_manager.json", manager)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		if manager.Read_replication_factor != 0 {
+			if needs_backfill {
+				fmt.Printf("Back filling new replicas, reads use %d replicas until complete\n", manager.Read_replication_factor)
+			}
+			err = manager.Wait_For_Backfill(time.Second, timeout)
+			if err != nil {
+				println(err.Error())
+				println("Run replication again to resume waiting")
+				return
+			}
+
+			manager.Finish_Backfill()
+			fmt.Printf("Back fill complete, pushing epoch %d\n", manager.Epoch)
+			err = manager.UpdateConfigs()
+			SaveClusterManagerState("cluster_manager.json", manager)
+			if err != nil {
+				println(err.Error())
+				return
+			}
+		}
+
+	case "create_bucket":
+		manager, err := ReadClusterManager("cluster_manager.json")
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		bucket := hash_ring.Bucket{}
+		flag.StringVar(&bucket.Name, "name", "", "The name of the bucket, lowercase letters, digits, _ or -")
+		flag.IntVar(&bucket.Replication_factor, "replication_factor", manager.Replication_factor, "The number of physical nodes each value of the bucket is stored on")
+		flag.IntVar(&bucket.Minimum_writes, "minimum_writes", manager.Minimum_writes, "The minium number of writes before response is sent to client")
+		flag.IntVar(&bucket.Minimum_read, "minimum_reads", manager.Minimum_read, "The minimum number of reads before results are returned to client")
+		flag.StringVar(&bucket.Conflict_resolution, "conflict_resolution", "", "How concurrent versions are resolved: first_instance or largest_value, by default the cluster's")
+		flag.IntVar(&bucket.Default_ttl, "default_ttl", 0, "Seconds until values written without a ttl expire, 0 keeps them")
+
+		flag.CommandLine.Parse(os.Args[2:])
+
+		warnings, err := manager.Create_Bucket(bucket)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+
+		fmt.Printf("Pushing epoch %d\n", manager.Epoch)
+		err = manager.UpdateConfigs()
+		SaveClusterManagerState("cluster_manager.json", manager)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+	case "drop_bucket":
+		manager, err := ReadClusterManager("cluster_manager.json")
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		var name string
+		flag.StringVar(&name, "name", "", "The name of the bucket")
+
+		flag.CommandLine.Parse(os.Args[2:])
+
+		err = manager.Drop_Bucket(name)
+		if err != nil {
+			println(err.Error())
+			return
+		}
+
+		fmt.Printf("Pushing epoch %d\n", manager.Epoch)
+		err = manager.UpdateConfigs()
+		SaveClusterManagerState("cluster_manager.json", manager)
+		if err != nil {
+			println(err.Error())
+			return
+		}
 	}
 
 }
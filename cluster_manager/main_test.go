@@ -92,3 +92,97 @@ func TestAdd(t *testing.T) {
 	base_node.Position = ring_positions[6]
 	assert.Equal(t, base_node, manager.Nodes[6])
 }
+
+func TestSetReplication(t *testing.T) {
+	base_node := Node{}
+	manager := New(3, base_node, 2, 2, 2, 2)
+
+	warnings, needs_backfill, err := manager.Set_Replication(3, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, true, needs_backfill)
+	assert.Equal(t, uint64(1), manager.Epoch)
+	assert.Equal(t, 3, manager.Replication_factor)
+	assert.Equal(t, 2, manager.Read_replication_factor)
+
+	manager.Finish_Backfill()
+	assert.Equal(t, uint64(2), manager.Epoch)
+	assert.Equal(t, 0, manager.Read_replication_factor)
+
+	//lowering needs no back fill
+	warnings, needs_backfill, err = manager.Set_Replication(2, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(warnings))
+	assert.Equal(t, false, needs_backfill)
+	assert.Equal(t, uint64(3), manager.Epoch)
+
+	//only 3 physical nodes
+	_, _, err = manager.Set_Replication(4, 1, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(3), manager.Epoch)
+	assert.Equal(t, 2, manager.Replication_factor)
+}
+
+func TestBuckets(t *testing.T) {
+	base_node := Node{}
+	manager := New(3, base_node, 2, 2, 2, 2)
+
+	_, err := manager.Create_Bucket(hash_ring.Bucket{Name: "users", Replication_factor: 3, Minimum_writes: 2, Minimum_read: 2, Default_ttl: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), manager.Epoch)
+
+	//taken name, too many replicas, unknown conflict resolution
+	_, err = manager.Create_Bucket(hash_ring.Bucket{Name: "users", Replication_factor: 1, Minimum_writes: 1, Minimum_read: 1})
+	assert.NotNil(t, err)
+	_, err = manager.Create_Bucket(hash_ring.Bucket{Name: "orders", Replication_factor: 4, Minimum_writes: 1, Minimum_read: 1})
+	assert.NotNil(t, err)
+	_, err = manager.Create_Bucket(hash_ring.Bucket{Name: "orders", Replication_factor: 1, Minimum_writes: 1, Minimum_read: 1, Conflict_resolution: "newest"})
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(1), manager.Epoch)
+
+	assert.NotNil(t, manager.Drop_Bucket("orders"))
+	assert.Nil(t, manager.Drop_Bucket("users"))
+	assert.Equal(t, 0, len(manager.Buckets))
+	assert.Equal(t, uint64(2), manager.Epoch)
+}
+
+func TestValidatePlacement(t *testing.T) {
+	base_node := Node{}
+	manager := New(3, base_node, 2, 3, 2, 2)
+
+	//no zones, nothing to check
+	assert.Nil(t, manager.Validate_Placement(3))
+
+	manager.Label_Physical_Nodes([]string{"a", "b"}, []string{})
+	assert.Equal(t, "a", manager.Nodes[0].Zone)
+	assert.Equal(t, "b", manager.Nodes[1].Zone)
+	assert.Equal(t, "a", manager.Nodes[2].Zone)
+	assert.Equal(t, "a", manager.Nodes[3].Zone)
+	assert.NotNil(t, manager.Validate_Placement(3))
+	assert.Nil(t, manager.Validate_Placement(2))
+
+	manager.Label_Physical_Node(2, "c", "")
+	assert.Nil(t, manager.Validate_Placement(3))
+
+	manager.Add_Node(base_node, 1)
+	assert.NotNil(t, manager.Validate_Placement(3))
+}
+
+func TestWeightedOwnershipReport(t *testing.T) {
+	base_node := Node{}
+	manager := New_Weighted([]int{1, 2, 1}, base_node, 2, 2, 1, 1)
+	assert.Equal(t, 8, len(manager.Nodes))
+
+	manager.Add_Weighted_Node(base_node, 4)
+	assert.Equal(t, 16, len(manager.Nodes))
+
+	report := manager.Ownership_Report()
+	assert.Equal(t, 4, len(report))
+	expected := []float64{0.125, 0.25, 0.125, 0.5}
+	for i := range report {
+		assert.Equal(t, uint64(i), report[i].Physical_Id)
+		assert.InDelta(t, expected[i], report[i].Expected_ownership, 0.0001)
+		assert.InDelta(t, expected[i], report[i].Ownership, 0.0001)
+	}
+	assert.Equal(t, 8, report[3].Virtual_nodes)
+}
@@ -1,3 +1,3 @@
 module github.com/lucifer1662/distrokdb
 
-go 1.19
+go 1.21
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ApiKeyHeader carries a static api key
+const ApiKeyHeader = "X-Api-Key"
+
+// ApiKey is a static key, only its sha256 is kept in the config so the config doesn't hold the key
+type ApiKey struct {
+	Principal string
+	//hex sha256 of the key, as printed by sha256sum
+	Sha256 string
+}
+
+type ApiKeyAuthenticator struct {
+	//principal by hex sha256 of the key
+	principals map[string]string
+}
+
+func NewApiKeyAuthenticator(keys []ApiKey) (*ApiKeyAuthenticator, error) {
+	authenticator := ApiKeyAuthenticator{principals: map[string]string{}}
+	for _, key := range keys {
+		digest, err := hex.DecodeString(key.Sha256)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("Api key of %s is not a hex sha256", key.Principal)
+		}
+		if key.Principal == "" {
+			return nil, errors.New("Api key has no principal")
+		}
+		authenticator.principals[hex.EncodeToString(digest)] = key.Principal
+	}
+	return &authenticator, nil
+}
+
+func (authenticator *ApiKeyAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	key := req.Header.Get(ApiKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	return authenticator.AuthenticateKey(key)
+}
+
+// AuthenticateKey finds whose key it is, for protocols other than http
+func (authenticator *ApiKeyAuthenticator) AuthenticateKey(key string) (*Principal, error) {
+	digest := sha256.Sum256([]byte(key))
+	principal, exists := authenticator.principals[hex.EncodeToString(digest[:])]
+	if !exists {
+		return nil, errors.New("Unknown api key")
+	}
+	return &Principal{Name: principal, Method: "api_key"}, nil
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries none of its credentials,
+// so the next authenticator can be tried
+var ErrNoCredentials = errors.New("No credentials")
+
+// Principal is who a request was authenticated as
+type Principal struct {
+	Name string
+	//api_key, hmac or jwt
+	Method string
+}
+
+// Authenticator finds who sent a request, failing with ErrNoCredentials when the request
+// carries none of its credentials and with any other error when they are invalid
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+type Permission int
+
+const (
+	Permission_read Permission = iota
+	Permission_write
+	//read and write, and the node wide endpoints such as the change log
+	Permission_admin
+)
+
+func (permission Permission) String() string {
+	switch permission {
+	case Permission_read:
+		return "read"
+	case Permission_write:
+		return "write"
+	default:
+		return "admin"
+	}
+}
+
+func Permission_By_Name(name string) (Permission, error) {
+	switch name {
+	case "read":
+		return Permission_read, nil
+	case "write":
+		return Permission_write, nil
+	case "admin":
+		return Permission_admin, nil
+	}
+	return Permission_read, fmt.Errorf("Unknown permission \"%s\"", name)
+}
+
+// Any is a rule's principal or bucket matching every principal or bucket
+const Any = "*"
+
+// Rule grants a principal permissions on the keys of a bucket starting with a prefix
+type Rule struct {
+	//name of the principal, * for every authenticated principal
+	Principal string
+	//* for every bucket, empty for keys outside of buckets
+	Bucket string `json:",omitempty"`
+	//empty for every key
+	Prefix      string `json:",omitempty"`
+	Permissions []string
+}
+
+type rule struct {
+	Rule
+	permissions map[Permission]bool
+}
+
+func (r *rule) matches(principal *Principal, bucket string, key string) bool {
+	return (r.Principal == Any || r.Principal == principal.Name) &&
+		(r.Bucket == Any || r.Bucket == bucket) &&
+		strings.HasPrefix(key, r.Prefix)
+}
+
+func (r *rule) grants(permission Permission) bool {
+	return r.permissions[permission] || r.permissions[Permission_admin]
+}
+
+type Config struct {
+	Api_keys  []ApiKey  `json:",omitempty"`
+	Hmac_keys []HmacKey `json:",omitempty"`
+	//json web key set of the keys jwts are signed with, jwts are only accepted when set
+	Jwks_file string `json:",omitempty"`
+	//when set jwts must have been issued by and for these
+	Jwt_issuer   string `json:",omitempty"`
+	Jwt_audience string `json:",omitempty"`
+	//permissions of authenticated principals, nothing is allowed unless a rule grants it
+	Rules []Rule
+}
+
+// Auth authenticates requests with each of its authenticators in turn and authorizes them against its rules.
+// The zero Auth authenticates nobody
+type Auth struct {
+	authenticators []Authenticator
+	rules          []rule
+}
+
+func New(config *Config) (*Auth, error) {
+	auth := Auth{}
+	if len(config.Api_keys) != 0 {
+		authenticator, err := NewApiKeyAuthenticator(config.Api_keys)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, authenticator)
+	}
+	if len(config.Hmac_keys) != 0 {
+		authenticator, err := NewHmacAuthenticator(config.Hmac_keys)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, authenticator)
+	}
+	if config.Jwks_file != "" {
+		authenticator, err := NewJwtAuthenticator(config.Jwks_file, config.Jwt_issuer, config.Jwt_audience)
+		if err != nil {
+			return nil, err
+		}
+		auth.authenticators = append(auth.authenticators, authenticator)
+	}
+	if len(auth.authenticators) == 0 {
+		return nil, errors.New("Auth needs api keys, hmac keys or a jwks file")
+	}
+
+	for i, config_rule := range config.Rules {
+		if config_rule.Principal == "" {
+			return nil, fmt.Errorf("Rule %d has no principal", i)
+		}
+		permissions := map[Permission]bool{}
+		for _, name := range config_rule.Permissions {
+			permission, err := Permission_By_Name(name)
+			if err != nil {
+				return nil, fmt.Errorf("Rule %d: %s", i, err.Error())
+			}
+			permissions[permission] = true
+		}
+		auth.rules = append(auth.rules, rule{config_rule, permissions})
+	}
+	return &auth, nil
+}
+
+// CheckConfig fails for a config New would reject
+func CheckConfig(config *Config) error {
+	_, err := New(config)
+	return err
+}
+
+// Authenticate tries each authenticator until one finds credentials in the request
+func (auth *Auth) Authenticate(req *http.Request) (*Principal, error) {
+	for _, authenticator := range auth.authenticators {
+		principal, err := authenticator.Authenticate(req)
+		if err != ErrNoCredentials {
+			return principal, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// AuthenticateApiKey finds whose api key it is, for protocols that can't sign requests or carry jwts
+func (auth *Auth) AuthenticateApiKey(key string) (*Principal, error) {
+	for _, authenticator := range auth.authenticators {
+		if api_keys, is_api_keys := authenticator.(*ApiKeyAuthenticator); is_api_keys {
+			return api_keys.AuthenticateKey(key)
+		}
+	}
+	return nil, errors.New("Api keys are not accepted")
+}
+
+// Allowed is whether a rule grants the principal the permission on a key of the bucket.
+// Given a prefix, as in scans, the rule must cover every key starting with it
+func (auth *Auth) Allowed(principal *Principal, permission Permission, bucket string, key string) bool {
+	for i := range auth.rules {
+		if auth.rules[i].matches(principal, bucket, key) && auth.rules[i].grants(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin is whether the principal is an admin of every key of every bucket, needed for node wide endpoints
+func (auth *Auth) IsAdmin(principal *Principal) bool {
+	for i := range auth.rules {
+		rule := &auth.rules[i]
+		if (rule.Principal == Any || rule.Principal == principal.Name) && rule.Bucket == Any && rule.Prefix == "" && rule.permissions[Permission_admin] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sha256_hex(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestApiKeys(t *testing.T) {
+	authenticator, err := NewApiKeyAuthenticator([]ApiKey{{Principal: "alice", Sha256: sha256_hex("secret")}})
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", "http://node/v1/keys/bar", nil)
+	_, err = authenticator.Authenticate(req)
+	assert.Equal(t, ErrNoCredentials, err)
+
+	req.Header.Set(ApiKeyHeader, "secret")
+	principal, err := authenticator.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", principal.Name)
+
+	req.Header.Set(ApiKeyHeader, "guess")
+	_, err = authenticator.Authenticate(req)
+	assert.NotNil(t, err)
+
+	_, err = NewApiKeyAuthenticator([]ApiKey{{Principal: "alice", Sha256: "secret"}})
+	assert.NotNil(t, err)
+
+	auth, err := New(&Config{Api_keys: []ApiKey{{Principal: "alice", Sha256: sha256_hex("secret")}}})
+	assert.Nil(t, err)
+	principal, err = auth.AuthenticateApiKey("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", principal.Name)
+	_, err = auth.AuthenticateApiKey("guess")
+	assert.NotNil(t, err)
+	_, err = (&Auth{}).AuthenticateApiKey("secret")
+	assert.NotNil(t, err)
+}
+
+func TestHmac(t *testing.T) {
+	authenticator, err := NewHmacAuthenticator([]HmacKey{{Id: "k1", Secret: "shh", Principal: "bob"}})
+	assert.Nil(t, err)
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	authenticator.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest("PUT", "http://node/v1/keys/bar?ttl=10", strings.NewReader("mar"))
+	assert.Nil(t, SignRequest(req, "k1", "shh", now))
+	principal, err := authenticator.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", principal.Name)
+	//the body is still there for the handler
+	body := make([]byte, 3)
+	req.Body.Read(body)
+	assert.Equal(t, "mar", string(body))
+
+	//a changed body, wrong secret or old signature fail
+	req, _ = http.NewRequest("PUT", "http://node/v1/keys/bar", strings.NewReader("mar"))
+	SignRequest(req, "k1", "shh", now)
+	req.Body = http.NoBody
+	_, err = authenticator.Authenticate(req)
+	assert.NotNil(t, err)
+
+	req, _ = http.NewRequest("GET", "http://node/v1/keys/bar", nil)
+	SignRequest(req, "k1", "guess", now)
+	_, err = authenticator.Authenticate(req)
+	assert.NotNil(t, err)
+
+	req, _ = http.NewRequest("GET", "http://node/v1/keys/bar", nil)
+	SignRequest(req, "k1", "shh", now.Add(-2*Max_clock_skew))
+	_, err = authenticator.Authenticate(req)
+	assert.NotNil(t, err)
+}
+
+func TestRules(t *testing.T) {
+	auth, err := New(&Config{
+		Api_keys: []ApiKey{{Principal: "alice", Sha256: sha256_hex("secret")}},
+		Rules: []Rule{
+			{Principal: "alice", Prefix: "users/", Permissions: []string{"read"}},
+			{Principal: "alice", Bucket: "orders", Permissions: []string{"write"}},
+			{Principal: Any, Bucket: "public", Permissions: []string{"read"}},
+			{Principal: "root", Bucket: Any, Permissions: []string{"admin"}},
+		},
+	})
+	assert.Nil(t, err)
+	alice := &Principal{Name: "alice"}
+	root := &Principal{Name: "root"}
+
+	assert.True(t, auth.Allowed(alice, Permission_read, "", "users/1"))
+	assert.False(t, auth.Allowed(alice, Permission_write, "", "users/1"))
+	assert.False(t, auth.Allowed(alice, Permission_read, "", "orders/1"))
+	//a scan of every key isn't covered by a prefix
+	assert.False(t, auth.Allowed(alice, Permission_read, "", ""))
+	assert.True(t, auth.Allowed(alice, Permission_write, "orders", "1"))
+	assert.False(t, auth.Allowed(alice, Permission_read, "orders", "1"))
+	assert.True(t, auth.Allowed(alice, Permission_read, "public", "1"))
+	assert.True(t, auth.Allowed(root, Permission_write, "public", "1"))
+	assert.True(t, auth.IsAdmin(root))
+	assert.False(t, auth.IsAdmin(alice))
+
+	_, err = New(&Config{Api_keys: []ApiKey{{Principal: "alice", Sha256: sha256_hex("secret")}}, Rules: []Rule{{Principal: "alice", Permissions: []string{"delete"}}}})
+	assert.NotNil(t, err)
+	_, err = New(&Config{})
+	assert.NotNil(t, err)
+	//the zero auth authenticates nobody
+	req, _ := http.NewRequest("GET", "http://node/v1/keys/bar", nil)
+	_, err = (&Auth{}).Authenticate(req)
+	assert.Equal(t, ErrNoCredentials, err)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Hmac_scheme starts the Authorization header of a signed request:
+// KDB-HMAC-SHA256 Credential=<key id>, Signature=<hex hmac of the string to sign>
+const Hmac_scheme = "KDB-HMAC-SHA256"
+
+// DateHeader is the RFC 3339 time a request was signed at, part of the signature
+const DateHeader = "X-Kdb-Date"
+
+// Max_clock_skew bounds how far the signing time may be from the node's clock.
+// A captured request can be replayed within it, clients needing more should send requests over tls
+const Max_clock_skew = 5 * time.Minute
+
+// Max_signed_body bounds the body read to check a signature
+const Max_signed_body = 32 << 20
+
+type HmacKey struct {
+	Id        string
+	Secret    string
+	Principal string
+}
+
+type HmacAuthenticator struct {
+	keys map[string]HmacKey
+	//time requests are checked against, replaced in tests
+	now func() time.Time
+}
+
+func NewHmacAuthenticator(keys []HmacKey) (*HmacAuthenticator, error) {
+	authenticator := HmacAuthenticator{keys: map[string]HmacKey{}, now: time.Now}
+	for _, key := range keys {
+		if key.Id == "" || key.Secret == "" || key.Principal == "" {
+			return nil, errors.New("Hmac keys need an id, secret and principal")
+		}
+		authenticator.keys[key.Id] = key
+	}
+	return &authenticator, nil
+}
+
+// string_to_sign covers the method, path, query, signing time and body, so none can be changed in transit
+func string_to_sign(req *http.Request, date string, body []byte) string {
+	body_hash := sha256.Sum256(body)
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		date,
+		hex.EncodeToString(body_hash[:]),
+	}, "\n")
+}
+
+func signature(secret string, to_sign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(to_sign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// read_body reads the body for signing, leaving it in place to be read again
+func read_body(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, Max_signed_body+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > Max_signed_body {
+		return nil, errors.New("Body is too large to be signed")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// SignRequest signs a request with an hmac key, setting the date and authorization headers
+func SignRequest(req *http.Request, key_id string, secret string, now time.Time) error {
+	body, err := read_body(req)
+	if err != nil {
+		return err
+	}
+	date := now.UTC().Format(time.RFC3339)
+	req.Header.Set(DateHeader, date)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, Signature=%s", Hmac_scheme, key_id, signature(secret, string_to_sign(req, date, body))))
+	return nil
+}
+
+// parse_hmac_authorization reads the key id and signature from the Authorization header
+func parse_hmac_authorization(authorization string) (string, string, error) {
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(authorization, Hmac_scheme+" "), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found {
+			params[name] = value
+		}
+	}
+	if params["Credential"] == "" || params["Signature"] == "" {
+		return "", "", errors.New("Signed requests need a Credential and Signature")
+	}
+	return params["Credential"], params["Signature"], nil
+}
+
+func (authenticator *HmacAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, Hmac_scheme+" ") {
+		return nil, ErrNoCredentials
+	}
+	key_id, given_signature, err := parse_hmac_authorization(authorization)
+	if err != nil {
+		return nil, err
+	}
+	key, exists := authenticator.keys[key_id]
+	if !exists {
+		return nil, errors.New("Unknown hmac key")
+	}
+
+	date := req.Header.Get(DateHeader)
+	signed_at, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", DateHeader)
+	}
+	if skew := authenticator.now().Sub(signed_at); skew > Max_clock_skew || skew < -Max_clock_skew {
+		return nil, errors.New("Request was signed too long ago, or its clock is wrong")
+	}
+
+	body, err := read_body(req)
+	if err != nil {
+		return nil, err
+	}
+	expected := signature(key.Secret, string_to_sign(req, date, body))
+	if !hmac.Equal([]byte(expected), []byte(given_signature)) {
+		return nil, errors.New("Signature does not match")
+	}
+	return &Principal{Name: key.Principal, Method: "hmac"}, nil
+}
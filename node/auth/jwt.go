@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jwt_leeway allows for clock differences between the node and the issuer when checking exp and nbf
+const Jwt_leeway = time.Minute
+
+// Jwks_reload_interval limits how often the jwks file is read again for a token signed with an unknown key,
+// so keys can be rotated by editing the file without a restart
+const Jwks_reload_interval = 10 * time.Second
+
+// jwk is a public key of a json web key set, only RSA and EC keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func decode_big_int(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, errors.New("Key parameter is not base64url encoded")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (key *jwk) public_key() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decode_big_int(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode_big_int(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent is out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("Unsupported curve \"%s\"", key.Crv)
+		}
+		x, err := decode_big_int(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode_big_int(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type \"%s\"", key.Kty)
+}
+
+// load_jwks reads the signing keys of a jwks file by key id, keys for encryption are skipped
+func load_jwks(path string) (map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := jwks{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("Jwks file is not a json web key set: %s", err.Error())
+	}
+	keys := map[string]crypto.PublicKey{}
+	for i := range set.Keys {
+		if set.Keys[i].Use == "enc" {
+			continue
+		}
+		key, err := set.Keys[i].public_key()
+		if err != nil {
+			return nil, fmt.Errorf("Key \"%s\": %s", set.Keys[i].Kid, err.Error())
+		}
+		keys[set.Keys[i].Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("Jwks file has no signing keys")
+	}
+	return keys, nil
+}
+
+// JwtAuthenticator accepts bearer tokens signed with RS256, RS384, RS512, ES256 or ES384
+// by a key in a local jwks file, the token's sub claim is the principal
+type JwtAuthenticator struct {
+	jwks_file string
+	issuer    string
+	audience  string
+	keys      map[string]crypto.PublicKey
+	loaded_at time.Time
+	lock      sync.Mutex
+	//time tokens are checked against, replaced in tests
+	now func() time.Time
+}
+
+func NewJwtAuthenticator(jwks_file string, issuer string, audience string) (*JwtAuthenticator, error) {
+	keys, err := load_jwks(jwks_file)
+	if err != nil {
+		return nil, err
+	}
+	return &JwtAuthenticator{
+		jwks_file: jwks_file,
+		issuer:    issuer,
+		audience:  audience,
+		keys:      keys,
+		loaded_at: time.Now(),
+		now:       time.Now,
+	}, nil
+}
+
+// key finds the key a token was signed with, a token without a key id can only use a set of one key
+func (authenticator *JwtAuthenticator) key(kid string) (crypto.PublicKey, error) {
+	defer authenticator.lock.Unlock()
+	authenticator.lock.Lock()
+	find := func() crypto.PublicKey {
+		if kid == "" && len(authenticator.keys) == 1 {
+			for _, key := range authenticator.keys {
+				return key
+			}
+		}
+		return authenticator.keys[kid]
+	}
+
+	if key := find(); key != nil {
+		return key, nil
+	}
+	if time.Since(authenticator.loaded_at) >= Jwks_reload_interval {
+		authenticator.loaded_at = time.Now()
+		if keys, err := load_jwks(authenticator.jwks_file); err == nil {
+			authenticator.keys = keys
+		}
+		if key := find(); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown signing key \"%s\"", kid)
+}
+
+type jwt_header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwt_claims struct {
+	Sub string   `json:"sub"`
+	Iss string   `json:"iss"`
+	Exp *float64 `json:"exp"`
+	Nbf *float64 `json:"nbf"`
+	//a string or a list of strings
+	Aud interface{} `json:"aud"`
+}
+
+func decode_segment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func verify_signature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("Unsupported algorithm \"%s\"", alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("Algorithm does not match the key")
+		}
+		if rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return errors.New("Signature does not match")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || key.Curve.Params().BitSize != hash.Size()*8 {
+			return errors.New("Algorithm does not match the key")
+		}
+		if len(signature) != 2*size {
+			return errors.New("Signature does not match")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("Signature does not match")
+		}
+	default:
+		return errors.New("Unsupported key type")
+	}
+	return nil
+}
+
+func (claims *jwt_claims) has_audience(audience string) bool {
+	switch aud := claims.Aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (authenticator *JwtAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("Bearer token is not a jwt")
+	}
+
+	header := jwt_header{}
+	if err := decode_segment(segments[0], &header); err != nil {
+		return nil, errors.New("Jwt header is not base64url encoded json")
+	}
+	key, err := authenticator.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, errors.New("Jwt signature is not base64url encoded")
+	}
+	if err := verify_signature(header.Alg, key, segments[0]+"."+segments[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := jwt_claims{}
+	if err := decode_segment(segments[1], &claims); err != nil {
+		return nil, errors.New("Jwt claims are not base64url encoded json")
+	}
+	now := authenticator.now()
+	if claims.Exp == nil || now.After(time.Unix(int64(*claims.Exp), 0).Add(Jwt_leeway)) {
+		return nil, errors.New("Jwt has expired")
+	}
+	if claims.Nbf != nil && now.Add(Jwt_leeway).Before(time.Unix(int64(*claims.Nbf), 0)) {
+		return nil, errors.New("Jwt is not valid yet")
+	}
+	if authenticator.issuer != "" && claims.Iss != authenticator.issuer {
+		return nil, errors.New("Jwt was issued by someone else")
+	}
+	if authenticator.audience != "" && !claims.has_audience(authenticator.audience) {
+		return nil, errors.New("Jwt is for another audience")
+	}
+	if claims.Sub == "" {
+		return nil, errors.New("Jwt has no subject")
+	}
+	return &Principal{Name: claims.Sub, Method: "jwt"}, nil
+}
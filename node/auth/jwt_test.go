@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encode_segment(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sign_jwt(key crypto.Signer, alg string, kid string, claims map[string]interface{}) string {
+	signed := encode_segment(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode_segment(claims)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest.Sum(nil))
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func big_int(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func write_jwks(t *testing.T, path string, keys ...jwk) {
+	data, _ := json.Marshal(jwks{Keys: keys})
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+}
+
+func TestJwt(t *testing.T) {
+	rsa_key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ec_key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	write_jwks(t, path, jwk{Kty: "RSA", Kid: "rsa", N: big_int(rsa_key.N), E: big_int(big.NewInt(int64(rsa_key.E)))})
+
+	authenticator, err := NewJwtAuthenticator(path, "issuer", "distrokdb")
+	assert.Nil(t, err)
+	now := time.Now()
+	authenticator.now = func() time.Time { return now }
+	authenticate := func(token string) (*Principal, error) {
+		req, _ := http.NewRequest("GET", "http://node/v1/keys/bar", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return authenticator.Authenticate(req)
+	}
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"sub": "carol", "iss": "issuer", "aud": []string{"distrokdb"}, "exp": now.Add(time.Hour).Unix()}
+		for name, value := range changes {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	principal, err := authenticate(sign_jwt(rsa_key, "RS256", "rsa", claims(nil)))
+	assert.Nil(t, err)
+	assert.Equal(t, "carol", principal.Name)
+
+	_, err = authenticate(sign_jwt(rsa_key, "RS256", "rsa", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})))
+	assert.NotNil(t, err)
+	_, err = authenticate(sign_jwt(rsa_key, "RS256", "rsa", claims(map[string]interface{}{"aud": "other"})))
+	assert.NotNil(t, err)
+	_, err = authenticate(sign_jwt(rsa_key, "RS256", "rsa", claims(map[string]interface{}{"iss": "other"})))
+	assert.NotNil(t, err)
+	//alg none and tampered claims
+	unsigned := encode_segment(map[string]string{"alg": "none", "kid": "rsa"}) + "." + encode_segment(claims(nil)) + "."
+	_, err = authenticate(unsigned)
+	assert.NotNil(t, err)
+	token := sign_jwt(rsa_key, "RS256", "rsa", claims(nil))
+	segments := strings.Split(token, ".")
+	_, err = authenticate(segments[0] + "." + encode_segment(claims(map[string]interface{}{"sub": "root"})) + "." + segments[2])
+	assert.NotNil(t, err)
+
+	//rotated in by editing the file
+	_, err = authenticate(sign_jwt(ec_key, "ES256", "ec", claims(nil)))
+	assert.NotNil(t, err)
+	write_jwks(t, path, jwk{Kty: "EC", Kid: "ec", Crv: "P-256", X: big_int(ec_key.X), Y: big_int(ec_key.Y)})
+	authenticator.loaded_at = time.Time{}
+	principal, err = authenticate(sign_jwt(ec_key, "ES256", "ec", claims(nil)))
+	assert.Nil(t, err)
+	assert.Equal(t, "carol", principal.Name)
+}
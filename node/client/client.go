@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+)
+
+const Default_timeout = 10 * time.Second
+
+// Max_contexts bounds the contexts remembered, the oldest half are forgotten when it is reached
+const Max_contexts = 10000
+
+var ErrNotFound = errors.New("Key not found")
+
+// ConflictError is returned when a write was based on an older version than the one stored.
+// The client then remembers the current version's context, so writing again overwrites it
+type ConflictError struct {
+	Value   []byte
+	Context string
+}
+
+func (err *ConflictError) Error() string {
+	return "Key was changed by another writer"
+}
+
+// Client sends requests straight to a replica of each key, using a copy of the ring fetched from the nodes.
+// It remembers the context of every key it reads or writes and sends it with later writes,
+// so writes from one client follow each other causally
+type Client struct {
+	seeds       []string
+	http_client *http.Client
+	//sent with every request when set
+	api_key  string
+	topology *topology
+	lock     sync.RWMutex
+
+	contexts      map[string]string
+	context_order []string
+	contexts_lock sync.Mutex
+}
+
+// New fetches the ring from any of the seed addresses, the http addresses of nodes in the cluster
+func New(seeds ...string) (*Client, error) {
+	return NewWithApiKey("", seeds...)
+}
+
+// NewWithApiKey is New for clusters that authenticate requests, the api key is sent with every request
+func NewWithApiKey(api_key string, seeds ...string) (*Client, error) {
+	client := Client{
+		http_client: &http.Client{Timeout: Default_timeout},
+		api_key:     api_key,
+		contexts:    map[string]string{},
+	}
+	for _, seed := range seeds {
+		client.seeds = append(client.seeds, base_url(seed))
+	}
+	if err := client.Refresh(0); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (client *Client) new_request(method string, address string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, address, body)
+	if err != nil {
+		return nil, err
+	}
+	if client.api_key != "" {
+		req.Header.Set(auth.ApiKeyHeader, client.api_key)
+	}
+	return req, nil
+}
+
+func (client *Client) context(key string) string {
+	client.contexts_lock.Lock()
+	defer client.contexts_lock.Unlock()
+	return client.contexts[key]
+}
+
+func (client *Client) remember(key string, context string) {
+	client.contexts_lock.Lock()
+	defer client.contexts_lock.Unlock()
+	if context == "" {
+		delete(client.contexts, key)
+		return
+	}
+	if _, ok := client.contexts[key]; !ok {
+		if len(client.context_order) >= Max_contexts {
+			for _, old_key := range client.context_order[:Max_contexts/2] {
+				delete(client.contexts, old_key)
+			}
+			client.context_order = append([]string{}, client.context_order[Max_contexts/2:]...)
+		}
+		client.context_order = append(client.context_order, key)
+	}
+	client.contexts[key] = context
+}
+
+// do sends the request to each replica of the key in turn, until one answers without a server error
+func (client *Client) do(method string, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	addresses := client.Replicas(key)
+	if len(addresses) == 0 {
+		return nil, errors.New("No nodes with http addresses in the ring")
+	}
+
+	errs := []string{}
+	for _, address := range addresses {
+		req, err := client.new_request(method, address+"/v1/keys/"+url.PathEscape(key), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range headers {
+			if value != "" {
+				req.Header.Set(name, value)
+			}
+		}
+
+		resp, err := client.http_client.Do(req)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		client.check_epoch(address, resp)
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			errs = append(errs, fmt.Sprintf("%s answered %d", address, resp.StatusCode))
+			continue
+		}
+		return resp, nil
+	}
+
+	//the nodes may have moved
+	client.Refresh(0)
+	return nil, fmt.Errorf("Every replica failed: %s", strings.Join(errs, ", "))
+}
+
+// check_epoch refreshes the ring when a node is running a newer config than the client has,
+// asking the node that answered first as it is known to have the config
+func (client *Client) check_epoch(address string, resp *http.Response) {
+	epoch, err := strconv.ParseUint(resp.Header.Get(http_db_server.EpochHeader), 10, 64)
+	if err == nil && epoch > client.Epoch() {
+		client.Refresh(epoch, address)
+	}
+}
+
+func response_error(resp *http.Response) error {
+	body := http_db_server.ErrorResponseBody{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Message == "" {
+		return fmt.Errorf("Request failed with status %d", resp.StatusCode)
+	}
+	return errors.New(body.Message)
+}
+
+// conflict remembers the current version of a key after a failed write, returning it as a ConflictError
+func (client *Client) conflict(key string, resp *http.Response) error {
+	body := http_db_server.ErrorResponseBody{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	client.remember(key, body.Context)
+	return &ConflictError{Value: body.Value, Context: body.Context}
+}
+
+func (client *Client) Get(key string) ([]byte, error) {
+	resp, err := client.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	//a missing key still has a context, when it has been deleted
+	client.remember(key, resp.Header.Get(http_db_server.ContextHeader))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	}
+	return nil, response_error(resp)
+}
+
+// Put writes the value, failing with a ConflictError if the key has changed since this client last saw it
+func (client *Client) Put(key string, value []byte) error {
+	resp, err := client.do(http.MethodPut, key, value, map[string]string{
+		http_db_server.ContextHeader: client.context(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		client.remember(key, resp.Header.Get(http_db_server.ContextHeader))
+		return nil
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return client.conflict(key, resp)
+	}
+	return response_error(resp)
+}
+
+// Delete removes the version this client last saw, or whatever is stored if it has not seen the key
+func (client *Client) Delete(key string) error {
+	resp, err := client.do(http.MethodDelete, key, nil, map[string]string{
+		http_db_server.ContextHeader: client.context(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		client.remember(key, resp.Header.Get(http_db_server.ContextHeader))
+		return nil
+	}
+	return response_error(resp)
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+	"github.com/stretchr/testify/assert"
+)
+
+// test_cluster serves one ring from a server per node, counting the requests each receives
+type test_cluster struct {
+	servers  []*httptest.Server
+	requests []int64
+	config   distributed_hash_ring.SharedConfig
+	//nodes still running the config of the previous epoch
+	behind []bool
+	lock   sync.Mutex
+}
+
+func new_test_cluster() *test_cluster {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 2, 1, 1, &hash_ring.ConflictResolutionFirstInstance{})
+
+	cluster := test_cluster{requests: make([]int64, len(nodes)), behind: make([]bool, len(nodes))}
+	cluster.config = distributed_hash_ring.SharedConfig{Epoch: 1, Replication_factor: 2}
+	for i := range nodes {
+		index := i
+		db := http_db_server.NewHttpDBServer(&http_db_server.Config{}, &hr)
+		db.SetRingConfig(func() *distributed_hash_ring.SharedConfig {
+			cluster.lock.Lock()
+			defer cluster.lock.Unlock()
+			config := cluster.config
+			if cluster.behind[index] {
+				config.Epoch--
+			}
+			return &config
+		})
+		handler := db.Handler()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&cluster.requests[index], 1)
+			handler.ServeHTTP(w, req)
+		}))
+		cluster.servers = append(cluster.servers, server)
+		cluster.config.Nodes = append(cluster.config.Nodes, distributed_hash_ring.Node{
+			Position:     nodes[i].GetPosition(),
+			Id:           uint64(i),
+			Physical_Id:  nodes[i].GetPhysicalId(),
+			Http_address: server.URL,
+		})
+	}
+	return &cluster
+}
+
+func (cluster *test_cluster) close() {
+	for _, server := range cluster.servers {
+		server.Close()
+	}
+}
+
+func (cluster *test_cluster) index_of(address string) int {
+	for i, server := range cluster.servers {
+		if server.URL == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestClientRoutesToReplicas(t *testing.T) {
+	cluster := new_test_cluster()
+	defer cluster.close()
+
+	client, err := New(cluster.servers[2].URL)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), client.Epoch())
+
+	replicas := client.Replicas("bar")
+	assert.Equal(t, 3, len(replicas))
+	primary := cluster.index_of(replicas[0])
+
+	before := atomic.LoadInt64(&cluster.requests[primary])
+	assert.Nil(t, client.Put("bar", []byte("mar")))
+	value, err := client.Get("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "mar", string(value))
+	assert.Equal(t, before+2, atomic.LoadInt64(&cluster.requests[primary]))
+
+	//retried on the next replica
+	cluster.servers[primary].Close()
+	value, err = client.Get("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "mar", string(value))
+
+	assert.Nil(t, client.Delete("bar"))
+	_, err = client.Get("bar")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClientTracksContexts(t *testing.T) {
+	cluster := new_test_cluster()
+	defer cluster.close()
+
+	first, _ := New(cluster.servers[0].URL)
+	second, _ := New(cluster.servers[1].URL)
+
+	assert.Nil(t, first.Put("bar", []byte("mar")))
+	//written with the context of the first write
+	assert.Nil(t, first.Put("bar", []byte("car")))
+
+	_, err := second.Get("bar")
+	assert.Nil(t, err)
+	assert.Nil(t, second.Put("bar", []byte("jar")))
+
+	err = first.Put("bar", []byte("tar"))
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "jar", string(conflict.Value))
+	//the conflict's context has been remembered, so the write can be retried
+	assert.Nil(t, first.Put("bar", []byte("tar")))
+	value, _ := second.Get("bar")
+	assert.Equal(t, "tar", string(value))
+}
+
+func TestClientRefreshesOnNewEpoch(t *testing.T) {
+	cluster := new_test_cluster()
+	defer cluster.close()
+
+	client, _ := New(cluster.servers[0].URL)
+	assert.Equal(t, uint64(1), client.Epoch())
+
+	cluster.lock.Lock()
+	cluster.config.Epoch = 2
+	cluster.lock.Unlock()
+
+	client.Get("bar")
+	assert.Equal(t, uint64(2), client.Epoch())
+
+	_, err := New("127.0.0.1:1")
+	assert.NotNil(t, err)
+}
+
+func TestClientRefreshSkipsNodesBehind(t *testing.T) {
+	cluster := new_test_cluster()
+	defer cluster.close()
+
+	client, _ := New(cluster.servers[0].URL)
+	assert.Equal(t, uint64(1), client.Epoch())
+
+	//known nodes are asked in order, so the nodes still on epoch 1 answer first
+	cluster.lock.Lock()
+	cluster.config.Epoch = 2
+	cluster.behind[0] = true
+	cluster.behind[1] = true
+	cluster.lock.Unlock()
+	assert.Nil(t, client.Refresh(2))
+	assert.Equal(t, uint64(2), client.Epoch())
+
+	assert.NotNil(t, client.Refresh(3))
+	assert.Equal(t, uint64(2), client.Epoch())
+}
+
+func TestClientRefreshesFromNodeAdvertisingEpoch(t *testing.T) {
+	cluster := new_test_cluster()
+	defer cluster.close()
+
+	client, _ := New(cluster.servers[0].URL)
+	cluster.lock.Lock()
+	cluster.config.Epoch = 2
+	for i := range cluster.behind {
+		cluster.behind[i] = true
+	}
+	//the first replica of the key is the only node on the new config
+	first := cluster.index_of(client.Replicas("bar")[0])
+	cluster.behind[first] = false
+	cluster.lock.Unlock()
+
+	before := make([]int64, len(cluster.servers))
+	for i := range before {
+		before[i] = atomic.LoadInt64(&cluster.requests[i])
+	}
+	client.Get("bar")
+	assert.Equal(t, uint64(2), client.Epoch())
+	//the get and the ring, without asking the nodes behind
+	assert.Equal(t, int64(2), atomic.LoadInt64(&cluster.requests[first])-before[first])
+	for i := range before {
+		if i != first {
+			assert.Equal(t, before[i], atomic.LoadInt64(&cluster.requests[i]))
+		}
+	}
+}
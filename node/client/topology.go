@@ -0,0 +1,151 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+)
+
+// topology is the client's copy of the ring, used to place keys exactly as the nodes do
+type topology struct {
+	epoch uint64
+	ring  *hash_ring.Hash_Ring
+	//http address of every physical node
+	addresses map[uint64]string
+}
+
+func new_topology(body *http_db_server.RingResponseBody) (*topology, error) {
+	if len(body.Nodes) == 0 {
+		return nil, errors.New("Ring has no nodes")
+	}
+
+	nodes := make([]hash_ring.Node, len(body.Nodes))
+	addresses := map[uint64]string{}
+	for i, node := range body.Nodes {
+		//the client only places keys, it never stores any
+		nodes[i] = hash_ring.NewNode(node.Position, &hash_ring.EmptyTable{}, &hash_ring.EmptyTable{}, node.Physical_id)
+		nodes[i].SetLocation(node.Zone, node.Rack)
+		if node.Http_address != "" {
+			addresses[node.Physical_id] = base_url(node.Http_address)
+		}
+	}
+
+	ring := hash_ring.New(nodes, body.Replication_factor, 1, 1, &hash_ring.ConflictResolutionFirstInstance{})
+	partitioner, err := hash_ring.Partitioner_By_Name(body.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+	ring.SetPartitioner(partitioner)
+
+	return &topology{epoch: body.Epoch, ring: &ring, addresses: addresses}, nil
+}
+
+// replicas gives the http addresses to try for a key, the primary replicas first.
+// The rest of the ring follows, as any node can coordinate a request
+func (t *topology) replicas(key string) []string {
+	addresses := []string{}
+	for _, node := range t.ring.PreferenceList(key) {
+		if address, ok := t.addresses[node.GetPhysicalId()]; ok {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+func base_url(address string) string {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		return strings.TrimSuffix(address, "/")
+	}
+	return "http://" + strings.TrimSuffix(address, "/")
+}
+
+func (client *Client) fetch_ring(address string) (*topology, error) {
+	req, err := client.new_request(http.MethodGet, address+"/v1/ring", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.http_client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching the ring from %s failed with status %d", address, resp.StatusCode)
+	}
+	body := http_db_server.RingResponseBody{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return new_topology(&body)
+}
+
+// Refresh fetches the ring from nodes in turn until one is running at least the epoch, trying the given
+// addresses first, such as the node that advertised the epoch, then the known nodes and then the seeds
+func (client *Client) Refresh(epoch uint64, first ...string) error {
+	client.lock.RLock()
+	addresses := append([]string{}, first...)
+	if client.topology != nil {
+		ids := []uint64{}
+		for id := range client.topology.addresses {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			addresses = append(addresses, client.topology.addresses[id])
+		}
+	}
+	client.lock.RUnlock()
+	addresses = append(addresses, client.seeds...)
+
+	tried := map[string]bool{}
+	errs := []string{}
+	for _, address := range addresses {
+		if tried[address] {
+			continue
+		}
+		tried[address] = true
+		fetched, err := client.fetch_ring(address)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		client.lock.Lock()
+		//a node still running an older config must not roll the client back
+		if client.topology == nil || fetched.epoch >= client.topology.epoch {
+			client.topology = fetched
+		}
+		client.lock.Unlock()
+		if fetched.epoch >= epoch {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s is running epoch %d", address, fetched.epoch))
+	}
+	return fmt.Errorf("Failed to fetch the ring of epoch %d: %s", epoch, strings.Join(errs, ", "))
+}
+
+// Epoch is the epoch of the ring the client is routing with
+func (client *Client) Epoch() uint64 {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+	if client.topology == nil {
+		return 0
+	}
+	return client.topology.epoch
+}
+
+// Replicas gives the http addresses requests for the key are sent to, in the order they are tried
+func (client *Client) Replicas(key string) []string {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+	if client.topology == nil {
+		return nil
+	}
+	return client.topology.replicas(key)
+}
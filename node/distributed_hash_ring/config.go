@@ -12,6 +12,11 @@ type Node struct {
 	Address     string
 	Id          uint64
 	Physical_Id uint64
+	//location of the physical node, replicas of a key are spread across distinct zones then racks
+	Zone string
+	Rack string
+	//address clients reach the node's http api at, handed to clients so they can send requests straight to replicas
+	Http_address string `json:",omitempty"`
 }
 
 type SharedConfig struct {
@@ -19,6 +24,14 @@ type SharedConfig struct {
 	Replication_factor int
 	Minimum_writes     int
 	Minimum_read       int
+	//increases every time the cluster manager pushes a new config, older configs are ignored
+	Epoch uint64
+	//number of replicas reads are limited to while a raised replication factor is back filled, 0 means all replicas
+	Read_replication_factor int
+	//places keys on the ring, every node must use the same one, empty is the default FNV partitioner
+	Partitioner string
+	//namespaces of keys with their own quorums, conflict resolution and default ttl
+	Buckets []hash_ring.Bucket `json:",omitempty"`
 }
 
 type InstanceConfig struct {
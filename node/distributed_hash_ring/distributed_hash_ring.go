@@ -1,31 +1,118 @@
 package distributed_hash_ring
 
-import "github.com/lucifer1662/distrokdb/node/hash_ring"
+import (
+	"fmt"
+	"log/slog"
 
-func New(config *InstanceConfig) hash_ring.Hash_Ring {
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+// New makes the ring of the config, logging to logger
+func New(config *InstanceConfig, logger *slog.Logger) *hash_ring.Hash_Ring {
 	nodes := make([]hash_ring.Node, len(config.Nodes))
 
 	//share all temporary data
 	in_memory_temp_table := hash_ring.NewInMemoryTable()
+	//every permanent write stored on this node, for change data capture
+	change_log := hash_ring.NewChangeLog(hash_ring.Default_change_log_capacity)
+
+	//every virtual node of this physical node is stored locally
+	my_physical_id := config.My_id
+	for i := range config.Nodes {
+		if config.Nodes[i].Id == config.My_id {
+			my_physical_id = config.Nodes[i].Physical_Id
+		}
+	}
 
 	for i := range nodes {
 		node := &config.Nodes[i]
-		is_me := node.Id == config.My_id
+		is_me := node.Physical_Id == my_physical_id
 		var permTable hash_ring.KeyValueTable
 		var temporaryTable hash_ring.KeyValueTable
 
 		if is_me {
 			mem_table1 := hash_ring.NewInMemoryTable()
-			permTable = &LocalTable{&mem_table1}
+			permTable = &LocalTable{&mem_table1, change_log}
 			temporaryTable = &in_memory_temp_table
 		} else {
-			permTable = &DistributedTable{node.Address, node.Position}
+			permTable = &DistributedTable{node.Address, node.Position, "", ""}
 			//temporary Table should never be directly accessed from distributed source
 			temporaryTable = &hash_ring.EmptyTable{}
 		}
 
 		nodes[i] = hash_ring.NewNode(node.Position, permTable, temporaryTable, node.Physical_Id)
+		nodes[i].SetLocation(node.Zone, node.Rack)
+	}
+
+	hr := hash_ring.New(nodes, config.Replication_factor, config.Minimum_writes, config.Minimum_read, &hash_ring.ConflictResolutionFirstInstance{})
+	//writes coordinated by any virtual node of this node share a vector clock entry
+	hr.SetId(my_physical_id)
+	hr.SetChangeLog(change_log)
+	hr.SetLogger(logger)
+	partitioner, err := hash_ring.Partitioner_By_Name(config.Partitioner)
+	if err != nil {
+		logger.Warn("Using default partitioner", "error", err.Error())
+	} else {
+		hr.SetPartitioner(partitioner)
+	}
+
+	if err := hr.SetBuckets(config.Buckets); err != nil {
+		logger.Warn("Ignoring buckets", "error", err.Error())
+	}
+
+	if config.Read_replication_factor != 0 {
+		err := hr.SetQuorum(config.Replication_factor, config.Minimum_writes, config.Minimum_read, config.Read_replication_factor)
+		if err != nil {
+			logger.Warn("Ignoring read replication factor", "error", err.Error())
+		}
+	}
+	return &hr
+}
+
+// CheckPartitioner makes sure the configured partitioner exists and matches every reachable peer,
+// a node placing keys differently to its peers would read and write the wrong replicas
+func CheckPartitioner(config *InstanceConfig) error {
+	partitioner, err := hash_ring.Partitioner_By_Name(config.Partitioner)
+	if err != nil {
+		return err
 	}
 
-	return hash_ring.New(nodes, config.Replication_factor, config.Minimum_writes, config.Minimum_read, &hash_ring.ConflictResolutionFirstInstance{})
+	my_physical_id := config.My_id
+	for i := range config.Nodes {
+		if config.Nodes[i].Id == config.My_id {
+			my_physical_id = config.Nodes[i].Physical_Id
+		}
+	}
+
+	physical_nodes_visited := make(map[uint64]bool)
+	for i := range config.Nodes {
+		node := &config.Nodes[i]
+		if node.Physical_Id == my_physical_id || physical_nodes_visited[node.Physical_Id] {
+			continue
+		}
+		physical_nodes_visited[node.Physical_Id] = true
+
+		info, err := GetInfo(node.Address)
+		if err != nil {
+			//peers that are down are checked when they start
+			continue
+		}
+		if info.Partitioner != partitioner.Name() {
+			return fmt.Errorf("Partitioner \"%s\" does not match \"%s\" used by %s", partitioner.Name(), info.Partitioner, node.Address)
+		}
+	}
+	return nil
+}
+
+// Backfill replicates the values held in this node's permanent tables to all of their primary replicas,
+// returning the number of keys that could not be fully replicated
+func Backfill(hr *hash_ring.Hash_Ring) int {
+	failed := 0
+	nodes := hr.Nodes()
+	for i := range nodes {
+		if local_table, is_local := nodes[i].GetTable().(*LocalTable); is_local {
+			failed += hash_ring.Replicate_permanent(hr, local_table)
+		}
+	}
+	return failed
 }
@@ -1,55 +1,159 @@
 package distributed_hash_ring
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"net/rpc"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/lucifer1662/distrokdb/node/metrics"
+	"github.com/lucifer1662/distrokdb/node/tracing"
 )
 
+var rpc_errors = metrics.Default.NewCounter("kdb_rpc_errors_total", "Failed requests to peers, including peers that couldn't be reached", "peer", "method")
+
+// count_rpc_error counts a failed request to a peer, returning the error
+func count_rpc_error(address string, method string, err error) error {
+	if err != nil {
+		rpc_errors.Inc(address, method)
+	}
+	return err
+}
+
 type DistributedTable struct {
 	server_address string
 	position       hash_ring.KeyHash
+	//sent with every request so the peer continues the trace, empty when untraced
+	trace_parent string
+	//sent with every request so the peer's log lines carry it, empty outside of requests
+	request_id string
+}
+
+// WithContext is a copy of the table continuing the trace and request of the context on the peer
+func (t *DistributedTable) WithContext(ctx context.Context) hash_ring.KeyValueTable {
+	return &DistributedTable{t.server_address, t.position, tracing.Traceparent(ctx), logging.RequestId(ctx)}
 }
 
-func (t *DistributedTable) Add(key string, value string, meta *hash_ring.ValueMeta) error {
+func (t *DistributedTable) Add(key string, value []byte, meta *hash_ring.ValueMeta) error {
 	client, err := rpc.Dial("tcp", t.server_address)
 	if err != nil {
-		return err
+		return count_rpc_error(t.server_address, "Add", err)
 	}
 
 	// Synchronous call
-	args := &AddRequest{key, value, *meta, t.position}
+	args := &AddRequest{key, value, *meta, t.position, t.trace_parent, t.request_id}
 	var reply AddResponse
 
 	//blocks for response
 	err = client.Call("DistributedHashRingServer.Add", args, &reply)
 	if err != nil {
-		return err
+		return count_rpc_error(t.server_address, "Add", err)
 	}
 	return nil
 }
 
-func (t *DistributedTable) Get(key string) (*string, *hash_ring.ValueMeta, error) {
+func (t *DistributedTable) Get(key string) ([]byte, *hash_ring.ValueMeta, error) {
 	client, err := rpc.Dial("tcp", t.server_address)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, count_rpc_error(t.server_address, "Get", err)
 	}
 
 	// Synchronous call
-	args := &GetRequest{key, t.position}
+	args := &GetRequest{key, t.position, t.trace_parent, t.request_id}
 	var reply GetResponse
 
 	//blocks for response
 	err = client.Call("DistributedHashRingServer.Get", args, &reply)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, count_rpc_error(t.server_address, "Get", err)
+	}
+	//gob sends empty and nil slices alike, so presence travels separately
+	if reply.Found && reply.Value == nil {
+		reply.Value = []byte{}
 	}
 	return reply.Value, &reply.Meta, nil
 }
 
+func (t *DistributedTable) MultiAdd(keys []string, values [][]byte, metas []*hash_ring.ValueMeta) error {
+	client, err := rpc.Dial("tcp", t.server_address)
+	if err != nil {
+		return count_rpc_error(t.server_address, "MultiAdd", err)
+	}
+	defer client.Close()
+
+	args := &MultiAddRequest{keys, values, make([]hash_ring.ValueMeta, len(metas)), t.position, t.trace_parent, t.request_id}
+	for i := range metas {
+		args.Metas[i] = *metas[i]
+	}
+	var reply AddResponse
+
+	return count_rpc_error(t.server_address, "MultiAdd", client.Call("DistributedHashRingServer.MultiAdd", args, &reply))
+}
+
+func (t *DistributedTable) MultiGet(keys []string) ([][]byte, []*hash_ring.ValueMeta, error) {
+	client, err := rpc.Dial("tcp", t.server_address)
+	if err != nil {
+		return nil, nil, count_rpc_error(t.server_address, "MultiGet", err)
+	}
+	defer client.Close()
+
+	args := &MultiGetRequest{keys, t.position, t.trace_parent, t.request_id}
+	var reply MultiGetResponse
+
+	err = client.Call("DistributedHashRingServer.MultiGet", args, &reply)
+	if err != nil {
+		return nil, nil, count_rpc_error(t.server_address, "MultiGet", err)
+	}
+
+	values := make([][]byte, len(keys))
+	metas := make([]*hash_ring.ValueMeta, len(keys))
+	for i := range keys {
+		if reply.Found[i] {
+			values[i] = reply.Values[i]
+			//gob sends empty and nil slices alike
+			if values[i] == nil {
+				values[i] = []byte{}
+			}
+		}
+		metas[i] = &reply.Metas[i]
+	}
+	return values, metas, nil
+}
+
+func (t *DistributedTable) Scan(prefix string, start string, limit int) ([]string, [][]byte, []*hash_ring.ValueMeta, error) {
+	client, err := rpc.Dial("tcp", t.server_address)
+	if err != nil {
+		return nil, nil, nil, count_rpc_error(t.server_address, "Scan", err)
+	}
+	defer client.Close()
+
+	args := &ScanRequest{prefix, start, limit, t.position, t.trace_parent, t.request_id}
+	var reply ScanResponse
+
+	err = client.Call("DistributedHashRingServer.Scan", args, &reply)
+	if err != nil {
+		return nil, nil, nil, count_rpc_error(t.server_address, "Scan", err)
+	}
+
+	values := make([][]byte, len(reply.Keys))
+	metas := make([]*hash_ring.ValueMeta, len(reply.Keys))
+	for i := range reply.Keys {
+		//scanned keys are always present, gob sends empty values as nil
+		values[i] = reply.Values[i]
+		if values[i] == nil {
+			values[i] = []byte{}
+		}
+		metas[i] = &reply.Metas[i]
+	}
+	return reply.Keys, values, metas, nil
+}
+
 func (t *DistributedTable) Remove(key string) error {
 	return nil
 
@@ -72,20 +176,77 @@ type DistributedHashRingServer struct {
 	rpc_server *rpc.Server
 	listener   *net.Listener
 	port       int
+	//slots of the requests being served, nil is unlimited
+	in_flight chan struct{}
+	logger    *slog.Logger
 }
 
 func NewServer(hr *hash_ring.Hash_Ring, port int) *DistributedHashRingServer {
 	rpc_server := rpc.NewServer()
-	s := DistributedHashRingServer{hr, rpc_server, nil, port}
+	s := DistributedHashRingServer{hr, rpc_server, nil, port, nil, slog.Default()}
 	rpc_server.Register(&s)
 	return &s
 }
 
+func (t *DistributedHashRingServer) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// start_request gives the context of a request from a peer, carrying the id of the client's request, and starts its span
+// continuing the peer's trace. Requests the peer didn't trace, such as hinted handoff and back fills, aren't traced here either
+func (t *DistributedHashRingServer) start_request(method string, trace_parent string, request_id string, node_position hash_ring.KeyHash) (context.Context, *tracing.Span) {
+	ctx := logging.WithRequestId(context.Background(), request_id)
+	if trace_parent == "" {
+		return ctx, nil
+	}
+	_, span := tracing.Start(tracing.ContextWithRemote(ctx, trace_parent), "DistributedHashRingServer."+method, tracing.Kind_server)
+	span.SetAttribute("kdb.node.position", strconv.FormatUint(node_position, 10))
+	return ctx, span
+}
+
+func (t *DistributedHashRingServer) log_request(ctx context.Context, method string, node_position hash_ring.KeyHash, err error) {
+	if err != nil {
+		t.logger.WarnContext(ctx, "Peer request failed", "method", method, "node", node_position, "error", err.Error())
+	} else {
+		t.logger.DebugContext(ctx, "Served peer request", "method", method, "node", node_position)
+	}
+}
+
+var ErrOverloaded = errors.New("Node is serving too many requests")
+
+// SetMaxConcurrentRequests rejects reads and writes from peers with ErrOverloaded while limit of them are being served,
+// the peer treats this node as down for the request, writing a hint elsewhere instead. 0 is unlimited,
+// call it before Start
+func (t *DistributedHashRingServer) SetMaxConcurrentRequests(limit int) {
+	if limit > 0 {
+		t.in_flight = make(chan struct{}, limit)
+	} else {
+		t.in_flight = nil
+	}
+}
+
+// admit takes a slot for a request, failing straight away rather than queueing behind a backlog
+func (t *DistributedHashRingServer) admit() (func(), error) {
+	if t.in_flight == nil {
+		return func() {}, nil
+	}
+	select {
+	case t.in_flight <- struct{}{}:
+		return func() { <-t.in_flight }, nil
+	default:
+		return nil, ErrOverloaded
+	}
+}
+
 type AddRequest struct {
 	Key           string
-	Value         string
+	Value         []byte
 	Meta          hash_ring.ValueMeta
 	Node_position hash_ring.KeyHash
+	//traceparent of the coordinator's span for this replica, empty when untraced
+	Trace_parent string
+	//id of the client request the write is part of, empty for background writes
+	Request_id string
 }
 
 type AddResponse struct {
@@ -94,8 +255,15 @@ type AddResponse struct {
 }
 
 func (t *DistributedHashRingServer) Add(request AddRequest, response *AddResponse) error {
-	var err error
+	release, err := t.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, span := t.start_request("Add", request.Trace_parent, request.Request_id, request.Node_position)
+	defer span.End()
 	err = t.hash_ring.AddToNodePermanent(request.Node_position, request.Key, request.Value, &request.Meta)
+	t.log_request(ctx, "Add", request.Node_position, err)
 
 	response.Success = err == nil
 	if !response.Success {
@@ -107,17 +275,28 @@ func (t *DistributedHashRingServer) Add(request AddRequest, response *AddRespons
 type GetRequest struct {
 	Key           string
 	Node_position hash_ring.KeyHash
+	Trace_parent  string
+	Request_id    string
 }
 
 type GetResponse struct {
 	Success       bool
-	Value         *string
+	Found         bool
+	Value         []byte
 	Meta          hash_ring.ValueMeta
 	Error_message string
 }
 
 func (t *DistributedHashRingServer) Get(request GetRequest, response *GetResponse) error {
+	release, err := t.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, span := t.start_request("Get", request.Trace_parent, request.Request_id, request.Node_position)
+	defer span.End()
 	value, meta, err := t.hash_ring.GetFromNodePermanent(request.Node_position, request.Key)
+	t.log_request(ctx, "Get", request.Node_position, err)
 
 	response.Success = err == nil
 	if !response.Success {
@@ -125,14 +304,240 @@ func (t *DistributedHashRingServer) Get(request GetRequest, response *GetRespons
 	}
 	response.Meta = *meta
 	response.Value = value
+	response.Found = value != nil
 	return err
 }
 
+// MultiAddRequest writes many keys to one virtual node
+type MultiAddRequest struct {
+	Keys          []string
+	Values        [][]byte
+	Metas         []hash_ring.ValueMeta
+	Node_position hash_ring.KeyHash
+	Trace_parent  string
+	Request_id    string
+}
+
+func (t *DistributedHashRingServer) MultiAdd(request MultiAddRequest, response *AddResponse) error {
+	release, err := t.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, span := t.start_request("MultiAdd", request.Trace_parent, request.Request_id, request.Node_position)
+	defer span.End()
+	metas := make([]*hash_ring.ValueMeta, len(request.Metas))
+	for i := range request.Metas {
+		metas[i] = &request.Metas[i]
+	}
+	err = t.hash_ring.MultiAddToNodePermanent(request.Node_position, request.Keys, request.Values, metas)
+	t.log_request(ctx, "MultiAdd", request.Node_position, err)
+
+	response.Success = err == nil
+	if !response.Success {
+		response.Error_message = err.Error()
+	}
+	return err
+}
+
+type MultiGetRequest struct {
+	Keys          []string
+	Node_position hash_ring.KeyHash
+	Trace_parent  string
+	Request_id    string
+}
+
+type MultiGetResponse struct {
+	Found         []bool
+	Values        [][]byte
+	Metas         []hash_ring.ValueMeta
+	Error_message string
+}
+
+func (t *DistributedHashRingServer) MultiGet(request MultiGetRequest, response *MultiGetResponse) error {
+	release, err := t.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, span := t.start_request("MultiGet", request.Trace_parent, request.Request_id, request.Node_position)
+	defer span.End()
+	values, metas, err := t.hash_ring.MultiGetFromNodePermanent(request.Node_position, request.Keys)
+	t.log_request(ctx, "MultiGet", request.Node_position, err)
+	if err != nil {
+		response.Error_message = err.Error()
+		return err
+	}
+
+	response.Found = make([]bool, len(values))
+	response.Metas = make([]hash_ring.ValueMeta, len(metas))
+	for i := range values {
+		response.Found[i] = values[i] != nil
+		response.Metas[i] = *metas[i]
+	}
+	response.Values = values
+	return nil
+}
+
+type ScanRequest struct {
+	Prefix        string
+	Start         string
+	Limit         int
+	Node_position hash_ring.KeyHash
+	Trace_parent  string
+	Request_id    string
+}
+
+type ScanResponse struct {
+	Keys          []string
+	Values        [][]byte
+	Metas         []hash_ring.ValueMeta
+	Error_message string
+}
+
+func (t *DistributedHashRingServer) Scan(request ScanRequest, response *ScanResponse) error {
+	release, err := t.admit()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, span := t.start_request("Scan", request.Trace_parent, request.Request_id, request.Node_position)
+	defer span.End()
+	keys, values, metas, err := t.hash_ring.ScanFromNodePermanent(request.Node_position, request.Prefix, request.Start, request.Limit)
+	t.log_request(ctx, "Scan", request.Node_position, err)
+	if err != nil {
+		response.Error_message = err.Error()
+		return err
+	}
+
+	response.Keys = keys
+	response.Values = values
+	response.Metas = make([]hash_ring.ValueMeta, len(metas))
+	for i := range metas {
+		response.Metas[i] = *metas[i]
+	}
+	return nil
+}
+
+type InfoRequest struct{}
+
+type InfoResponse struct {
+	Partitioner string
+}
+
+func (t *DistributedHashRingServer) Info(request InfoRequest, response *InfoResponse) error {
+	response.Partitioner = t.hash_ring.Partitioner().Name()
+	return nil
+}
+
+func GetInfo(server_address string) (*InfoResponse, error) {
+	client, err := rpc.Dial("tcp", server_address)
+	if err != nil {
+		return nil, count_rpc_error(server_address, "Info", err)
+	}
+	defer client.Close()
+
+	var reply InfoResponse
+	err = client.Call("DistributedHashRingServer.Info", &InfoRequest{}, &reply)
+	if err != nil {
+		return nil, count_rpc_error(server_address, "Info", err)
+	}
+	return &reply, nil
+}
+
+// ChangesRequest asks for changes from a sequence number, waiting up to Wait_ms for one to be written
+type ChangesRequest struct {
+	From    uint64
+	Limit   int
+	Wait_ms int
+}
+
+type ChangesResponse struct {
+	Changes []hash_ring.Change
+	//sequence number to continue from
+	Next uint64
+	//changes on a node that restarted continue from 1 in a log with a new id
+	Log_id        string
+	Error_message string
+}
+
+// Changes is a long poll over the change log, calling it repeatedly from Next streams the changes
+func (t *DistributedHashRingServer) Changes(request ChangesRequest, response *ChangesResponse) error {
+	change_log := t.hash_ring.ChangeLog()
+	if change_log == nil {
+		return errors.New("Changes are not recorded")
+	}
+
+	select {
+	case <-change_log.Appended(request.From):
+	case <-time.After(time.Duration(request.Wait_ms) * time.Millisecond):
+	}
+
+	response.Log_id = change_log.Id()
+	changes, err := change_log.Read(request.From, request.Limit)
+	if err != nil {
+		response.Error_message = err.Error()
+		return err
+	}
+	response.Changes = changes
+	response.Next = request.From
+	if len(changes) > 0 {
+		response.Next = changes[len(changes)-1].Sequence + 1
+	}
+	return nil
+}
+
+func GetChanges(server_address string, from uint64, limit int, wait time.Duration) (*ChangesResponse, error) {
+	client, err := rpc.Dial("tcp", server_address)
+	if err != nil {
+		return nil, count_rpc_error(server_address, "Changes", err)
+	}
+	defer client.Close()
+
+	var reply ChangesResponse
+	err = client.Call("DistributedHashRingServer.Changes", &ChangesRequest{from, limit, int(wait / time.Millisecond)}, &reply)
+	if err != nil {
+		return nil, count_rpc_error(server_address, "Changes", err)
+	}
+	return &reply, nil
+}
+
+// StreamChanges sends the changes of a node from a sequence number onwards until stop is closed,
+// reconnecting when the node can't be reached. It only returns early if changes have been dropped
+// from the node's change log, the consumer must then resync
+func StreamChanges(server_address string, from uint64, changes chan<- hash_ring.Change, stop <-chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		reply, err := GetChanges(server_address, from, 1000, 10*time.Second)
+		if err != nil {
+			if err.Error() == hash_ring.ErrChangesTruncated.Error() {
+				return hash_ring.ErrChangesTruncated
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		for i := range reply.Changes {
+			select {
+			case changes <- reply.Changes[i]:
+			case <-stop:
+				return nil
+			}
+		}
+		from = reply.Next
+	}
+}
+
 func (server *DistributedHashRingServer) Start() {
 	listener, e := net.Listen("tcp", ":"+strconv.Itoa(server.port))
 	server.listener = &listener
 	if e != nil {
-		log.Fatal("listen error:", e)
+		server.logger.Error("Failed to listen for peers", "port", server.port, "error", e.Error())
+		os.Exit(1)
 	}
 	go server.rpc_server.Accept(*server.listener)
 }
@@ -1,6 +1,7 @@
 package distributed_hash_ring
 
 import (
+	"log/slog"
 	"testing"
 
 	"github.com/lucifer1662/distrokdb/node/hash_ring"
@@ -11,18 +12,18 @@ import (
 func TestDistributedTableAdd(t *testing.T) {
 	nodes1 := hash_ring.Generate_Nodes(2)
 	hr1 := hash_ring.New(nodes1, 1, 1, 1, &hash_ring.ConflictResolutionFirstInstance{})
-	nodes1[0].SetTable(&DistributedTable{"localhost:1234", nodes1[0].GetPosition()})
+	nodes1[0].SetTable(&DistributedTable{"localhost:1234", nodes1[0].GetPosition(), "", ""})
 	nodes1[0].SetTemporaryTable(&hash_ring.EmptyTable{})
 	table1 := hash_ring.NewInMemoryTable()
-	nodes1[1].SetTable(&LocalTable{&table1})
+	nodes1[1].SetTable(&LocalTable{table: &table1})
 	nodes1[1].SetTemporaryTable(&hash_ring.EmptyTable{})
 
 	nodes2 := hash_ring.Generate_Nodes(2)
 	hr2 := hash_ring.New(nodes2, 1, 1, 1, &hash_ring.ConflictResolutionFirstInstance{})
 	table2 := hash_ring.NewInMemoryTable()
-	nodes2[0].SetTable(&LocalTable{&table2})
+	nodes2[0].SetTable(&LocalTable{table: &table2})
 	nodes2[0].SetTemporaryTable(&hash_ring.EmptyTable{})
-	nodes2[1].SetTable(&DistributedTable{"localhost:1235", nodes2[1].GetPosition()})
+	nodes2[1].SetTable(&DistributedTable{"localhost:1235", nodes2[1].GetPosition(), "", ""})
 	nodes2[1].SetTemporaryTable(&hash_ring.EmptyTable{})
 
 	server1 := NewServer(&hr1, 1235)
@@ -37,22 +38,22 @@ func TestDistributedTableAdd(t *testing.T) {
 
 	value_meta := hash_ring.NewValueMeta(hash_ring.NewVectorClock())
 
-	hr1.Add("bar", "bar", value_meta)
+	hr1.Add("bar", []byte("bar"), value_meta)
 	val, _, err := hr1.Get("bar")
-	assert.Equal(t, "bar", *val)
+	assert.Equal(t, "bar", string(val))
 	assert.Equal(t, nil, err)
 
 	val, _, err = hr2.Get("bar")
-	assert.Equal(t, "bar", *val)
+	assert.Equal(t, "bar", string(val))
 	assert.Equal(t, nil, err)
 
-	hr2.Add("foo", "foo", value_meta)
+	hr2.Add("foo", []byte("foo"), value_meta)
 	val, _, err = hr2.Get("foo")
-	assert.Equal(t, "foo", *val)
+	assert.Equal(t, "foo", string(val))
 	assert.Equal(t, nil, err)
 
 	val, _, err = hr1.Get("foo")
-	assert.Equal(t, "foo", *val)
+	assert.Equal(t, "foo", string(val))
 	assert.Equal(t, nil, err)
 }
 
@@ -82,11 +83,11 @@ func TestDistributedTableAddWithConfig(t *testing.T) {
 	node1_config := InstanceConfig{&shared_config, 0, 1234}
 	node2_config := InstanceConfig{&shared_config, 1, 1235}
 
-	hr1 := New(&node1_config)
-	hr2 := New(&node2_config)
+	hr1 := New(&node1_config, slog.Default())
+	hr2 := New(&node2_config, slog.Default())
 
-	server1 := NewServer(&hr1, 1234)
-	server2 := NewServer(&hr2, 1235)
+	server1 := NewServer(hr1, 1234)
+	server2 := NewServer(hr2, 1235)
 
 	server1.Start()
 	server2.Start()
@@ -97,21 +98,21 @@ func TestDistributedTableAddWithConfig(t *testing.T) {
 
 	value_meta := hash_ring.NewValueMeta(hash_ring.NewVectorClock())
 
-	hr1.Add("bar", "bar", value_meta)
+	hr1.Add("bar", []byte("bar"), value_meta)
 	val, _, err := hr1.Get("bar")
-	assert.Equal(t, "bar", *val)
+	assert.Equal(t, "bar", string(val))
 	assert.Equal(t, nil, err)
 
 	val, _, err = hr2.Get("bar")
-	assert.Equal(t, "bar", *val)
+	assert.Equal(t, "bar", string(val))
 	assert.Equal(t, nil, err)
 
-	hr2.Add("foo", "foo", value_meta)
+	hr2.Add("foo", []byte("foo"), value_meta)
 	val, _, err = hr2.Get("foo")
-	assert.Equal(t, "foo", *val)
+	assert.Equal(t, "foo", string(val))
 	assert.Equal(t, nil, err)
 
 	val, _, err = hr1.Get("foo")
-	assert.Equal(t, "foo", *val)
+	assert.Equal(t, "foo", string(val))
 	assert.Equal(t, nil, err)
 }
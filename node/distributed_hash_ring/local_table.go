@@ -1,16 +1,25 @@
 package distributed_hash_ring
 
-import "github.com/lucifer1662/distrokdb/node/hash_ring"
+import (
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
 
 type LocalTable struct {
-	table hash_ring.KeyValueTable
+	table      hash_ring.KeyValueTable
+	change_log *hash_ring.ChangeLog
 }
 
-func (t *LocalTable) Add(key string, value string, meta *hash_ring.ValueMeta) error {
-	return t.table.Add(key, value, meta)
+func (t *LocalTable) Add(key string, value []byte, meta *hash_ring.ValueMeta) error {
+	err := t.table.Add(key, value, meta)
+	if err == nil && t.change_log != nil {
+		t.change_log.Append(key, value, meta)
+	}
+	return err
 }
 
-func (t *LocalTable) Get(key string) (*string, *hash_ring.ValueMeta, error) {
+func (t *LocalTable) Get(key string) ([]byte, *hash_ring.ValueMeta, error) {
 	return t.table.Get(key)
 }
 
@@ -22,6 +31,18 @@ func (t *LocalTable) Iter() hash_ring.KeyValueIterator {
 	return t.table.Iter()
 }
 
+func (t *LocalTable) IsLocal() bool {
+	return true
+}
+
+func (t *LocalTable) Sweep(expired_before time.Time) int {
+	sweepable, is_sweepable := t.table.(hash_ring.SweepableKeyValueTable)
+	if !is_sweepable {
+		return 0
+	}
+	return sweepable.Sweep(expired_before)
+}
+
 func (t *LocalTable) Erase(key string) {
 	t.table.Erase(key)
 }
@@ -0,0 +1,202 @@
+package hash_ring
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchKeyValueTable is implemented by tables that can serve many keys in one round trip,
+// other tables are called once per key
+type BatchKeyValueTable interface {
+	MultiAdd(keys []string, values [][]byte, metas []*ValueMeta) error
+	MultiGet(keys []string) ([][]byte, []*ValueMeta, error)
+}
+
+func multi_add(table KeyValueTable, keys []string, values [][]byte, metas []*ValueMeta) error {
+	if batch_table, is_batch := table.(BatchKeyValueTable); is_batch {
+		return batch_table.MultiAdd(keys, values, metas)
+	}
+	for i := range keys {
+		if err := table.Add(keys[i], values[i], metas[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func multi_get(table KeyValueTable, keys []string) ([][]byte, []*ValueMeta, error) {
+	if batch_table, is_batch := table.(BatchKeyValueTable); is_batch {
+		return batch_table.MultiGet(keys)
+	}
+	values := make([][]byte, len(keys))
+	metas := make([]*ValueMeta, len(keys))
+	for i := range keys {
+		value, meta, err := table.Get(keys[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = value
+		metas[i] = meta
+	}
+	return values, metas, nil
+}
+
+type MultiGetResult struct {
+	Value []byte
+	Meta  *ValueMeta
+	Err   error
+}
+
+// key_group is the keys of a batch sharing a preference list, with their index in the batch
+type key_group struct {
+	key_hash KeyHash
+	//first key of the group, every key of a group is in the same bucket
+	key     string
+	indexes []int
+}
+
+// group_by_replicas groups keys of a bucket that are stored on the same primary nodes,
+// so each group costs one request per replica
+func (ring *Hash_Ring) group_by_replicas(keys []string) []*key_group {
+	groups := []*key_group{}
+	group_of := make(map[string]*key_group)
+	for i := range keys {
+		key_hash := ring.KeyHash(keys[i])
+		bucket, _ := Split_Bucket_Key(keys[i])
+		replicas := bucket + bucket_marker + fmt.Sprint(ring.primary_nodes_for(key_hash, ring.replication_factor_of(keys[i])))
+		group, exists := group_of[replicas]
+		if !exists {
+			group = &key_group{key_hash: key_hash, key: keys[i]}
+			group_of[replicas] = group
+			groups = append(groups, group)
+		}
+		group.indexes = append(group.indexes, i)
+	}
+	return groups
+}
+
+// MultiAdd writes many keys, sending one request to each replica of every group of keys sharing primary nodes.
+// A replica failing any key of a group counts as failing the group, and hinted handoff for a group
+// uses the fallback nodes of its first key, the hinted copies are moved to the right primaries on cleanup.
+// The error of each key is returned in the order of the keys
+func (ring *Hash_Ring) MultiAdd(keys []string, values [][]byte, metas []*ValueMeta) []error {
+	return ring.MultiAddAt(keys, values, metas, Consistency_default)
+}
+
+// MultiAddAt is MultiAdd waiting for the replicas given by the consistency level
+func (ring *Hash_Ring) MultiAddAt(keys []string, values [][]byte, metas []*ValueMeta, level Consistency) []error {
+	return ring.MultiAddAtContext(context.Background(), keys, values, metas, level)
+}
+
+// MultiAddAtContext is MultiAddAt tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) MultiAddAtContext(ctx context.Context, keys []string, values [][]byte, metas []*ValueMeta, level Consistency) []error {
+	errs := make([]error, len(keys))
+	new_metas := make([]*ValueMeta, len(keys))
+	for i := range metas {
+		new_metas[i] = ring.written_meta(keys[i], metas[i])
+		ring.record_access(keys[i])
+	}
+
+	wait_group := sync.WaitGroup{}
+	for _, group := range ring.group_by_replicas(keys) {
+		wait_group.Add(1)
+		go func(group *key_group) {
+			defer wait_group.Done()
+			group_keys := make([]string, len(group.indexes))
+			group_values := make([][]byte, len(group.indexes))
+			group_metas := make([]*ValueMeta, len(group.indexes))
+			for i, index := range group.indexes {
+				group_keys[i] = keys[index]
+				group_values[i] = values[index]
+				group_metas[i] = new_metas[index]
+			}
+
+			ctx, query := ring.start_query(ctx, "multi_add", group.key_hash)
+			replication_factor, minimum_writes := ring.write_quorum_at(group.key, level)
+			err := ring.consensus(ctx, "multi_add", group.key_hash, replication_factor, replication_factor, minimum_writes, false, func(node *Node, result_chan chan bool, hinted bool) {
+				err := node.MultiAdd(group_keys, group_values, group_metas, !hinted)
+				if err == nil && hinted {
+					hinted_writes.Add(float64(len(group_keys)))
+				}
+				result_chan <- (err == nil)
+			})
+			record_quorum("multi_add", err)
+			ring.finish_query(ctx, query, err, false)
+			for _, index := range group.indexes {
+				errs[index] = err
+				if err == nil {
+					ring.watchers.Notify(keys[index], values[index], new_metas[index])
+				}
+			}
+		}(group)
+	}
+	wait_group.Wait()
+	return errs
+}
+
+// MultiGet reads many keys, sending one request to each replica of every group of keys sharing primary nodes.
+// Each key is then resolved as in Get, missing and deleted keys have a nil value
+func (ring *Hash_Ring) MultiGet(keys []string) []MultiGetResult {
+	return ring.MultiGetAt(keys, Consistency_default)
+}
+
+// MultiGetAt is MultiGet waiting for the replicas given by the consistency level
+func (ring *Hash_Ring) MultiGetAt(keys []string, level Consistency) []MultiGetResult {
+	return ring.MultiGetAtContext(context.Background(), keys, level)
+}
+
+// MultiGetAtContext is MultiGetAt tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) MultiGetAtContext(ctx context.Context, keys []string, level Consistency) []MultiGetResult {
+	results := make([]MultiGetResult, len(keys))
+	for i := range keys {
+		ring.record_access(keys[i])
+	}
+
+	wait_group := sync.WaitGroup{}
+	for _, group := range ring.group_by_replicas(keys) {
+		wait_group.Add(1)
+		go func(group *key_group) {
+			defer wait_group.Done()
+			group_keys := make([]string, len(group.indexes))
+			for i, index := range group.indexes {
+				group_keys[i] = keys[index]
+			}
+			found := make([]versions, len(group.indexes))
+			lock := sync.Mutex{}
+
+			ctx, query := ring.start_query(ctx, "multi_get", group.key_hash)
+			read_replication_factor, minimum_read := ring.read_quorum_at(group.key, level)
+			err := ring.consensus(ctx, "multi_get", group.key_hash, ring.replication_factor_of(group.key), read_replication_factor, minimum_read, false, func(node *Node, result_chan chan bool, hinted bool) {
+				values, metas, err := node.MultiGet(group_keys, !hinted)
+				if err == nil {
+					lock.Lock()
+					for i := range values {
+						if values[i] != nil {
+							found[i].add(values[i], metas[i], node, !hinted)
+						}
+					}
+					lock.Unlock()
+				}
+				result_chan <- (err == nil)
+			})
+			record_quorum("multi_get", err)
+
+			//replicas still answering after the quorum must not change the versions being resolved
+			lock.Lock()
+			defer lock.Unlock()
+			resolved := false
+			for i, index := range group.indexes {
+				if err != nil {
+					results[index].Err = err
+					continue
+				}
+				results[index].Value, results[index].Meta = ring.latest_version(keys[index], &found[i])
+				resolved = resolved || found[i].resolved
+			}
+			ring.finish_query(ctx, query, err, resolved)
+		}(group)
+	}
+	wait_group.Wait()
+	return results
+}
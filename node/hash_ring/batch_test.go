@@ -0,0 +1,72 @@
+package hash_ring
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// CountingBatchTable counts the batched calls made to it
+type CountingBatchTable struct {
+	InMemoryTable
+	Multi_adds int32
+	Multi_gets int32
+}
+
+func (t *CountingBatchTable) MultiAdd(keys []string, values [][]byte, metas []*ValueMeta) error {
+	atomic.AddInt32(&t.Multi_adds, 1)
+	return multi_add(&t.InMemoryTable, keys, values, metas)
+}
+
+func (t *CountingBatchTable) MultiGet(keys []string) ([][]byte, []*ValueMeta, error) {
+	atomic.AddInt32(&t.Multi_gets, 1)
+	return multi_get(&t.InMemoryTable, keys)
+}
+
+func TestMultiAddGet(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	tables := make([]*CountingBatchTable, len(hr.nodes))
+	for i := range hr.nodes {
+		tables[i] = &CountingBatchTable{InMemoryTable: NewInMemoryTable()}
+		hr.nodes[i].table = tables[i]
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	keys := make([]string, 50)
+	values := make([][]byte, 50)
+	metas := make([]*ValueMeta, 50)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		values[i] = []byte(fmt.Sprintf("value%d", i))
+		metas[i] = NewValueMeta(NewVectorClock())
+	}
+
+	errs := hr.MultiAdd(keys, values, metas)
+	for i := range errs {
+		assert.Nil(t, errs[i])
+	}
+
+	//5 nodes give at most 5 preference lists, each replica is sent one batch per list it is in
+	for i := range tables {
+		assert.LessOrEqual(t, int(atomic.LoadInt32(&tables[i].Multi_adds)), 3)
+	}
+
+	hr.Delete("key7", metas[7])
+	results := hr.MultiGet(append(keys, "missing"))
+	for i := range keys {
+		assert.Nil(t, results[i].Err)
+		if i == 7 {
+			assert.Nil(t, results[i].Value)
+		} else {
+			assert.Equal(t, values[i], results[i].Value)
+			assert.Equal(t, 1, results[i].Meta.VectorClock.Get(0))
+		}
+	}
+	assert.Nil(t, results[50].Value)
+	for i := range tables {
+		assert.LessOrEqual(t, int(atomic.LoadInt32(&tables[i].Multi_gets)), 3)
+	}
+}
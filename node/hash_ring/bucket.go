@@ -0,0 +1,215 @@
+package hash_ring
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Bucket is a named namespace of keys with its own settings, stored in the cluster config.
+// Its keys are stored in the ring's flat keyspace under Bucket_Key
+type Bucket struct {
+	Name               string
+	Replication_factor int
+	Minimum_writes     int
+	Minimum_read       int
+	//name of the conflict resolution, see Conflict_Resolution_By_Name, empty uses the ring's
+	Conflict_resolution string `json:",omitempty"`
+	//seconds until values written without a ttl expire, 0 keeps them
+	Default_ttl int `json:",omitempty"`
+}
+
+// ring_bucket is a bucket with its conflict resolution looked up
+type ring_bucket struct {
+	Bucket
+	conflict_resolution ConflictResolution
+}
+
+// bucket_marker starts every key stored in a named bucket and ends the bucket's name,
+// bucket names can't contain it so a stored key always splits back into one bucket and key
+const bucket_marker = "\x00"
+
+// Bucket_keys_end is the first key after every key stored in a named bucket,
+// scans outside of buckets start from it
+const Bucket_keys_end = "\x01"
+
+var bucket_name_pattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Bucket_Key gives the key a key of the bucket is stored under, keys outside of buckets are stored as they are
+func Bucket_Key(bucket string, key string) string {
+	if bucket == "" {
+		return key
+	}
+	return bucket_marker + bucket + bucket_marker + key
+}
+
+// Split_Bucket_Key reverses Bucket_Key, giving an empty bucket for keys outside of buckets
+func Split_Bucket_Key(stored_key string) (string, string) {
+	if !strings.HasPrefix(stored_key, bucket_marker) {
+		return "", stored_key
+	}
+	end := strings.Index(stored_key[1:], bucket_marker)
+	if end == -1 {
+		//a prefix of the bucket's name
+		return stored_key[1:], ""
+	}
+	return stored_key[1 : end+1], stored_key[end+2:]
+}
+
+func Validate_Bucket_Name(name string) error {
+	if !bucket_name_pattern.MatchString(name) {
+		return fmt.Errorf("Bucket name \"%s\" must be 1 to 63 lowercase letters, digits, _ or -, starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// Conflict_Resolution_By_Name finds a conflict resolution from its name in the config,
+// the empty name is nil, meaning the ring's conflict resolution
+func Conflict_Resolution_By_Name(name string) (ConflictResolution, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "first_instance":
+		return &ConflictResolutionFirstInstance{}, nil
+	case "largest_value":
+		return &ConflictResolutionLargestValue{}, nil
+	}
+	return nil, fmt.Errorf("Unknown conflict resolution \"%s\"", name)
+}
+
+// ValidateBuckets checks the names, quorums and conflict resolutions of the buckets against this ring
+func (ring *Hash_Ring) ValidateBuckets(buckets []Bucket) error {
+	_, err := ring.ring_buckets(buckets)
+	return err
+}
+
+func (ring *Hash_Ring) ring_buckets(buckets []Bucket) (map[string]*ring_bucket, error) {
+	ring_buckets := make(map[string]*ring_bucket, len(buckets))
+	for _, bucket := range buckets {
+		if err := Validate_Bucket_Name(bucket.Name); err != nil {
+			return nil, err
+		}
+		if ring_buckets[bucket.Name] != nil {
+			return nil, fmt.Errorf("Bucket \"%s\" is configured twice", bucket.Name)
+		}
+		_, err := Validate_Quorum(bucket.Replication_factor, bucket.Minimum_writes, bucket.Minimum_read, ring.number_of_physical_nodes())
+		if err != nil {
+			return nil, fmt.Errorf("Bucket \"%s\": %s", bucket.Name, err.Error())
+		}
+		if bucket.Default_ttl < 0 {
+			return nil, fmt.Errorf("Bucket \"%s\": default ttl must not be negative", bucket.Name)
+		}
+		conflict_resolution, err := Conflict_Resolution_By_Name(bucket.Conflict_resolution)
+		if err != nil {
+			return nil, fmt.Errorf("Bucket \"%s\": %s", bucket.Name, err.Error())
+		}
+		ring_buckets[bucket.Name] = &ring_bucket{bucket, conflict_resolution}
+	}
+	return ring_buckets, nil
+}
+
+// SetBuckets replaces the buckets of a running ring.
+// Keys of a dropped bucket stay stored, they can be read again if a bucket of the same name is created
+func (ring *Hash_Ring) SetBuckets(buckets []Bucket) error {
+	ring_buckets, err := ring.ring_buckets(buckets)
+	if err != nil {
+		return err
+	}
+	defer ring.config_lock.Unlock()
+	ring.config_lock.Lock()
+	ring.buckets = ring_buckets
+	return nil
+}
+
+// Bucket gives the settings of a bucket, false if it doesn't exist
+func (ring *Hash_Ring) Bucket(name string) (Bucket, bool) {
+	defer ring.config_lock.RUnlock()
+	ring.config_lock.RLock()
+	bucket, exists := ring.buckets[name]
+	if !exists {
+		return Bucket{}, false
+	}
+	return bucket.Bucket, true
+}
+
+// Buckets lists the buckets by name
+func (ring *Hash_Ring) Buckets() []Bucket {
+	ring.config_lock.RLock()
+	buckets := make([]Bucket, 0, len(ring.buckets))
+	for _, bucket := range ring.buckets {
+		buckets = append(buckets, bucket.Bucket)
+	}
+	ring.config_lock.RUnlock()
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets
+}
+
+// key_settings are what operations on a key use, the settings of its bucket or those of the ring
+type key_settings struct {
+	replication_factor int
+	minimum_writes     int
+	minimum_read       int
+	//0 reads every replica, see SetQuorum
+	read_replication_factor int
+	conflict_resolution     ConflictResolution
+	default_ttl             time.Duration
+}
+
+// settings_of gives the settings of the bucket the stored key is in.
+// Keys outside of buckets, or in buckets that have been dropped, use the ring's settings
+func (ring *Hash_Ring) settings_of(key string) key_settings {
+	defer ring.config_lock.RUnlock()
+	ring.config_lock.RLock()
+	settings := key_settings{
+		replication_factor:      ring.replication_factor,
+		minimum_writes:          ring.minimum_writes,
+		minimum_read:            ring.minimum_read,
+		read_replication_factor: ring.read_replication_factor,
+		conflict_resolution:     ring.conflict_resolution,
+	}
+
+	name, _ := Split_Bucket_Key(key)
+	bucket, exists := ring.buckets[name]
+	if name == "" || !exists {
+		return settings
+	}
+	settings.replication_factor = bucket.Replication_factor
+	settings.minimum_writes = bucket.Minimum_writes
+	settings.minimum_read = bucket.Minimum_read
+	//buckets are not back filled, every replica is read
+	settings.read_replication_factor = 0
+	if bucket.conflict_resolution != nil {
+		settings.conflict_resolution = bucket.conflict_resolution
+	}
+	settings.default_ttl = time.Duration(bucket.Default_ttl) * time.Second
+	return settings
+}
+
+// read_quorum gives the number of replicas to read from, and how many must succeed
+func (settings *key_settings) read_quorum() (int, int) {
+	if settings.read_replication_factor == 0 {
+		return settings.replication_factor, settings.minimum_read
+	}
+	if settings.minimum_read > settings.read_replication_factor {
+		return settings.read_replication_factor, settings.read_replication_factor
+	}
+	return settings.read_replication_factor, settings.minimum_read
+}
+
+// replication_factor_of gives the number of replicas the key is placed on
+func (ring *Hash_Ring) replication_factor_of(key string) int {
+	return ring.settings_of(key).replication_factor
+}
+
+// written_meta is WrittenMeta, also expiring values written without a ttl after the bucket's default ttl
+func (ring *Hash_Ring) written_meta(key string, meta *ValueMeta) *ValueMeta {
+	new_meta := ring.WrittenMeta(meta)
+	if default_ttl := ring.settings_of(key).default_ttl; new_meta.Expires == 0 && default_ttl != 0 {
+		new_meta.ExpireAfter(default_ttl)
+	}
+	return new_meta
+}
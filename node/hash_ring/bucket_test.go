@@ -0,0 +1,81 @@
+package hash_ring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketKey(t *testing.T) {
+	bucket, key := Split_Bucket_Key(Bucket_Key("users", "a/b"))
+	assert.Equal(t, "users", bucket)
+	assert.Equal(t, "a/b", key)
+
+	bucket, key = Split_Bucket_Key(Bucket_Key("", "a/b"))
+	assert.Equal(t, "", bucket)
+	assert.Equal(t, "a/b", key)
+
+	//keys of buckets sort before every other key
+	assert.Less(t, Bucket_Key("zzz", "zzz"), Bucket_keys_end)
+
+	assert.Nil(t, Validate_Bucket_Name("users-2"))
+	assert.NotNil(t, Validate_Bucket_Name("Users"))
+	assert.NotNil(t, Validate_Bucket_Name(""))
+	assert.NotNil(t, Validate_Bucket_Name("-users"))
+}
+
+func TestBucketSettings(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 2, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	tables := make([]*InMemoryTable, len(hr.nodes))
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		tables[i] = &table
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+	replicas := func(key string) int {
+		count := 0
+		for i := range tables {
+			if value, _, _ := tables[i].Get(key); value != nil {
+				count++
+			}
+		}
+		return count
+	}
+
+	assert.NotNil(t, hr.SetBuckets([]Bucket{{Name: "users", Replication_factor: 6, Minimum_writes: 1, Minimum_read: 1}}))
+	assert.NotNil(t, hr.SetBuckets([]Bucket{{Name: "users", Replication_factor: 4, Minimum_writes: 1, Minimum_read: 1, Conflict_resolution: "newest"}}))
+	assert.NotNil(t, hr.SetBuckets([]Bucket{{Name: "users", Replication_factor: 4, Minimum_writes: 1, Minimum_read: 1}, {Name: "users", Replication_factor: 2, Minimum_writes: 1, Minimum_read: 1}}))
+	assert.Nil(t, hr.SetBuckets([]Bucket{{Name: "users", Replication_factor: 4, Minimum_writes: 4, Minimum_read: 1, Conflict_resolution: "largest_value", Default_ttl: 60}}))
+
+	bucket, exists := hr.Bucket("users")
+	assert.True(t, exists)
+	assert.Equal(t, 4, bucket.Replication_factor)
+	_, exists = hr.Bucket("orders")
+	assert.False(t, exists)
+
+	key := Bucket_Key("users", "bar")
+	assert.Nil(t, hr.Add(key, []byte("mar"), NewValueMeta(NewVectorClock())))
+	assert.Nil(t, hr.AddAt("bar", []byte("mar"), NewValueMeta(NewVectorClock()), Consistency_all))
+	assert.Equal(t, 4, replicas(key))
+	assert.Equal(t, 2, replicas("bar"))
+
+	//the bucket's default ttl only applies to its keys
+	_, meta, _ := hr.Get(key)
+	assert.NotEqual(t, int64(0), meta.Expires)
+	_, meta, _ = hr.Get("bar")
+	assert.Equal(t, int64(0), meta.Expires)
+
+	//the bucket's conflict resolution picks the largest value, the ring's the first
+	values := [][]byte{[]byte("car"), []byte("mar")}
+	metas := []*ValueMeta{NewValueMeta(NewVectorClock()), NewValueMeta(NewVectorClock())}
+	value, _ := hr.resolve(key, values, metas, []uint64{})
+	assert.Equal(t, "mar", string(value))
+	value, _ = hr.resolve("bar", values, metas, []uint64{})
+	assert.Equal(t, "car", string(value))
+
+	//dropped buckets fall back to the ring's settings
+	assert.Nil(t, hr.SetBuckets(nil))
+	assert.Equal(t, 2, hr.replication_factor_of(key))
+}
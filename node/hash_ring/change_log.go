@@ -0,0 +1,132 @@
+package hash_ring
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+const Default_change_log_capacity = 100000
+
+var ErrChangesTruncated = errors.New("Changes from the sequence number have been dropped from the change log")
+
+var ErrChangeLogReset = errors.New("The sequence number is from a previous change log, the node has restarted since")
+
+// Change is a write committed to a permanent table
+type Change struct {
+	Sequence uint64
+	Key      string
+	Value    []byte
+	Meta     ValueMeta
+}
+
+// ChangeLog keeps the latest permanent writes of a node in order, numbered from 1.
+// Only the newest capacity changes are kept, consumers that fall further behind must resync.
+// The log is only kept in memory, so it starts again from 1 with a new id when the node restarts
+type ChangeLog struct {
+	id            string
+	lock          sync.Mutex
+	changes       []Change
+	capacity      int
+	next_sequence uint64
+	//closed and replaced on every append, waking anyone waiting for a change
+	appended chan struct{}
+}
+
+func NewChangeLog(capacity int) *ChangeLog {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &ChangeLog{
+		id:            hex.EncodeToString(id),
+		capacity:      capacity,
+		next_sequence: 1,
+		appended:      make(chan struct{}),
+	}
+}
+
+func (log *ChangeLog) Append(key string, value []byte, meta *ValueMeta) uint64 {
+	defer log.lock.Unlock()
+	log.lock.Lock()
+	sequence := log.next_sequence
+	log.next_sequence++
+	log.changes = append(log.changes, Change{sequence, key, append([]byte{}, value...), *meta.Copy()})
+
+	//trimmed in bulk, so appends stay cheap
+	if len(log.changes) >= 2*log.capacity {
+		kept := make([]Change, log.capacity, 2*log.capacity)
+		copy(kept, log.changes[len(log.changes)-log.capacity:])
+		log.changes = kept
+	}
+
+	close(log.appended)
+	log.appended = make(chan struct{})
+	return sequence
+}
+
+// Id tells change logs apart, a consumer seeing a different id has to resync as sequence numbers started again
+func (log *ChangeLog) Id() string {
+	return log.id
+}
+
+// First is the oldest sequence number still held
+func (log *ChangeLog) First() uint64 {
+	defer log.lock.Unlock()
+	log.lock.Lock()
+	return log.first()
+}
+
+func (log *ChangeLog) first() uint64 {
+	if len(log.changes) <= log.capacity {
+		if len(log.changes) == 0 {
+			return log.next_sequence
+		}
+		return log.changes[0].Sequence
+	}
+	return log.next_sequence - uint64(log.capacity)
+}
+
+// Next is the sequence number the next change will have
+func (log *ChangeLog) Next() uint64 {
+	defer log.lock.Unlock()
+	log.lock.Lock()
+	return log.next_sequence
+}
+
+// Read returns up to limit changes from the sequence number onwards,
+// failing with ErrChangesTruncated if some of them have been dropped,
+// or ErrChangeLogReset if the sequence number is past the next one, so from before a restart
+func (log *ChangeLog) Read(from uint64, limit int) ([]Change, error) {
+	defer log.lock.Unlock()
+	log.lock.Lock()
+	if from < log.first() {
+		return nil, ErrChangesTruncated
+	}
+	if from > log.next_sequence {
+		return nil, ErrChangeLogReset
+	}
+	if from == log.next_sequence {
+		return []Change{}, nil
+	}
+
+	start := int(from - log.changes[0].Sequence)
+	end := len(log.changes)
+	if end-start > limit {
+		end = start + limit
+	}
+	changes := make([]Change, end-start)
+	copy(changes, log.changes[start:end])
+	return changes, nil
+}
+
+// Appended returns a channel that is closed once there is a change at or after the sequence number
+func (log *ChangeLog) Appended(from uint64) <-chan struct{} {
+	defer log.lock.Unlock()
+	log.lock.Lock()
+	if from < log.next_sequence {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return log.appended
+}
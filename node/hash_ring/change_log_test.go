@@ -0,0 +1,56 @@
+package hash_ring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeLogReadFrom(t *testing.T) {
+	change_log := NewChangeLog(4)
+	appended := change_log.Appended(1)
+
+	meta := NewValueMeta(NewVectorClock())
+	for i := 0; i < 3; i++ {
+		change_log.Append(fmt.Sprintf("key%d", i), []byte("value"), meta)
+	}
+	//closed by the first append
+	<-appended
+
+	changes, err := change_log.Read(2, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, uint64(2), changes[0].Sequence)
+	assert.Equal(t, "key2", changes[1].Key)
+
+	changes, _ = change_log.Read(1, 1)
+	assert.Equal(t, "key0", changes[0].Key)
+
+	changes, _ = change_log.Read(4, 10)
+	assert.Empty(t, changes)
+
+	//only a restarted log is behind the consumer
+	_, err = change_log.Read(5, 10)
+	assert.Equal(t, ErrChangeLogReset, err)
+	assert.Equal(t, 16, len(change_log.Id()))
+	assert.NotEqual(t, change_log.Id(), NewChangeLog(4).Id())
+}
+
+func TestChangeLogDropsOldest(t *testing.T) {
+	change_log := NewChangeLog(4)
+	meta := NewValueMeta(NewVectorClock())
+	for i := 0; i < 10; i++ {
+		change_log.Append(fmt.Sprintf("key%d", i), []byte("value"), meta)
+	}
+
+	assert.Equal(t, uint64(7), change_log.First())
+	assert.Equal(t, uint64(11), change_log.Next())
+	_, err := change_log.Read(6, 10)
+	assert.Equal(t, ErrChangesTruncated, err)
+
+	changes, err := change_log.Read(7, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(changes))
+	assert.Equal(t, "key9", changes[3].Key)
+}
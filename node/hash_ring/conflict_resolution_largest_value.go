@@ -0,0 +1,17 @@
+package hash_ring
+
+import "bytes"
+
+// ConflictResolutionLargestValue keeps the largest of the concurrent values byte by byte,
+// so every node resolves the same conflict to the same value whatever order the versions arrive in
+type ConflictResolutionLargestValue struct{}
+
+func (conflict *ConflictResolutionLargestValue) Resolve(key string, values [][]byte, meta []*ValueMeta, nodes_position []uint64) int {
+	largest := 0
+	for i := range values {
+		if bytes.Compare(values[i], values[largest]) > 0 {
+			largest = i
+		}
+	}
+	return largest
+}
@@ -2,6 +2,6 @@ package hash_ring
 
 type ConflictResolutionFirstInstance struct{}
 
-func (conflict *ConflictResolutionFirstInstance) Resolve(key string, values []*string, meta []*ValueMeta, nodes_position []uint64) *string {
-	return values[0]
+func (conflict *ConflictResolutionFirstInstance) Resolve(key string, values [][]byte, meta []*ValueMeta, nodes_position []uint64) int {
+	return 0
 }
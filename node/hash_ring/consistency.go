@@ -0,0 +1,71 @@
+package hash_ring
+
+import "fmt"
+
+// Consistency is how many replicas must answer an operation before it succeeds
+type Consistency int
+
+const (
+	//the configured minimum writes or reads
+	Consistency_default Consistency = iota
+	Consistency_one
+	//a majority of the replicas
+	Consistency_quorum
+	Consistency_all
+)
+
+func (level Consistency) String() string {
+	switch level {
+	case Consistency_one:
+		return "one"
+	case Consistency_quorum:
+		return "quorum"
+	case Consistency_all:
+		return "all"
+	default:
+		return "default"
+	}
+}
+
+func Consistency_By_Name(name string) (Consistency, error) {
+	switch name {
+	case "", "default":
+		return Consistency_default, nil
+	case "one":
+		return Consistency_one, nil
+	case "quorum":
+		return Consistency_quorum, nil
+	case "all":
+		return Consistency_all, nil
+	}
+	return Consistency_default, fmt.Errorf("Unknown consistency level \"%s\"", name)
+}
+
+// minimum gives how many of the replicas must succeed at this level
+func (level Consistency) minimum(replicas int, configured int) int {
+	switch level {
+	case Consistency_one:
+		return 1
+	case Consistency_quorum:
+		return replicas/2 + 1
+	case Consistency_all:
+		return replicas
+	default:
+		return configured
+	}
+}
+
+func (ring *Hash_Ring) write_quorum_at(key string, level Consistency) (int, int) {
+	settings := ring.settings_of(key)
+	return settings.replication_factor, level.minimum(settings.replication_factor, settings.minimum_writes)
+}
+
+func (ring *Hash_Ring) read_quorum_at(key string, level Consistency) (int, int) {
+	settings := ring.settings_of(key)
+	if level == Consistency_all {
+		//every replica, not only those configured to be read
+		return settings.replication_factor, settings.replication_factor
+	}
+	read_replication_factor, minimum_read := settings.read_quorum()
+	return read_replication_factor, level.minimum(read_replication_factor, minimum_read)
+}
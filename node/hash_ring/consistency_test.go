@@ -0,0 +1,47 @@
+package hash_ring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsistencyByName(t *testing.T) {
+	for _, level := range []Consistency{Consistency_default, Consistency_one, Consistency_quorum, Consistency_all} {
+		parsed, err := Consistency_By_Name(level.String())
+		assert.Nil(t, err)
+		assert.Equal(t, level, parsed)
+	}
+	_, err := Consistency_By_Name("most")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 1, Consistency_one.minimum(5, 3))
+	assert.Equal(t, 3, Consistency_quorum.minimum(5, 2))
+	assert.Equal(t, 5, Consistency_all.minimum(5, 3))
+	assert.Equal(t, 2, Consistency_default.minimum(5, 2))
+}
+
+func TestConsistencyAllWaitsForEveryReplica(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	tables := make([]*InMemoryTable, len(hr.nodes))
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		tables[i] = &table
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	assert.Nil(t, hr.AddAt("bar", []byte("mar"), NewValueMeta(NewVectorClock()), Consistency_all))
+	replicas := 0
+	for i := range tables {
+		if value, _, _ := tables[i].Get("bar"); value != nil {
+			replicas++
+		}
+	}
+	assert.Equal(t, 3, replicas)
+
+	value, _, err := hr.GetAt("bar", Consistency_one)
+	assert.Nil(t, err)
+	assert.Equal(t, "mar", string(value))
+}
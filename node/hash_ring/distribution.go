@@ -0,0 +1,56 @@
+package hash_ring
+
+import (
+	"sort"
+	"time"
+)
+
+// RangeStats counts the live keys stored on this node in the range of the ring ending at a virtual node's position,
+// the keys that virtual node is the first replica for
+type RangeStats struct {
+	Position KeyHash
+	Keys     int
+	//of the keys, without their bucket, and their values
+	Bytes int64
+}
+
+// Range_Stats counts the live keys of the local permanent tables by the range they hash into, ordered by position.
+// Writes made while counting may be missed, so the counts are approximate
+func (ring *Hash_Ring) Range_Stats(now time.Time) []RangeStats {
+	by_position := make(map[KeyHash]*RangeStats)
+	counted := make(map[KeyValueTable]bool)
+	for i := range ring.nodes {
+		table := ring.nodes[i].table
+		//only tables holding their values locally can be iterated
+		if !Is_Local_Table(table) || counted[table] {
+			continue
+		}
+		counted[table] = true
+		iter := table.Iter()
+		for stored_key, value, meta := iter.Next(); stored_key != nil; stored_key, value, meta = iter.Next() {
+			if meta.Deleted || meta.Expired(now) {
+				continue
+			}
+			range_index := ring.primary_node_index(ring.KeyHash(*stored_key))
+			if range_index == -1 {
+				continue
+			}
+			position := ring.nodes[range_index].position
+			if by_position[position] == nil {
+				by_position[position] = &RangeStats{Position: position}
+			}
+			_, key := Split_Bucket_Key(*stored_key)
+			by_position[position].Keys++
+			by_position[position].Bytes += int64(len(key) + len(value))
+		}
+	}
+
+	stats := make([]RangeStats, 0, len(by_position))
+	for _, range_stats := range by_position {
+		stats = append(stats, *range_stats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Position < stats[j].Position
+	})
+	return stats
+}
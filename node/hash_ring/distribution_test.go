@@ -0,0 +1,85 @@
+package hash_ring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeStats(t *testing.T) {
+	//every virtual node of a physical node shares its table, so each key is counted once
+	nodes := Generate_Nodes(4)
+	table := NewInMemoryTable()
+	temp_table := NewInMemoryTable()
+	for i := range nodes {
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := New(nodes, 3, 3, 3, &ConflictResolutionFirstInstance{})
+	assert.Equal(t, 0, len(hr.Range_Stats(time.Now())))
+
+	keys := []string{"bar", "foo", Bucket_Key("users", "alice"), "zoo", "moo"}
+	expected := make(map[KeyHash]RangeStats)
+	for _, key := range keys {
+		assert.Nil(t, hr.Add(key, []byte("value"), NewValueMeta(NewVectorClock())))
+		range_index := hr.primary_node_index(hr.KeyHash(key))
+		if range_index == -1 {
+			continue
+		}
+		position := hr.nodes[range_index].position
+		_, user_key := Split_Bucket_Key(key)
+		stats := expected[position]
+		stats.Position = position
+		stats.Keys++
+		stats.Bytes += int64(len(user_key) + len("value"))
+		expected[position] = stats
+	}
+	assert.Nil(t, hr.Add("gone", []byte("value"), NewValueMeta(NewVectorClock())))
+	assert.Nil(t, hr.Delete("gone", NewValueMeta(NewVectorClock())))
+	expiring := NewValueMeta(NewVectorClock())
+	expiring.ExpireAfter(time.Minute)
+	assert.Nil(t, hr.Add("expiring", []byte("value"), expiring))
+
+	stats := hr.Range_Stats(time.Now().Add(time.Hour))
+	assert.Equal(t, len(expected), len(stats))
+	for i := range stats {
+		assert.Equal(t, expected[stats[i].Position], stats[i])
+		if i > 0 {
+			assert.Less(t, stats[i-1].Position, stats[i].Position)
+		}
+	}
+}
+
+// unsweepable_table is a local table without expiry sweeping
+type unsweepable_table struct {
+	table *InMemoryTable
+}
+
+func (t *unsweepable_table) Add(key string, value []byte, meta *ValueMeta) error {
+	return t.table.Add(key, value, meta)
+}
+func (t *unsweepable_table) Get(key string) ([]byte, *ValueMeta, error) { return t.table.Get(key) }
+func (t *unsweepable_table) Size() int                                  { return t.table.Size() }
+func (t *unsweepable_table) Iter() KeyValueIterator                     { return t.table.Iter() }
+func (t *unsweepable_table) Erase(key string)                           { t.table.Erase(key) }
+func (t *unsweepable_table) IsLocal() bool                              { return true }
+
+func TestRangeStatsOfUnsweepableTables(t *testing.T) {
+	nodes := Generate_Nodes(3)
+	in_memory := NewInMemoryTable()
+	table := unsweepable_table{&in_memory}
+	temp_table := NewInMemoryTable()
+	for i := range nodes {
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := New(nodes, 3, 3, 3, &ConflictResolutionFirstInstance{})
+	assert.Nil(t, hr.Add("bar", []byte("value"), NewValueMeta(NewVectorClock())))
+
+	stats := hr.Range_Stats(time.Now())
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, 1, stats[0].Keys)
+	//a remote table is never counted
+	assert.False(t, Is_Local_Table(&EmptyTable{}))
+}
@@ -2,11 +2,11 @@ package hash_ring
 
 type EmptyTable struct{}
 
-func (t *EmptyTable) Add(key string, value string, meta *ValueMeta) error {
+func (t *EmptyTable) Add(key string, value []byte, meta *ValueMeta) error {
 	panic("Add operation should have never been called")
 }
 
-func (t *EmptyTable) Get(key string) (*string, *ValueMeta, error) {
+func (t *EmptyTable) Get(key string) ([]byte, *ValueMeta, error) {
 	return nil, &ValueMeta{VectorClock: NewVectorClock()}, nil
 }
 
@@ -21,3 +21,7 @@ func (t *EmptyTable) Iter() KeyValueIterator {
 func (t *EmptyTable) Erase(key string) {
 	panic("Add operation should have never been called")
 }
+
+func (t *EmptyTable) Scan(prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error) {
+	return []string{}, [][]byte{}, []*ValueMeta{}, nil
+}
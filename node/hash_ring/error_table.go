@@ -4,11 +4,11 @@ import "errors"
 
 type ErrorTable struct{}
 
-func (t *ErrorTable) Add(key string, value string, meta *ValueMeta) error {
+func (t *ErrorTable) Add(key string, value []byte, meta *ValueMeta) error {
 	return errors.New("Failed")
 }
 
-func (t *ErrorTable) Get(key string) (*string, *ValueMeta, error) {
+func (t *ErrorTable) Get(key string) ([]byte, *ValueMeta, error) {
 	return nil, nil, errors.New("Failed")
 }
 
@@ -18,7 +18,7 @@ func (t *ErrorTable) Size() int {
 
 type ErrorIterator struct{}
 
-func (t *ErrorIterator) Next() (*string, *string, *ValueMeta) {
+func (t *ErrorIterator) Next() (*string, []byte, *ValueMeta) {
 	return nil, nil, nil
 }
 
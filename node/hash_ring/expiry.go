@@ -0,0 +1,49 @@
+package hash_ring
+
+import "time"
+
+// Expiry_grace is how long expired values are kept before being swept.
+// Until then reads keep repairing replicas that missed the expiring version,
+// sweeping straight away could let an older version without an expiry be read again
+const Expiry_grace = time.Hour
+
+// SweepableKeyValueTable is implemented by local tables that can erase their expired values
+type SweepableKeyValueTable interface {
+	//Sweep erases values that expired before the time, returning how many were erased
+	Sweep(expired_before time.Time) int
+}
+
+// Sweep_expired erases values that expired more than Expiry_grace ago from every local table of the ring,
+// returning how many were erased
+func Sweep_expired(ring *Hash_Ring, now time.Time) int {
+	swept := 0
+	//the temporary table may be shared between nodes
+	tables_swept := make(map[SweepableKeyValueTable]bool)
+	sweep := func(table KeyValueTable) {
+		if sweepable, is_sweepable := table.(SweepableKeyValueTable); is_sweepable && !tables_swept[sweepable] {
+			tables_swept[sweepable] = true
+			swept += sweepable.Sweep(now.Add(-Expiry_grace))
+		}
+	}
+	for i := range ring.nodes {
+		sweep(ring.nodes[i].table)
+		sweep(ring.nodes[i].temporaryTable)
+	}
+	return swept
+}
+
+// Start_sweeper sweeps the ring every interval until stop is closed
+func Start_sweeper(ring *Hash_Ring, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				Sweep_expired(ring, now)
+			}
+		}
+	}()
+}
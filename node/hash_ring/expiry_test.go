@@ -0,0 +1,43 @@
+package hash_ring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiredValuesReadAsAbsent(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	tables := make([]*InMemoryTable, len(hr.nodes))
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		tables[i] = &table
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	meta := NewValueMeta(NewVectorClock())
+	meta.ExpireAfter(time.Hour)
+	hr.Add("bar", []byte("mar"), meta)
+	value, got_meta, _ := hr.Get("bar")
+	assert.Equal(t, "mar", string(value))
+	assert.Equal(t, meta.Expires, got_meta.Expires)
+
+	meta.Expires = time.Now().Add(-time.Minute).UnixMilli()
+	hr.Add("foo", []byte("car"), meta)
+	value, got_meta, _ = hr.Get("foo")
+	assert.Nil(t, value)
+	assert.Equal(t, 1, got_meta.VectorClock.Get(0))
+
+	//kept through the grace period, so reads still repair replicas with the expiring version
+	assert.Equal(t, 0, Sweep_expired(&hr, time.Now()))
+	assert.Equal(t, 3, Sweep_expired(&hr, time.Now().Add(Expiry_grace)))
+	remaining := 0
+	for i := range tables {
+		remaining += tables[i].Size()
+	}
+	//only "bar" on its 3 replicas
+	assert.Equal(t, 3, remaining)
+}
@@ -0,0 +1,168 @@
+package hash_ring
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	xxhash_prime1 uint64 = 11400714785074694791
+	xxhash_prime2 uint64 = 14029467366897019727
+	xxhash_prime3 uint64 = 1609587929392839161
+	xxhash_prime4 uint64 = 9650029242287828579
+	xxhash_prime5 uint64 = 2870177450012600261
+)
+
+func xxhash_round(acc uint64, input uint64) uint64 {
+	acc += input * xxhash_prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxhash_prime1
+}
+
+func xxhash_merge_round(acc uint64, value uint64) uint64 {
+	acc ^= xxhash_round(0, value)
+	return acc*xxhash_prime1 + xxhash_prime4
+}
+
+// XXHash64 is the 64 bit xxHash of data
+func XXHash64(data []byte, seed uint64) uint64 {
+	length := len(data)
+	var h uint64
+
+	if length >= 32 {
+		v1 := seed + xxhash_prime1 + xxhash_prime2
+		v2 := seed + xxhash_prime2
+		v3 := seed
+		v4 := seed - xxhash_prime1
+		for len(data) >= 32 {
+			v1 = xxhash_round(v1, binary.LittleEndian.Uint64(data[0:]))
+			v2 = xxhash_round(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = xxhash_round(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = xxhash_round(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxhash_merge_round(h, v1)
+		h = xxhash_merge_round(h, v2)
+		h = xxhash_merge_round(h, v3)
+		h = xxhash_merge_round(h, v4)
+	} else {
+		h = seed + xxhash_prime5
+	}
+
+	h += uint64(length)
+
+	for len(data) >= 8 {
+		h ^= xxhash_round(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxhash_prime1 + xxhash_prime4
+		data = data[8:]
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxhash_prime1
+		h = bits.RotateLeft64(h, 23)*xxhash_prime2 + xxhash_prime3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * xxhash_prime5
+		h = bits.RotateLeft64(h, 11) * xxhash_prime1
+	}
+
+	h ^= h >> 33
+	h *= xxhash_prime2
+	h ^= h >> 29
+	h *= xxhash_prime3
+	h ^= h >> 32
+	return h
+}
+
+const (
+	murmur3_c1 uint64 = 0x87c37b91114253d5
+	murmur3_c2 uint64 = 0x4cf5ad432745937f
+)
+
+func murmur3_fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// Murmur3_128 is the x64 128 bit MurmurHash3 of data
+func Murmur3_128(data []byte, seed uint64) (uint64, uint64) {
+	length := len(data)
+	h1 := seed
+	h2 := seed
+
+	for len(data) >= 16 {
+		k1 := binary.LittleEndian.Uint64(data[0:])
+		k2 := binary.LittleEndian.Uint64(data[8:])
+
+		k1 *= murmur3_c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmur3_c2
+		h1 ^= k1
+
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= murmur3_c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmur3_c1
+		h2 ^= k2
+
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+
+		data = data[16:]
+	}
+
+	var k1, k2 uint64
+	for i := len(data) - 1; i >= 8; i-- {
+		k2 ^= uint64(data[i]) << (8 * uint(i-8))
+	}
+	if len(data) > 8 {
+		k2 *= murmur3_c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmur3_c1
+		h2 ^= k2
+	}
+	for i := 0; i < len(data) && i < 8; i++ {
+		k1 ^= uint64(data[i]) << (8 * uint(i))
+	}
+	if len(data) > 0 {
+		k1 *= murmur3_c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmur3_c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(length)
+	h2 ^= uint64(length)
+
+	h1 += h2
+	h2 += h1
+
+	h1 = murmur3_fmix64(h1)
+	h2 = murmur3_fmix64(h2)
+
+	h1 += h2
+	h2 += h1
+
+	return h1, h2
+}
+
+// Jump_Hash is Lamping and Veach's jump consistent hash, mapping a key to one of number_of_buckets buckets
+// such that growing the number of buckets moves the fewest keys
+func Jump_Hash(key uint64, number_of_buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(number_of_buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
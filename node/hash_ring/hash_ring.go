@@ -1,10 +1,13 @@
 package hash_ring
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"hash/fnv"
-	"log"
+	"log/slog"
 	"sync"
+	"time"
 )
 
 func Hash(s string) uint64 {
@@ -28,39 +31,92 @@ func (r KeyHashRange) contains(key_hash KeyHash) bool {
 
 type ValueMeta struct {
 	VectorClock VectorClock
+	//tombstone left by a delete, kept so the delete replicates and wins over older versions
+	Deleted bool
+	//media type given when the value was written, empty when unknown
+	ContentType string
+	//id of the node that coordinated the write
+	Origin uint64
+	//unix time in milliseconds the value expires at, 0 if it never does.
+	//A time rather than a duration, so every replica and hinted copy expires the value together
+	Expires int64
+	//opaque flags memcached clients store alongside the value
+	Flags uint32
 }
 
 func (meta *ValueMeta) Copy() *ValueMeta {
 	return &ValueMeta{
 		VectorClock: meta.VectorClock.Copy(),
+		Deleted:     meta.Deleted,
+		ContentType: meta.ContentType,
+		Origin:      meta.Origin,
+		Expires:     meta.Expires,
+		Flags:       meta.Flags,
 	}
 }
 
+// ExpireAfter sets the value to expire ttl from now
+func (meta *ValueMeta) ExpireAfter(ttl time.Duration) {
+	meta.Expires = time.Now().Add(ttl).UnixMilli()
+}
+
+func (meta *ValueMeta) Expired(now time.Time) bool {
+	return meta.Expires != 0 && now.UnixMilli() >= meta.Expires
+}
+
 func NewValueMeta(vectorClock VectorClock) *ValueMeta {
 	return &ValueMeta{VectorClock: vectorClock}
 }
 
 type KeyValueIterator interface {
-	Next() (*string, *string, *ValueMeta)
+	Next() (*string, []byte, *ValueMeta)
 }
 
 type KeyValueTable interface {
-	Add(string, string, *ValueMeta) error
-	Get(string) (*string, *ValueMeta, error)
+	Add(string, []byte, *ValueMeta) error
+	Get(string) ([]byte, *ValueMeta, error)
 	Size() int
 	Iter() KeyValueIterator
 	Erase(key string)
 }
 
+// LocalKeyValueTable is implemented by tables holding their values in this process,
+// which can be counted and iterated without asking another node
+type LocalKeyValueTable interface {
+	KeyValueTable
+	IsLocal() bool
+}
+
+// Is_Local_Table is whether the table holds its values in this process
+func Is_Local_Table(table KeyValueTable) bool {
+	local, is_local := table.(LocalKeyValueTable)
+	return is_local && local.IsLocal()
+}
+
 func CopyToMap(table KeyValueTable, data *map[string]string) {
 	iter := table.Iter()
 	for key, value, _ := iter.Next(); key != nil; key, value, _ = iter.Next() {
-		(*data)[*key] = *value
+		(*data)[*key] = string(value)
 	}
 }
 
+var ErrNoNodes = errors.New("Missing node for key")
+var ErrQuorumNotMet = errors.New("Failed to replicate value to replication factor")
+
+// ConflictError is returned when a write is rejected because the key has changed since the context
+// the write was based on, it holds the current version
+type ConflictError struct {
+	Value []byte
+	Meta  *ValueMeta
+}
+
+func (err *ConflictError) Error() string {
+	return "Key has changed since the supplied context"
+}
+
+// ConflictResolution chooses between concurrent versions of a key, giving the index of the version to keep
 type ConflictResolution interface {
-	Resolve(key string, values []*string, metas []*ValueMeta, nodes_position []uint64) *string
+	Resolve(key string, values [][]byte, metas []*ValueMeta, nodes_position []uint64) int
 }
 
 type Hash_Ring struct {
@@ -70,6 +126,23 @@ type Hash_Ring struct {
 	minimum_read        int
 	conflict_resolution ConflictResolution
 	myId                uint64
+	//while a raised replication factor is being back filled reads only use the old replicas, 0 means all replicas
+	read_replication_factor int
+	config_lock             sync.RWMutex
+	//indexes by replication factor, buckets may place keys on a different number of replicas than the ring
+	indexes map[int]*ring_index
+	//nil uses FNV, see Hash
+	partitioner Partitioner
+	//permanent writes stored on this node, nil when not recorded
+	change_log *ChangeLog
+	watchers   Watchers
+	buckets    map[string]*ring_bucket
+	//nil logs to slog's default logger, see SetLogger
+	logger *slog.Logger
+	//nil when slow operations aren't recorded
+	slow_log *SlowLog
+	//nil when accessed keys aren't recorded
+	hot_keys *HotKeys
 }
 
 func New(nodes []Node,
@@ -86,10 +159,140 @@ func New(nodes []Node,
 	}
 }
 
+// SetId sets the id this ring coordinates writes as, used in vector clocks
+func (hr *Hash_Ring) SetId(id uint64) {
+	hr.myId = id
+}
+
+// Id is the physical id of the node the ring runs on
+func (hr *Hash_Ring) Id() uint64 {
+	return hr.myId
+}
+
+func (hr *Hash_Ring) SetLogger(logger *slog.Logger) {
+	hr.logger = logger
+}
+
+// Logger is the logger of the ring, lines logged with a request's context carry its request id
+func (hr *Hash_Ring) Logger() *slog.Logger {
+	if hr.logger == nil {
+		return slog.Default()
+	}
+	return hr.logger
+}
+
+func (hr *Hash_Ring) SetChangeLog(change_log *ChangeLog) {
+	hr.change_log = change_log
+}
+
+func (hr *Hash_Ring) ChangeLog() *ChangeLog {
+	return hr.change_log
+}
+
+// Watchers are woken by versions of keys this node coordinates or stores
+func (hr *Hash_Ring) Watchers() *Watchers {
+	return &hr.watchers
+}
+
 func (hr *Hash_Ring) Nodes() []Node {
 	return hr.nodes
 }
 
+func (hr *Hash_Ring) number_of_physical_nodes() int {
+	physical_ids := make(map[uint64]bool)
+	for i := range hr.nodes {
+		physical_ids[hr.nodes[i].physical_id] = true
+	}
+	return len(physical_ids)
+}
+
+// Validate_Quorum checks a replication factor and quorum sizes against the size of the cluster,
+// returning warnings for settings that are allowed but weaken consistency
+func Validate_Quorum(replication_factor int, minimum_writes int, minimum_read int, number_of_physical_nodes int) ([]string, error) {
+	if replication_factor < 1 {
+		return nil, errors.New("Replication factor must be at least 1")
+	}
+	if minimum_writes < 1 || minimum_read < 1 {
+		return nil, errors.New("Minimum writes and reads must be at least 1")
+	}
+	if minimum_writes > replication_factor {
+		return nil, fmt.Errorf("Minimum writes (%d) can not exceed the replication factor (%d)", minimum_writes, replication_factor)
+	}
+	if minimum_read > replication_factor {
+		return nil, fmt.Errorf("Minimum reads (%d) can not exceed the replication factor (%d)", minimum_read, replication_factor)
+	}
+	if replication_factor > number_of_physical_nodes {
+		return nil, fmt.Errorf("Replication factor (%d) can not exceed the number of physical nodes (%d)", replication_factor, number_of_physical_nodes)
+	}
+
+	warnings := []string{}
+	if minimum_read+minimum_writes <= replication_factor {
+		warnings = append(warnings, fmt.Sprintf("Minimum reads + minimum writes (%d) <= replication factor (%d), reads may not see the latest write", minimum_read+minimum_writes, replication_factor))
+	}
+	if replication_factor == 1 {
+		warnings = append(warnings, "Replication factor of 1 keeps a single copy of each value")
+	}
+	return warnings, nil
+}
+
+// SetQuorum changes the replication factor and quorum sizes of a running ring.
+// read_replication_factor limits reads to the first replicas while new replicas are back filled, 0 means all replicas.
+func (ring *Hash_Ring) SetQuorum(replication_factor int, minimum_writes int, minimum_read int, read_replication_factor int) error {
+	_, err := Validate_Quorum(replication_factor, minimum_writes, minimum_read, ring.number_of_physical_nodes())
+	if err != nil {
+		return err
+	}
+	if read_replication_factor < 0 || read_replication_factor > replication_factor {
+		return fmt.Errorf("Read replication factor (%d) must be between 0 and the replication factor (%d)", read_replication_factor, replication_factor)
+	}
+
+	defer ring.config_lock.Unlock()
+	ring.config_lock.Lock()
+	ring.replication_factor = replication_factor
+	ring.minimum_writes = minimum_writes
+	ring.minimum_read = minimum_read
+	ring.read_replication_factor = read_replication_factor
+	return nil
+}
+
+func (ring *Hash_Ring) SetPartitioner(partitioner Partitioner) {
+	defer ring.config_lock.Unlock()
+	ring.config_lock.Lock()
+	ring.partitioner = partitioner
+}
+
+func (ring *Hash_Ring) Partitioner() Partitioner {
+	defer ring.config_lock.RUnlock()
+	ring.config_lock.RLock()
+	if ring.partitioner == nil {
+		return &FNVPartitioner{}
+	}
+	return ring.partitioner
+}
+
+// KeyHash places a key on the ring using the ring's partitioner
+func (ring *Hash_Ring) KeyHash(key string) KeyHash {
+	return ring.Partitioner().KeyHash(key, ring.get_index().positions)
+}
+
+func (ring *Hash_Ring) ReplicationFactor() int {
+	defer ring.config_lock.RUnlock()
+	ring.config_lock.RLock()
+	return ring.replication_factor
+}
+
+// number of replicas to write to, and how many must succeed
+func (ring *Hash_Ring) write_quorum() (int, int) {
+	settings := ring.settings_of("")
+	return settings.replication_factor, settings.minimum_writes
+}
+
+// number of replicas to read from, and how many must succeed
+func (ring *Hash_Ring) read_quorum() (int, int) {
+	settings := ring.settings_of("")
+	return settings.read_quorum()
+}
+
 func Generate_Nodes_With_Virtual(number_of_physical_nodes int, virtual_nodes_counts []int) []Node {
 	count := 0
 	for i := 0; i < number_of_physical_nodes; i++ {
@@ -110,6 +313,95 @@ func Generate_Nodes_With_Virtual(number_of_physical_nodes int, virtual_nodes_cou
 	return nodes
 }
 
+// Virtual_Node_Counts gives each physical node a number of virtual nodes proportional to its capacity weight
+func Virtual_Node_Counts(weights []int, virtual_nodes_per_weight int) []int {
+	counts := make([]int, len(weights))
+	for i := range weights {
+		counts[i] = weights[i] * virtual_nodes_per_weight
+	}
+	return counts
+}
+
+// Weighted_Order interleaves the virtual nodes of each physical node around the ring,
+// returning the index of the physical node for each ring slot.
+// Each slot takes the physical node with the most virtual nodes left to place, skipping the
+// previous slot's physical node where possible, so neighbouring virtual nodes are on different machines
+func Weighted_Order(virtual_nodes_counts []int) []int {
+	total := 0
+	remaining := make([]int, len(virtual_nodes_counts))
+	for i, count := range virtual_nodes_counts {
+		total += count
+		remaining[i] = count
+	}
+
+	order := make([]int, total)
+	for slot := range order {
+		best := -1
+		fallback := -1
+		for i := range remaining {
+			if remaining[i] == 0 {
+				continue
+			}
+			//the last slot neighbours the first one around the ring
+			is_neighbour := (slot > 0 && order[slot-1] == i) || (slot == total-1 && order[0] == i)
+			if is_neighbour {
+				fallback = i
+			} else if best == -1 || remaining[i] > remaining[best] {
+				best = i
+			}
+		}
+		if best == -1 {
+			best = fallback
+		}
+		remaining[best]--
+		order[slot] = best
+	}
+	return order
+}
+
+// Generate_Nodes_With_Weights creates a ring where each physical node owns a share of the key space
+// proportional to its weight
+func Generate_Nodes_With_Weights(weights []int, virtual_nodes_per_weight int) []Node {
+	order := Weighted_Order(Virtual_Node_Counts(weights, virtual_nodes_per_weight))
+	nodes := Generate_Nodes(len(order))
+	for i := range nodes {
+		nodes[i].physical_id = uint64(order[i])
+	}
+	return nodes
+}
+
+// Ownership returns the fraction of the key space owned by each physical node,
+// positions must be sorted and a node owns the keys after the previous position up to its own
+func Ownership(positions []KeyHash, physical_ids []uint64) map[uint64]float64 {
+	ownership := make(map[uint64]float64)
+	if len(positions) == 0 {
+		return ownership
+	}
+
+	ring_size := float64(MaxKeyHash)
+	for i := range positions {
+		var owned float64
+		if i == 0 {
+			//wraps around from the last node
+			owned = float64(positions[0]) + float64(MaxKeyHash-positions[len(positions)-1])
+		} else {
+			owned = float64(positions[i] - positions[i-1])
+		}
+		ownership[physical_ids[i]] += owned / ring_size
+	}
+	return ownership
+}
+
+func (hr *Hash_Ring) Ownership() map[uint64]float64 {
+	positions := make([]KeyHash, len(hr.nodes))
+	physical_ids := make([]uint64, len(hr.nodes))
+	for i := range hr.nodes {
+		positions[i] = hr.nodes[i].position
+		physical_ids[i] = hr.nodes[i].physical_id
+	}
+	return Ownership(positions, physical_ids)
+}
+
 func Generate_Nodes(number_of_nodes int) []Node {
 	nodes := make([]Node, number_of_nodes)
 
@@ -141,23 +433,21 @@ func Generate_Ring_Positions(number_of_nodes int) []KeyHash {
 	return hashes
 }
 
-func (ring *Hash_Ring) primary_node_index(keyHash KeyHash) int {
-	for i, node := range ring.nodes {
-		if node.position >= keyHash {
-			return i
-		}
-	}
-	return -1
-}
-
 func (ring *Hash_Ring) wrapped_index(i int) int {
 	return i - ((i / len(ring.nodes)) * len(ring.nodes))
 }
 
-func (ring *Hash_Ring) add(key string, value string, meta *ValueMeta, key_hash uint64) error {
-	return ring.consensus(key_hash, ring.minimum_writes, false, func(node *Node, result_chan chan bool, hinted bool) {
+func (ring *Hash_Ring) add(ctx context.Context, key string, value []byte, meta *ValueMeta, key_hash uint64, level Consistency) error {
+	start := time.Now()
+	ring.record_access(key)
+	ctx, query := ring.start_query(ctx, "add", key_hash)
+	replication_factor, minimum_writes := ring.write_quorum_at(key, level)
+	err := ring.consensus(ctx, "add", key_hash, replication_factor, replication_factor, minimum_writes, false, func(node *Node, result_chan chan bool, hinted bool) {
 		if hinted {
 			err := node.AddTemporary(key, value, meta)
+			if err == nil {
+				hinted_writes.Inc()
+			}
 			result_chan <- (err == nil)
 		} else {
 			err := node.Add(key, value, meta)
@@ -165,126 +455,184 @@ func (ring *Hash_Ring) add(key string, value string, meta *ValueMeta, key_hash u
 		}
 
 	})
+	add_seconds.Observe(seconds_since(start))
+	record_quorum("add", err)
+	ring.finish_query(ctx, query, err, false)
+	return err
+}
+
+func (ring *Hash_Ring) Add(key string, value []byte, meta *ValueMeta) error {
+	return ring.AddAt(key, value, meta, Consistency_default)
 }
 
-func (ring *Hash_Ring) Add(key string, value string, meta *ValueMeta) error {
+// WrittenMeta gives the meta Add writes when given this context, so it can be handed back to the writer
+func (ring *Hash_Ring) WrittenMeta(meta *ValueMeta) *ValueMeta {
 	new_meta := meta.Copy()
 	new_meta.VectorClock.Counts[int(ring.myId)] = new_meta.VectorClock.Get(int(ring.myId)) + 1
-	return ring.add(key, value, new_meta, Hash(key))
+	//the meta is the context of a read, which may have been of a tombstone
+	new_meta.Deleted = false
+	new_meta.Origin = ring.myId
+	return new_meta
+}
+
+// AddAt is Add waiting for the replicas given by the consistency level
+func (ring *Hash_Ring) AddAt(key string, value []byte, meta *ValueMeta, level Consistency) error {
+	return ring.AddAtContext(context.Background(), key, value, meta, level)
+}
+
+// AddAtContext is AddAt tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) AddAtContext(ctx context.Context, key string, value []byte, meta *ValueMeta, level Consistency) error {
+	new_meta := ring.written_meta(key, meta)
+	err := ring.add(ctx, key, value, new_meta, ring.KeyHash(key), level)
+	if err == nil {
+		ring.watchers.Notify(key, value, new_meta)
+	}
+	return err
 }
 
 func (ring *Hash_Ring) IsPrimaryNodeFor(node_id int, key string) bool {
-	first_primary_node_id := ring.primary_node_index(Hash(key))
-	for i := 0; i < ring.replication_factor; i++ {
-		if first_primary_node_id == node_id {
+	for _, primary_node_id := range ring.primary_nodes_for(ring.KeyHash(key), ring.replication_factor_of(key)) {
+		if primary_node_id == node_id {
 			return true
 		}
-
-		first_primary_node_id++
-		first_primary_node_id = ring.wrapped_index(first_primary_node_id)
 	}
 	return false
 }
 
-func (ring *Hash_Ring) resolveConflicts(node_id int, key string, value string, meta *ValueMeta) (string, *ValueMeta) {
+// resolve runs conflict resolution between concurrent versions, returning the chosen value with its meta,
+// so versions with equal bytes keep their own meta
+func (ring *Hash_Ring) resolve(key string, values [][]byte, metas []*ValueMeta, nodes_position []uint64) ([]byte, *ValueMeta) {
+	chosen := ring.settings_of(key).conflict_resolution.Resolve(key, values, metas, nodes_position)
+	conflicts_resolved.Inc()
+	if chosen < 0 || chosen >= len(values) {
+		//a resolution choosing no version keeps the first, as every replica would
+		chosen = 0
+	}
+	return values[chosen], metas[chosen]
+}
+
+func (ring *Hash_Ring) resolveConflicts(node_id int, key string, value []byte, meta *ValueMeta) ([]byte, *ValueMeta) {
 	old_value, current_meta, _ := ring.nodes[node_id].Get(key, ring.IsPrimaryNodeFor(node_id, key))
 
 	//if !(old -> new)
 	if old_value != nil && IsNotCausal(&current_meta.VectorClock, &meta.VectorClock) {
 		//need to resolve version
-		new_value := ring.conflict_resolution.Resolve(key, []*string{old_value, &value}, []*ValueMeta{current_meta, meta}, []uint64{})
+		new_value, resolved_meta := ring.resolve(key, [][]byte{old_value, value}, []*ValueMeta{current_meta, meta}, []uint64{})
 		new_meta := ValueMeta{
 			VectorClock: MaxUpVectorClock(meta.VectorClock, current_meta.VectorClock),
+			Deleted:     resolved_meta.Deleted,
+			ContentType: resolved_meta.ContentType,
+			Origin:      resolved_meta.Origin,
+			Expires:     resolved_meta.Expires,
+			Flags:       resolved_meta.Flags,
 		}
-		return *new_value, &new_meta
+		return new_value, &new_meta
 	} else {
 		return value, meta
 	}
 }
 
-func (ring *Hash_Ring) AddToNodePermanent(node_position uint64, key string, value string, meta *ValueMeta) error {
-	for i := range ring.nodes {
-		if node_position == ring.nodes[i].position {
-			new_value, new_meta := ring.resolveConflicts(i, key, value, meta)
-			return ring.nodes[i].AddPermanent(key, new_value, new_meta)
-		}
+func (ring *Hash_Ring) AddToNodePermanent(node_position uint64, key string, value []byte, meta *ValueMeta) error {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return errors.New("No node found")
+	}
+	new_value, new_meta := ring.resolveConflicts(i, key, value, meta)
+	err := ring.nodes[i].AddPermanent(key, new_value, new_meta)
+	if err == nil {
+		ring.watchers.Notify(key, new_value, new_meta)
 	}
-	return errors.New("No node found")
+	return err
 }
 
-func (ring *Hash_Ring) AddToNodeTemporary(node_position uint64, key string, value string, meta *ValueMeta) error {
-	for i := range ring.nodes {
-		if node_position == ring.nodes[i].position {
-			new_value, new_meta := ring.resolveConflicts(i, key, value, meta)
-			return ring.nodes[i].AddTemporary(key, new_value, new_meta)
-		}
+func (ring *Hash_Ring) AddToNodeTemporary(node_position uint64, key string, value []byte, meta *ValueMeta) error {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return errors.New("No node found")
 	}
-	return errors.New("No node found")
+	new_value, new_meta := ring.resolveConflicts(i, key, value, meta)
+	return ring.nodes[i].AddTemporary(key, new_value, new_meta)
 }
 
-func (ring *Hash_Ring) GetFromNodePermanent(node_position uint64, key string) (*string, *ValueMeta, error) {
-	for i := range ring.nodes {
-		if node_position == ring.nodes[i].position {
-			return ring.nodes[i].GetPermanent(key)
+func (ring *Hash_Ring) MultiAddToNodePermanent(node_position uint64, keys []string, values [][]byte, metas []*ValueMeta) error {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return errors.New("No node found")
+	}
+	new_values := make([][]byte, len(keys))
+	new_metas := make([]*ValueMeta, len(keys))
+	for k := range keys {
+		new_values[k], new_metas[k] = ring.resolveConflicts(i, keys[k], values[k], metas[k])
+	}
+	err := ring.nodes[i].MultiAdd(keys, new_values, new_metas, true)
+	if err == nil {
+		for k := range keys {
+			ring.watchers.Notify(keys[k], new_values[k], new_metas[k])
 		}
 	}
-	return nil, nil, errors.New("No node found")
+	return err
 }
 
-func (ring *Hash_Ring) GetFromNodeTemporary(node_position uint64, key string) (*string, *ValueMeta, error) {
-	for i := range ring.nodes {
-		if node_position == ring.nodes[i].position {
-			return ring.nodes[i].GetTemporary(key)
-		}
+func (ring *Hash_Ring) MultiGetFromNodePermanent(node_position uint64, keys []string) ([][]byte, []*ValueMeta, error) {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return nil, nil, errors.New("No node found")
+	}
+	return ring.nodes[i].MultiGet(keys, true)
+}
+
+func (ring *Hash_Ring) ScanFromNodePermanent(node_position uint64, prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error) {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return nil, nil, nil, errors.New("No node found")
 	}
-	return nil, nil, errors.New("No node found")
+	return ring.nodes[i].Scan(prefix, start, limit, true)
 }
 
-func (ring *Hash_Ring) ReplicateToPrimary(key string, value string, meta *ValueMeta) int {
-	return ring.consensus_only_primary(Hash(key), func(node *Node, result_chan chan bool) {
-		err := node.Add(key, value, meta)
+func (ring *Hash_Ring) GetFromNodePermanent(node_position uint64, key string) ([]byte, *ValueMeta, error) {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return nil, nil, errors.New("No node found")
+	}
+	return ring.nodes[i].GetPermanent(key)
+}
+
+func (ring *Hash_Ring) GetFromNodeTemporary(node_position uint64, key string) ([]byte, *ValueMeta, error) {
+	i := ring.node_index(node_position)
+	if i == -1 {
+		return nil, nil, errors.New("No node found")
+	}
+	return ring.nodes[i].GetTemporary(key)
+}
+
+// ReplicateToPrimary copies a version read earlier to the primary replicas of its key. Versions written since
+// may be newer, so local tables resolve conflicts before the write, as remote ones do when it reaches them
+func (ring *Hash_Ring) ReplicateToPrimary(key string, value []byte, meta *ValueMeta) int {
+	return ring.consensus_only_primary(ring.KeyHash(key), ring.replication_factor_of(key), func(node *Node, result_chan chan bool) {
+		var err error
+		if Is_Local_Table(node.table) {
+			err = ring.AddToNodePermanent(node.position, key, value, meta)
+		} else {
+			err = node.Add(key, value, meta)
+		}
 		result_chan <- (err == nil)
 	})
 }
 
-func (ring *Hash_Ring) consensus_only_primary(key_hash KeyHash, node_op func(node *Node, result_chan chan bool)) int {
-	node_i := ring.primary_node_index(key_hash)
-	physical_nodes_visited := make(map[uint64]bool)
-	if node_i == -1 {
+func (ring *Hash_Ring) consensus_only_primary(key_hash KeyHash, placement int, node_op func(node *Node, result_chan chan bool)) int {
+	primary_nodes := ring.primary_nodes_for(key_hash, placement)
+	if primary_nodes == nil {
 		return -1
 	}
 
 	number_finished := 0
 	result_chan := make(chan bool)
 
-	nodes_started := 0
-	nodes_inspected := 0
-
-	request_node := func() bool {
-		for nodes_inspected < len(ring.nodes) {
-			node := &ring.nodes[node_i]
-			node_i++
-			if node_i == len(ring.nodes) {
-				node_i = 0
-			}
-
-			_, exists := physical_nodes_visited[node.physical_id]
-			if !exists {
-				physical_nodes_visited[node.physical_id] = true
-				nodes_started++
-				go node_op(node, result_chan)
-				return true
-			}
-			nodes_inspected++
-		}
-		return false
-	}
-
 	//launch number of nodes as the replication factor
-	for nodes_started < ring.replication_factor {
-		if !request_node() {
-			break
-		}
+	nodes_started := 0
+	for nodes_started < len(primary_nodes) {
+		go node_op(&ring.nodes[primary_nodes[nodes_started]], result_chan)
+		nodes_started++
 	}
 
 	for i := 0; i < nodes_started; i++ {
@@ -297,12 +645,15 @@ func (ring *Hash_Ring) consensus_only_primary(key_hash KeyHash, node_op func(nod
 	return number_finished
 }
 
-func (ring *Hash_Ring) consensus(key_hash KeyHash, minimum_for_early_return int, finish_early bool, node_op func(node *Node, result_chan chan bool, hinted bool)) error {
-	node_i := ring.primary_node_index(key_hash)
-	physical_nodes_visited := make(map[uint64]bool)
-	if node_i == -1 {
-		return errors.New("Missing node for key")
+// consensus runs node_op on replication_factor of the primary replicas of a key placed on placement replicas,
+// returning once minimum_for_early_return have succeeded. Each replica's request is traced as a child of the context's span
+func (ring *Hash_Ring) consensus(ctx context.Context, operation string, key_hash KeyHash, placement int, replication_factor int, minimum_for_early_return int, finish_early bool, node_op func(node *Node, result_chan chan bool, hinted bool)) error {
+	//hinted handoff nodes are only found if a primary fails
+	preference_list := ring.primary_nodes_for(key_hash, placement)
+	if preference_list == nil {
+		return ErrNoNodes
 	}
+	found_hinted_nodes := false
 
 	minimum_succeeded_chan := make(chan error)
 	//start replicating data
@@ -311,35 +662,33 @@ func (ring *Hash_Ring) consensus(key_hash KeyHash, minimum_for_early_return int,
 		result_chan := make(chan bool)
 
 		nodes_started := 0
-		nodes_inspected := 0
-
-		request_node := func(hinted bool) bool {
-			for nodes_inspected < len(ring.nodes) {
-				node := &ring.nodes[node_i]
-				node_i++
-				if node_i == len(ring.nodes) {
-					node_i = 0
-				}
 
-				_, exists := physical_nodes_visited[node.physical_id]
-				if !exists {
-					physical_nodes_visited[node.physical_id] = true
-					nodes_started++
-					go node_op(node, result_chan, hinted)
-					return true
-				}
-				nodes_inspected++
+		request_node := func() bool {
+			if nodes_started == len(preference_list) && !found_hinted_nodes {
+				preference_list = ring.preference_list(key_hash, len(preference_list))
+				found_hinted_nodes = true
+			}
+			if nodes_started < len(preference_list) {
+				node := &ring.nodes[preference_list[nodes_started]]
+				//reads of fewer than placement replicas fall back to the remaining primaries first,
+				//only nodes past the primaries hold hinted copies
+				hinted := nodes_started >= placement
+				nodes_started++
+				//recorded before the request is sent, so the operation can't return without it
+				call := query_of(ctx).contacted(node, hinted)
+				go ring.traced_op(ctx, operation, node, hinted, call, result_chan, node_op)
+				return true
 			}
 			//replication failed
-			log.Printf("Failed to replicate value to replication factor")
+			ring.Logger().WarnContext(ctx, "Failed to replicate to the replication factor", "operation", operation, "replicas", number_finished, "required", minimum_for_early_return)
 			//sometimes this will not propagate all the way up, as add() returns early
-			minimum_succeeded_chan <- errors.New("Failed to replicate value to replication factor")
+			minimum_succeeded_chan <- ErrQuorumNotMet
 			return false
 		}
 
 		//launch number of nodes as the replication factor
-		for nodes_started < ring.replication_factor {
-			if !request_node(false) {
+		for nodes_started < replication_factor {
+			if !request_node() {
 				//replication failed
 				return
 			}
@@ -365,13 +714,13 @@ func (ring *Hash_Ring) consensus(key_hash KeyHash, minimum_for_early_return int,
 			}
 
 			//replicate to the replication factor, success
-			if number_finished == ring.replication_factor {
+			if number_finished == replication_factor {
 				return
 			}
 
 			//node failed to replicate,
 			if !succeeded {
-				if !request_node(true) {
+				if !request_node() {
 					//replication failed
 					return
 				}
@@ -381,101 +730,314 @@ func (ring *Hash_Ring) consensus(key_hash KeyHash, minimum_for_early_return int,
 	return <-minimum_succeeded_chan
 }
 
-func (ring *Hash_Ring) get(key string, key_hash uint64) (*string, *ValueMeta, error) {
-	results := []*string{}
-	metas := []*ValueMeta{}
-	nodes_results := []uint64{}
-	nodes_involved := []*Node{}
-	was_primary := []bool{}
-	lock := sync.Mutex{}
-
-	err := ring.consensus(key_hash, ring.minimum_read, false, func(node *Node, result_chan chan bool, hinted bool) {
-		var value *string
-		var meta *ValueMeta
-		var err error
-		if hinted {
-			value, meta, err = node.GetTemporary(key)
-		} else {
-			value, meta, err = node.GetPermanent(key)
-		}
-
-		if err == nil && value != nil {
-			// if err == nil {
-			lock.Lock()
-			results = append(results, value)
-			metas = append(metas, meta)
-			nodes_results = append(nodes_results, node.position)
-			nodes_involved = append(nodes_involved, node)
-			was_primary = append(was_primary, !hinted)
-			lock.Unlock()
-		}
-		result_chan <- (err == nil)
-	})
+// versions collects the copies of a key returned by each replica during a read
+type versions struct {
+	values         [][]byte
+	metas          []*ValueMeta
+	nodes_position []uint64
+	nodes_involved []*Node
+	was_primary    []bool
+	//set once latest_version had to merge concurrent versions
+	resolved bool
+}
 
-	if err != nil {
-		return nil, nil, err
-	}
+func (v *versions) add(value []byte, meta *ValueMeta, node *Node, was_primary bool) {
+	v.values = append(v.values, value)
+	v.metas = append(v.metas, meta)
+	v.nodes_position = append(v.nodes_position, node.position)
+	v.nodes_involved = append(v.nodes_involved, node)
+	v.was_primary = append(v.was_primary, was_primary)
+}
 
-	if len(results) == 0 {
-		return nil, NewValueMeta(NewVectorClock()), nil
+// latest_version picks the newest of the versions read, resolving conflicts and repairing stale replicas.
+// Tombstones are returned as a nil value with their meta
+func (ring *Hash_Ring) latest_version(key string, v *versions) ([]byte, *ValueMeta) {
+	if len(v.values) == 0 {
+		return nil, NewValueMeta(NewVectorClock())
 	}
 
-	leading_clocks := make([]*VectorClock, len(metas))
-	for i := range metas {
-		leading_clocks[i] = &metas[i].VectorClock
+	leading_clocks := make([]*VectorClock, len(v.metas))
+	for i := range v.metas {
+		leading_clocks[i] = &v.metas[i].VectorClock
 	}
 
-	var latest_value *string
+	var latest_value []byte
 	var latest_meta *ValueMeta
 	newest_casual_clock_index := FindLatestCasualVersion(leading_clocks)
 	if newest_casual_clock_index != -1 {
 		//no conflict resolution required
-		latest_value = results[newest_casual_clock_index]
-		latest_meta = metas[newest_casual_clock_index]
+		latest_value = v.values[newest_casual_clock_index]
+		latest_meta = v.metas[newest_casual_clock_index]
 
 	} else {
 		//Non casual relation found
 		//Need to perform merge and create new leading version
 		//perform merge
-		latest_value = ring.conflict_resolution.Resolve(key, results, metas, nodes_results)
+		var resolved_meta *ValueMeta
+		latest_value, resolved_meta = ring.resolve(key, v.values, v.metas, v.nodes_position)
+		v.resolved = true
 
 		//calculate newest version
-		clocks := make([]VectorClock, len(metas))
-		for i := range metas {
-			clocks[i] = metas[i].VectorClock
+		clocks := make([]VectorClock, len(v.metas))
+		for i := range v.metas {
+			clocks[i] = v.metas[i].VectorClock
 		}
 		new_clock := MaxUpVectorClocks(clocks)
 		new_clock.Add(int(ring.myId))
 
 		latest_meta = NewValueMeta(new_clock)
+		latest_meta.Deleted = resolved_meta.Deleted
+		latest_meta.ContentType = resolved_meta.ContentType
+		latest_meta.Origin = ring.myId
+		latest_meta.Expires = resolved_meta.Expires
+		latest_meta.Flags = resolved_meta.Flags
+		ring.watchers.Notify(key, latest_value, latest_meta)
 	}
 
 	//should update old versions to latest version
 	//will all be nil, if no head version is found
 	for i := range leading_clocks {
 		if leading_clocks[i] == nil {
-			if was_primary[i] {
-				nodes_involved[i].AddPermanent(key, *latest_value, latest_meta)
+			read_repairs.Inc()
+			if v.was_primary[i] {
+				v.nodes_involved[i].AddPermanent(key, latest_value, latest_meta)
 			} else {
-				nodes_involved[i].AddTemporary(key, *latest_value, latest_meta)
+				v.nodes_involved[i].AddTemporary(key, latest_value, latest_meta)
+			}
+		}
+	}
+
+	if latest_meta.Deleted || latest_meta.Expired(time.Now()) {
+		//the context is still returned, so later writes supersede the delete
+		return nil, latest_meta
+	}
+	return latest_value, latest_meta
+}
+
+func (ring *Hash_Ring) get(ctx context.Context, key string, key_hash uint64, level Consistency) ([]byte, *ValueMeta, []uint64, error) {
+	start := time.Now()
+	defer func() { get_seconds.Observe(seconds_since(start)) }()
+	found := versions{}
+	answered := []uint64{}
+	lock := sync.Mutex{}
+
+	ring.record_access(key)
+	ctx, query := ring.start_query(ctx, "get", key_hash)
+	read_replication_factor, minimum_read := ring.read_quorum_at(key, level)
+	err := ring.consensus(ctx, "get", key_hash, ring.replication_factor_of(key), read_replication_factor, minimum_read, false, func(node *Node, result_chan chan bool, hinted bool) {
+		var value []byte
+		var meta *ValueMeta
+		var err error
+		if hinted {
+			value, meta, err = node.GetTemporary(key)
+		} else {
+			value, meta, err = node.GetPermanent(key)
+		}
+
+		if err == nil {
+			lock.Lock()
+			answered = append(answered, node.physical_id)
+			if value != nil {
+				found.add(value, meta, node, !hinted)
 			}
+			lock.Unlock()
 		}
+		result_chan <- (err == nil)
+	})
+
+	if err != nil {
+		record_quorum("get", err)
+		ring.finish_query(ctx, query, err, false)
+		return nil, nil, nil, err
 	}
 
-	return latest_value, latest_meta, nil
+	//replicas still answering after the quorum must not change the versions being resolved
+	lock.Lock()
+	defer lock.Unlock()
+	value, meta := ring.latest_version(key, &found)
+	ring.finish_query(ctx, query, nil, found.resolved)
+	return value, meta, append([]uint64{}, answered...), nil
 }
 
-func (ring *Hash_Ring) Get(key string) (*string, *ValueMeta, error) {
-	return ring.get(key, Hash(key))
+func (ring *Hash_Ring) Get(key string) ([]byte, *ValueMeta, error) {
+	return ring.GetAt(key, Consistency_default)
+}
+
+// GetAt is Get waiting for the replicas given by the consistency level
+func (ring *Hash_Ring) GetAt(key string, level Consistency) ([]byte, *ValueMeta, error) {
+	return ring.GetAtContext(context.Background(), key, level)
+}
+
+// GetAtContext is GetAt tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) GetAtContext(ctx context.Context, key string, level Consistency) ([]byte, *ValueMeta, error) {
+	value, meta, _, err := ring.get(ctx, key, ring.KeyHash(key), level)
+	return value, meta, err
+}
+
+// GetWithReplicas is GetAt also giving the physical ids of the nodes that answered before the read returned
+func (ring *Hash_Ring) GetWithReplicas(key string, level Consistency) ([]byte, *ValueMeta, []uint64, error) {
+	return ring.GetWithReplicasContext(context.Background(), key, level)
+}
+
+// GetWithReplicasContext is GetWithReplicas tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) GetWithReplicasContext(ctx context.Context, key string, level Consistency) ([]byte, *ValueMeta, []uint64, error) {
+	return ring.get(ctx, key, ring.KeyHash(key), level)
+}
+
+// Delete replaces the value with a tombstone, reads of the key then find no value
+func (ring *Hash_Ring) Delete(key string, meta *ValueMeta) error {
+	return ring.DeleteAt(key, meta, Consistency_default)
+}
+
+// DeleteAt is Delete waiting for the replicas given by the consistency level
+func (ring *Hash_Ring) DeleteAt(key string, meta *ValueMeta, level Consistency) error {
+	return ring.DeleteAtContext(context.Background(), key, meta, level)
+}
+
+// DeleteAtContext is DeleteAt tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) DeleteAtContext(ctx context.Context, key string, meta *ValueMeta, level Consistency) error {
+	tombstone := meta.Copy()
+	tombstone.VectorClock.Counts[int(ring.myId)] = tombstone.VectorClock.Get(int(ring.myId)) + 1
+	tombstone.Deleted = true
+	tombstone.ContentType = ""
+	tombstone.Origin = ring.myId
+	tombstone.Expires = 0
+	tombstone.Flags = 0
+	err := ring.add(ctx, key, []byte{}, tombstone, ring.KeyHash(key), level)
+	if err == nil {
+		ring.watchers.Notify(key, nil, tombstone)
+	}
+	return err
+}
+
+// AddCausal only writes if the supplied context has seen the current version of the key,
+// otherwise a ConflictError holding the current version is returned.
+// The check and the write are separate quorum operations, so concurrent writers can both pass
+// the check, their versions are then merged by conflict resolution as usual
+func (ring *Hash_Ring) AddCausal(key string, value []byte, meta *ValueMeta) error {
+	return ring.AddCausalAt(key, value, meta, Consistency_default)
+}
+
+// AddCausalAt is AddCausal reading and writing at the consistency level
+func (ring *Hash_Ring) AddCausalAt(key string, value []byte, meta *ValueMeta, level Consistency) error {
+	return ring.AddCausalAtContext(context.Background(), key, value, meta, level)
+}
+
+// AddCausalAtContext is AddCausalAt tracing the requests to each replica as children of the context's span
+func (ring *Hash_Ring) AddCausalAtContext(ctx context.Context, key string, value []byte, meta *ValueMeta, level Consistency) error {
+	current_value, current_meta, err := ring.GetAtContext(ctx, key, level)
+	if err != nil {
+		return err
+	}
+
+	if !meta.VectorClock.Descends(&current_meta.VectorClock) {
+		return &ConflictError{current_value, current_meta}
+	}
+	return ring.AddAtContext(ctx, key, value, meta, level)
+}
+
+// PreconditionFailedError is returned by a conditional write when the key's current version is not
+// the one the write expected, it holds the current version
+type PreconditionFailedError struct {
+	Value []byte
+	Meta  *ValueMeta
+}
+
+func (err *PreconditionFailedError) Error() string {
+	return "Key is not at the expected version"
+}
+
+// check_version reads the key at quorum and fails unless its vector clock equals the expected one.
+// A missing key has an empty clock, so an empty expected context means the key must not exist
+func (ring *Hash_Ring) check_version(ctx context.Context, key string, expected *ValueMeta, level Consistency) error {
+	current_value, current_meta, err := ring.GetAtContext(ctx, key, level)
+	if err != nil {
+		return err
+	}
+	if !current_meta.VectorClock.Equals(expected.VectorClock) {
+		return &PreconditionFailedError{current_value, current_meta}
+	}
+	return nil
+}
+
+// AddIf is a compare and set, only writing if the key's current vector clock equals the supplied context,
+// otherwise a PreconditionFailedError holding the current version is returned.
+//
+// The guarantee is only as strong as the quorums: the read and the write are separate quorum operations,
+// so two writers that read the same version can both succeed when R+W<=N, or when sloppy quorum sends
+// either operation to hinted nodes that missed the other write. Both versions are then concurrent and are
+// merged by conflict resolution on the next read, as with an unconditional Add
+func (ring *Hash_Ring) AddIf(key string, value []byte, meta *ValueMeta) error {
+	return ring.AddIfAt(key, value, meta, Consistency_default)
+}
+
+// AddIfAt is AddIf reading and writing at the consistency level
+func (ring *Hash_Ring) AddIfAt(key string, value []byte, meta *ValueMeta, level Consistency) error {
+	return ring.AddIfAtContext(context.Background(), key, value, meta, level)
+}
+
+// AddIfAtContext is AddIfAt tracing the requests to each replica as children of the context's span
+func (ring *Hash_Ring) AddIfAtContext(ctx context.Context, key string, value []byte, meta *ValueMeta, level Consistency) error {
+	if err := ring.check_version(ctx, key, meta, level); err != nil {
+		return err
+	}
+	return ring.AddAtContext(ctx, key, value, meta, level)
+}
+
+// AddIfAbsentAtContext is AddIf for a key with no current value, never written, deleted or expired.
+// meta takes the clock of the tombstone or expired version, so the write supersedes it
+func (ring *Hash_Ring) AddIfAbsentAtContext(ctx context.Context, key string, value []byte, meta *ValueMeta, level Consistency) error {
+	current_value, current_meta, err := ring.GetAtContext(ctx, key, level)
+	if err != nil {
+		return err
+	}
+	if current_value != nil {
+		return &PreconditionFailedError{current_value, current_meta}
+	}
+	meta.VectorClock = current_meta.VectorClock.Copy()
+	return ring.AddAtContext(ctx, key, value, meta, level)
+}
+
+// DeleteIf is AddIf for deletes
+func (ring *Hash_Ring) DeleteIf(key string, meta *ValueMeta) error {
+	return ring.DeleteIfAt(key, meta, Consistency_default)
+}
+
+// DeleteIfAt is DeleteIf reading and writing at the consistency level
+func (ring *Hash_Ring) DeleteIfAt(key string, meta *ValueMeta, level Consistency) error {
+	return ring.DeleteIfAtContext(context.Background(), key, meta, level)
+}
+
+// DeleteIfAtContext is DeleteIfAt tracing the requests to each replica as children of the context's span
+func (ring *Hash_Ring) DeleteIfAtContext(ctx context.Context, key string, meta *ValueMeta, level Consistency) error {
+	if err := ring.check_version(ctx, key, meta, level); err != nil {
+		return err
+	}
+	return ring.DeleteAtContext(ctx, key, meta, level)
 }
 
 func Cleanup_temporary(ring *Hash_Ring, temporaryTable KeyValueTable) {
 	iter := temporaryTable.Iter()
 	for key, value, meta := iter.Next(); key != nil; key, value, meta = iter.Next() {
-		num_replicated_to := ring.ReplicateToPrimary(*key, *value, meta)
-		if num_replicated_to == ring.replication_factor {
+		num_replicated_to := ring.ReplicateToPrimary(*key, value, meta)
+		if num_replicated_to == ring.replication_factor_of(*key) {
 			//adheres to replication invariant, therefore can delete from temp
 			temporaryTable.Erase(*key)
 		}
 	}
 }
+
+// Replicate_permanent copies every value in a permanent table to all of its primary replicas,
+// used to back fill new replicas after the replication factor is raised.
+// Returns the number of keys that could not be replicated to the full replication factor
+func Replicate_permanent(ring *Hash_Ring, table KeyValueTable) int {
+	failed := 0
+	iter := table.Iter()
+	for key, value, meta := iter.Next(); key != nil; key, value, meta = iter.Next() {
+		num_replicated_to := ring.ReplicateToPrimary(*key, value, meta)
+		if num_replicated_to != ring.replication_factor_of(*key) {
+			failed++
+		}
+	}
+	return failed
+}
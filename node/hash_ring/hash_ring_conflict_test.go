@@ -8,7 +8,7 @@ import (
 )
 
 func TestGetOfNonExistentValue(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(1), 1, 1, 1, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(1), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
 		hr.nodes[i].table = &table
@@ -16,7 +16,7 @@ func TestGetOfNonExistentValue(t *testing.T) {
 		hr.nodes[i].temporaryTable = &tempTable
 	}
 
-	var nil_string *string = nil
+	var nil_string []byte = nil
 	value, meta, err := hr.Get("foo")
 	assert.Nil(t, err)
 	assert.Equal(t, nil_string, value)
@@ -25,7 +25,7 @@ func TestGetOfNonExistentValue(t *testing.T) {
 }
 
 func TestPutNoConflict(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(1), 1, 1, 1, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(1), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
 		hr.nodes[i].table = &table
@@ -38,18 +38,48 @@ func TestPutNoConflict(t *testing.T) {
 	//get foo -> "moo"
 
 	meta := NewValueMeta(NewVectorClock())
-	hr.Add("foo", "moo", meta)
+	hr.Add("foo", []byte("moo"), meta)
 
 	value, get_meta, err := hr.Get("foo")
 	assert.Nil(t, err)
-	assert.Equal(t, "moo", *value)
+	assert.Equal(t, "moo", string(value))
 	assert.Equal(t, VectorClock{Counts: map[int]int{0: 1}}, get_meta.VectorClock)
 }
 
+type last_instance_resolution struct{}
+
+func (conflict *last_instance_resolution) Resolve(key string, values [][]byte, metas []*ValueMeta, nodes_position []uint64) int {
+	return len(values) - 1
+}
+
+func TestResolveEqualValues(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(1), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+
+	//an empty write and a concurrent delete hold the same bytes
+	written := &ValueMeta{VectorClock: VectorClock{Counts: map[int]int{0: 1}}, ContentType: "text/plain"}
+	tombstone := &ValueMeta{VectorClock: VectorClock{Counts: map[int]int{1: 1}}, Deleted: true}
+
+	value, meta := hr.resolve("foo", [][]byte{{}, {}}, []*ValueMeta{written, tombstone}, []uint64{})
+	assert.Equal(t, []byte{}, value)
+	assert.Equal(t, written, meta)
+
+	hr.conflict_resolution = &last_instance_resolution{}
+	value, meta = hr.resolve("foo", [][]byte{{}, {}}, []*ValueMeta{written, tombstone}, []uint64{})
+	assert.Equal(t, []byte{}, value)
+	assert.Equal(t, tombstone, meta)
+
+	//resolutions choosing by value still get the meta of the version they chose
+	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
+	hr.conflict_resolution = resolution
+	value, meta = hr.resolve("foo", [][]byte{[]byte("b"), []byte("a")}, []*ValueMeta{written, tombstone}, []uint64{})
+	assert.Equal(t, "a", string(value))
+	assert.Equal(t, tombstone, meta)
+}
+
 func TestPutConflictSameNode(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
 
-	hr := Hash_Ring{Generate_Nodes(1), 1, 1, 1, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(1), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: resolution, myId: 0}
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
 		hr.nodes[i].table = &table
@@ -64,20 +94,20 @@ func TestPutConflictSameNode(t *testing.T) {
 	//		  get foo -> car (0:2)
 
 	meta := NewValueMeta(NewVectorClock())
-	hr.Add("foo", "moo", meta)
+	hr.Add("foo", []byte("moo"), meta)
 
 	value, get_meta, err := hr.Get("foo")
 	assert.Nil(t, err)
-	assert.Equal(t, "moo", *value)
+	assert.Equal(t, "moo", string(value))
 	assert.Equal(t, VectorClock{Counts: map[int]int{0: 1}}, get_meta.VectorClock)
 
-	hr.Add("foo", "car", meta)
+	hr.Add("foo", []byte("car"), meta)
 
 	assert.Equal(t, true, resolution.Was_Called)
 
 	value, get_meta, err = hr.Get("foo")
 	assert.Nil(t, err)
-	assert.Equal(t, "car", *value)
+	assert.Equal(t, "car", string(value))
 	assert.Equal(t, VectorClock{Counts: map[int]int{0: 2}}, get_meta.VectorClock)
 }
 
@@ -86,8 +116,8 @@ func TestPutConflictDifferentNodeAddOverwrites(t *testing.T) {
 
 	positions := Generate_Ring_Positions(2)
 
-	hr1 := Hash_Ring{Generate_Nodes(2), 2, 2, 2, resolution, 0}
-	hr2 := Hash_Ring{Generate_Nodes(2), 2, 2, 2, resolution, 1}
+	hr1 := Hash_Ring{nodes: Generate_Nodes(2), replication_factor: 2, minimum_writes: 2, minimum_read: 2, conflict_resolution: resolution, myId: 0}
+	hr2 := Hash_Ring{nodes: Generate_Nodes(2), replication_factor: 2, minimum_writes: 2, minimum_read: 2, conflict_resolution: resolution, myId: 1}
 	permTable1 := NewInMemoryTable()
 	permTable2 := NewInMemoryTable()
 	tempTable1 := NewInMemoryTable()
@@ -122,11 +152,11 @@ func TestPutConflictDifferentNodeAddOverwrites(t *testing.T) {
 
 	meta := NewValueMeta(NewVectorClock())
 	resolution.Was_Called = false
-	hr1.Add("foo", "moo", meta)
+	hr1.Add("foo", []byte("moo"), meta)
 	assert.Equal(t, false, resolution.Was_Called)
 
 	resolution.Was_Called = false
-	hr2.Add("foo", "car", meta)
+	hr2.Add("foo", []byte("car"), meta)
 	assert.Equal(t, true, resolution.Was_Called)
 	//should have done a merge here
 
@@ -135,7 +165,7 @@ func TestPutConflictDifferentNodeAddOverwrites(t *testing.T) {
 	value, get_meta, err := hr1.Get("foo")
 	assert.Equal(t, false, resolution.Was_Called)
 	assert.Nil(t, err)
-	assert.Equal(t, "car", *value)
+	assert.Equal(t, "car", string(value))
 	assert_equal_vector_clocks(t, VectorClock{Counts: map[int]int{0: 1, 1: 1}}, get_meta.VectorClock)
 
 	resolution.Was_Called = false
@@ -144,7 +174,7 @@ func TestPutConflictDifferentNodeAddOverwrites(t *testing.T) {
 	value, get_meta, err = hr2.Get("foo")
 	assert.Equal(t, false, resolution.Was_Called)
 	assert.Nil(t, err)
-	assert.Equal(t, "car", *value)
+	assert.Equal(t, "car", string(value))
 	assert_equal_vector_clocks(t, VectorClock{Counts: map[int]int{0: 1, 1: 1}}, get_meta.VectorClock)
 }
 
@@ -153,8 +183,8 @@ func TestGetConflictDifferentNodeFromPartition(t *testing.T) {
 
 	positions := Generate_Ring_Positions(2)
 
-	hr1 := Hash_Ring{Generate_Nodes(2), 2, 2, 2, resolution, 0}
-	hr2 := Hash_Ring{Generate_Nodes(2), 2, 2, 2, resolution, 1}
+	hr1 := Hash_Ring{nodes: Generate_Nodes(2), replication_factor: 2, minimum_writes: 2, minimum_read: 2, conflict_resolution: resolution, myId: 0}
+	hr2 := Hash_Ring{nodes: Generate_Nodes(2), replication_factor: 2, minimum_writes: 2, minimum_read: 2, conflict_resolution: resolution, myId: 1}
 
 	//no temporary tables should be used
 	hr1.nodes[0].temporaryTable = &PanicTable{}
@@ -183,11 +213,11 @@ func TestGetConflictDifferentNodeFromPartition(t *testing.T) {
 
 	meta := NewValueMeta(NewVectorClock())
 	resolution.Was_Called = false
-	hr1.Add("foo", "moo", meta)
+	hr1.Add("foo", []byte("moo"), meta)
 	assert.Equal(t, false, resolution.Was_Called)
 
 	resolution.Was_Called = false
-	hr2.Add("foo", "car", meta)
+	hr2.Add("foo", []byte("car"), meta)
 	assert.Equal(t, false, resolution.Was_Called)
 
 	//repair network between rings
@@ -199,7 +229,7 @@ func TestGetConflictDifferentNodeFromPartition(t *testing.T) {
 	value, get_meta, err := hr1.Get("foo")
 	assert.Equal(t, true, resolution.Was_Called)
 	assert.Nil(t, err)
-	assert.Equal(t, "car", *value)
+	assert.Equal(t, "car", string(value))
 	assert_equal_vector_clocks(t, VectorClock{Counts: map[int]int{0: 2, 1: 1}}, get_meta.VectorClock)
 
 	resolution.Was_Called = false
@@ -208,6 +238,6 @@ func TestGetConflictDifferentNodeFromPartition(t *testing.T) {
 	value, get_meta, err = hr2.Get("foo")
 	assert.Equal(t, false, resolution.Was_Called)
 	assert.Nil(t, err)
-	assert.Equal(t, "car", *value)
+	assert.Equal(t, "car", string(value))
 	assert_equal_vector_clocks(t, VectorClock{Counts: map[int]int{0: 2, 1: 1}}, get_meta.VectorClock)
 }
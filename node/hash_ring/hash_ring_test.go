@@ -11,28 +11,28 @@ import (
 )
 
 func SimpleHashRingDefaultTest(t *testing.T, hr *Hash_Ring) {
-	var nil_string *string = nil
+	var nil_string []byte = nil
 
 	assert.Greater(t, uint64(18446744073709551615)/2, Hash("bar"))
 	assert.Less(t, uint64(18446744073709551615)/2, Hash("foo"))
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.Add("bar", "bar", &value_meta)
-	hr.Add("foo", "mar", &value_meta)
+	hr.Add("bar", []byte("bar"), &value_meta)
+	hr.Add("foo", []byte("mar"), &value_meta)
 
 	val, _, _ := hr.Get("bar")
-	assert.Equal(t, "bar", *val)
+	assert.Equal(t, "bar", string(val))
 
 	val, _, _ = hr.Get("foo")
-	assert.Equal(t, "mar", *val)
+	assert.Equal(t, "mar", string(val))
 
 	val, _, _ = hr.Get("far")
 	assert.Equal(t, nil_string, val)
 }
 
 func TestAddGetSomeData(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 1, 1, 1, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
 		hr.nodes[i].table = &table
@@ -74,7 +74,7 @@ func TestCorrectVirtualNodeBoundsGenerated(t *testing.T) {
 }
 
 func TestDataSpreadsOut(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 1, 1, 1, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
 		hr.nodes[i].table = &table
@@ -85,7 +85,7 @@ func TestDataSpreadsOut(t *testing.T) {
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
 	for i := 0; i < 10000; i++ {
-		hr.Add(fmt.Sprintf("%f{.9}", math.Cos(float64(i))), strconv.Itoa(i), &value_meta)
+		hr.Add(fmt.Sprintf("%f{.9}", math.Cos(float64(i))), []byte(strconv.Itoa(i)), &value_meta)
 	}
 
 	for _, node := range hr.nodes {
@@ -131,7 +131,7 @@ func ReplicatedMatchesIds(t *testing.T, nodes []Node, key string) []int {
 }
 
 func TestReplicateAllSuccessfully(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -147,7 +147,7 @@ func TestReplicateAllSuccessfully(t *testing.T) {
 }
 
 func TestReplicateAllSuccessfullyVirtual(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes_With_Virtual(5, []int{2, 2, 2, 2, 2}), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes_With_Virtual(5, []int{2, 2, 2, 2, 2}), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -170,14 +170,14 @@ type DelayAddTable struct {
 	wait_chan chan bool
 }
 
-func (t *DelayAddTable) Add(key string, value string, meta *ValueMeta) error {
+func (t *DelayAddTable) Add(key string, value []byte, meta *ValueMeta) error {
 	<-t.wait_chan
 	result := t.table.Add(key, value, meta)
 	t.wait_chan <- true
 	return result
 }
 
-func (t *DelayAddTable) Get(key string) (*string, *ValueMeta, error) {
+func (t *DelayAddTable) Get(key string) ([]byte, *ValueMeta, error) {
 	return t.table.Get(key)
 }
 
@@ -194,7 +194,7 @@ func (t *DelayAddTable) Erase(key string) {
 }
 
 func TestReplicateAllSuccessfullySlowNode(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 2, 2, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 2, minimum_read: 2, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -207,7 +207,7 @@ func TestReplicateAllSuccessfullySlowNode(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.Add("bar", "mar", &value_meta)
+	hr.Add("bar", []byte("mar"), &value_meta)
 
 	assert.Equal(t, []int{1, 2}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
 	slow_table.wait_chan <- true //send update
@@ -216,7 +216,7 @@ func TestReplicateAllSuccessfullySlowNode(t *testing.T) {
 }
 
 func TestReplicateSinglePartialFailure(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -229,13 +229,13 @@ func TestReplicateSinglePartialFailure(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.Add("bar", "mar", &value_meta)
+	hr.Add("bar", []byte("mar"), &value_meta)
 
 	assert.Equal(t, []int{1, 2, 3}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
 }
 
 func TestReplicateSinglePartialFailureVirtual(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes_With_Virtual(5, []int{2, 2, 2, 2, 2}), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes_With_Virtual(5, []int{2, 2, 2, 2, 2}), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -248,14 +248,14 @@ func TestReplicateSinglePartialFailureVirtual(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.Add("bar", "mar", &value_meta)
+	hr.Add("bar", []byte("mar"), &value_meta)
 	//normally "bar" is on 0,1,2, but since 0 fails it will be on 1,2,3
 	assert.Equal(t, []int{1, 2, 3}, ReplicatedMatchesIds(t, hr.nodes, "bar"))
 	assert.Equal(t, []int{2, 4, 6}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
 }
 
 func TestReplicateMultiplePartialFailure(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -270,13 +270,13 @@ func TestReplicateMultiplePartialFailure(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.Add("bar", "mar", &value_meta)
+	hr.Add("bar", []byte("mar"), &value_meta)
 
 	assert.Equal(t, []int{2, 3, 4}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
 }
 
 func TestReplicateFullFailureSomeCommit(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	error_table := ErrorTable{}
 
@@ -290,19 +290,19 @@ func TestReplicateFullFailureSomeCommit(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	err := hr.Add("bar", "mar", &value_meta)
+	err := hr.Add("bar", []byte("mar"), &value_meta)
 
 	assert.NotNil(t, err)
 
 	val, _, _ := memory_table1.Get("bar")
-	assert.Equal(t, "mar", *val)
+	assert.Equal(t, "mar", string(val))
 
 	val, _, _ = memory_table2.Get("bar")
-	assert.Equal(t, "mar", *val)
+	assert.Equal(t, "mar", string(val))
 }
 
 func TestReplicateFullFailure(t *testing.T) {
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, &ConflictResolutionFirstInstance{}, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
 
 	error_table := ErrorTable{}
 	for i := range hr.nodes {
@@ -312,7 +312,7 @@ func TestReplicateFullFailure(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	err := hr.Add("bar", "mar", &value_meta)
+	err := hr.Add("bar", []byte("mar"), &value_meta)
 	assert.NotNil(t, err)
 }
 
@@ -322,29 +322,29 @@ type SavePositionConflictResolution struct {
 	Was_Called      bool
 }
 
-func (conflict *SavePositionConflictResolution) Resolve(key string, values []*string, metas []*ValueMeta, nodes_position []uint64) *string {
+func (conflict *SavePositionConflictResolution) Resolve(key string, values [][]byte, metas []*ValueMeta, nodes_position []uint64) int {
 	sort.SliceStable(nodes_position, func(i, j int) bool {
 		return nodes_position[i] < nodes_position[j]
 	})
 	conflict.Nodes_positions = nodes_position
 	conflict.Values = make([]string, len(values))
 	for i := range values {
-		if values[i] == nil {
-			conflict.Values[i] = ""
-		} else {
-			conflict.Values[i] = *values[i]
-		}
+		conflict.Values[i] = string(values[i])
 	}
 	conflict.Was_Called = true
-	sort.SliceStable(values, func(i, j int) bool {
-		return *values[i] < *values[j]
-	})
-	return values[0]
+	//picks alphabetically
+	first := 0
+	for i := range values {
+		if string(values[i]) < string(values[first]) {
+			first = i
+		}
+	}
+	return first
 }
 
 func TestRetrieveAllSuccessfully(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -355,9 +355,9 @@ func TestRetrieveAllSuccessfully(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.nodes[0].Add("bar", "mar", &value_meta)
-	hr.nodes[1].Add("bar", "mar", &value_meta)
-	hr.nodes[2].Add("bar", "mar", &value_meta)
+	hr.nodes[0].Add("bar", []byte("mar"), &value_meta)
+	hr.nodes[1].Add("bar", []byte("mar"), &value_meta)
+	hr.nodes[2].Add("bar", []byte("mar"), &value_meta)
 
 	hr.Get("bar")
 
@@ -368,7 +368,7 @@ func TestRetrieveAllSuccessfully(t *testing.T) {
 
 func TestRetrievePartialSuccessfully(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -382,9 +382,9 @@ func TestRetrievePartialSuccessfully(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.nodes[0].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[1].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[3].AddTemporary("bar", "mar", &value_meta)
+	hr.nodes[0].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[1].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[3].AddTemporary("bar", []byte("mar"), &value_meta)
 
 	hr.Get("bar")
 
@@ -395,7 +395,7 @@ func TestRetrievePartialSuccessfully(t *testing.T) {
 
 func TestRetrievePartialFailure(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	error_table := ErrorTable{}
 	for i := range hr.nodes {
@@ -416,7 +416,7 @@ func TestRetrievePartialFailure(t *testing.T) {
 
 func TestRetrieveFullFailure(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	for i := range hr.nodes {
 		tempTable := NewInMemoryTable()
@@ -437,7 +437,7 @@ func TestRetrieveFullFailure(t *testing.T) {
 
 func TestReplicateToPrimaryFull(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -448,7 +448,7 @@ func TestReplicateToPrimaryFull(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	replicated_to := hr.ReplicateToPrimary("foo", "mar", &value_meta)
+	replicated_to := hr.ReplicateToPrimary("foo", []byte("mar"), &value_meta)
 
 	assert.Equal(t, 3, replicated_to)
 
@@ -461,7 +461,7 @@ func TestReplicateToPrimaryFull(t *testing.T) {
 
 func TestReplicateToPrimaryPartial(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	for i := range hr.nodes {
 		table := NewInMemoryTable()
@@ -475,7 +475,7 @@ func TestReplicateToPrimaryPartial(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	replicated_to := hr.ReplicateToPrimary("foo", "mar", &value_meta)
+	replicated_to := hr.ReplicateToPrimary("foo", []byte("mar"), &value_meta)
 
 	assert.Equal(t, 2, replicated_to)
 
@@ -488,7 +488,7 @@ func TestReplicateToPrimaryPartial(t *testing.T) {
 
 func TestRetrievePartialSuccessfullyRecovery(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	tempTable := NewInMemoryTable()
 	for i := range hr.nodes {
@@ -499,9 +499,9 @@ func TestRetrievePartialSuccessfullyRecovery(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.nodes[0].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[1].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[3].AddTemporary("bar", "mar", &value_meta)
+	hr.nodes[0].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[1].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[3].AddTemporary("bar", []byte("mar"), &value_meta)
 
 	Cleanup_temporary(&hr, &tempTable)
 
@@ -513,13 +513,13 @@ func TestRetrievePartialSuccessfullyRecovery(t *testing.T) {
 
 	val, _, err := hr.nodes[3].Get("bar", false)
 	assert.Nil(t, err)
-	var nil_string *string = nil
+	var nil_string []byte = nil
 	assert.Equal(t, nil_string, val)
 }
 
 func TestRetrievePartialUnsuccessfullyRecovery(t *testing.T) {
 	resolution := &SavePositionConflictResolution{[]uint64{}, []string{}, false}
-	hr := Hash_Ring{Generate_Nodes(5), 3, 3, 3, resolution, 0}
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: resolution, myId: 0}
 
 	tempTable := NewInMemoryTable()
 	for i := range hr.nodes {
@@ -534,9 +534,9 @@ func TestRetrievePartialUnsuccessfullyRecovery(t *testing.T) {
 
 	value_meta := ValueMeta{VectorClock: NewVectorClock()}
 
-	hr.nodes[0].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[1].AddPermanent("bar", "mar", &value_meta)
-	hr.nodes[3].AddTemporary("bar", "mar", &value_meta)
+	hr.nodes[0].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[1].AddPermanent("bar", []byte("mar"), &value_meta)
+	hr.nodes[3].AddTemporary("bar", []byte("mar"), &value_meta)
 
 	var partition_size uint64 = uint64(18446744073709551615) / 5
 
@@ -554,5 +554,223 @@ func TestRetrievePartialUnsuccessfullyRecovery(t *testing.T) {
 
 	val, _, err := hr.nodes[3].Get("bar", false)
 	assert.Nil(t, err)
-	assert.Equal(t, "mar", *val)
+	assert.Equal(t, "mar", string(val))
+}
+
+func TestValidateQuorum(t *testing.T) {
+	warnings, err := Validate_Quorum(3, 2, 2, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warnings))
+
+	warnings, err = Validate_Quorum(3, 1, 1, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(warnings))
+
+	_, err = Validate_Quorum(3, 4, 1, 5)
+	assert.NotNil(t, err)
+
+	_, err = Validate_Quorum(6, 1, 1, 5)
+	assert.NotNil(t, err)
+}
+
+func TestRaiseReplicationFactorBackfill(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	value_meta := ValueMeta{VectorClock: NewVectorClock()}
+	hr.Add("bar", []byte("mar"), &value_meta)
+	assert.Equal(t, []int{0}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
+
+	//reads stay on the single populated replica until back filled
+	assert.Nil(t, hr.SetQuorum(3, 2, 2, 1))
+	read_replication_factor, minimum_read := hr.read_quorum()
+	assert.Equal(t, 1, read_replication_factor)
+	assert.Equal(t, 1, minimum_read)
+
+	failed := Replicate_permanent(&hr, hr.nodes[0].table)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, []int{0, 1, 2}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
+
+	assert.Nil(t, hr.SetQuorum(3, 2, 2, 0))
+	read_replication_factor, minimum_read = hr.read_quorum()
+	assert.Equal(t, 3, read_replication_factor)
+	assert.Equal(t, 2, minimum_read)
+
+	val, _, err := hr.Get("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "mar", string(val))
+}
+
+func TestBackfillKeepsNewerWrites(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	snapshot := ValueMeta{VectorClock: NewVectorClock()}
+	snapshot.VectorClock.Add(0)
+	assert.Nil(t, hr.Add("bar", []byte("mar"), &snapshot))
+	//a client write landing after the back fill read the key
+	newer := ValueMeta{VectorClock: snapshot.VectorClock.Copy()}
+	newer.VectorClock.Add(0)
+	assert.Nil(t, hr.Add("bar", []byte("car"), &newer))
+
+	assert.Equal(t, 3, hr.ReplicateToPrimary("bar", []byte("mar"), &snapshot))
+	for _, i := range ReplicatedMatchesIndexes(t, hr.nodes, "bar") {
+		value, meta, _ := hr.nodes[i].GetPermanent("bar")
+		assert.Equal(t, "car", string(value))
+		assert.True(t, meta.VectorClock.Descends(&newer.VectorClock))
+	}
+}
+
+func TestReducedReadFallsBackToPrimary(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	value_meta := ValueMeta{VectorClock: NewVectorClock()}
+	assert.Nil(t, hr.Add("bar", []byte("mar"), &value_meta))
+	assert.Nil(t, hr.SetQuorum(3, 3, 1, 1))
+
+	//the next primary is read in place of the failed one, from its permanent table
+	hr.nodes[0].table = &ErrorTable{}
+	val, _, err := hr.Get("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "mar", string(val))
+}
+
+func TestReplicateAcrossZones(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	zones := []string{"a", "a", "b", "b", "c"}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+		hr.nodes[i].SetLocation(zones[i], "")
+	}
+
+	value_meta := ValueMeta{VectorClock: NewVectorClock()}
+	hr.Add("bar", []byte("mar"), &value_meta)
+
+	//without zones "bar" is on 0,1,2
+	assert.Equal(t, []int{0, 2, 4}, ReplicatedMatchesIndexes(t, hr.nodes, "bar"))
+	assert.Equal(t, []int{0, 2, 4, 1, 3}, hr.preference_list(Hash("bar"), 3))
+}
+
+func TestReplicateAcrossRacksWhenZonesRunOut(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(4), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	zones := []string{"a", "a", "a", "b"}
+	racks := []string{"1", "1", "2", "1"}
+	for i := range hr.nodes {
+		hr.nodes[i].SetLocation(zones[i], racks[i])
+	}
+
+	assert.Equal(t, []int{0, 3, 2, 1}, hr.preference_list(Hash("bar"), 3))
+}
+
+func TestWeightedNodesOwnership(t *testing.T) {
+	assert.Equal(t, []int{2, 4, 2}, Virtual_Node_Counts([]int{1, 2, 1}, 2))
+	assert.Equal(t, []int{1, 0, 1, 2}, Weighted_Order([]int{1, 2, 1}))
+
+	nodes := Generate_Nodes_With_Weights([]int{1, 2, 1}, 4)
+	assert.Equal(t, 16, len(nodes))
+
+	hr := Hash_Ring{nodes: nodes, replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	ownership := hr.Ownership()
+	assert.InDelta(t, 0.25, ownership[0], 0.0001)
+	assert.InDelta(t, 0.5, ownership[1], 0.0001)
+	assert.InDelta(t, 0.25, ownership[2], 0.0001)
+
+	//no two neighbouring virtual nodes belong to the same physical node
+	for i := 1; i < len(nodes); i++ {
+		assert.NotEqual(t, nodes[i-1].physical_id, nodes[i].physical_id)
+	}
+}
+
+func TestDeleteLeavesTombstone(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock()))
+	_, meta, err := hr.Get("bar")
+	assert.Nil(t, err)
+
+	assert.Nil(t, hr.Delete("bar", meta))
+	value, meta, err := hr.Get("bar")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	assert.True(t, meta.Deleted)
+	assert.Equal(t, 2, meta.VectorClock.Get(0))
+
+	//writing with the tombstone's context brings the key back
+	assert.Nil(t, hr.Add("bar", []byte("car"), meta))
+	value, _, _ = hr.Get("bar")
+	assert.Equal(t, "car", string(value))
+}
+
+func TestAddCausalRejectsStaleContext(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock()))
+	_, first_meta, _ := hr.Get("bar")
+	assert.Nil(t, hr.AddCausal("bar", []byte("car"), first_meta))
+
+	err := hr.AddCausal("bar", []byte("jar"), first_meta)
+	var conflict *ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "car", string(conflict.Value))
+	assert.Equal(t, 2, conflict.Meta.VectorClock.Get(0))
+}
+
+func TestAddIfRequiresExactVersion(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	//an empty context only matches a missing key
+	assert.Nil(t, hr.AddIf("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	err := hr.AddIf("bar", []byte("car"), NewValueMeta(NewVectorClock()))
+	var failed *PreconditionFailedError
+	assert.ErrorAs(t, err, &failed)
+	assert.Equal(t, "mar", string(failed.Value))
+
+	assert.Nil(t, hr.AddIf("bar", []byte("car"), failed.Meta))
+
+	//a context that has seen more than the current version is not the current version either
+	ahead := NewValueMeta(NewVectorClock())
+	ahead.VectorClock.Counts[0] = 5
+	assert.ErrorAs(t, hr.AddIf("bar", []byte("jar"), ahead), &failed)
+	assert.ErrorAs(t, hr.DeleteIf("bar", ahead), &failed)
+
+	assert.Nil(t, hr.DeleteIf("bar", failed.Meta))
+	value, _, _ := hr.Get("bar")
+	assert.Nil(t, value)
 }
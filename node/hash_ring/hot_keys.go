@@ -0,0 +1,163 @@
+package hash_ring
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+const Default_hot_keys_capacity = 128
+
+// Hot_keys_decay_interval is how often the counts of hot keys are halved, so keys that stop being accessed cool down
+const Hot_keys_decay_interval = time.Minute
+
+// HotKey is the estimated number of accesses of a stored key, which over counts by at most Error
+type HotKey struct {
+	Key   string
+	Count uint64
+	Error uint64
+}
+
+// HotKeys estimates the most accessed keys with the space saving sketch, tracking a fixed number of keys.
+// An untracked key replaces the least accessed one, inheriting its count as the error of its own
+type HotKeys struct {
+	capacity int
+	tracked  map[string]*hot_key_counter
+	//least accessed first
+	by_count hot_key_heap
+	lock     sync.Mutex
+}
+
+type hot_key_counter struct {
+	HotKey
+	index int
+}
+
+type hot_key_heap []*hot_key_counter
+
+func (h hot_key_heap) Len() int           { return len(h) }
+func (h hot_key_heap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h hot_key_heap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hot_key_heap) Push(counter any) {
+	counter.(*hot_key_counter).index = len(*h)
+	*h = append(*h, counter.(*hot_key_counter))
+}
+
+func (h *hot_key_heap) Pop() any {
+	old := *h
+	counter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return counter
+}
+
+func NewHotKeys(capacity int) *HotKeys {
+	if capacity <= 0 {
+		capacity = Default_hot_keys_capacity
+	}
+	return &HotKeys{capacity: capacity, tracked: make(map[string]*hot_key_counter)}
+}
+
+// Record counts an access of the stored key
+func (hot_keys *HotKeys) Record(key string) {
+	defer hot_keys.lock.Unlock()
+	hot_keys.lock.Lock()
+	if counter, is_tracked := hot_keys.tracked[key]; is_tracked {
+		counter.Count++
+		heap.Fix(&hot_keys.by_count, counter.index)
+		return
+	}
+	if len(hot_keys.by_count) < hot_keys.capacity {
+		counter := &hot_key_counter{HotKey: HotKey{Key: key, Count: 1}}
+		hot_keys.tracked[key] = counter
+		heap.Push(&hot_keys.by_count, counter)
+		return
+	}
+	//the least accessed key makes way, the new key may have been accessed as often while untracked
+	counter := hot_keys.by_count[0]
+	delete(hot_keys.tracked, counter.Key)
+	counter.Key = key
+	counter.Error = counter.Count
+	counter.Count++
+	hot_keys.tracked[key] = counter
+	heap.Fix(&hot_keys.by_count, 0)
+}
+
+// Top gives up to n of the most accessed keys, most accessed first
+func (hot_keys *HotKeys) Top(n int) []HotKey {
+	hot_keys.lock.Lock()
+	top := make([]HotKey, len(hot_keys.by_count))
+	for i, counter := range hot_keys.by_count {
+		top[i] = counter.HotKey
+	}
+	hot_keys.lock.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Decay halves every count, forgetting keys no longer accessed
+func (hot_keys *HotKeys) Decay() {
+	defer hot_keys.lock.Unlock()
+	hot_keys.lock.Lock()
+	kept := hot_key_heap{}
+	for _, counter := range hot_keys.by_count {
+		counter.Count /= 2
+		counter.Error /= 2
+		if counter.Count == 0 {
+			delete(hot_keys.tracked, counter.Key)
+			continue
+		}
+		kept = append(kept, counter)
+	}
+	for i := range kept {
+		kept[i].index = i
+	}
+	heap.Init(&kept)
+	hot_keys.by_count = kept
+}
+
+// Start_decay decays the hot keys every interval until stop is closed
+func Start_decay(hot_keys *HotKeys, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				hot_keys.Decay()
+			}
+		}
+	}()
+}
+
+// SetHotKeys records the keys of reads and writes coordinated by this node in hot_keys, nil stops recording
+func (ring *Hash_Ring) SetHotKeys(hot_keys *HotKeys) {
+	ring.hot_keys = hot_keys
+}
+
+// HotKeys is the sketch accesses are recorded in, nil when they aren't
+func (ring *Hash_Ring) HotKeys() *HotKeys {
+	return ring.hot_keys
+}
+
+func (ring *Hash_Ring) record_access(key string) {
+	if ring.hot_keys != nil {
+		ring.hot_keys.Record(key)
+	}
+}
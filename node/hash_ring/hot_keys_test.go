@@ -0,0 +1,44 @@
+package hash_ring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotKeys(t *testing.T) {
+	hot_keys := NewHotKeys(2)
+	for i := 0; i < 5; i++ {
+		hot_keys.Record("a")
+	}
+	for i := 0; i < 3; i++ {
+		hot_keys.Record("b")
+	}
+	//c replaces b, the least accessed, inheriting its count as its error
+	hot_keys.Record("c")
+	assert.Equal(t, []HotKey{{"a", 5, 0}, {"c", 4, 3}}, hot_keys.Top(10))
+	assert.Equal(t, []HotKey{{"a", 5, 0}}, hot_keys.Top(1))
+
+	hot_keys.Decay()
+	assert.Equal(t, []HotKey{{"a", 2, 0}, {"c", 2, 1}}, hot_keys.Top(10))
+	hot_keys.Decay()
+	hot_keys.Decay()
+	assert.Equal(t, 0, len(hot_keys.Top(10)))
+	hot_keys.Record("b")
+	assert.Equal(t, []HotKey{{"b", 1, 0}}, hot_keys.Top(10))
+
+	assert.Equal(t, Default_hot_keys_capacity, NewHotKeys(0).capacity)
+}
+
+func TestRingRecordsHotKeys(t *testing.T) {
+	hr := metrics_test_ring(4)
+	hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock()))
+	assert.Nil(t, hr.HotKeys())
+
+	hr.SetHotKeys(NewHotKeys(10))
+	hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock()))
+	hr.Get("bar")
+	hr.MultiAdd([]string{"bar", "foo"}, [][]byte{[]byte("car"), []byte("far")}, []*ValueMeta{NewValueMeta(NewVectorClock()), NewValueMeta(NewVectorClock())})
+	hr.MultiGet([]string{Bucket_Key("users", "foo")})
+	assert.Equal(t, []HotKey{{"bar", 3, 0}, {Bucket_Key("users", "foo"), 1, 0}, {"foo", 1, 0}}, hr.HotKeys().Top(10))
+}
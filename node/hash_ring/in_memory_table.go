@@ -1,9 +1,14 @@
 package hash_ring
 
-import "sync"
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
 type Value struct {
-	value string
+	value []byte
 	meta  ValueMeta
 }
 
@@ -14,19 +19,20 @@ type InMemoryTable struct {
 
 func NewInMemoryTable() InMemoryTable { return InMemoryTable{make(map[string]Value), sync.Mutex{}} }
 
-func (t *InMemoryTable) Add(key string, value string, meta *ValueMeta) error {
+func (t *InMemoryTable) Add(key string, value []byte, meta *ValueMeta) error {
 	defer t.lock.Unlock()
 	t.lock.Lock()
-	t.data[key] = Value{value: value, meta: *meta}
+	//copied so callers can reuse their buffers, and so a stored empty value is never nil
+	t.data[key] = Value{value: append([]byte{}, value...), meta: *meta}
 	return nil
 }
 
-func (t *InMemoryTable) Get(key string) (*string, *ValueMeta, error) {
+func (t *InMemoryTable) Get(key string) ([]byte, *ValueMeta, error) {
 	defer t.lock.Unlock()
 	t.lock.Lock()
 	value, success := t.data[key]
 	if success {
-		return &value.value, &value.meta, nil
+		return value.value, &value.meta, nil
 	} else {
 		return nil, NewValueMeta(NewVectorClock()), nil
 	}
@@ -41,27 +47,76 @@ func (t *InMemoryTable) Size() int {
 type iterator struct {
 	current_index int
 	keys          []string
-	data          map[string]Value
+	table         *InMemoryTable
 }
 
-func (t *iterator) Next() (*string, *string, *ValueMeta) {
-	t.current_index++
-	if t.current_index < len(t.data) {
+func (t *iterator) Next() (*string, []byte, *ValueMeta) {
+	defer t.table.lock.Unlock()
+	t.table.lock.Lock()
+	for t.current_index++; t.current_index < len(t.keys); t.current_index++ {
 		key := t.keys[t.current_index]
-		value := t.data[key]
-		return &key, &value.value, &value.meta
-	} else {
-		return nil, nil, nil
+		//keys erased since the iterator was created are skipped
+		value, exists := t.table.data[key]
+		if exists {
+			return &key, value.value, &value.meta
+		}
 	}
+	return nil, nil, nil
 }
 
 func (t *InMemoryTable) Iter() KeyValueIterator {
+	defer t.lock.Unlock()
+	t.lock.Lock()
 	keys := make([]string, 0, len(t.data))
 	for k := range t.data {
 		keys = append(keys, k)
 	}
+	//iterating in key order keeps scans and their pages stable
+	sort.Strings(keys)
+
+	return &iterator{-1, keys, t}
+}
 
-	return &iterator{-1, keys, t.data}
+// Scan returns up to limit keys starting with prefix, from start onwards in key order
+func (t *InMemoryTable) Scan(prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error) {
+	defer t.lock.Unlock()
+	t.lock.Lock()
+	keys := []string{}
+	for k := range t.data {
+		if strings.HasPrefix(k, prefix) && k >= start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	values := make([][]byte, len(keys))
+	metas := make([]*ValueMeta, len(keys))
+	for i := range keys {
+		value := t.data[keys[i]]
+		values[i] = value.value
+		metas[i] = &value.meta
+	}
+	return keys, values, metas, nil
+}
+
+func (t *InMemoryTable) IsLocal() bool {
+	return true
+}
+
+func (t *InMemoryTable) Sweep(expired_before time.Time) int {
+	defer t.lock.Unlock()
+	t.lock.Lock()
+	swept := 0
+	for key, value := range t.data {
+		if value.meta.Expired(expired_before) {
+			delete(t.data, key)
+			swept++
+		}
+	}
+	return swept
 }
 
 func (t *InMemoryTable) Erase(key string) {
@@ -0,0 +1,51 @@
+package hash_ring
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/metrics"
+)
+
+var add_seconds = metrics.Default.NewHistogram("kdb_ring_add_seconds", "Time taken by writes coordinated by this node to reach their quorum", metrics.Latency_buckets)
+var get_seconds = metrics.Default.NewHistogram("kdb_ring_get_seconds", "Time taken by reads coordinated by this node to reach their quorum", metrics.Latency_buckets)
+var quorum_failures = metrics.Default.NewCounter("kdb_ring_quorum_failures_total", "Requests coordinated by this node that could not reach their quorum", "operation")
+var hinted_writes = metrics.Default.NewCounter("kdb_ring_hinted_writes_total", "Keys written to a fallback node's temporary table in place of a primary replica")
+var read_repairs = metrics.Default.NewCounter("kdb_ring_read_repairs_total", "Out of date replicas updated by reads")
+var conflicts_resolved = metrics.Default.NewCounter("kdb_ring_conflicts_resolved_total", "Concurrent versions merged by conflict resolution")
+
+// record_quorum counts a request of the operation that failed its quorum
+func record_quorum(operation string, err error) {
+	if errors.Is(err, ErrQuorumNotMet) || errors.Is(err, ErrNoNodes) {
+		quorum_failures.Inc(operation)
+	}
+}
+
+func seconds_since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Register_table_sizes reports the number of keys in the local tables of each virtual node of the ring when metrics
+// are written. Virtual nodes of a physical node may share a temporary table, it is reported under the first
+func Register_table_sizes(registry *metrics.Registry, ring *Hash_Ring) {
+	report_tables := func(temporary bool) func(report func(value float64, label_values ...string)) {
+		return func(report func(value float64, label_values ...string)) {
+			reported := make(map[KeyValueTable]bool)
+			for i := range ring.nodes {
+				table := ring.nodes[i].table
+				if temporary {
+					table = ring.nodes[i].temporaryTable
+				}
+				//only tables holding their values locally know their size
+				if !Is_Local_Table(table) || reported[table] {
+					continue
+				}
+				reported[table] = true
+				report(float64(table.Size()), strconv.FormatUint(ring.nodes[i].position, 10))
+			}
+		}
+	}
+	registry.NewGaugeFunc("kdb_permanent_table_keys", "Keys stored in the permanent table of each local virtual node", []string{"node"}, report_tables(false))
+	registry.NewGaugeFunc("kdb_temporary_table_keys", "Hinted keys held for other nodes in each local temporary table", []string{"node"}, report_tables(true))
+}
@@ -0,0 +1,52 @@
+package hash_ring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func metrics_test_ring(number_of_nodes int) Hash_Ring {
+	nodes := Generate_Nodes(number_of_nodes)
+	for i := range nodes {
+		table := NewInMemoryTable()
+		temp_table := NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	return New(nodes, 3, 3, 3, &ConflictResolutionFirstInstance{})
+}
+
+func TestRingMetrics(t *testing.T) {
+	hr := metrics_test_ring(4)
+	primaries := hr.primary_nodes(hr.KeyHash("bar"))
+
+	hinted := hinted_writes.Value()
+	hr.nodes[primaries[0]].table = &ErrorTable{}
+	assert.Nil(t, hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	assert.Equal(t, hinted+1, hinted_writes.Value())
+
+	failures := quorum_failures.Value("add")
+	for i := range hr.nodes {
+		hr.nodes[i].table = &ErrorTable{}
+		hr.nodes[i].temporaryTable = &ErrorTable{}
+	}
+	assert.NotNil(t, hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	assert.Equal(t, failures+1, quorum_failures.Value("add"))
+
+	//a replica holding an older version is repaired by reads
+	hr = metrics_test_ring(3)
+	assert.Nil(t, hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	_, meta, _ := hr.nodes[0].GetPermanent("bar")
+	newer := meta.Copy()
+	newer.VectorClock.Add(5)
+	hr.nodes[1].AddPermanent("bar", []byte("car"), newer)
+	hr.nodes[2].AddPermanent("bar", []byte("car"), newer)
+	repairs := read_repairs.Value()
+	reads := get_seconds.Count()
+	value, _, err := hr.Get("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "car", string(value))
+	assert.Equal(t, repairs+1, read_repairs.Value())
+	assert.Equal(t, reads+1, get_seconds.Count())
+}
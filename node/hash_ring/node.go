@@ -5,10 +5,12 @@ type Node struct {
 	table          KeyValueTable
 	temporaryTable KeyValueTable
 	physical_id    uint64
+	zone           string
+	rack           string
 }
 
 func NewNode(position KeyHash, table KeyValueTable, temporaryTable KeyValueTable, physical_id uint64) Node {
-	return Node{position, table, temporaryTable, physical_id}
+	return Node{position, table, temporaryTable, physical_id, "", ""}
 }
 
 func (n *Node) GetTable() KeyValueTable {
@@ -27,6 +29,20 @@ func (n *Node) GetPhysicalId() uint64 {
 	return n.physical_id
 }
 
+func (n *Node) GetZone() string {
+	return n.zone
+}
+
+func (n *Node) GetRack() string {
+	return n.rack
+}
+
+// SetLocation labels the node with the zone and rack of its physical machine, used to spread replicas
+func (n *Node) SetLocation(zone string, rack string) {
+	n.zone = zone
+	n.rack = rack
+}
+
 func (n *Node) SetTable(table KeyValueTable) {
 	n.table = table
 }
@@ -35,19 +51,19 @@ func (n *Node) SetTemporaryTable(temporaryTable KeyValueTable) {
 	n.temporaryTable = temporaryTable
 }
 
-func (n *Node) Add(key string, value string, meta *ValueMeta) error {
+func (n *Node) Add(key string, value []byte, meta *ValueMeta) error {
 	return n.AddPermanent(key, value, meta)
 }
 
-func (n *Node) AddPermanent(key string, value string, meta *ValueMeta) error {
+func (n *Node) AddPermanent(key string, value []byte, meta *ValueMeta) error {
 	return n.table.Add(key, value, meta)
 }
 
-func (n *Node) AddTemporary(key string, value string, meta *ValueMeta) error {
+func (n *Node) AddTemporary(key string, value []byte, meta *ValueMeta) error {
 	return n.temporaryTable.Add(key, value, meta)
 }
 
-func (n *Node) GetEither(key string) (*string, *ValueMeta, error) {
+func (n *Node) GetEither(key string) ([]byte, *ValueMeta, error) {
 	val, meta, err := n.GetPermanent(key)
 	if err == nil && val != nil {
 		return val, meta, err
@@ -56,7 +72,7 @@ func (n *Node) GetEither(key string) (*string, *ValueMeta, error) {
 	}
 }
 
-func (n *Node) Get(key string, usePermanent bool) (*string, *ValueMeta, error) {
+func (n *Node) Get(key string, usePermanent bool) ([]byte, *ValueMeta, error) {
 	if usePermanent {
 		return n.GetPermanent(key)
 	} else {
@@ -64,10 +80,34 @@ func (n *Node) Get(key string, usePermanent bool) (*string, *ValueMeta, error) {
 	}
 }
 
-func (n *Node) GetPermanent(key string) (*string, *ValueMeta, error) {
+func (n *Node) GetPermanent(key string) ([]byte, *ValueMeta, error) {
 	return n.table.Get(key)
 }
 
-func (n *Node) GetTemporary(key string) (*string, *ValueMeta, error) {
+func (n *Node) GetTemporary(key string) ([]byte, *ValueMeta, error) {
 	return n.temporaryTable.Get(key)
 }
+
+func (n *Node) MultiAdd(keys []string, values [][]byte, metas []*ValueMeta, usePermanent bool) error {
+	if usePermanent {
+		return multi_add(n.table, keys, values, metas)
+	} else {
+		return multi_add(n.temporaryTable, keys, values, metas)
+	}
+}
+
+func (n *Node) MultiGet(keys []string, usePermanent bool) ([][]byte, []*ValueMeta, error) {
+	if usePermanent {
+		return multi_get(n.table, keys)
+	} else {
+		return multi_get(n.temporaryTable, keys)
+	}
+}
+
+func (n *Node) Scan(prefix string, start string, limit int, usePermanent bool) ([]string, [][]byte, []*ValueMeta, error) {
+	if usePermanent {
+		return scan_table(n.table, prefix, start, limit)
+	} else {
+		return scan_table(n.temporaryTable, prefix, start, limit)
+	}
+}
@@ -0,0 +1,107 @@
+package hash_ring
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Partitioner places keys on the ring. Every node of a cluster must use the same partitioner
+type Partitioner interface {
+	Name() string
+	//positions are the sorted positions of every node on the ring
+	KeyHash(key string, positions []KeyHash) KeyHash
+}
+
+const DefaultPartitioner = "fnv"
+
+// Partitioner_By_Name finds a partitioner from its name in the config, the empty name is the default FNV partitioner
+func Partitioner_By_Name(name string) (Partitioner, error) {
+	switch name {
+	case "", "fnv":
+		return &FNVPartitioner{}, nil
+	case "xxhash":
+		return &XXHashPartitioner{}, nil
+	case "murmur3":
+		return &Murmur3Partitioner{}, nil
+	case "jump":
+		return &JumpPartitioner{}, nil
+	case "rendezvous":
+		return &RendezvousPartitioner{}, nil
+	case "order_preserving":
+		return &OrderPreservingPartitioner{}, nil
+	}
+	return nil, fmt.Errorf("Unknown partitioner \"%s\"", name)
+}
+
+// 64 bit FNV-1a, the original hash of the ring
+type FNVPartitioner struct{}
+
+func (p *FNVPartitioner) Name() string { return "fnv" }
+
+func (p *FNVPartitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	return Hash(key)
+}
+
+type XXHashPartitioner struct{}
+
+func (p *XXHashPartitioner) Name() string { return "xxhash" }
+
+func (p *XXHashPartitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	return XXHash64([]byte(key), 0)
+}
+
+// uses the first 64 bits of the x64 128 bit MurmurHash3
+type Murmur3Partitioner struct{}
+
+func (p *Murmur3Partitioner) Name() string { return "murmur3" }
+
+func (p *Murmur3Partitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	h1, _ := Murmur3_128([]byte(key), 0)
+	return h1
+}
+
+// JumpPartitioner picks a node range with jump consistent hashing, so keys are spread evenly
+// between ranges regardless of how evenly the node positions are spaced
+type JumpPartitioner struct{}
+
+func (p *JumpPartitioner) Name() string { return "jump" }
+
+func (p *JumpPartitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	if len(positions) == 0 {
+		return 0
+	}
+	return positions[Jump_Hash(XXHash64([]byte(key), 0), len(positions))]
+}
+
+// RendezvousPartitioner picks the node with the highest random weight for the key (HRW hashing),
+// the following replicas are the nodes after it on the ring
+type RendezvousPartitioner struct{}
+
+func (p *RendezvousPartitioner) Name() string { return "rendezvous" }
+
+func (p *RendezvousPartitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	key_hash := XXHash64([]byte(key), 0)
+	var best KeyHash
+	var best_weight uint64
+	for i, position := range positions {
+		weight := murmur3_fmix64(key_hash ^ position)
+		if i == 0 || weight > best_weight {
+			best = position
+			best_weight = weight
+		}
+	}
+	return best
+}
+
+// OrderPreservingPartitioner places keys on the ring in byte order using their first 8 bytes,
+// so neighbouring keys share ranges and range scans touch few nodes. Keys are only spread evenly
+// if their prefixes are, so node positions should follow the key distribution
+type OrderPreservingPartitioner struct{}
+
+func (p *OrderPreservingPartitioner) Name() string { return "order_preserving" }
+
+func (p *OrderPreservingPartitioner) KeyHash(key string, positions []KeyHash) KeyHash {
+	prefix := make([]byte, 8)
+	copy(prefix, key)
+	return binary.BigEndian.Uint64(prefix)
+}
@@ -0,0 +1,96 @@
+package hash_ring
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashFunctionsKnownValues(t *testing.T) {
+	assert.Equal(t, uint64(0xef46db3751d8e999), XXHash64([]byte(""), 0))
+	assert.Equal(t, uint64(0x44bc2cf5ad770999), XXHash64([]byte("abc"), 0))
+
+	h1, h2 := Murmur3_128([]byte(""), 0)
+	assert.Equal(t, uint64(0), h1)
+	assert.Equal(t, uint64(0), h2)
+
+	h1, h2 = Murmur3_128([]byte("The quick brown fox jumps over the lazy dog"), 0)
+	assert.Equal(t, uint64(0xe34bbc7bbc071b6c), h1)
+	assert.Equal(t, uint64(0x7a433ca9c49a9347), h2)
+}
+
+func TestJumpHashMovesFewKeys(t *testing.T) {
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := XXHash64([]byte(strconv.Itoa(i)), 0)
+		before := Jump_Hash(key, 10)
+		after := Jump_Hash(key, 11)
+		assert.Less(t, before, 10)
+		if before != after {
+			//keys only ever move to the new bucket
+			assert.Equal(t, 10, after)
+			moved++
+		}
+	}
+	assert.InDelta(t, 10000/11, moved, 200)
+}
+
+func TestPartitionerByName(t *testing.T) {
+	for _, name := range []string{"fnv", "xxhash", "murmur3", "jump", "rendezvous", "order_preserving"} {
+		partitioner, err := Partitioner_By_Name(name)
+		assert.Nil(t, err)
+		assert.Equal(t, name, partitioner.Name())
+	}
+
+	partitioner, err := Partitioner_By_Name("")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPartitioner, partitioner.Name())
+
+	_, err = Partitioner_By_Name("md5")
+	assert.NotNil(t, err)
+}
+
+func TestNodePartitionersPickNodePositions(t *testing.T) {
+	positions := Generate_Ring_Positions(7)
+	for _, partitioner := range []Partitioner{&JumpPartitioner{}, &RendezvousPartitioner{}} {
+		counts := make(map[KeyHash]int)
+		for i := 0; i < 7000; i++ {
+			counts[partitioner.KeyHash(strconv.Itoa(i), positions)]++
+		}
+		assert.Equal(t, 7, len(counts))
+		for _, position := range positions {
+			assert.InDelta(t, 1000, counts[position], 150)
+		}
+	}
+}
+
+func TestOrderPreservingPartitioner(t *testing.T) {
+	partitioner := OrderPreservingPartitioner{}
+	assert.Less(t, partitioner.KeyHash("apple", nil), partitioner.KeyHash("banana", nil))
+	assert.Less(t, partitioner.KeyHash("a", nil), partitioner.KeyHash("ab", nil))
+	assert.Equal(t, KeyHash(0), partitioner.KeyHash("", nil))
+}
+
+func TestRingUsesPartitioner(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(4), replication_factor: 1, minimum_writes: 1, minimum_read: 1, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+	hr.SetPartitioner(&OrderPreservingPartitioner{})
+
+	value_meta := ValueMeta{VectorClock: NewVectorClock()}
+	hr.Add("1apple", []byte("1"), &value_meta)
+	hr.Add("épée", []byte("2"), &value_meta)
+
+	//'1' is in the first quarter of the byte range, the utf-8 'é' in the last
+	assert.Equal(t, []int{0}, ReplicatedMatchesIndexes(t, hr.nodes, "1apple"))
+	assert.Equal(t, []int{3}, ReplicatedMatchesIndexes(t, hr.nodes, "épée"))
+
+	val, _, err := hr.Get("épée")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(val))
+}
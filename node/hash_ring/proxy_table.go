@@ -10,7 +10,7 @@ type ProxyTable struct {
 	isPermanent  bool
 }
 
-func (t *ProxyTable) Add(key string, value string, meta *ValueMeta) error {
+func (t *ProxyTable) Add(key string, value []byte, meta *ValueMeta) error {
 	defer t.lock.Unlock()
 	t.lock.Lock()
 	if t.isPermanent {
@@ -20,7 +20,7 @@ func (t *ProxyTable) Add(key string, value string, meta *ValueMeta) error {
 	}
 }
 
-func (t *ProxyTable) Get(key string) (*string, *ValueMeta, error) {
+func (t *ProxyTable) Get(key string) ([]byte, *ValueMeta, error) {
 	defer t.lock.Unlock()
 	t.lock.Lock()
 	if t.isPermanent {
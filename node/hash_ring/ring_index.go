@@ -0,0 +1,195 @@
+package hash_ring
+
+import "sort"
+
+// ring_index is derived from the nodes of the ring, it is built lazily
+// for each replication factor keys are placed with
+type ring_index struct {
+	replication_factor int
+	number_of_zones    int
+	number_of_racks    int
+	position_to_node   map[KeyHash]int
+	positions          []KeyHash
+	//primary replicas of the range ending at each node
+	primary_nodes [][]int
+}
+
+func (ring *Hash_Ring) get_index() *ring_index {
+	return ring.index_for(ring.ReplicationFactor())
+}
+
+// index_for gives the index placing keys on replication_factor replicas
+func (ring *Hash_Ring) index_for(replication_factor int) *ring_index {
+	ring.config_lock.RLock()
+	index := ring.indexes[replication_factor]
+	ring.config_lock.RUnlock()
+
+	if index != nil {
+		return index
+	}
+
+	defer ring.config_lock.Unlock()
+	ring.config_lock.Lock()
+	if ring.indexes == nil {
+		ring.indexes = make(map[int]*ring_index)
+	}
+	if ring.indexes[replication_factor] == nil {
+		ring.indexes[replication_factor] = ring.build_index(replication_factor)
+	}
+	return ring.indexes[replication_factor]
+}
+
+func (ring *Hash_Ring) build_index(replication_factor int) *ring_index {
+	index := ring_index{
+		replication_factor: replication_factor,
+		position_to_node:   make(map[KeyHash]int, len(ring.nodes)),
+		positions:          make([]KeyHash, len(ring.nodes)),
+		primary_nodes:      make([][]int, len(ring.nodes)),
+	}
+
+	zones := make(map[string]bool)
+	racks := make(map[string]bool)
+	for i := range ring.nodes {
+		index.position_to_node[ring.nodes[i].position] = i
+		index.positions[i] = ring.nodes[i].position
+		zones[ring.nodes[i].zone] = true
+		racks[ring.nodes[i].zone+"/"+ring.nodes[i].rack] = true
+	}
+	index.number_of_zones = len(zones)
+	index.number_of_racks = len(racks)
+
+	for i := range ring.nodes {
+		walk := ring.walk_physical_nodes(i, replication_factor, &index)
+		index.primary_nodes[i] = ring.choose_replicas(walk, replication_factor, false)
+	}
+
+	return &index
+}
+
+// primary_node_index finds the first node at or after the key hash
+func (ring *Hash_Ring) primary_node_index(keyHash KeyHash) int {
+	i := sort.Search(len(ring.nodes), func(i int) bool {
+		return ring.nodes[i].position >= keyHash
+	})
+	if i == len(ring.nodes) {
+		return -1
+	}
+	return i
+}
+
+// node_index finds the node at a position, -1 if there is none
+func (ring *Hash_Ring) node_index(position KeyHash) int {
+	i, exists := ring.get_index().position_to_node[position]
+	if !exists {
+		return -1
+	}
+	return i
+}
+
+// primary_nodes returns the primary replicas for a key, the result is shared and must not be modified
+func (ring *Hash_Ring) primary_nodes(key_hash KeyHash) []int {
+	return ring.primary_nodes_for(key_hash, ring.ReplicationFactor())
+}
+
+// primary_nodes_for is primary_nodes for keys placed on replication_factor replicas, as in buckets
+func (ring *Hash_Ring) primary_nodes_for(key_hash KeyHash, replication_factor int) []int {
+	node_i := ring.primary_node_index(key_hash)
+	if node_i == -1 {
+		return nil
+	}
+	return ring.index_for(replication_factor).primary_nodes[node_i]
+}
+
+// preference_list orders one node of every physical node by preference to store the key.
+// The first replication_factor nodes are the primary replicas, chosen walking clockwise from the key
+// while preferring nodes in zones, then racks, that do not yet hold a replica.
+// The rest follow in ring order and are used for hinted handoff
+func (ring *Hash_Ring) preference_list(key_hash KeyHash, replication_factor int) []int {
+	node_i := ring.primary_node_index(key_hash)
+	if node_i == -1 {
+		return nil
+	}
+	walk := ring.walk_physical_nodes(node_i, replication_factor, nil)
+	return ring.choose_replicas(walk, replication_factor, true)
+}
+
+// PreferenceList gives one node of each physical node in order of preference to store the key,
+// the primary replicas first, as used by clients to send requests straight to a replica
+func (ring *Hash_Ring) PreferenceList(key string) []Node {
+	indexes := ring.preference_list(ring.KeyHash(key), ring.replication_factor_of(key))
+	nodes := make([]Node, len(indexes))
+	for i, index := range indexes {
+		nodes[i] = ring.nodes[index]
+	}
+	return nodes
+}
+
+// walk_physical_nodes returns one node of each physical node in ring order starting from node_i.
+// Given an index it stops as soon as enough zones, racks and physical nodes have been seen
+// to decide the primary replicas, otherwise it walks the whole ring
+func (ring *Hash_Ring) walk_physical_nodes(node_i int, replication_factor int, index *ring_index) []int {
+	walk := []int{}
+	physical_nodes_visited := make(map[uint64]bool)
+	zones := make(map[string]bool)
+	racks := make(map[string]bool)
+
+	for i := 0; i < len(ring.nodes); i++ {
+		node := &ring.nodes[node_i]
+		if !physical_nodes_visited[node.physical_id] {
+			physical_nodes_visited[node.physical_id] = true
+			walk = append(walk, node_i)
+			zones[node.zone] = true
+			racks[node.zone+"/"+node.rack] = true
+
+			if index != nil {
+				enough_zones := len(zones) >= replication_factor
+				enough_racks := len(zones) == index.number_of_zones && len(racks) >= replication_factor
+				enough_nodes := len(zones) == index.number_of_zones && len(racks) == index.number_of_racks && len(walk) >= replication_factor
+				if enough_zones || enough_racks || enough_nodes {
+					break
+				}
+			}
+		}
+		node_i = ring.wrapped_index(node_i + 1)
+	}
+
+	return walk
+}
+
+// choose_replicas picks the primary replicas from a walk of physical nodes,
+// optionally followed by the remaining nodes in ring order
+func (ring *Hash_Ring) choose_replicas(walk []int, replication_factor int, include_rest bool) []int {
+	chosen := make([]bool, len(walk))
+	preference_list := make([]int, 0, len(walk))
+	zones_used := make(map[string]bool)
+	racks_used := make(map[string]bool)
+
+	choose := func(can_choose func(node *Node) bool) {
+		for i, node_i := range walk {
+			if len(preference_list) >= replication_factor {
+				return
+			}
+			node := &ring.nodes[node_i]
+			if !chosen[i] && can_choose(node) {
+				chosen[i] = true
+				preference_list = append(preference_list, node_i)
+				zones_used[node.zone] = true
+				racks_used[node.zone+"/"+node.rack] = true
+			}
+		}
+	}
+
+	choose(func(node *Node) bool { return !zones_used[node.zone] })
+	choose(func(node *Node) bool { return !racks_used[node.zone+"/"+node.rack] })
+	choose(func(node *Node) bool { return true })
+
+	if include_rest {
+		for i, node_i := range walk {
+			if !chosen[i] {
+				preference_list = append(preference_list, node_i)
+			}
+		}
+	}
+
+	return preference_list
+}
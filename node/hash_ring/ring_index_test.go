@@ -0,0 +1,92 @@
+package hash_ring
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func benchmark_ring(number_of_physical_nodes int, virtual_nodes_per_physical int) *Hash_Ring {
+	weights := make([]int, number_of_physical_nodes)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return &Hash_Ring{nodes: Generate_Nodes_With_Weights(weights, virtual_nodes_per_physical), replication_factor: 3, minimum_writes: 2, minimum_read: 2, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+}
+
+func TestPrimaryNodesMatchPreferenceList(t *testing.T) {
+	hr := benchmark_ring(20, 5)
+	zones := []string{"a", "b", "c"}
+	for i := range hr.nodes {
+		hr.nodes[i].SetLocation(zones[int(hr.nodes[i].physical_id)%len(zones)], strconv.Itoa(int(hr.nodes[i].physical_id)%4))
+	}
+
+	for i := 0; i < 1000; i++ {
+		key_hash := Hash(strconv.Itoa(i))
+		preference_list := hr.preference_list(key_hash, 3)
+		assert.Equal(t, preference_list[:3], hr.primary_nodes(key_hash))
+		assert.Equal(t, 20, len(preference_list))
+	}
+}
+
+func TestPrimaryNodesRebuiltOnQuorumChange(t *testing.T) {
+	hr := benchmark_ring(5, 2)
+	assert.Equal(t, 3, len(hr.primary_nodes(Hash("bar"))))
+
+	assert.Nil(t, hr.SetQuorum(4, 2, 2, 0))
+	assert.Equal(t, 4, len(hr.primary_nodes(Hash("bar"))))
+}
+
+func TestNodeIndex(t *testing.T) {
+	hr := benchmark_ring(5, 2)
+	for i := range hr.nodes {
+		assert.Equal(t, i, hr.node_index(hr.nodes[i].position))
+		assert.Equal(t, i, hr.primary_node_index(hr.nodes[i].position))
+	}
+	assert.Equal(t, -1, hr.node_index(1))
+	assert.Equal(t, 0, hr.primary_node_index(0))
+}
+
+func benchmarkPrimaryNodes(b *testing.B, number_of_virtual_nodes int) {
+	hr := benchmark_ring(number_of_virtual_nodes/10, 10)
+	keys := make([]KeyHash, 1024)
+	for i := range keys {
+		keys[i] = Hash(strconv.Itoa(i))
+	}
+	hr.get_index()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hr.primary_nodes(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkPrimaryNodes1000(b *testing.B)  { benchmarkPrimaryNodes(b, 1000) }
+func BenchmarkPrimaryNodes5000(b *testing.B)  { benchmarkPrimaryNodes(b, 5000) }
+func BenchmarkPrimaryNodes10000(b *testing.B) { benchmarkPrimaryNodes(b, 10000) }
+
+func benchmarkNodeIndex(b *testing.B, number_of_virtual_nodes int) {
+	hr := benchmark_ring(number_of_virtual_nodes/10, 10)
+	hr.get_index()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hr.node_index(hr.nodes[i%len(hr.nodes)].position)
+	}
+}
+
+func BenchmarkNodeIndex1000(b *testing.B)  { benchmarkNodeIndex(b, 1000) }
+func BenchmarkNodeIndex10000(b *testing.B) { benchmarkNodeIndex(b, 10000) }
+
+func benchmarkBuildIndex(b *testing.B, number_of_virtual_nodes int) {
+	hr := benchmark_ring(number_of_virtual_nodes/10, 10)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hr.build_index(3)
+	}
+}
+
+func BenchmarkBuildIndex1000(b *testing.B)  { benchmarkBuildIndex(b, 1000) }
+func BenchmarkBuildIndex10000(b *testing.B) { benchmarkBuildIndex(b, 10000) }
@@ -0,0 +1,227 @@
+package hash_ring
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ScanKeyValueTable is implemented by tables that can list their keys in order,
+// other tables are scanned through Iter
+type ScanKeyValueTable interface {
+	Scan(prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error)
+}
+
+func scan_table(table KeyValueTable, prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error) {
+	if scan_table, is_scan := table.(ScanKeyValueTable); is_scan {
+		return scan_table.Scan(prefix, start, limit)
+	}
+
+	keys := []string{}
+	values := [][]byte{}
+	metas := []*ValueMeta{}
+	iter := table.Iter()
+	for key, value, meta := iter.Next(); key != nil; key, value, meta = iter.Next() {
+		if strings.HasPrefix(*key, prefix) && *key >= start {
+			keys = append(keys, *key)
+			values = append(values, value)
+			metas = append(metas, meta)
+		}
+	}
+	sort.Sort(&scan_page{keys, values, metas})
+	if len(keys) > limit {
+		return keys[:limit], values[:limit], metas[:limit], nil
+	}
+	return keys, values, metas, nil
+}
+
+type scan_page struct {
+	keys   []string
+	values [][]byte
+	metas  []*ValueMeta
+}
+
+func (p *scan_page) Len() int           { return len(p.keys) }
+func (p *scan_page) Less(i, j int) bool { return p.keys[i] < p.keys[j] }
+func (p *scan_page) Swap(i, j int) {
+	p.keys[i], p.keys[j] = p.keys[j], p.keys[i]
+	p.values[i], p.values[j] = p.values[j], p.values[i]
+	p.metas[i], p.metas[j] = p.metas[j], p.metas[i]
+}
+
+type ScanEntry struct {
+	Key   string
+	Value []byte
+	Meta  *ValueMeta
+}
+
+// Next_key is the first key after key in scan order, used to continue a scan after the last key of a page
+func Next_key(key string) string {
+	return key + "\x00"
+}
+
+// table_scan is one table's part of a page of a scan. Tables hold the keys of every range their node replicates,
+// so the table is read once, in order, and its keys are split by the range they hash into
+type table_scan struct {
+	//where the next read of the table starts
+	start string
+	done  bool
+	//the first keys of each range in the table, up to the page's limit
+	by_slot map[int]*scan_page
+	lock    sync.Mutex
+}
+
+// page_scans are the tables read by a page of a scan, shared by the requests for every range
+type page_scans struct {
+	tables map[KeyValueTable]*table_scan
+	lock   sync.Mutex
+}
+
+func (scans *page_scans) of(table KeyValueTable, start string) *table_scan {
+	defer scans.lock.Unlock()
+	scans.lock.Lock()
+	if scans.tables[table] == nil {
+		scans.tables[table] = &table_scan{start: start, by_slot: make(map[int]*scan_page)}
+	}
+	return scans.tables[table]
+}
+
+// scan_range reads up to limit keys of the range owned by the node at slot from one replica.
+// The replica's table is only read further when none of the ranges already read from it has enough keys,
+// chunk keys at a time
+func (ring *Hash_Ring) scan_range(scans *page_scans, node *Node, usePermanent bool, slot int, prefix string, start string, limit int, chunk int) (*scan_page, error) {
+	table := node.table
+	if !usePermanent {
+		table = node.temporaryTable
+	}
+	scan := scans.of(table, start)
+	defer scan.lock.Unlock()
+	scan.lock.Lock()
+	for !scan.done && (scan.by_slot[slot] == nil || len(scan.by_slot[slot].keys) < limit) {
+		keys, values, metas, err := node.Scan(prefix, scan.start, chunk, usePermanent)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			key_slot := ring.primary_node_index(ring.KeyHash(keys[i]))
+			if scan.by_slot[key_slot] == nil {
+				scan.by_slot[key_slot] = &scan_page{}
+			}
+			page := scan.by_slot[key_slot]
+			if len(page.keys) < limit {
+				page.keys = append(page.keys, keys[i])
+				page.values = append(page.values, values[i])
+				page.metas = append(page.metas, metas[i])
+			}
+		}
+		if len(keys) < chunk {
+			scan.done = true
+		} else {
+			scan.start = Next_key(keys[len(keys)-1])
+		}
+	}
+	page := scan_page{}
+	if scan.by_slot[slot] != nil {
+		//later reads only append past the returned keys
+		page = *scan.by_slot[slot]
+	}
+	return &page, nil
+}
+
+// Scan returns up to limit keys starting with prefix, from start onwards in key order,
+// and the start of the next page, which is empty once the scan is complete.
+// Keys are spread over the ring by hash, so every range is read from a quorum of its replicas
+// and each key is resolved by vector clock as in Get. Deleted keys are skipped, so pages may be short
+func (ring *Hash_Ring) Scan(prefix string, start string, limit int) ([]ScanEntry, string, error) {
+	return ring.ScanContext(context.Background(), prefix, start, limit)
+}
+
+// ScanContext is Scan tracing the request to each replica as a child of the context's span
+func (ring *Hash_Ring) ScanContext(ctx context.Context, prefix string, start string, limit int) ([]ScanEntry, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("Limit must be positive")
+	}
+	if start < prefix {
+		start = prefix
+	}
+
+	//every key of a bucket's scan is in the bucket, other scans use the ring's settings
+	settings := ring.settings_of(prefix)
+	read_replication_factor, minimum_read := settings.read_quorum()
+	candidates := []ScanEntry{}
+	errs := make([]error, len(ring.nodes))
+	candidates_lock := sync.Mutex{}
+	scans := &page_scans{tables: make(map[KeyValueTable]*table_scan)}
+	//a table holds the keys of the replication factor's ranges, so one chunk usually fills all of them
+	chunk := limit * settings.replication_factor
+	wait_group := sync.WaitGroup{}
+	for slot := range ring.nodes {
+		wait_group.Add(1)
+		go func(slot int) {
+			defer wait_group.Done()
+			found := make(map[string]*versions)
+			lock := sync.Mutex{}
+
+			ctx, query := ring.start_query(ctx, "scan", ring.nodes[slot].position)
+			errs[slot] = ring.consensus(ctx, "scan", ring.nodes[slot].position, settings.replication_factor, read_replication_factor, minimum_read, false, func(node *Node, result_chan chan bool, hinted bool) {
+				page, err := ring.scan_range(scans, node, !hinted, slot, prefix, start, limit, chunk)
+				if err == nil {
+					lock.Lock()
+					for i := range page.keys {
+						if found[page.keys[i]] == nil {
+							found[page.keys[i]] = &versions{}
+						}
+						found[page.keys[i]].add(page.values[i], page.metas[i], node, !hinted)
+					}
+					lock.Unlock()
+				}
+				result_chan <- (err == nil)
+			})
+			if errs[slot] != nil {
+				ring.finish_query(ctx, query, errs[slot], false)
+				return
+			}
+
+			//replicas still answering after the quorum must not change the versions being resolved
+			lock.Lock()
+			defer lock.Unlock()
+			resolved := false
+			for key, key_versions := range found {
+				value, meta := ring.latest_version(key, key_versions)
+				resolved = resolved || key_versions.resolved
+				candidates_lock.Lock()
+				candidates = append(candidates, ScanEntry{key, value, meta})
+				candidates_lock.Unlock()
+			}
+			ring.finish_query(ctx, query, nil, resolved)
+		}(slot)
+	}
+	wait_group.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			return nil, "", errs[i]
+		}
+	}
+
+	//a replica can only have missed a key before the cutoff if it returned limit keys before it,
+	//so the first limit keys of every replica's pages are exactly the first limit keys of the ring
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Key < candidates[j].Key
+	})
+	next := ""
+	if len(candidates) >= limit {
+		candidates = candidates[:limit]
+		next = Next_key(candidates[limit-1].Key)
+	}
+
+	entries := []ScanEntry{}
+	for i := range candidates {
+		if candidates[i].Value != nil {
+			entries = append(entries, candidates[i])
+		}
+	}
+	return entries, next, nil
+}
@@ -0,0 +1,88 @@
+package hash_ring
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanPages(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes_With_Virtual(5, []int{2, 2, 2, 2, 2}), replication_factor: 3, minimum_writes: 3, minimum_read: 2, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	expected := []string{}
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("user/%02d", i)
+		expected = append(expected, key)
+		hr.Add(key, []byte(key), NewValueMeta(NewVectorClock()))
+	}
+	hr.Add("other", []byte("other"), NewValueMeta(NewVectorClock()))
+	_, meta, _ := hr.Get("user/03")
+	hr.Delete("user/03", meta)
+
+	scanned := []string{}
+	start := ""
+	pages := 0
+	for {
+		entries, next, err := hr.Scan("user/", start, 10)
+		assert.Nil(t, err)
+		for i := range entries {
+			assert.Equal(t, entries[i].Key, string(entries[i].Value))
+			scanned = append(scanned, entries[i].Key)
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		start = next
+	}
+
+	assert.Equal(t, append(expected[:3:3], expected[4:]...), scanned)
+	assert.Equal(t, 3, pages)
+}
+
+// counting_table counts the scans of an in memory table
+type counting_table struct {
+	InMemoryTable
+	scans int
+	lock  sync.Mutex
+}
+
+func (table *counting_table) Scan(prefix string, start string, limit int) ([]string, [][]byte, []*ValueMeta, error) {
+	table.lock.Lock()
+	table.scans++
+	table.lock.Unlock()
+	return table.InMemoryTable.Scan(prefix, start, limit)
+}
+
+func TestScanReadsTablesOnce(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes_With_Virtual(5, []int{4, 4, 4, 4, 4}), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	tables := make([]*counting_table, len(hr.nodes))
+	for i := range hr.nodes {
+		tables[i] = &counting_table{InMemoryTable: NewInMemoryTable()}
+		hr.nodes[i].table = tables[i]
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user/%03d", i)
+		hr.Add(key, []byte(key), NewValueMeta(NewVectorClock()))
+	}
+
+	entries, next, err := hr.Scan("user/", "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(entries))
+	assert.Equal(t, Next_key("user/009"), next)
+	//every range is read from its replicas, but no part of a table is read twice
+	chunk := 10 * hr.replication_factor
+	for i := range tables {
+		assert.LessOrEqual(t, tables[i].scans, tables[i].Size()/chunk+1)
+	}
+}
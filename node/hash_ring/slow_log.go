@@ -0,0 +1,225 @@
+package hash_ring
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+)
+
+const Default_slow_log_capacity = 256
+
+const (
+	Outcome_succeeded = "succeeded"
+	Outcome_failed    = "failed"
+	//the replica hadn't answered by the time the operation returned
+	Outcome_pending = "pending"
+)
+
+type SlowLogConfig struct {
+	//operations coordinated by this node taking longer are recorded
+	Threshold_ms int
+	//number of the most recent slow operations kept, Default_slow_log_capacity when 0
+	Capacity int `json:",omitempty"`
+}
+
+func CheckSlowLogConfig(config *SlowLogConfig) error {
+	if config.Threshold_ms < 0 {
+		return errors.New("Slow log threshold must not be negative")
+	}
+	if config.Capacity < 0 {
+		return errors.New("Slow log capacity must not be negative")
+	}
+	return nil
+}
+
+// ReplicaCall is the request an operation made to one replica
+type ReplicaCall struct {
+	Node        KeyHash
+	Physical_id uint64
+	Hinted      bool
+	//until the replica answered, or until the operation returned for pending calls
+	Latency time.Duration
+	Outcome string
+}
+
+// SlowQuery is an operation coordinated by this node that took longer than the slow log's threshold.
+// Batches and scans record an operation for each group of keys or range of the ring they read
+type SlowQuery struct {
+	Operation  string
+	Key_hash   KeyHash
+	Request_id string
+	Start      time.Time
+	Duration   time.Duration
+	//in the order they were contacted, fallback nodes after the primaries that failed
+	Replicas []ReplicaCall
+	//whether a fallback node was used in place of a primary
+	Hinted            bool
+	Conflict_resolved bool
+	//empty when the operation succeeded
+	Error string
+}
+
+// SlowLog keeps the most recent slow operations
+type SlowLog struct {
+	threshold time.Duration
+	queries   []SlowQuery
+	//index the next query is written to, once full the oldest
+	next int
+	full bool
+	lock sync.Mutex
+}
+
+func NewSlowLog(config *SlowLogConfig) *SlowLog {
+	capacity := config.Capacity
+	if capacity == 0 {
+		capacity = Default_slow_log_capacity
+	}
+	return &SlowLog{
+		threshold: time.Duration(config.Threshold_ms) * time.Millisecond,
+		queries:   make([]SlowQuery, capacity),
+	}
+}
+
+func (slow_log *SlowLog) Threshold() time.Duration {
+	return slow_log.threshold
+}
+
+// Record keeps the query if it exceeded the threshold, replacing the oldest once full
+func (slow_log *SlowLog) Record(query SlowQuery) bool {
+	if query.Duration <= slow_log.threshold {
+		return false
+	}
+	defer slow_log.lock.Unlock()
+	slow_log.lock.Lock()
+	slow_log.queries[slow_log.next] = query
+	slow_log.next = (slow_log.next + 1) % len(slow_log.queries)
+	if slow_log.next == 0 {
+		slow_log.full = true
+	}
+	return true
+}
+
+// Queries gives the recorded queries, newest first
+func (slow_log *SlowLog) Queries() []SlowQuery {
+	defer slow_log.lock.Unlock()
+	slow_log.lock.Lock()
+	count := slow_log.next
+	if slow_log.full {
+		count = len(slow_log.queries)
+	}
+	queries := make([]SlowQuery, count)
+	for i := range queries {
+		queries[i] = slow_log.queries[(slow_log.next-1-i+len(slow_log.queries))%len(slow_log.queries)]
+	}
+	return queries
+}
+
+func (slow_log *SlowLog) Clear() {
+	defer slow_log.lock.Unlock()
+	slow_log.lock.Lock()
+	slow_log.queries = make([]SlowQuery, len(slow_log.queries))
+	slow_log.next = 0
+	slow_log.full = false
+}
+
+// SetSlowLog records operations slower than the log's threshold in it, nil stops recording
+func (ring *Hash_Ring) SetSlowLog(slow_log *SlowLog) {
+	ring.slow_log = slow_log
+}
+
+// SlowLog is the log slow operations are recorded in, nil when they aren't
+func (ring *Hash_Ring) SlowLog() *SlowLog {
+	return ring.slow_log
+}
+
+// query_recorder collects what an operation did while it runs, for the slow log.
+// A nil recorder records nothing
+type query_recorder struct {
+	query          SlowQuery
+	replica_starts []time.Time
+	lock           sync.Mutex
+}
+
+type query_key struct{}
+
+// start_query starts recording an operation when the ring has a slow log,
+// replicas called with the returned context are recorded as part of it
+func (ring *Hash_Ring) start_query(ctx context.Context, operation string, key_hash KeyHash) (context.Context, *query_recorder) {
+	if ring.slow_log == nil {
+		return ctx, nil
+	}
+	recorder := &query_recorder{query: SlowQuery{
+		Operation:  operation,
+		Key_hash:   key_hash,
+		Request_id: logging.RequestId(ctx),
+		Start:      time.Now(),
+	}}
+	return context.WithValue(ctx, query_key{}, recorder), recorder
+}
+
+func query_of(ctx context.Context) *query_recorder {
+	recorder, _ := ctx.Value(query_key{}).(*query_recorder)
+	return recorder
+}
+
+// contacted records a request being sent to a replica, giving the call to pass to answered
+func (recorder *query_recorder) contacted(node *Node, hinted bool) int {
+	if recorder == nil {
+		return -1
+	}
+	defer recorder.lock.Unlock()
+	recorder.lock.Lock()
+	recorder.query.Replicas = append(recorder.query.Replicas, ReplicaCall{
+		Node:        node.position,
+		Physical_id: node.physical_id,
+		Hinted:      hinted,
+		Outcome:     Outcome_pending,
+	})
+	recorder.replica_starts = append(recorder.replica_starts, time.Now())
+	return len(recorder.query.Replicas) - 1
+}
+
+func (recorder *query_recorder) answered(call int, succeeded bool) {
+	if recorder == nil {
+		return
+	}
+	defer recorder.lock.Unlock()
+	recorder.lock.Lock()
+	replica := &recorder.query.Replicas[call]
+	replica.Latency = time.Since(recorder.replica_starts[call])
+	replica.Outcome = Outcome_failed
+	if succeeded {
+		replica.Outcome = Outcome_succeeded
+	}
+}
+
+// finish_query records the operation in the slow log if it took too long,
+// replicas answering afterwards aren't included
+func (ring *Hash_Ring) finish_query(ctx context.Context, recorder *query_recorder, err error, conflict_resolved bool) {
+	if recorder == nil || ring.slow_log == nil {
+		return
+	}
+	now := time.Now()
+	recorder.lock.Lock()
+	query := recorder.query
+	query.Duration = now.Sub(query.Start)
+	query.Replicas = append([]ReplicaCall{}, recorder.query.Replicas...)
+	for i := range query.Replicas {
+		if query.Replicas[i].Outcome == Outcome_pending {
+			query.Replicas[i].Latency = now.Sub(recorder.replica_starts[i])
+		}
+		query.Hinted = query.Hinted || query.Replicas[i].Hinted
+	}
+	recorder.lock.Unlock()
+
+	query.Conflict_resolved = conflict_resolved
+	if err != nil {
+		query.Error = err.Error()
+	}
+	if ring.slow_log.Record(query) {
+		ring.Logger().WarnContext(ctx, "Slow operation", "operation", query.Operation, "key_hash", query.Key_hash, "duration", query.Duration, "replicas", len(query.Replicas), "hinted", query.Hinted)
+	}
+}
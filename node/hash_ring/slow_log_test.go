@@ -0,0 +1,96 @@
+package hash_ring
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// slow_table answers like an in memory table after a delay
+type slow_table struct {
+	InMemoryTable
+	delay time.Duration
+}
+
+func (table *slow_table) Add(key string, value []byte, meta *ValueMeta) error {
+	time.Sleep(table.delay)
+	return table.InMemoryTable.Add(key, value, meta)
+}
+
+func TestSlowLog(t *testing.T) {
+	slow_log := NewSlowLog(&SlowLogConfig{Threshold_ms: 10, Capacity: 2})
+	assert.False(t, slow_log.Record(SlowQuery{Operation: "get", Duration: 10 * time.Millisecond}))
+	assert.True(t, slow_log.Record(SlowQuery{Operation: "get", Duration: 11 * time.Millisecond}))
+	assert.True(t, slow_log.Record(SlowQuery{Operation: "add", Duration: 12 * time.Millisecond}))
+	assert.True(t, slow_log.Record(SlowQuery{Operation: "scan", Duration: 13 * time.Millisecond}))
+	queries := slow_log.Queries()
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "scan", queries[0].Operation)
+	assert.Equal(t, "add", queries[1].Operation)
+	slow_log.Clear()
+	assert.Equal(t, 0, len(slow_log.Queries()))
+
+	assert.NotNil(t, CheckSlowLogConfig(&SlowLogConfig{Threshold_ms: -1}))
+	assert.Nil(t, CheckSlowLogConfig(&SlowLogConfig{Threshold_ms: 100}))
+	assert.Equal(t, Default_slow_log_capacity, len(NewSlowLog(&SlowLogConfig{}).queries))
+}
+
+func TestSlowQueries(t *testing.T) {
+	hr := metrics_test_ring(4)
+	hr.SetSlowLog(NewSlowLog(&SlowLogConfig{Threshold_ms: 20}))
+	assert.Nil(t, hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	assert.Equal(t, 0, len(hr.SlowLog().Queries()))
+
+	//one primary is slow and another fails, so the write is handed off to the last node
+	primaries := hr.primary_nodes(hr.KeyHash("bar"))
+	hr.nodes[primaries[0]].table = &slow_table{NewInMemoryTable(), 30 * time.Millisecond}
+	hr.nodes[primaries[1]].table = &ErrorTable{}
+	ctx := logging.WithRequestId(context.Background(), "abc")
+	assert.Nil(t, hr.AddAtContext(ctx, "bar", []byte("car"), NewValueMeta(NewVectorClock()), Consistency_default))
+
+	queries := hr.SlowLog().Queries()
+	assert.Equal(t, 1, len(queries))
+	query := queries[0]
+	assert.Equal(t, "add", query.Operation)
+	assert.Equal(t, hr.KeyHash("bar"), query.Key_hash)
+	assert.Equal(t, "abc", query.Request_id)
+	assert.True(t, query.Duration >= 30*time.Millisecond)
+	assert.True(t, query.Hinted)
+	assert.False(t, query.Conflict_resolved)
+	assert.Equal(t, "", query.Error)
+	assert.Equal(t, 4, len(query.Replicas))
+	outcomes := map[KeyHash]string{}
+	for _, replica := range query.Replicas[:3] {
+		assert.False(t, replica.Hinted)
+		outcomes[replica.Node] = replica.Outcome
+		if replica.Node == hr.nodes[primaries[0]].position {
+			assert.True(t, replica.Latency >= 30*time.Millisecond)
+		}
+	}
+	assert.Equal(t, Outcome_succeeded, outcomes[hr.nodes[primaries[0]].position])
+	assert.Equal(t, Outcome_failed, outcomes[hr.nodes[primaries[1]].position])
+	assert.Equal(t, Outcome_succeeded, outcomes[hr.nodes[primaries[2]].position])
+	assert.True(t, query.Replicas[3].Hinted)
+	assert.Equal(t, Outcome_succeeded, query.Replicas[3].Outcome)
+
+	//reads merging concurrent versions record the conflict resolution
+	hr = metrics_test_ring(3)
+	hr.SetSlowLog(NewSlowLog(&SlowLogConfig{}))
+	left := NewVectorClock()
+	left.Add(1)
+	right := NewVectorClock()
+	right.Add(2)
+	hr.nodes[0].AddPermanent("bar", []byte("car"), NewValueMeta(left))
+	hr.nodes[1].AddPermanent("bar", []byte("mar"), NewValueMeta(right))
+	hr.nodes[2].AddPermanent("bar", []byte("mar"), NewValueMeta(right))
+	_, _, err := hr.Get("bar")
+	assert.Nil(t, err)
+	query = hr.SlowLog().Queries()[0]
+	assert.Equal(t, "get", query.Operation)
+	assert.True(t, query.Conflict_resolved)
+	assert.False(t, query.Hinted)
+	assert.Equal(t, 3, len(query.Replicas))
+}
@@ -0,0 +1,56 @@
+package hash_ring
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/lucifer1662/distrokdb/node/tracing"
+)
+
+// ContextKeyValueTable is implemented by tables on other nodes, giving a copy of the table
+// that sends the trace of the context with its requests
+type ContextKeyValueTable interface {
+	WithContext(ctx context.Context) KeyValueTable
+}
+
+func table_with_context(ctx context.Context, table KeyValueTable) KeyValueTable {
+	if contextual, is_contextual := table.(ContextKeyValueTable); is_contextual {
+		return contextual.WithContext(ctx)
+	}
+	return table
+}
+
+var errReplicaFailed = errors.New("Replica failed")
+
+// traced_op runs node_op on a replica within a span of its own, the node's tables passing the span
+// and the request id on to remote replicas. The answer is recorded as the call in the operation's slow log entry
+func (ring *Hash_Ring) traced_op(ctx context.Context, operation string, node *Node, hinted bool, call int, result_chan chan bool, node_op func(node *Node, result_chan chan bool, hinted bool)) {
+	query := query_of(ctx)
+	span_ctx, span := tracing.Start(ctx, "replica "+operation, tracing.Kind_client)
+	if span == nil && logging.RequestId(ctx) == "" && query == nil {
+		node_op(node, result_chan, hinted)
+		return
+	}
+	if span != nil {
+		span.SetAttribute("kdb.node.position", strconv.FormatUint(node.position, 10))
+		span.SetAttribute("kdb.node.physical_id", strconv.FormatUint(node.physical_id, 10))
+		span.SetAttribute("kdb.hinted", strconv.FormatBool(hinted))
+	}
+
+	//a copy, so only this request's tables carry the span
+	traced_node := *node
+	traced_node.table = table_with_context(span_ctx, node.table)
+	traced_node.temporaryTable = table_with_context(span_ctx, node.temporaryTable)
+	op_result := make(chan bool, 1)
+	node_op(&traced_node, op_result, hinted)
+	succeeded := <-op_result
+	query.answered(call, succeeded)
+	if !succeeded {
+		span.SetError(errReplicaFailed)
+		ring.Logger().DebugContext(ctx, "Replica failed", "operation", operation, "node", node.position, "physical_id", node.physical_id, "hinted", hinted)
+	}
+	span.End()
+	result_chan <- succeeded
+}
@@ -0,0 +1,95 @@
+package hash_ring
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/lucifer1662/distrokdb/node/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+type recording_exporter struct {
+	spans []*tracing.SpanData
+	lock  sync.Mutex
+}
+
+func (exporter *recording_exporter) Export(resource tracing.Resource, spans []*tracing.SpanData) error {
+	defer exporter.lock.Unlock()
+	exporter.lock.Lock()
+	exporter.spans = append(exporter.spans, spans...)
+	return nil
+}
+
+func TestReplicaSpans(t *testing.T) {
+	exporter := &recording_exporter{}
+	tracer := tracing.NewTracerWithExporter(exporter)
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+	tracer.Start()
+
+	hr := metrics_test_ring(4)
+	primaries := hr.primary_nodes(hr.KeyHash("bar"))
+	hr.nodes[primaries[0]].table = &ErrorTable{}
+
+	ctx, request := tracing.Start(context.Background(), "PUT keys", tracing.Kind_server)
+	assert.Nil(t, hr.AddAtContext(ctx, "bar", []byte("mar"), NewValueMeta(NewVectorClock()), Consistency_default))
+	request.End()
+	tracer.Stop()
+
+	//background work of other tests may be traced alongside
+	traced := []*tracing.SpanData{}
+	for _, span := range exporter.spans {
+		if span.Trace_id == request.Context().Trace_id {
+			traced = append(traced, span)
+		}
+	}
+	//each primary is tried, and the failed one is handed off to the next node
+	assert.Equal(t, 5, len(traced))
+	failed, hinted := 0, 0
+	for _, span := range traced[:4] {
+		assert.Equal(t, "replica add", span.Name)
+		assert.Equal(t, tracing.Kind_client, span.Kind)
+		assert.Equal(t, request.Context().Span_id, span.Parent_id)
+		if span.Error != "" {
+			failed++
+		}
+		if span.Attributes["kdb.hinted"] == "true" {
+			hinted++
+		}
+	}
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 1, hinted)
+	assert.Equal(t, "PUT keys", traced[4].Name)
+}
+
+// request_table records the request ids it was given, as a table on another node would send them
+type request_table struct {
+	InMemoryTable
+	request_ids chan string
+}
+
+func (table *request_table) WithContext(ctx context.Context) KeyValueTable {
+	table.request_ids <- logging.RequestId(ctx)
+	return table
+}
+
+func TestReplicaRequestIds(t *testing.T) {
+	hr := metrics_test_ring(3)
+	request_ids := make(chan string, 6)
+	for i := range hr.nodes {
+		hr.nodes[i].table = &request_table{NewInMemoryTable(), request_ids}
+	}
+
+	//without a request id or a trace the tables are used as they are
+	assert.Nil(t, hr.Add("bar", []byte("mar"), NewValueMeta(NewVectorClock())))
+	assert.Equal(t, 0, len(request_ids))
+
+	ctx := logging.WithRequestId(context.Background(), "abc")
+	_, _, err := hr.GetAtContext(ctx, "bar", Consistency_all)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "abc", <-request_ids)
+	}
+}
@@ -66,6 +66,16 @@ func (clock *VectorClock) Equals(other_clock VectorClock) bool {
 	return true
 }
 
+// Descends is true if clock has seen every event ancestor has, including when they are equal
+func (clock *VectorClock) Descends(ancestor *VectorClock) bool {
+	for key, count := range ancestor.Counts {
+		if clock.Get(key) < count {
+			return false
+		}
+	}
+	return true
+}
+
 func MaxUpVectorClocks(clocks []VectorClock) VectorClock {
 	keys := make(map[int]bool)
 	for i := range clocks {
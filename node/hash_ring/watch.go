@@ -0,0 +1,114 @@
+package hash_ring
+
+import (
+	"strings"
+	"sync"
+)
+
+const watch_buffer = 64
+
+// watch_seen_capacity is the number of keys a watch remembers the newest clock of. Versions of keys forgotten
+// since are delivered again, which watchers already handle as they may see the same version on reconnecting
+const watch_seen_capacity = 1024
+
+type WatchEvent struct {
+	Key string
+	//nil when the key was deleted
+	Value []byte
+	Meta  ValueMeta
+}
+
+type watch struct {
+	key       string
+	is_prefix bool
+	events    chan WatchEvent
+	//newest clock delivered for the most recent keys, so versions seen both as coordinator and replica are sent once
+	seen map[string]VectorClock
+	//keys of seen in the order they were added, the oldest is forgotten first
+	seen_order []string
+	next_seen  int
+}
+
+// remember records the newest clock delivered for the key, forgetting the oldest key once full
+func (w *watch) remember(key string, clock VectorClock) {
+	if _, exists := w.seen[key]; !exists {
+		if len(w.seen_order) < watch_seen_capacity {
+			w.seen_order = append(w.seen_order, key)
+		} else {
+			delete(w.seen, w.seen_order[w.next_seen])
+			w.seen_order[w.next_seen] = key
+			w.next_seen = (w.next_seen + 1) % watch_seen_capacity
+		}
+	}
+	w.seen[key] = clock
+}
+
+func (w *watch) matches(key string) bool {
+	if w.is_prefix {
+		//as in scans, prefixes outside of buckets don't match the keys of buckets, which are stored first
+		if !strings.HasPrefix(w.key, bucket_marker) && key < Bucket_keys_end {
+			return false
+		}
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// Watchers wakes watches of keys and prefixes when this node sees a newer version of a matching key,
+// the zero value is ready to use
+type Watchers struct {
+	lock    sync.Mutex
+	watches map[int]*watch
+	next_id int
+}
+
+// Watch returns the id and events of a new watch. A watch that falls too far behind is closed,
+// the watcher then reads the key again and watches from its context
+func (watchers *Watchers) Watch(key string, is_prefix bool) (int, <-chan WatchEvent) {
+	defer watchers.lock.Unlock()
+	watchers.lock.Lock()
+	if watchers.watches == nil {
+		watchers.watches = make(map[int]*watch)
+	}
+	id := watchers.next_id
+	watchers.next_id++
+	w := &watch{key: key, is_prefix: is_prefix, events: make(chan WatchEvent, watch_buffer), seen: make(map[string]VectorClock)}
+	watchers.watches[id] = w
+	return id, w.events
+}
+
+func (watchers *Watchers) Unwatch(id int) {
+	defer watchers.lock.Unlock()
+	watchers.lock.Lock()
+	if w, exists := watchers.watches[id]; exists {
+		close(w.events)
+		delete(watchers.watches, id)
+	}
+}
+
+// Notify tells watches of a version of a key, it is only delivered to those that haven't seen a newer one
+func (watchers *Watchers) Notify(key string, value []byte, meta *ValueMeta) {
+	defer watchers.lock.Unlock()
+	watchers.lock.Lock()
+	for id, w := range watchers.watches {
+		if !w.matches(key) {
+			continue
+		}
+		seen, has_seen := w.seen[key]
+		if has_seen && seen.Descends(&meta.VectorClock) {
+			continue
+		}
+		w.remember(key, meta.VectorClock.Copy())
+
+		event := WatchEvent{key, nil, *meta.Copy()}
+		if !meta.Deleted {
+			event.Value = append([]byte{}, value...)
+		}
+		select {
+		case w.events <- event:
+		default:
+			close(w.events)
+			delete(watchers.watches, id)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package hash_ring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchNewerVersionsOnce(t *testing.T) {
+	hr := Hash_Ring{nodes: Generate_Nodes(5), replication_factor: 3, minimum_writes: 3, minimum_read: 3, conflict_resolution: &ConflictResolutionFirstInstance{}, myId: 0}
+	for i := range hr.nodes {
+		table := NewInMemoryTable()
+		hr.nodes[i].table = &table
+		tempTable := NewInMemoryTable()
+		hr.nodes[i].temporaryTable = &tempTable
+	}
+
+	key_id, key_events := hr.Watchers().Watch("user/1", false)
+	_, prefix_events := hr.Watchers().Watch("user/", true)
+
+	hr.Add("user/1", []byte("mar"), NewValueMeta(NewVectorClock()))
+	hr.Add("other", []byte("car"), NewValueMeta(NewVectorClock()))
+	event := <-key_events
+	assert.Equal(t, "mar", string(event.Value))
+	assert.Equal(t, "user/1", (<-prefix_events).Key)
+
+	//the same version seen again, eg. as a replica, isn't delivered twice
+	hr.Watchers().Notify("user/1", []byte("mar"), &event.Meta)
+	hr.Delete("user/1", &event.Meta)
+	event = <-key_events
+	assert.Nil(t, event.Value)
+	assert.True(t, event.Meta.Deleted)
+	assert.Equal(t, 0, len(key_events))
+
+	hr.Watchers().Unwatch(key_id)
+	_, open := <-key_events
+	assert.False(t, open)
+}
+
+func TestWatchForgetsOldestKeys(t *testing.T) {
+	watchers := Watchers{}
+	id, events := watchers.Watch("user/", true)
+	meta := NewValueMeta(VectorClock{Counts: map[int]int{0: 1}})
+	for i := 0; i < watch_seen_capacity+10; i++ {
+		watchers.Notify(fmt.Sprintf("user/%d", i), []byte("mar"), meta)
+		<-events
+	}
+	w := watchers.watches[id]
+	assert.Equal(t, watch_seen_capacity, len(w.seen))
+	assert.Equal(t, watch_seen_capacity, len(w.seen_order))
+
+	//the newest keys are still delivered once, the oldest were forgotten
+	watchers.Notify(fmt.Sprintf("user/%d", watch_seen_capacity+9), []byte("mar"), meta)
+	assert.Equal(t, 0, len(events))
+	watchers.Notify("user/0", []byte("mar"), meta)
+	assert.Equal(t, "user/0", (<-events).Key)
+	assert.Equal(t, watch_seen_capacity, len(w.seen))
+}
+
+func TestWatchPrefixOutsideBuckets(t *testing.T) {
+	outside := watch{key: "", is_prefix: true}
+	assert.True(t, outside.matches("bar"))
+	assert.False(t, outside.matches(Bucket_Key("users", "bar")))
+
+	inside := watch{key: Bucket_Key("users", ""), is_prefix: true}
+	assert.True(t, inside.matches(Bucket_Key("users", "bar")))
+	assert.False(t, inside.matches(Bucket_Key("admins", "bar")))
+	assert.False(t, inside.matches("bar"))
+}
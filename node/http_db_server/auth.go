@@ -0,0 +1,68 @@
+package http_db_server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+type principal_key struct{}
+
+// SetAuth makes every request authenticate, and checks the permissions of each key before the ring is used.
+// Without it every request is allowed
+func (db *HttpDBServer) SetAuth(authenticator *auth.Auth) {
+	db.auth = authenticator
+}
+
+func (db *HttpDBServer) with_auth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if db.auth == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		principal, err := db.auth.Authenticate(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", auth.Hmac_scheme+", Bearer")
+			write_error(w, 401, "unauthenticated", err.Error())
+			return
+		}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), principal_key{}, principal)))
+	})
+}
+
+// authorize checks the request's principal has the permission on a stored key, or on every key starting
+// with a stored prefix, writing the error response if it doesn't
+func (db *HttpDBServer) authorize(w http.ResponseWriter, req *http.Request, permission auth.Permission, key string) bool {
+	if db.auth == nil {
+		return true
+	}
+	principal, _ := req.Context().Value(principal_key{}).(*auth.Principal)
+	bucket, bucket_key := hash_ring.Split_Bucket_Key(key)
+	if principal == nil || !db.auth.Allowed(principal, permission, bucket, bucket_key) {
+		write_error(w, 403, "forbidden", "Not allowed to "+permission.String()+" "+describe_key(bucket, bucket_key))
+		return false
+	}
+	return true
+}
+
+// authorize_admin checks the request's principal is an admin of every key, for node wide endpoints
+func (db *HttpDBServer) authorize_admin(w http.ResponseWriter, req *http.Request) bool {
+	if db.auth == nil {
+		return true
+	}
+	principal, _ := req.Context().Value(principal_key{}).(*auth.Principal)
+	if principal == nil || !db.auth.IsAdmin(principal) {
+		write_error(w, 403, "forbidden", "Only admins of every bucket are allowed")
+		return false
+	}
+	return true
+}
+
+func describe_key(bucket string, key string) string {
+	if bucket == "" {
+		return "\"" + key + "\""
+	}
+	return "\"" + key + "\" in bucket " + bucket
+}
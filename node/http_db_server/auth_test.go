@@ -0,0 +1,74 @@
+package http_db_server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	assert.Nil(t, hr.SetBuckets([]hash_ring.Bucket{{Name: "orders", Replication_factor: 3, Minimum_writes: 2, Minimum_read: 2}}))
+	sha256_hex := func(key string) string {
+		digest := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(digest[:])
+	}
+	authenticator, err := auth.New(&auth.Config{
+		Api_keys: []auth.ApiKey{{Principal: "alice", Sha256: sha256_hex("alice-key")}, {Principal: "root", Sha256: sha256_hex("root-key")}},
+		Rules: []auth.Rule{
+			{Principal: "alice", Prefix: "users/", Permissions: []string{"read", "write"}},
+			{Principal: "alice", Bucket: "orders", Permissions: []string{"read"}},
+			{Principal: "root", Bucket: auth.Any, Permissions: []string{"admin"}},
+		},
+	})
+	assert.Nil(t, err)
+	db := NewHttpDBServer(&Config{}, &hr)
+	db.SetAuth(authenticator)
+	server := httptest.NewServer(db.Handler())
+	defer server.Close()
+
+	send := func(method string, url string, body string, key string) int {
+		req, _ := http.NewRequest(method, server.URL+url, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(auth.ApiKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 401, send("GET", "/v1/keys/users%2F1", "", ""))
+	assert.Equal(t, 401, send("GET", "/v1/keys/users%2F1", "", "guess"))
+	assert.Equal(t, 204, send("PUT", "/v1/keys/users%2F1", "mar", "alice-key"))
+	assert.Equal(t, 200, send("GET", "/v1/keys/users%2F1", "", "alice-key"))
+	assert.Equal(t, 403, send("PUT", "/v1/keys/orders%2F1", "mar", "alice-key"))
+	assert.Equal(t, 403, send("PUT", "/v1/buckets/orders/keys/1", "mar", "alice-key"))
+	assert.Equal(t, 204, send("PUT", "/v1/buckets/orders/keys/1", "mar", "root-key"))
+	assert.Equal(t, 200, send("GET", "/v1/buckets/orders/keys/1", "", "alice-key"))
+
+	//scans need the permission on every key they could return
+	assert.Equal(t, 200, send("GET", "/v1/scan?prefix=users%2F", "", "alice-key"))
+	assert.Equal(t, 403, send("GET", "/v1/scan", "", "alice-key"))
+	assert.Equal(t, 200, send("GET", "/v1/scan", "", "root-key"))
+
+	//every key of a batch is checked
+	assert.Equal(t, 403, send("POST", "/v1/batch/put", `{"items":[{"key":"users/2","value":"bWFy"},{"key":"orders/2","value":"bWFy"}]}`, "alice-key"))
+
+	assert.Equal(t, 403, send("GET", "/get_all_local", "", "alice-key"))
+	assert.Equal(t, 200, send("GET", "/get_all_local", "", "root-key"))
+}
@@ -0,0 +1,158 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const Max_batch_keys = 1000
+
+type BatchGetRequestBody struct {
+	Keys []string `json:"keys"`
+}
+
+type BatchPutItem struct {
+	Key string `json:"key"`
+	//base64 encoded in json
+	Value        []byte `json:"value"`
+	Content_type string `json:"content_type,omitempty"`
+	Context      string `json:"context,omitempty"`
+	//seconds until the value expires, 0 if it doesn't
+	Ttl int64 `json:"ttl,omitempty"`
+}
+
+type BatchPutRequestBody struct {
+	Items []BatchPutItem `json:"items"`
+}
+
+type BatchResult struct {
+	Key          string `json:"key"`
+	Found        bool   `json:"found,omitempty"`
+	Value        []byte `json:"value,omitempty"`
+	Content_type string `json:"content_type,omitempty"`
+	Context      string `json:"context,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+type BatchResponseBody struct {
+	Results []BatchResult `json:"results"`
+}
+
+// read_batch decodes a batch body, writing the error response if it is invalid
+func read_batch(w http.ResponseWriter, req *http.Request, body interface{}) bool {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on batches")
+		return false
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, Max_batch_keys*Max_value_size))
+	if err := decoder.Decode(body); err != nil {
+		var too_large *http.MaxBytesError
+		if errors.As(err, &too_large) {
+			write_error(w, 413, "too_large", "Batch is larger than the maximum size")
+		} else {
+			write_error(w, 400, "bad_body", err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// batch_get handles POST /v1/batch/get, each key has its own result and error,
+// so a key whose replicas are down doesn't fail the whole batch
+func (db *HttpDBServer) batch_get(w http.ResponseWriter, req *http.Request) {
+	var body BatchGetRequestBody
+	if !read_batch(w, req, &body) {
+		return
+	}
+	if len(body.Keys) > Max_batch_keys {
+		write_error(w, 413, "too_large", "Batch has more than the maximum number of keys")
+		return
+	}
+	for _, key := range body.Keys {
+		if !db.authorize(w, req, auth.Permission_read, key) {
+			return
+		}
+	}
+
+	results := db.hr.MultiGetAtContext(req.Context(), body.Keys, hash_ring.Consistency_default)
+	response := BatchResponseBody{make([]BatchResult, len(body.Keys))}
+	for i := range results {
+		result := &response.Results[i]
+		result.Key = body.Keys[i]
+		if results[i].Err != nil {
+			result.Error = error_code(results[i].Err)
+			result.Message = results[i].Err.Error()
+			continue
+		}
+		result.Found = results[i].Value != nil
+		result.Value = results[i].Value
+		result.Content_type = results[i].Meta.ContentType
+		result.Context = EncodeContext(results[i].Meta)
+	}
+	write_json(w, 200, response)
+}
+
+// batch_put handles POST /v1/batch/put. The contexts of items are used as the clocks the writes follow,
+// unlike PUT /v1/keys they are not checked against the current version
+func (db *HttpDBServer) batch_put(w http.ResponseWriter, req *http.Request) {
+	var body BatchPutRequestBody
+	if !read_batch(w, req, &body) {
+		return
+	}
+	if len(body.Items) > Max_batch_keys {
+		write_error(w, 413, "too_large", "Batch has more than the maximum number of keys")
+		return
+	}
+	for i := range body.Items {
+		if !db.authorize(w, req, auth.Permission_write, body.Items[i].Key) {
+			return
+		}
+	}
+
+	keys := make([]string, len(body.Items))
+	values := make([][]byte, len(body.Items))
+	metas := make([]*hash_ring.ValueMeta, len(body.Items))
+	for i := range body.Items {
+		meta, err := DecodeContext(body.Items[i].Context)
+		if err != nil {
+			write_error(w, 400, "bad_context", body.Items[i].Key+": "+err.Error())
+			return
+		}
+		meta.ContentType = body.Items[i].Content_type
+		if body.Items[i].Ttl < 0 {
+			write_error(w, 400, "bad_ttl", body.Items[i].Key+": ttl must be a positive number of seconds")
+			return
+		}
+		if body.Items[i].Ttl != 0 {
+			meta.ExpireAfter(time.Duration(body.Items[i].Ttl) * time.Second)
+		}
+		keys[i] = body.Items[i].Key
+		values[i] = body.Items[i].Value
+		if values[i] == nil {
+			values[i] = []byte{}
+		}
+		if !db.admit_write(w, keys[i], len(values[i])) {
+			return
+		}
+		metas[i] = meta
+	}
+
+	errs := db.hr.MultiAddAtContext(req.Context(), keys, values, metas, hash_ring.Consistency_default)
+	response := BatchResponseBody{make([]BatchResult, len(keys))}
+	for i := range errs {
+		response.Results[i].Key = keys[i]
+		if errs[i] != nil {
+			response.Results[i].Error = error_code(errs[i])
+			response.Results[i].Message = errs[i].Error()
+		}
+	}
+	write_json(w, 200, response)
+}
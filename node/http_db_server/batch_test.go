@@ -0,0 +1,38 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchPutGet(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+
+	put := `{"items":[{"key":"bar","value":"bWFy"},{"key":"foo","value":"Y2Fy","content_type":"text/plain"}]}`
+	resp, err := http.Post(server.URL+"/v1/batch/put", "application/json", strings.NewReader(put))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var put_body BatchResponseBody
+	json.NewDecoder(resp.Body).Decode(&put_body)
+	assert.Equal(t, []BatchResult{{Key: "bar"}, {Key: "foo"}}, put_body.Results)
+
+	resp, err = http.Post(server.URL+"/v1/batch/get", "application/json", strings.NewReader(`{"keys":["foo","missing","bar"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var get_body BatchResponseBody
+	json.NewDecoder(resp.Body).Decode(&get_body)
+	assert.Equal(t, 3, len(get_body.Results))
+	assert.Equal(t, "car", string(get_body.Results[0].Value))
+	assert.Equal(t, "text/plain", get_body.Results[0].Content_type)
+	assert.False(t, get_body.Results[1].Found)
+	assert.Equal(t, "mar", string(get_body.Results[2].Value))
+	assert.NotEmpty(t, get_body.Results[2].Context)
+
+	resp = do(t, "GET", server.URL+"/v1/batch/get", "", "")
+	assert.Equal(t, 405, resp.StatusCode)
+}
@@ -0,0 +1,89 @@
+package http_db_server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const buckets_path = "/v1/buckets/"
+
+type BucketBody struct {
+	Name                string `json:"name"`
+	Replication_factor  int    `json:"replication_factor"`
+	Minimum_writes      int    `json:"minimum_writes"`
+	Minimum_read        int    `json:"minimum_read"`
+	Conflict_resolution string `json:"conflict_resolution,omitempty"`
+	//seconds until values written without a ttl expire
+	Default_ttl int `json:"default_ttl,omitempty"`
+}
+
+type BucketsResponseBody struct {
+	Buckets []BucketBody `json:"buckets"`
+}
+
+func bucket_body(bucket *hash_ring.Bucket) BucketBody {
+	return BucketBody{
+		Name:                bucket.Name,
+		Replication_factor:  bucket.Replication_factor,
+		Minimum_writes:      bucket.Minimum_writes,
+		Minimum_read:        bucket.Minimum_read,
+		Conflict_resolution: bucket.Conflict_resolution,
+		Default_ttl:         bucket.Default_ttl,
+	}
+}
+
+// buckets handles GET /v1/buckets, listing the buckets created by the cluster manager
+func (db *HttpDBServer) buckets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on buckets")
+		return
+	}
+	buckets := db.hr.Buckets()
+	body := BucketsResponseBody{Buckets: make([]BucketBody, len(buckets))}
+	for i := range buckets {
+		body.Buckets[i] = bucket_body(&buckets[i])
+	}
+	write_json(w, 200, body)
+}
+
+// bucket handles /v1/buckets/{bucket} giving its settings, /v1/buckets/{bucket}/keys/{key} which is
+// /v1/keys/{key} within the bucket, and /v1/buckets/{bucket}/scan and /v1/buckets/{bucket}/watch
+// which are /v1/scan and /v1/watch within the bucket
+func (db *HttpDBServer) bucket(w http.ResponseWriter, req *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.EscapedPath(), buckets_path), "/")
+	name, err := url.PathUnescape(name)
+	if err != nil {
+		write_error(w, 400, "bad_bucket", err.Error())
+		return
+	}
+	bucket, exists := db.hr.Bucket(name)
+	if !exists {
+		write_error(w, 404, "bucket_not_found", "Bucket not found")
+		return
+	}
+
+	switch {
+	case rest == "":
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			write_error(w, 405, "method_not_allowed", req.Method+" is not supported on buckets")
+			return
+		}
+		write_json(w, 200, bucket_body(&bucket))
+	case strings.HasPrefix(rest, "keys/"):
+		key, ok := parse_key(w, strings.TrimPrefix(rest, "keys/"))
+		if ok {
+			db.key(w, req, hash_ring.Bucket_Key(name, key))
+		}
+	case rest == "scan":
+		db.scan_bucket(w, req, name)
+	case rest == "watch":
+		db.watch_bucket(w, req, name)
+	default:
+		write_error(w, 404, "not_found", "Not found")
+	}
+}
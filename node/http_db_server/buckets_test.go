@@ -0,0 +1,64 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuckets(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	assert.Nil(t, hr.SetBuckets([]hash_ring.Bucket{{Name: "users", Replication_factor: 2, Minimum_writes: 1, Minimum_read: 1, Default_ttl: 60}}))
+	server := httptest.NewServer(NewHttpDBServer(&Config{}, &hr).Handler())
+	defer server.Close()
+
+	resp, _ := http.Get(server.URL + "/v1/buckets")
+	assert.Equal(t, 200, resp.StatusCode)
+	var buckets BucketsResponseBody
+	json.NewDecoder(resp.Body).Decode(&buckets)
+	assert.Equal(t, []BucketBody{{Name: "users", Replication_factor: 2, Minimum_writes: 1, Minimum_read: 1, Default_ttl: 60}}, buckets.Buckets)
+
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/buckets/users/keys/bar", "mar", "").StatusCode)
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/bar", "car", "").StatusCode)
+
+	resp = do(t, "GET", server.URL+"/v1/buckets/users/keys/bar", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "mar", string(body))
+	assert.NotEqual(t, "", resp.Header.Get("Expires"))
+
+	//the same key outside of the bucket is another key
+	resp = do(t, "GET", server.URL+"/v1/keys/bar", "", "")
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "car", string(body))
+	assert.Equal(t, "", resp.Header.Get("Expires"))
+
+	scan := func(url string) []string {
+		resp, _ := http.Get(url)
+		assert.Equal(t, 200, resp.StatusCode)
+		var body ScanResponseBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		keys := []string{}
+		for _, item := range body.Items {
+			keys = append(keys, item.Key+"="+string(item.Value))
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"bar=mar"}, scan(server.URL+"/v1/buckets/users/scan"))
+	assert.Equal(t, []string{"bar=car"}, scan(server.URL+"/v1/scan"))
+
+	assert.Equal(t, 404, do(t, "GET", server.URL+"/v1/buckets/orders/keys/bar", "", "").StatusCode)
+	assert.Equal(t, 400, do(t, "GET", server.URL+"/v1/keys/%00users%00bar", "", "").StatusCode)
+}
@@ -0,0 +1,122 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const changes_heartbeat = 15 * time.Second
+
+// ChangeLogIdHeader names the change log the stream's sequence numbers belong to, they start again in a new log
+// when the node restarts
+const ChangeLogIdHeader = "X-Change-Log-Id"
+
+type ChangeEvent struct {
+	Sequence uint64 `json:"sequence"`
+	Key      string `json:"key"`
+	//base64 encoded in json
+	Value        []byte `json:"value,omitempty"`
+	Content_type string `json:"content_type,omitempty"`
+	Deleted      bool   `json:"deleted,omitempty"`
+	Context      string `json:"context"`
+	Origin       uint64 `json:"origin"`
+}
+
+func change_event(change *hash_ring.Change) ChangeEvent {
+	return ChangeEvent{
+		Sequence:     change.Sequence,
+		Key:          change.Key,
+		Value:        change.Value,
+		Content_type: change.Meta.ContentType,
+		Deleted:      change.Meta.Deleted,
+		Context:      EncodeContext(&change.Meta),
+		Origin:       change.Meta.Origin,
+	}
+}
+
+// changes streams the permanent writes stored on this node as server sent events, with the change log's id and
+// the sequence number as the event id, log_id:sequence, so reconnecting with Last-Event-ID resumes the stream.
+// ?from= starts from a sequence number, checked against ?log_id= when given, otherwise only new changes are sent.
+// A consumer resuming from a log the node no longer has, as it restarted, gets a 410 and must resync.
+// Every replica logs its own writes, so consumers following the whole cluster subscribe to every node
+// and drop versions they have already seen by vector clock
+func (db *HttpDBServer) changes(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on changes")
+		return
+	}
+	if !db.authorize_admin(w, req) {
+		return
+	}
+	change_log := db.hr.ChangeLog()
+	flusher, can_flush := w.(http.Flusher)
+	if change_log == nil || !can_flush {
+		write_error(w, 501, "not_supported", "Changes are not recorded by this node")
+		return
+	}
+
+	from := change_log.Next()
+	log_id := req.URL.Query().Get("log_id")
+	var err error
+	if last_event_id := req.Header.Get("Last-Event-ID"); last_event_id != "" {
+		sequence := last_event_id
+		if separator := strings.LastIndex(last_event_id, ":"); separator != -1 {
+			log_id, sequence = last_event_id[:separator], last_event_id[separator+1:]
+		}
+		from, err = strconv.ParseUint(sequence, 10, 64)
+		from++
+	} else if req.URL.Query().Has("from") {
+		from, err = strconv.ParseUint(req.URL.Query().Get("from"), 10, 64)
+	}
+	if err != nil {
+		write_error(w, 400, "bad_sequence", "Sequence numbers must be unsigned integers")
+		return
+	}
+	w.Header().Set(ChangeLogIdHeader, change_log.Id())
+	if (log_id != "" && log_id != change_log.Id()) || from > change_log.Next() {
+		write_error(w, 410, "reset", hash_ring.ErrChangeLogReset.Error())
+		return
+	}
+	if from < change_log.First() {
+		write_error(w, 410, "truncated", hash_ring.ErrChangesTruncated.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(changes_heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+			continue
+		case <-change_log.Appended(from):
+		}
+
+		changes, err := change_log.Read(from, 1000)
+		if err != nil {
+			//the consumer fell too far behind, it reconnects and gets a 410
+			return
+		}
+		for i := range changes {
+			data, _ := json.Marshal(change_event(&changes[i]))
+			fmt.Fprintf(w, "id: %s:%d\nevent: change\ndata: %s\n\n", change_log.Id(), changes[i].Sequence, data)
+		}
+		flusher.Flush()
+		from = changes[len(changes)-1].Sequence + 1
+	}
+}
@@ -0,0 +1,69 @@
+package http_db_server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangesResume(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	change_log := hash_ring.NewChangeLog(10)
+	hr.SetChangeLog(change_log)
+	server := httptest.NewServer(NewHttpDBServer(&Config{}, &hr).Handler())
+	defer server.Close()
+	url := server.URL + "/v1/changes"
+
+	meta := hash_ring.NewValueMeta(hash_ring.NewVectorClock())
+	for _, key := range []string{"bar", "foo"} {
+		change_log.Append(key, []byte("value"), meta)
+	}
+
+	changes := func(last_event_id string, query string) *http.Response {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", url+query, nil)
+		if last_event_id != "" {
+			req.Header.Set("Last-Event-ID", last_event_id)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	resp := changes(change_log.Id()+":1", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, change_log.Id(), resp.Header.Get(ChangeLogIdHeader))
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, "id: "+change_log.Id()+":2\n", line)
+	resp.Body.Close()
+
+	//a consumer of the log before a restart, further along or with another log id, has to resync
+	for _, last_event_id := range []string{change_log.Id() + ":5000", "0123456789abcdef:1", "5000"} {
+		resp = changes(last_event_id, "")
+		assert.Equal(t, 410, resp.StatusCode)
+		assert.Equal(t, change_log.Id(), resp.Header.Get(ChangeLogIdHeader))
+	}
+	assert.Equal(t, 410, changes("", "?from=5000").StatusCode)
+	assert.Equal(t, 410, changes("", "?from=1&log_id=0123456789abcdef").StatusCode)
+
+	resp = changes("", "?from=1&log_id="+change_log.Id())
+	assert.Equal(t, 200, resp.StatusCode)
+	line, _ = bufio.NewReader(resp.Body).ReadString('\n')
+	assert.True(t, strings.HasSuffix(line, ":1\n"))
+	resp.Body.Close()
+}
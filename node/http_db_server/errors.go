@@ -0,0 +1,72 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+type ErrorResponseBody struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	//base64 encoded, as values may not be text
+	Value        []byte `json:"value,omitempty"`
+	Content_type string `json:"content_type,omitempty"`
+	Context      string `json:"context,omitempty"`
+}
+
+func write_json(w http.ResponseWriter, status int, body interface{}) {
+	json_string, err := json.Marshal(body)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(json_string)
+}
+
+func write_error(w http.ResponseWriter, status int, code string, message string) {
+	if recorder, is_recorder := w.(*status_recorder); is_recorder {
+		recorder.record_error(message)
+	}
+	write_json(w, status, ErrorResponseBody{Error: code, Message: message})
+}
+
+// error_code gives the code used in error bodies for errors from the hash ring
+func error_code(err error) string {
+	if errors.Is(err, hash_ring.ErrQuorumNotMet) || errors.Is(err, hash_ring.ErrNoNodes) {
+		return "unavailable"
+	}
+	return "internal"
+}
+
+// write_ring_error maps errors from the hash ring onto status codes
+func write_ring_error(w http.ResponseWriter, err error) {
+	var conflict *hash_ring.ConflictError
+	var precondition *hash_ring.PreconditionFailedError
+	switch {
+	case errors.As(err, &conflict):
+		write_json(w, 409, ErrorResponseBody{
+			Error:        "conflict",
+			Message:      err.Error(),
+			Value:        conflict.Value,
+			Content_type: conflict.Meta.ContentType,
+			Context:      EncodeContext(conflict.Meta),
+		})
+	case errors.As(err, &precondition):
+		write_json(w, 412, ErrorResponseBody{
+			Error:        "precondition_failed",
+			Message:      err.Error(),
+			Value:        precondition.Value,
+			Content_type: precondition.Meta.ContentType,
+			Context:      EncodeContext(precondition.Meta),
+		})
+	case error_code(err) == "unavailable":
+		write_error(w, 503, "unavailable", err.Error())
+	default:
+		write_error(w, 500, "internal", err.Error())
+	}
+}
@@ -4,18 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
 	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
 )
 
 type HttpDBServer struct {
 	hr                   *hash_ring.Hash_Ring
 	http_external_server *http.Server
 	My_id                uint64
+	//the cluster config this node is running, served to clients at /v1/ring
+	ring_config func() *distributed_hash_ring.SharedConfig
+	//nil allows every request, see SetAuth
+	auth *auth.Auth
+	//nil leaves requests and writes unlimited, see SetLimits
+	limiter *limits.Limiter
+	//nil leaves clients unlimited before they authenticate, see SetIpLimits
+	ip_limiter *limits.Limiter
+	quotas     *limits.QuotaTracker
+	logger     *slog.Logger
 }
 
 type Config struct {
@@ -26,21 +40,32 @@ type Config struct {
 func NewHttpDBServer(config *Config, hr *hash_ring.Hash_Ring) *HttpDBServer {
 	http_mux := http.NewServeMux()
 
-	http_external_server := http.Server{
+	db := HttpDBServer{
+		hr:     hr,
+		My_id:  config.My_id,
+		logger: slog.Default(),
+	}
+	db.http_external_server = &http.Server{
 		Addr:        ":" + strconv.Itoa(config.Http_port),
 		ConnContext: SaveConnInContext,
-		Handler:     http_mux,
-	}
-
-	db := HttpDBServer{
-		hr,
-		&http_external_server,
-		config.My_id,
+		Handler:     db.with_request_id(db.with_epoch(db.with_tracing(db.with_ip_rate_limit(db.with_auth(db.with_rate_limit(http_mux)))))),
 	}
 
 	http_mux.HandleFunc("/add", db.add)
 	http_mux.HandleFunc("/get", db.get)
 	http_mux.HandleFunc("/get_all_local", db.get_all_local)
+	http_mux.HandleFunc(keys_path, db.keys)
+	http_mux.HandleFunc("/v1/batch/get", db.batch_get)
+	http_mux.HandleFunc("/v1/batch/put", db.batch_put)
+	http_mux.HandleFunc("/v1/scan", db.scan)
+	http_mux.HandleFunc("/v1/changes", db.changes)
+	http_mux.HandleFunc("/v1/watch", db.watch)
+	http_mux.HandleFunc("/v1/ring", db.ring)
+	http_mux.HandleFunc("/v1/buckets", db.buckets)
+	http_mux.HandleFunc(buckets_path, db.bucket)
+	http_mux.HandleFunc("/metrics", db.metrics)
+	http_mux.HandleFunc("/v1/log_level", db.log_level)
+	http_mux.HandleFunc("/v1/slow_queries", db.slow_queries)
 
 	return &db
 
@@ -54,6 +79,11 @@ func (db *HttpDBServer) Stop() {
 	}
 }
 
+// Handler serves the same requests as the server, for tests and embedding
+func (db *HttpDBServer) Handler() http.Handler {
+	return db.http_external_server.Handler
+}
+
 func (db *HttpDBServer) Start() {
 	db.http_external_server.ListenAndServe()
 }
@@ -62,40 +92,52 @@ func (db *HttpDBServer) get(w http.ResponseWriter, req *http.Request) {
 	query := req.URL.Query()
 
 	if !query.Has("key") {
-		w.WriteHeader(400)
+		write_error(w, 400, "missing_key", "Missing key query parameter")
 		return
 	}
 
 	key := query.Get("key")
+	if !db.authorize(w, req, auth.Permission_read, key) {
+		return
+	}
 
-	value, _, err := db.hr.Get(key)
+	value, _, err := db.hr.GetAtContext(req.Context(), key, hash_ring.Consistency_default)
 
 	if err == nil {
-		json_string, json_err := json.Marshal(value)
+		//kept as a json string for existing clients, /v1/keys returns the raw bytes
+		var json_value *string
+		if value != nil {
+			string_value := string(value)
+			json_value = &string_value
+		}
+		json_string, json_err := json.Marshal(json_value)
 		if json_err == nil {
 			w.WriteHeader(200)
 			w.Write(json_string)
 		} else {
-			w.WriteHeader(500)
+			write_error(w, 500, "internal", json_err.Error())
 		}
 	} else {
-		w.WriteHeader(500)
+		write_error(w, 500, "internal", err.Error())
 	}
 }
 
 type Context struct {
-	clock hash_ring.VectorClock
+	Clock hash_ring.VectorClock `json:"clock"`
 }
 
 func (db *HttpDBServer) add(w http.ResponseWriter, req *http.Request) {
 	query := req.URL.Query()
 
 	if !query.Has("key") {
-		w.WriteHeader(400)
+		write_error(w, 400, "missing_key", "Missing key query parameter")
 		return
 	}
 
 	key := query.Get("key")
+	if !db.authorize(w, req, auth.Permission_write, key) {
+		return
+	}
 
 	var value string = ""
 	if query.Has("value") {
@@ -106,17 +148,21 @@ func (db *HttpDBServer) add(w http.ResponseWriter, req *http.Request) {
 	if query.Has("context") {
 		err := json.Unmarshal([]byte(query.Get("context")), &context)
 		if err != nil {
-			w.WriteHeader(500)
+			write_error(w, 400, "bad_context", err.Error())
 			return
 		}
 	}
 
-	err := db.hr.Add(key, value, hash_ring.NewValueMeta(context.clock))
+	if !db.admit_write(w, key, len(value)) {
+		return
+	}
+
+	err := db.hr.AddAtContext(req.Context(), key, []byte(value), hash_ring.NewValueMeta(context.Clock), hash_ring.Consistency_default)
 
 	if err == nil {
 		w.WriteHeader(200)
 	} else {
-		w.WriteHeader(500)
+		write_error(w, 500, "internal", err.Error())
 	}
 }
 
@@ -126,6 +172,9 @@ type GetAllLocalResponseBody struct {
 }
 
 func (db *HttpDBServer) get_all_local(w http.ResponseWriter, req *http.Request) {
+	if !db.authorize_admin(w, req) {
+		return
+	}
 	nodes := db.hr.Nodes()
 	perm_values := make(map[string]string)
 	temp_values := make(map[string]string)
@@ -147,7 +196,7 @@ func (db *HttpDBServer) get_all_local(w http.ResponseWriter, req *http.Request)
 		w.WriteHeader(200)
 		w.Write(json_string)
 	} else {
-		w.WriteHeader(500)
+		write_error(w, 500, "internal", json_err.Error())
 	}
 }
 
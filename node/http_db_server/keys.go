@@ -0,0 +1,293 @@
+package http_db_server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const keys_path = "/v1/keys/"
+
+// ContextHeader carries the vector clock of a read back into later writes
+const ContextHeader = "X-Context"
+
+const Max_value_size = 1 << 20
+
+// ReplicasHeader lists the physical ids of the nodes that answered a read
+const ReplicasHeader = "X-Replicas"
+
+// Default_content_type is returned for values written without a Content-Type
+const Default_content_type = "application/octet-stream"
+
+// EncodeContext gives the opaque context handed to clients, base64url encoded json of the vector clock
+func EncodeContext(meta *hash_ring.ValueMeta) string {
+	if meta == nil {
+		return ""
+	}
+	json_string, err := json.Marshal(meta.VectorClock.Counts)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(json_string)
+}
+
+// DecodeContext reverses EncodeContext, an empty context is an empty clock
+func DecodeContext(context string) (*hash_ring.ValueMeta, error) {
+	clock := hash_ring.NewVectorClock()
+	if context == "" {
+		return hash_ring.NewValueMeta(clock), nil
+	}
+	json_string, err := base64.RawURLEncoding.DecodeString(context)
+	if err != nil {
+		return nil, errors.New("Context is not base64url encoded")
+	}
+	if err := json.Unmarshal(json_string, &clock.Counts); err != nil {
+		return nil, errors.New("Context is not a vector clock")
+	}
+	if clock.Counts == nil {
+		clock = hash_ring.NewVectorClock()
+	}
+	return hash_ring.NewValueMeta(clock), nil
+}
+
+// condition reads If-Match, giving the version a conditional write expects.
+// Contexts are also sent as the ETag, so If-Match may quote them
+func condition(req *http.Request) (*hash_ring.ValueMeta, bool, error) {
+	if if_match := req.Header.Get("If-Match"); if_match != "" {
+		meta, err := DecodeContext(strings.Trim(if_match, "\""))
+		return meta, true, err
+	}
+	return nil, false, nil
+}
+
+// if_absent is whether If-None-Match: * only allows the write when the key has no current value
+func if_absent(req *http.Request) bool {
+	return req.Header.Get("If-Match") == "" && req.Header.Get("If-None-Match") == "*"
+}
+
+// parse_consistency reads ?consistency=, one, quorum or all, by default the configured quorums
+func parse_consistency(req *http.Request) (hash_ring.Consistency, error) {
+	return hash_ring.Consistency_By_Name(req.URL.Query().Get("consistency"))
+}
+
+// parse_ttl reads ?ttl=, the seconds until the value expires, 0 if it doesn't
+func parse_ttl(req *http.Request) (time.Duration, error) {
+	if !req.URL.Query().Has("ttl") {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseInt(req.URL.Query().Get("ttl"), 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, errors.New("ttl must be a positive number of seconds")
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// parse_key reads the key from the rest of the path after a keys path
+func parse_key(w http.ResponseWriter, escaped_key string) (string, bool) {
+	//keys containing / are sent escaped as %2F
+	key, err := url.PathUnescape(escaped_key)
+	if err != nil || key == "" || strings.Contains(escaped_key, "/") {
+		write_error(w, 400, "bad_key", "Key must be a single non empty path segment")
+		return "", false
+	}
+	return key, true
+}
+
+func (db *HttpDBServer) keys(w http.ResponseWriter, req *http.Request) {
+	key, ok := parse_key(w, strings.TrimPrefix(req.URL.EscapedPath(), keys_path))
+	if !ok {
+		return
+	}
+	//would be read as the key of a bucket
+	if bucket, _ := hash_ring.Split_Bucket_Key(key); bucket != "" {
+		write_error(w, 400, "bad_key", "Keys outside of buckets must not start with a NUL byte")
+		return
+	}
+	db.key(w, req, key)
+}
+
+// key serves a key by the key it is stored under, see hash_ring.Bucket_Key
+func (db *HttpDBServer) key(w http.ResponseWriter, req *http.Request, key string) {
+	level, err := parse_consistency(req)
+	if err != nil {
+		write_error(w, 400, "bad_consistency", err.Error())
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if db.authorize(w, req, auth.Permission_read, key) {
+			db.get_key(w, req, key, level)
+		}
+	case http.MethodPut:
+		if db.authorize(w, req, auth.Permission_write, key) {
+			db.put_key(w, req, key, level)
+		}
+	case http.MethodDelete:
+		if db.authorize(w, req, auth.Permission_write, key) {
+			db.delete_key(w, req, key, level)
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on keys")
+	}
+}
+
+func (db *HttpDBServer) get_key(w http.ResponseWriter, req *http.Request, key string, level hash_ring.Consistency) {
+	value, meta, replicas, err := db.hr.GetWithReplicasContext(req.Context(), key, level)
+	if err != nil {
+		write_ring_error(w, err)
+		return
+	}
+
+	replica_ids := make([]string, len(replicas))
+	for i := range replicas {
+		replica_ids[i] = strconv.FormatUint(replicas[i], 10)
+	}
+	w.Header().Set(ReplicasHeader, strings.Join(replica_ids, ","))
+
+	//deleted keys still hand back a context, so the next write supersedes the tombstone
+	w.Header().Set(ContextHeader, EncodeContext(meta))
+	w.Header().Set("ETag", "\""+EncodeContext(meta)+"\"")
+	if value == nil {
+		write_error(w, 404, "not_found", "Key not found")
+		return
+	}
+
+	content_type := meta.ContentType
+	if content_type == "" {
+		content_type = Default_content_type
+	}
+	w.Header().Set("Content-Type", content_type)
+	if meta.Expires != 0 {
+		w.Header().Set("Expires", time.UnixMilli(meta.Expires).UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(200)
+	w.Write(value)
+}
+
+func (db *HttpDBServer) put_key(w http.ResponseWriter, req *http.Request, key string, level hash_ring.Consistency) {
+	meta, err := DecodeContext(req.Header.Get(ContextHeader))
+	if err != nil {
+		write_error(w, 400, "bad_context", err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, Max_value_size))
+	if err != nil {
+		var too_large *http.MaxBytesError
+		if errors.As(err, &too_large) {
+			write_error(w, 413, "too_large", "Value is larger than the maximum size")
+		} else {
+			write_error(w, 400, "bad_body", err.Error())
+		}
+		return
+	}
+
+	expected, conditional, err := condition(req)
+	if err != nil {
+		write_error(w, 400, "bad_context", err.Error())
+		return
+	}
+
+	ttl, err := parse_ttl(req)
+	if err != nil {
+		write_error(w, 400, "bad_ttl", err.Error())
+		return
+	}
+
+	if !db.admit_write(w, key, len(body)) {
+		return
+	}
+
+	meta.ContentType = req.Header.Get("Content-Type")
+	if ttl != 0 {
+		meta.ExpireAfter(ttl)
+	}
+
+	if conditional {
+		expected.ContentType = meta.ContentType
+		expected.Expires = meta.Expires
+		meta = expected
+		err = db.hr.AddIfAtContext(req.Context(), key, body, expected, level)
+	} else if if_absent(req) {
+		//deleted and expired keys have no current value either, the write supersedes their version
+		err = db.hr.AddIfAbsentAtContext(req.Context(), key, body, meta, level)
+	} else if req.Header.Get(ContextHeader) == "" {
+		//writes without a context can't have seen any version, so they only conflict through resolution
+		err = db.hr.AddAtContext(req.Context(), key, body, meta, level)
+	} else {
+		err = db.hr.AddCausalAtContext(req.Context(), key, body, meta, level)
+	}
+	if err != nil {
+		write_ring_error(w, err)
+		return
+	}
+	//the context of the version written, so the writer can keep writing without reading again
+	w.Header().Set(ContextHeader, EncodeContext(db.hr.WrittenMeta(meta)))
+	w.WriteHeader(204)
+}
+
+func (db *HttpDBServer) delete_key(w http.ResponseWriter, req *http.Request, key string, level hash_ring.Consistency) {
+	meta, err := DecodeContext(req.Header.Get(ContextHeader))
+	if err != nil {
+		write_error(w, 400, "bad_context", err.Error())
+		return
+	}
+
+	expected, conditional, err := condition(req)
+	if err != nil {
+		write_error(w, 400, "bad_context", err.Error())
+		return
+	}
+	if conditional {
+		if err := db.hr.DeleteIfAtContext(req.Context(), key, expected, level); err != nil {
+			write_ring_error(w, err)
+			return
+		}
+		w.Header().Set(ContextHeader, EncodeContext(db.hr.WrittenMeta(expected)))
+		w.WriteHeader(204)
+		return
+	}
+	if if_absent(req) {
+		value, current_meta, err := db.hr.GetAtContext(req.Context(), key, level)
+		if err == nil && value != nil {
+			err = &hash_ring.PreconditionFailedError{Value: value, Meta: current_meta}
+		}
+		if err != nil {
+			write_ring_error(w, err)
+			return
+		}
+		//there is nothing to delete
+		w.Header().Set(ContextHeader, EncodeContext(current_meta))
+		w.WriteHeader(204)
+		return
+	}
+
+	//a delete without a context removes whatever is currently stored
+	if req.Header.Get(ContextHeader) == "" {
+		_, current_meta, err := db.hr.GetAtContext(req.Context(), key, level)
+		if err != nil {
+			write_ring_error(w, err)
+			return
+		}
+		meta = current_meta
+	}
+
+	if err := db.hr.DeleteAtContext(req.Context(), key, meta, level); err != nil {
+		write_ring_error(w, err)
+		return
+	}
+	//the tombstone has the clock a write would, so later writes can supersede it
+	w.Header().Set(ContextHeader, EncodeContext(db.hr.WrittenMeta(meta)))
+	w.WriteHeader(204)
+}
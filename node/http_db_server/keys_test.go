@@ -0,0 +1,207 @@
+package http_db_server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_server() *httptest.Server {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	db := NewHttpDBServer(&Config{}, &hr)
+	return httptest.NewServer(db.http_external_server.Handler)
+}
+
+func do(t *testing.T, method string, url string, body string, context string) *http.Response {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if context != "" {
+		req.Header.Set(ContextHeader, context)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestKeysResource(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/keys/bar"
+
+	resp := do(t, "GET", url, "", "")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	resp = do(t, "PUT", url, "mar", "")
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = do(t, "GET", url, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "mar", string(body))
+	context := resp.Header.Get(ContextHeader)
+
+	resp = do(t, "PUT", url, "car", context)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	//the first context has been superseded
+	resp = do(t, "PUT", url, "jar", context)
+	assert.Equal(t, 409, resp.StatusCode)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"value":"Y2Fy"`)
+
+	resp = do(t, "DELETE", url, "", "")
+	assert.Equal(t, 204, resp.StatusCode)
+	resp = do(t, "GET", url, "", "")
+	assert.Equal(t, 404, resp.StatusCode)
+
+	resp = do(t, "POST", url, "", "")
+	assert.Equal(t, 405, resp.StatusCode)
+	assert.Equal(t, "GET, PUT, DELETE", resp.Header.Get("Allow"))
+
+	resp = do(t, "PUT", url, strings.Repeat("a", Max_value_size+1), "")
+	assert.Equal(t, 413, resp.StatusCode)
+}
+
+func TestAddBadContext(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+
+	resp := do(t, "GET", server.URL+"/add?key=bar&value=mar&context=%7Bnot", "", "")
+	assert.Equal(t, 400, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"bad_context"`)
+
+	resp = do(t, "GET", server.URL+"/add?key=bar&value=mar", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestKeysBinaryValue(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/keys/image"
+	value := string([]byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe})
+
+	req, _ := http.NewRequest("PUT", url, strings.NewReader(value))
+	req.Header.Set("Content-Type", "image/png")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = do(t, "GET", url, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, value, string(body))
+
+	//empty values are stored, not treated as missing
+	resp = do(t, "PUT", url, "", "")
+	assert.Equal(t, 204, resp.StatusCode)
+	resp = do(t, "GET", url, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, Default_content_type, resp.Header.Get("Content-Type"))
+}
+
+func TestKeysIfMatch(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/keys/bar"
+
+	put_if := func(header string, value string, body string) *http.Response {
+		req, _ := http.NewRequest("PUT", url, strings.NewReader(body))
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	assert.Equal(t, 204, put_if("If-None-Match", "*", "mar").StatusCode)
+	assert.Equal(t, 412, put_if("If-None-Match", "*", "car").StatusCode)
+
+	resp := do(t, "GET", url, "", "")
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, 204, put_if("If-Match", etag, "car").StatusCode)
+
+	resp = put_if("If-Match", etag, "jar")
+	assert.Equal(t, 412, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"value":"Y2Fy"`)
+
+	//a deleted key has no current value, though its tombstone keeps a clock
+	req, _ := http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-None-Match", "*")
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(t, 412, resp.StatusCode)
+	assert.Equal(t, 204, do(t, "DELETE", url, "", "").StatusCode)
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-None-Match", "*")
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	assert.Equal(t, 204, put_if("If-None-Match", "*", "far").StatusCode)
+	resp = do(t, "GET", url, "", "")
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "far", string(body))
+	assert.Equal(t, 412, put_if("If-None-Match", "*", "tar").StatusCode)
+}
+
+func TestKeysIfNoneMatchExpired(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/keys/bar"
+
+	resp := do(t, "PUT", url+"?ttl=1", "mar", "")
+	assert.Equal(t, 204, resp.StatusCode)
+	time.Sleep(1100 * time.Millisecond)
+
+	req, _ := http.NewRequest("PUT", url, strings.NewReader("car"))
+	req.Header.Set("If-None-Match", "*")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	resp = do(t, "GET", url, "", "")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "car", string(body))
+}
+
+func TestKeysTtl(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/bar?ttl=60", "mar", "").StatusCode)
+	resp := do(t, "GET", server.URL+"/v1/keys/bar", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	expires, err := http.ParseTime(resp.Header.Get("Expires"))
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expires, 5*time.Second)
+
+	assert.Equal(t, 400, do(t, "PUT", server.URL+"/v1/keys/bar?ttl=-1", "mar", "").StatusCode)
+}
+
+func TestKeysConsistency(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/keys/bar"
+
+	resp := do(t, "PUT", url+"?consistency=all", "mar", "")
+	assert.Equal(t, 204, resp.StatusCode)
+
+	resp = do(t, "GET", url+"?consistency=all", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, len(strings.Split(resp.Header.Get(ReplicasHeader), ",")))
+
+	resp = do(t, "GET", url+"?consistency=most", "", "")
+	assert.Equal(t, 400, resp.StatusCode)
+}
@@ -0,0 +1,123 @@
+package http_db_server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/limits"
+)
+
+// SetLimits rate limits every client's requests and checks writes against the quotas,
+// either may be nil to leave that unlimited
+func (db *HttpDBServer) SetLimits(limiter *limits.Limiter, quotas *limits.QuotaTracker) {
+	db.limiter = limiter
+	db.quotas = quotas
+}
+
+// SetIpLimits rate limits requests by the client's ip before they are authenticated, nil leaves them unlimited
+func (db *HttpDBServer) SetIpLimits(limiter *limits.Limiter) {
+	db.ip_limiter = limiter
+}
+
+// endpoint_of names the endpoint of a request for rate limits
+func endpoint_of(path string) string {
+	switch {
+	case path == "/add" || path == "/get" || strings.HasPrefix(path, keys_path):
+		return "keys"
+	case strings.HasPrefix(path, "/v1/batch/"):
+		return "batch"
+	case path == "/v1/scan":
+		return "scan"
+	case path == "/v1/watch":
+		return "watch"
+	case path == "/v1/changes":
+		return "changes"
+	case path == "/v1/ring":
+		return "ring"
+	case path == "/metrics":
+		return "metrics"
+	case path == "/get_all_local" || path == "/v1/log_level" || path == "/v1/slow_queries":
+		return "admin"
+	case strings.HasPrefix(path, buckets_path):
+		//bucket settings, or its keys, scans and watches
+		rest := strings.TrimPrefix(path, buckets_path)
+		if _, resource, found := strings.Cut(rest, "/"); found {
+			if resource == "scan" || resource == "watch" {
+				return resource
+			}
+			return "keys"
+		}
+		return "buckets"
+	case path == "/v1/buckets":
+		return "buckets"
+	}
+	return "other"
+}
+
+// client_of is who a request is rate limited as, the principal it was authenticated as or its ip
+func client_of(req *http.Request) string {
+	if principal, _ := req.Context().Value(principal_key{}).(*auth.Principal); principal != nil {
+		return principal.Name
+	}
+	return ip_of(req)
+}
+
+func ip_of(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func write_too_many_requests(w http.ResponseWriter, code string, message string, retry_after time.Duration) {
+	//whole seconds, rounded up so clients retrying straight after aren't limited again
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry_after.Seconds()))))
+	write_error(w, 429, code, message)
+}
+
+// with_rate_limit runs after authentication, so authenticated clients are limited by who they are
+func (db *HttpDBServer) with_rate_limit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if db.limiter != nil {
+			endpoint := endpoint_of(req.URL.Path)
+			if allowed, wait := db.limiter.Allow(client_of(req), endpoint); !allowed {
+				write_too_many_requests(w, "rate_limited", "Too many requests to "+endpoint, wait)
+				return
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// with_ip_rate_limit runs before authentication, so clients sending requests that fail it are limited too
+func (db *HttpDBServer) with_ip_rate_limit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if db.ip_limiter != nil {
+			endpoint := endpoint_of(req.URL.Path)
+			if allowed, wait := db.ip_limiter.Allow(ip_of(req), endpoint); !allowed {
+				write_too_many_requests(w, "rate_limited", "Too many requests from "+ip_of(req), wait)
+				return
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// admit_write checks a write of a value to a stored key is within its quotas, writing the error response if not
+func (db *HttpDBServer) admit_write(w http.ResponseWriter, key string, value_size int) bool {
+	if db.quotas == nil {
+		return true
+	}
+	if err := db.quotas.Admit(key, value_size); err != nil {
+		//usage only goes down once it is recounted
+		write_too_many_requests(w, "quota_exceeded", err.Error(), limits.Quota_refresh_interval)
+		return false
+	}
+	return true
+}
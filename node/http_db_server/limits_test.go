@@ -0,0 +1,93 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	limiter, err := limits.NewLimiter([]limits.RateLimit{{Client: limits.Any, Endpoint: "scan", Requests_per_second: 0.01, Burst: 1}})
+	assert.Nil(t, err)
+	quotas, err := limits.NewQuotaTracker([]limits.Quota{{Prefix: "users/", Max_keys: 1}})
+	assert.Nil(t, err)
+	db := NewHttpDBServer(&Config{}, &hr)
+	db.SetLimits(limiter, quotas)
+	server := httptest.NewServer(db.Handler())
+	defer server.Close()
+
+	assert.Equal(t, 200, do(t, "GET", server.URL+"/v1/scan", "", "").StatusCode)
+	resp := do(t, "GET", server.URL+"/v1/scan", "", "")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "100", resp.Header.Get("Retry-After"))
+	var body ErrorResponseBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "rate_limited", body.Error)
+	//other endpoints aren't limited
+	assert.Equal(t, 404, do(t, "GET", server.URL+"/v1/keys/bar", "", "").StatusCode)
+
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/users%2F1", "mar", "").StatusCode)
+	resp = do(t, "PUT", server.URL+"/v1/keys/users%2F2", "mar", "")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "quota_exceeded", body.Error)
+	//deletes free space, so are never over quota
+	assert.Equal(t, 204, do(t, "DELETE", server.URL+"/v1/keys/users%2F1", "", "").StatusCode)
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/other", "mar", "").StatusCode)
+}
+
+func TestIpLimitsBeforeAuth(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	ip_limiter, err := limits.NewLimiter([]limits.RateLimit{{Client: limits.Any, Endpoint: limits.Any, Requests_per_second: 0.01, Burst: 2}})
+	assert.Nil(t, err)
+	db := NewHttpDBServer(&Config{}, &hr)
+	//authenticating nobody
+	db.SetAuth(&auth.Auth{})
+	db.SetIpLimits(ip_limiter)
+	server := httptest.NewServer(db.Handler())
+	defer server.Close()
+
+	//requests failing authentication use up the ip's tokens
+	assert.Equal(t, 401, do(t, "GET", server.URL+"/v1/keys/bar", "", "").StatusCode)
+	assert.Equal(t, 401, do(t, "GET", server.URL+"/v1/keys/bar", "", "").StatusCode)
+	resp := do(t, "GET", server.URL+"/v1/keys/bar", "", "")
+	assert.Equal(t, 429, resp.StatusCode)
+	var body ErrorResponseBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "rate_limited", body.Error)
+}
+
+func TestEndpointOf(t *testing.T) {
+	assert.Equal(t, "keys", endpoint_of("/v1/keys/bar"))
+	assert.Equal(t, "keys", endpoint_of("/get"))
+	assert.Equal(t, "keys", endpoint_of("/v1/buckets/users/keys/bar"))
+	assert.Equal(t, "scan", endpoint_of("/v1/buckets/users/scan"))
+	assert.Equal(t, "watch", endpoint_of("/v1/buckets/users/watch"))
+	assert.Equal(t, "buckets", endpoint_of("/v1/buckets/users"))
+	assert.Equal(t, "buckets", endpoint_of("/v1/buckets"))
+	assert.Equal(t, "batch", endpoint_of("/v1/batch/put"))
+	assert.Equal(t, "admin", endpoint_of("/get_all_local"))
+	assert.Equal(t, "admin", endpoint_of("/v1/log_level"))
+	assert.Equal(t, "admin", endpoint_of("/v1/slow_queries"))
+}
@@ -0,0 +1,74 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+)
+
+func (db *HttpDBServer) SetLogger(logger *slog.Logger) {
+	db.logger = logger
+}
+
+// with_request_id gives every request an id, the client's when it sends a valid one, which is sent back
+// in the response and on to every replica the request reaches, so their log lines can be found together
+func (db *HttpDBServer) with_request_id(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		request_id := req.Header.Get(logging.RequestIdHeader)
+		if logging.Check_Request_Id(request_id) != nil {
+			request_id = logging.New_Request_Id()
+		}
+		w.Header().Set(logging.RequestIdHeader, request_id)
+		ctx := logging.WithRequestId(req.Context(), request_id)
+
+		start := time.Now()
+		recorder := &status_recorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, req.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = 200
+		}
+		attributes := []any{"method", req.Method, "path", req.URL.Path, "status", recorder.status, "duration", time.Since(start)}
+		if recorder.status >= 500 {
+			db.logger.ErrorContext(ctx, "Request failed", append(attributes, "error", recorder.message)...)
+		} else {
+			db.logger.DebugContext(ctx, "Served request", attributes...)
+		}
+	})
+}
+
+type LogLevelBody struct {
+	Level string `json:"level"`
+}
+
+// log_level reads or changes the level of the node's logs while it runs
+func (db *HttpDBServer) log_level(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "GET, PUT")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on the log level")
+		return
+	}
+	if !db.authorize_admin(w, req) {
+		return
+	}
+
+	if req.Method == http.MethodPut {
+		var body LogLevelBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			write_error(w, 400, "bad_body", err.Error())
+			return
+		}
+		level, err := logging.Parse_Level(body.Level)
+		if err != nil || body.Level == "" {
+			write_error(w, 400, "bad_level", "Unknown log level \""+body.Level+"\", use debug, info, warn or error")
+			return
+		}
+		previous := logging.Level.Level()
+		logging.Level.Set(level)
+		db.logger.InfoContext(req.Context(), "Changed log level", "from", previous.String(), "to", level.String())
+	}
+
+	write_json(w, 200, LogLevelBody{logging.Level.Level().String()})
+}
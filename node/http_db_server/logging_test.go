@@ -0,0 +1,72 @@
+package http_db_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIds(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		nodes[i].SetTable(&hash_ring.ErrorTable{})
+		nodes[i].SetTemporaryTable(&hash_ring.ErrorTable{})
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	var out bytes.Buffer
+	logger, _ := logging.New(nil, &out)
+	hr.SetLogger(logger)
+	db := NewHttpDBServer(&Config{}, &hr)
+	db.SetLogger(logger)
+	server := httptest.NewServer(db.Handler())
+	defer server.Close()
+
+	resp := do(t, "GET", server.URL+"/v1/keys/bar", "", "")
+	assert.Equal(t, 503, resp.StatusCode)
+	request_id := resp.Header.Get(logging.RequestIdHeader)
+	assert.Equal(t, 16, len(request_id))
+	//the ring's and the server's lines of the request carry its id
+	assert.True(t, strings.Contains(out.String(), "msg=\"Failed to replicate to the replication factor\" operation=get"))
+	assert.True(t, strings.Contains(out.String(), "msg=\"Request failed\" method=GET path=/v1/keys/bar status=503"))
+	assert.Equal(t, 2, strings.Count(out.String(), "request_id="+request_id))
+
+	req, _ := http.NewRequest("GET", server.URL+"/v1/ring", nil)
+	req.Header.Set(logging.RequestIdHeader, "client-1")
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(t, "client-1", resp.Header.Get(logging.RequestIdHeader))
+	req.Header.Set(logging.RequestIdHeader, "not valid")
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(t, 16, len(resp.Header.Get(logging.RequestIdHeader)))
+}
+
+func TestLogLevel(t *testing.T) {
+	defer logging.Level.Set(slog.LevelInfo)
+	server := test_server()
+	defer server.Close()
+	url := server.URL + "/v1/log_level"
+
+	var body LogLevelBody
+	resp := do(t, "GET", url, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "INFO", body.Level)
+
+	resp = do(t, "PUT", url, `{"level":"debug"}`, "")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "DEBUG", body.Level)
+	assert.Equal(t, slog.LevelDebug, logging.Level.Level())
+
+	assert.Equal(t, 400, do(t, "PUT", url, `{"level":"loud"}`, "").StatusCode)
+	assert.Equal(t, 400, do(t, "PUT", url, `{}`, "").StatusCode)
+	assert.Equal(t, 405, do(t, "POST", url, "", "").StatusCode)
+	assert.Equal(t, slog.LevelDebug, logging.Level.Level())
+}
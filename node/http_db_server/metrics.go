@@ -0,0 +1,22 @@
+package http_db_server
+
+import (
+	"net/http"
+
+	"github.com/lucifer1662/distrokdb/node/metrics"
+)
+
+// metrics serves the node's metrics in the prometheus text format.
+// With auth the scraper must be an admin, as the metrics cover every bucket
+func (db *HttpDBServer) metrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on metrics")
+		return
+	}
+	if !db.authorize_admin(w, req) {
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	metrics.Default.Write(w)
+}
@@ -0,0 +1,25 @@
+package http_db_server
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/bar", "mar", "").StatusCode)
+
+	resp := do(t, "GET", server.URL+"/metrics", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.True(t, strings.Contains(string(body), "# TYPE kdb_ring_add_seconds histogram"))
+	assert.True(t, strings.Contains(string(body), "kdb_ring_add_seconds_count "))
+
+	assert.Equal(t, 405, do(t, "POST", server.URL+"/metrics", "", "").StatusCode)
+}
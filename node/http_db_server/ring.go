@@ -0,0 +1,74 @@
+package http_db_server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
+)
+
+// EpochHeader is the epoch of the config the node is running, sent with every response
+// so clients notice when their copy of the ring is out of date
+const EpochHeader = "X-Ring-Epoch"
+
+type RingNode struct {
+	Id           uint64 `json:"id"`
+	Physical_id  uint64 `json:"physical_id"`
+	Position     uint64 `json:"position"`
+	Zone         string `json:"zone,omitempty"`
+	Rack         string `json:"rack,omitempty"`
+	Http_address string `json:"http_address"`
+}
+
+type RingResponseBody struct {
+	Epoch              uint64     `json:"epoch"`
+	Partitioner        string     `json:"partitioner"`
+	Replication_factor int        `json:"replication_factor"`
+	Nodes              []RingNode `json:"nodes"`
+}
+
+// SetRingConfig gives the server the cluster config to hand to clients, it is called on every request
+// as the cluster manager may push new configs
+func (db *HttpDBServer) SetRingConfig(ring_config func() *distributed_hash_ring.SharedConfig) {
+	db.ring_config = ring_config
+}
+
+func (db *HttpDBServer) with_epoch(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if db.ring_config != nil {
+			w.Header().Set(EpochHeader, strconv.FormatUint(db.ring_config().Epoch, 10))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (db *HttpDBServer) ring(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on the ring")
+		return
+	}
+	if db.ring_config == nil {
+		write_error(w, 503, "unavailable", "Ring config is not available")
+		return
+	}
+
+	config := db.ring_config()
+	body := RingResponseBody{
+		Epoch:              config.Epoch,
+		Partitioner:        db.hr.Partitioner().Name(),
+		Replication_factor: db.hr.ReplicationFactor(),
+		Nodes:              make([]RingNode, len(config.Nodes)),
+	}
+	for i, node := range config.Nodes {
+		body.Nodes[i] = RingNode{
+			Id:           node.Id,
+			Physical_id:  node.Physical_Id,
+			Position:     node.Position,
+			Zone:         node.Zone,
+			Rack:         node.Rack,
+			Http_address: node.Http_address,
+		}
+	}
+	write_json(w, 200, body)
+}
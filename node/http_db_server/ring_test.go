@@ -0,0 +1,53 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(2)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&table)
+	}
+	hr := hash_ring.New(nodes, 2, 1, 1, &hash_ring.ConflictResolutionFirstInstance{})
+	db := NewHttpDBServer(&Config{}, &hr)
+	server := httptest.NewServer(db.Handler())
+	defer server.Close()
+
+	resp := do(t, "GET", server.URL+"/v1/ring", "", "")
+	assert.Equal(t, 503, resp.StatusCode)
+
+	db.SetRingConfig(func() *distributed_hash_ring.SharedConfig {
+		return &distributed_hash_ring.SharedConfig{
+			Epoch: 4,
+			Nodes: []distributed_hash_ring.Node{
+				{Position: nodes[0].GetPosition(), Id: 0, Physical_Id: 0, Http_address: "localhost:3000"},
+				{Position: nodes[1].GetPosition(), Id: 1, Physical_Id: 1, Zone: "a", Http_address: "localhost:3001"},
+			},
+		}
+	})
+	resp = do(t, "GET", server.URL+"/v1/ring", "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "4", resp.Header.Get(EpochHeader))
+	body := RingResponseBody{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, uint64(4), body.Epoch)
+	assert.Equal(t, "fnv", body.Partitioner)
+	assert.Equal(t, 2, body.Replication_factor)
+	assert.Equal(t, "localhost:3001", body.Nodes[1].Http_address)
+	assert.Equal(t, "a", body.Nodes[1].Zone)
+
+	//writes hand back the context of the version written
+	resp = do(t, "PUT", server.URL+"/v1/keys/bar", "mar", "")
+	context := resp.Header.Get(ContextHeader)
+	resp = do(t, "GET", server.URL+"/v1/keys/bar", "", "")
+	assert.Equal(t, resp.Header.Get(ContextHeader), context)
+}
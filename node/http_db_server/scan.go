@@ -0,0 +1,94 @@
+package http_db_server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const Default_scan_limit = 100
+const Max_scan_limit = 1000
+
+type ScanItem struct {
+	Key string `json:"key"`
+	//base64 encoded in json
+	Value        []byte `json:"value"`
+	Content_type string `json:"content_type,omitempty"`
+	Context      string `json:"context"`
+}
+
+type ScanResponseBody struct {
+	Items []ScanItem `json:"items"`
+	//passed back to continue the scan, empty once it is complete
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// scan handles GET /v1/scan?prefix=&start=&limit=&cursor=, listing keys in order.
+// start is the first key to list, a cursor from a previous page replaces it
+func (db *HttpDBServer) scan(w http.ResponseWriter, req *http.Request) {
+	db.scan_bucket(w, req, "")
+}
+
+// scan_bucket lists the keys of a bucket, or of the keys outside of buckets when it is empty
+func (db *HttpDBServer) scan_bucket(w http.ResponseWriter, req *http.Request, bucket string) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on scans")
+		return
+	}
+	query := req.URL.Query()
+
+	limit := Default_scan_limit
+	if query.Has("limit") {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > Max_scan_limit {
+			write_error(w, 400, "bad_limit", "Limit must be between 1 and "+strconv.Itoa(Max_scan_limit))
+			return
+		}
+	}
+
+	start := hash_ring.Bucket_Key(bucket, query.Get("start"))
+	if query.Has("cursor") {
+		cursor, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+		if err != nil {
+			write_error(w, 400, "bad_cursor", "Cursor is not base64url encoded")
+			return
+		}
+		//cursors are stored keys, they already include the bucket
+		start = string(cursor)
+	}
+	if bucket == "" && start < hash_ring.Bucket_keys_end {
+		//keys of buckets are stored first
+		start = hash_ring.Bucket_keys_end
+	}
+
+	prefix := hash_ring.Bucket_Key(bucket, query.Get("prefix"))
+	if !db.authorize(w, req, auth.Permission_read, prefix) {
+		return
+	}
+
+	entries, next, err := db.hr.ScanContext(req.Context(), prefix, start, limit)
+	if err != nil {
+		write_ring_error(w, err)
+		return
+	}
+
+	response := ScanResponseBody{Items: make([]ScanItem, len(entries))}
+	for i := range entries {
+		_, key := hash_ring.Split_Bucket_Key(entries[i].Key)
+		response.Items[i] = ScanItem{
+			Key:          key,
+			Value:        entries[i].Value,
+			Content_type: entries[i].Meta.ContentType,
+			Context:      EncodeContext(entries[i].Meta),
+		}
+	}
+	if next != "" {
+		response.Cursor = base64.RawURLEncoding.EncodeToString([]byte(next))
+	}
+	write_json(w, 200, response)
+}
@@ -0,0 +1,39 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanCursor(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1"} {
+		assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/"+url.PathEscape(key), key, "").StatusCode)
+	}
+
+	scanned := []string{}
+	cursor := ""
+	for {
+		resp, err := http.Get(server.URL + "/v1/scan?prefix=a/&limit=2&cursor=" + cursor)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var body ScanResponseBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		for _, item := range body.Items {
+			scanned = append(scanned, item.Key)
+		}
+		if body.Cursor == "" {
+			break
+		}
+		cursor = body.Cursor
+	}
+	assert.Equal(t, []string{"a/1", "a/2", "a/3"}, scanned)
+
+	resp, _ := http.Get(server.URL + "/v1/scan?limit=0")
+	assert.Equal(t, 400, resp.StatusCode)
+}
@@ -0,0 +1,110 @@
+package http_db_server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+type SlowReplicaCall struct {
+	Node        uint64  `json:"node"`
+	Physical_id uint64  `json:"physical_id"`
+	Hinted      bool    `json:"hinted"`
+	Latency_ms  float64 `json:"latency_ms"`
+	//succeeded, failed or pending when the replica hadn't answered by the time the operation returned
+	Outcome string `json:"outcome"`
+}
+
+type SlowQueryBody struct {
+	Operation         string            `json:"operation"`
+	Key_hash          uint64            `json:"key_hash"`
+	Request_id        string            `json:"request_id,omitempty"`
+	Start             time.Time         `json:"start"`
+	Duration_ms       float64           `json:"duration_ms"`
+	Replicas          []SlowReplicaCall `json:"replicas"`
+	Hinted            bool              `json:"hinted"`
+	Conflict_resolved bool              `json:"conflict_resolved"`
+	Error             string            `json:"error,omitempty"`
+}
+
+type SlowQueriesResponseBody struct {
+	Threshold_ms float64         `json:"threshold_ms"`
+	Queries      []SlowQueryBody `json:"queries"`
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// slow_queries lists the operations this node coordinated that exceeded the slow log's threshold, newest first.
+// ?operation= only lists one kind of operation and ?limit= the newest of them, DELETE empties the log
+func (db *HttpDBServer) slow_queries(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, DELETE")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on slow queries")
+		return
+	}
+	if !db.authorize_admin(w, req) {
+		return
+	}
+	slow_log := db.hr.SlowLog()
+	if slow_log == nil {
+		write_error(w, 404, "slow_log_disabled", "Slow queries are not recorded by this node")
+		return
+	}
+	if req.Method == http.MethodDelete {
+		slow_log.Clear()
+		w.WriteHeader(204)
+		return
+	}
+
+	query := req.URL.Query()
+	limit := -1
+	if query.Has("limit") {
+		parsed, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || parsed < 0 {
+			write_error(w, 400, "bad_limit", "Limit must be a non negative number")
+			return
+		}
+		limit = parsed
+	}
+	operation := query.Get("operation")
+
+	body := SlowQueriesResponseBody{Threshold_ms: milliseconds(slow_log.Threshold()), Queries: []SlowQueryBody{}}
+	for _, slow_query := range slow_log.Queries() {
+		if len(body.Queries) == limit {
+			break
+		}
+		if operation != "" && slow_query.Operation != operation {
+			continue
+		}
+		body.Queries = append(body.Queries, slow_query_body(&slow_query))
+	}
+	write_json(w, 200, body)
+}
+
+func slow_query_body(slow_query *hash_ring.SlowQuery) SlowQueryBody {
+	body := SlowQueryBody{
+		Operation:         slow_query.Operation,
+		Key_hash:          slow_query.Key_hash,
+		Request_id:        slow_query.Request_id,
+		Start:             slow_query.Start,
+		Duration_ms:       milliseconds(slow_query.Duration),
+		Replicas:          make([]SlowReplicaCall, len(slow_query.Replicas)),
+		Hinted:            slow_query.Hinted,
+		Conflict_resolved: slow_query.Conflict_resolved,
+		Error:             slow_query.Error,
+	}
+	for i, replica := range slow_query.Replicas {
+		body.Replicas[i] = SlowReplicaCall{
+			Node:        replica.Node,
+			Physical_id: replica.Physical_id,
+			Hinted:      replica.Hinted,
+			Latency_ms:  milliseconds(replica.Latency),
+			Outcome:     replica.Outcome,
+		}
+	}
+	return body
+}
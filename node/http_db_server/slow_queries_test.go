@@ -0,0 +1,77 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowQueries(t *testing.T) {
+	disabled := test_server()
+	defer disabled.Close()
+	assert.Equal(t, 404, do(t, "GET", disabled.URL+"/v1/slow_queries", "", "").StatusCode)
+
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	//every operation is slower than no time at all
+	hr.SetSlowLog(hash_ring.NewSlowLog(&hash_ring.SlowLogConfig{}))
+	server := httptest.NewServer(NewHttpDBServer(&Config{}, &hr).Handler())
+	defer server.Close()
+	url := server.URL + "/v1/slow_queries"
+
+	req, _ := http.NewRequest("PUT", server.URL+"/v1/keys/bar", nil)
+	req.Header.Set(logging.RequestIdHeader, "put-1")
+	resp, _ := http.DefaultClient.Do(req)
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, 200, do(t, "GET", server.URL+"/v1/keys/bar", "", "").StatusCode)
+
+	var body SlowQueriesResponseBody
+	resp = do(t, "GET", url, "", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, 0.0, body.Threshold_ms)
+	assert.Equal(t, 2, len(body.Queries))
+	assert.Equal(t, "get", body.Queries[0].Operation)
+	add := body.Queries[1]
+	assert.Equal(t, "add", add.Operation)
+	assert.Equal(t, hr.KeyHash("bar"), add.Key_hash)
+	assert.Equal(t, "put-1", add.Request_id)
+	assert.True(t, add.Duration_ms > 0)
+	//the write returns once 2 replicas have it, the third may still be writing
+	assert.Equal(t, 3, len(add.Replicas))
+	succeeded := 0
+	for _, replica := range add.Replicas {
+		assert.False(t, replica.Hinted)
+		if replica.Outcome == hash_ring.Outcome_succeeded {
+			succeeded++
+		}
+	}
+	assert.True(t, succeeded >= 2)
+
+	body = SlowQueriesResponseBody{}
+	json.NewDecoder(do(t, "GET", url+"?operation=add", "", "").Body).Decode(&body)
+	assert.Equal(t, 1, len(body.Queries))
+	assert.Equal(t, "add", body.Queries[0].Operation)
+	body = SlowQueriesResponseBody{}
+	json.NewDecoder(do(t, "GET", url+"?limit=1", "", "").Body).Decode(&body)
+	assert.Equal(t, 1, len(body.Queries))
+	assert.Equal(t, "get", body.Queries[0].Operation)
+	assert.Equal(t, 400, do(t, "GET", url+"?limit=-1", "", "").StatusCode)
+	assert.Equal(t, 405, do(t, "POST", url, "", "").StatusCode)
+
+	assert.Equal(t, 204, do(t, "DELETE", url, "", "").StatusCode)
+	body = SlowQueriesResponseBody{}
+	json.NewDecoder(do(t, "GET", url, "", "").Body).Decode(&body)
+	assert.Equal(t, 0, len(body.Queries))
+}
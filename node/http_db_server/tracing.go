@@ -0,0 +1,84 @@
+package http_db_server
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/lucifer1662/distrokdb/node/tracing"
+)
+
+// TraceIdHeader is the id of the trace a request was recorded in, sent with responses to traced requests
+// so a slow request can be found among the exported spans
+const TraceIdHeader = "X-Trace-Id"
+
+var errServerError = errors.New("Server error")
+
+// status_recorder keeps the status and error message a handler wrote, for the request's span and log line
+type status_recorder struct {
+	http.ResponseWriter
+	status  int
+	message string
+}
+
+// record_error keeps the message of an error response, passing it on to the recorders this one wraps
+func (recorder *status_recorder) record_error(message string) {
+	recorder.message = message
+	if inner, is_recorder := recorder.ResponseWriter.(*status_recorder); is_recorder {
+		inner.record_error(message)
+	}
+}
+
+func (recorder *status_recorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *status_recorder) Write(data []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = 200
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Flush keeps change and watch streams working through the recorder
+func (recorder *status_recorder) Flush() {
+	if flusher, can_flush := recorder.ResponseWriter.(http.Flusher); can_flush {
+		flusher.Flush()
+	}
+}
+
+// with_tracing starts a span for every request, continuing the trace of the client's traceparent header.
+// The span is the parent of the spans of each replica the request reaches
+func (db *HttpDBServer) with_tracing(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := tracing.ContextWithRemote(req.Context(), req.Header.Get(tracing.TraceparentHeader))
+		ctx, span := tracing.Start(ctx, req.Method+" "+endpoint_of(req.URL.Path), tracing.Kind_server)
+		if span == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		defer span.End()
+		if span.Context().Sampled {
+			trace_id := span.Context().Trace_id
+			w.Header().Set(TraceIdHeader, hex.EncodeToString(trace_id[:]))
+		}
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", req.URL.Path)
+		span.SetAttribute("kdb.request_id", logging.RequestId(ctx))
+
+		recorder := &status_recorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, req.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = 200
+		}
+		span.SetAttribute("http.status_code", strconv.Itoa(recorder.status))
+		if recorder.status >= 500 {
+			span.SetError(errServerError)
+		}
+	})
+}
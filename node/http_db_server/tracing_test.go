@@ -0,0 +1,70 @@
+package http_db_server
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+type recording_exporter struct {
+	spans []*tracing.SpanData
+	lock  sync.Mutex
+}
+
+func (exporter *recording_exporter) Export(resource tracing.Resource, spans []*tracing.SpanData) error {
+	defer exporter.lock.Unlock()
+	exporter.lock.Lock()
+	exporter.spans = append(exporter.spans, spans...)
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+	//without a tracer requests aren't traced
+	resp := do(t, "PUT", server.URL+"/v1/keys/bar", "mar", "")
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get(TraceIdHeader))
+
+	exporter := &recording_exporter{}
+	tracer := tracing.NewTracerWithExporter(exporter)
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+	tracer.Start()
+
+	req, _ := http.NewRequest("GET", server.URL+"/v1/keys/bar", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", resp.Header.Get(TraceIdHeader))
+
+	resp = do(t, "GET", server.URL+"/v1/keys/missing", "", "")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, 32, len(resp.Header.Get(TraceIdHeader)))
+	tracer.Stop()
+
+	var request *tracing.SpanData
+	replicas := 0
+	for _, span := range exporter.spans {
+		if span.Name == "GET keys" && hex.EncodeToString(span.Trace_id[:]) == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			request = span
+		}
+	}
+	assert.NotNil(t, request)
+	assert.Equal(t, tracing.Kind_server, request.Kind)
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(request.Parent_id[:]))
+	assert.Equal(t, "200", request.Attributes["http.status_code"])
+	for _, span := range exporter.spans {
+		if strings.HasPrefix(span.Name, "replica ") && span.Parent_id == request.Span_id {
+			replicas++
+		}
+	}
+	//a replica span for each read of the quorum
+	assert.True(t, replicas >= 2)
+}
@@ -0,0 +1,168 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+const Default_watch_timeout = 30 * time.Second
+const Max_watch_timeout = 5 * time.Minute
+
+type WatchEventBody struct {
+	Key string `json:"key"`
+	//base64 encoded in json
+	Value        []byte `json:"value,omitempty"`
+	Content_type string `json:"content_type,omitempty"`
+	Deleted      bool   `json:"deleted,omitempty"`
+	Context      string `json:"context"`
+}
+
+func watch_event(event *hash_ring.WatchEvent) WatchEventBody {
+	_, key := hash_ring.Split_Bucket_Key(event.Key)
+	return WatchEventBody{
+		Key:          key,
+		Value:        event.Value,
+		Content_type: event.Meta.ContentType,
+		Deleted:      event.Meta.Deleted,
+		Context:      EncodeContext(&event.Meta),
+	}
+}
+
+// watch handles /v1/watch?key= or ?prefix=, waking when this node coordinates or stores a newer version
+// of a matching key. By default it long polls, returning the first new version or 204 after ?timeout= seconds,
+// with Accept: text/event-stream every new version is streamed.
+// A key watch given the context of the client's last read (?context= or X-Context) returns straight away
+// if that read is already out of date, so no version is missed between the read and the watch
+func (db *HttpDBServer) watch(w http.ResponseWriter, req *http.Request) {
+	db.watch_bucket(w, req, "")
+}
+
+// watch_bucket watches keys of a bucket, or keys outside of buckets when it is empty.
+// Events carry the key within the bucket
+func (db *HttpDBServer) watch_bucket(w http.ResponseWriter, req *http.Request, bucket string) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		write_error(w, 405, "method_not_allowed", req.Method+" is not supported on watches")
+		return
+	}
+	query := req.URL.Query()
+	if query.Has("key") == query.Has("prefix") {
+		write_error(w, 400, "bad_watch", "Watch exactly one of key or prefix")
+		return
+	}
+	key := query.Get("key") + query.Get("prefix")
+	//would be read as keys of a bucket
+	if bucket == "" && strings.HasPrefix(key, "\x00") {
+		write_error(w, 400, "bad_key", "Keys outside of buckets must not start with a NUL byte")
+		return
+	}
+	stored_key := hash_ring.Bucket_Key(bucket, key)
+
+	timeout := Default_watch_timeout
+	if query.Has("timeout") {
+		seconds, err := strconv.Atoi(query.Get("timeout"))
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > Max_watch_timeout {
+			write_error(w, 400, "bad_timeout", "Timeout must be between 1 and "+strconv.Itoa(int(Max_watch_timeout/time.Second))+" seconds")
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	context := query.Get("context")
+	if context == "" {
+		context = req.Header.Get(ContextHeader)
+	}
+	last_read, err := DecodeContext(context)
+	if err != nil {
+		write_error(w, 400, "bad_context", err.Error())
+		return
+	}
+
+	if !db.authorize(w, req, auth.Permission_read, stored_key) {
+		return
+	}
+
+	//watching before reading, so a write between the two is still seen
+	id, events := db.hr.Watchers().Watch(stored_key, query.Has("prefix"))
+	defer db.hr.Watchers().Unwatch(id)
+
+	var current *hash_ring.WatchEvent
+	if query.Has("key") && context != "" {
+		value, meta, err := db.hr.Get(stored_key)
+		if err != nil {
+			write_ring_error(w, err)
+			return
+		}
+		if !last_read.VectorClock.Descends(&meta.VectorClock) {
+			current = &hash_ring.WatchEvent{Key: stored_key, Value: value, Meta: *meta}
+		}
+	}
+
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		db.stream_watch(w, req, current, events)
+		return
+	}
+
+	if current == nil {
+		select {
+		case event, open := <-events:
+			if !open {
+				write_error(w, 503, "unavailable", "Watch was closed")
+				return
+			}
+			current = &event
+		case <-time.After(timeout):
+			w.WriteHeader(204)
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+	write_json(w, 200, watch_event(current))
+}
+
+func (db *HttpDBServer) stream_watch(w http.ResponseWriter, req *http.Request, current *hash_ring.WatchEvent, events <-chan hash_ring.WatchEvent) {
+	flusher, can_flush := w.(http.Flusher)
+	if !can_flush {
+		write_error(w, 501, "not_supported", "Streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	send := func(event *hash_ring.WatchEvent) {
+		data, _ := json.Marshal(watch_event(event))
+		fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+	}
+	if current != nil {
+		send(current)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(changes_heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, open := <-events:
+			if !open {
+				//fell too far behind, the client reads again and rewatches
+				return
+			}
+			send(&event)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package http_db_server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchLongPoll(t *testing.T) {
+	server := test_server()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/watch?key=bar&timeout=1")
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		do(t, "PUT", server.URL+"/v1/keys/bar", "mar", "")
+	}()
+	resp, err = http.Get(server.URL + "/v1/watch?prefix=ba&timeout=5")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var event WatchEventBody
+	json.NewDecoder(resp.Body).Decode(&event)
+	assert.Equal(t, "bar", event.Key)
+	assert.Equal(t, "mar", string(event.Value))
+
+	//a watch from an out of date read returns the current version straight away
+	resp, _ = http.Get(server.URL + "/v1/watch?key=bar&timeout=5&context=e30")
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestWatchBuckets(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	assert.Nil(t, hr.SetBuckets([]hash_ring.Bucket{{Name: "users", Replication_factor: 3, Minimum_writes: 2, Minimum_read: 2}}))
+	server := httptest.NewServer(NewHttpDBServer(&Config{}, &hr).Handler())
+	defer server.Close()
+
+	watch := func(url string, result chan WatchEventBody) {
+		resp, err := http.Get(url)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		var event WatchEventBody
+		json.NewDecoder(resp.Body).Decode(&event)
+		result <- event
+	}
+	outside := make(chan WatchEventBody, 1)
+	inside := make(chan WatchEventBody, 1)
+	go watch(server.URL+"/v1/watch?prefix=&timeout=5", outside)
+	go watch(server.URL+"/v1/buckets/users/watch?prefix=&timeout=5", inside)
+	time.Sleep(100 * time.Millisecond)
+
+	//keys of buckets are not seen by watches outside of them
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/buckets/users/keys/bar", "mar", "").StatusCode)
+	event := <-inside
+	assert.Equal(t, "bar", event.Key)
+	assert.Equal(t, "mar", string(event.Value))
+	assert.Equal(t, 204, do(t, "PUT", server.URL+"/v1/keys/foo", "car", "").StatusCode)
+	event = <-outside
+	assert.Equal(t, "foo", event.Key)
+	assert.Equal(t, "car", string(event.Value))
+
+	resp, _ := http.Get(server.URL + "/v1/watch?prefix=%00users&timeout=1")
+	assert.Equal(t, 400, resp.StatusCode)
+	resp, _ = http.Get(server.URL + "/v1/buckets/users/watch?key=bar&timeout=1&context=e30")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&event)
+	assert.Equal(t, "bar", event.Key)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+)
+
+const usage = `kdbctl talks to a distroKDB node over its http api.
+
+Usage:
+  kdbctl [-node address] [-api-key key] [-consistency level] [-output table|json] <command> [flags] [args]
+
+Commands:
+  get <key>                                     read a key, with its vector clock and the replicas that answered
+  put [-ttl s] [-content-type t] [-context c] <key> [value]
+                                                write a key, the value is read from stdin when not given
+  delete [-context c] <key>                     delete a key
+  scan [-prefix p] [-start k] [-limit n] [-all] list keys in order, -all follows the cursor to the end
+  watch (-key k | -prefix p)                    stream new versions of a key or prefix
+
+Global flags:
+`
+
+type options struct {
+	node        string
+	api_key     string
+	consistency string
+	output      string
+	http_client *http.Client
+}
+
+func main() {
+	opts := options{http_client: &http.Client{}}
+	default_node := os.Getenv("KDB_NODE")
+	if default_node == "" {
+		default_node = "localhost:8080"
+	}
+	flag.StringVar(&opts.node, "node", default_node, "http address of any node, also read from KDB_NODE")
+	flag.StringVar(&opts.api_key, "api-key", os.Getenv("KDB_API_KEY"), "api key sent with every request, also read from KDB_API_KEY")
+	flag.StringVar(&opts.consistency, "consistency", "", "one, quorum or all, by default the cluster's configured quorums")
+	flag.StringVar(&opts.output, "output", "table", "table or json")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(&opts, flag.Args(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "kdbctl: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(opts *options, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("Missing command, see kdbctl -h")
+	}
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("Unknown output \"%s\", use table or json", opts.output)
+	}
+	if _, err := hash_ring.Consistency_By_Name(opts.consistency); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(opts.node, "http://") && !strings.HasPrefix(opts.node, "https://") {
+		opts.node = "http://" + opts.node
+	}
+	opts.node = strings.TrimSuffix(opts.node, "/")
+
+	switch args[0] {
+	case "get":
+		return get(opts, args[1:], out)
+	case "put":
+		return put(opts, args[1:], in, out)
+	case "delete":
+		return remove(opts, args[1:], out)
+	case "scan":
+		return scan(opts, args[1:], out)
+	case "watch":
+		return watch(opts, args[1:], out)
+	}
+	return fmt.Errorf("Unknown command \"%s\", see kdbctl -h", args[0])
+}
+
+func (opts *options) key_url(key string, query url.Values) string {
+	if opts.consistency != "" {
+		query.Set("consistency", opts.consistency)
+	}
+	key_url := opts.node + "/v1/keys/" + url.PathEscape(key)
+	if len(query) != 0 {
+		key_url += "?" + query.Encode()
+	}
+	return key_url
+}
+
+func (opts *options) do(method string, request_url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, request_url, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		if value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if opts.api_key != "" {
+		req.Header.Set(auth.ApiKeyHeader, opts.api_key)
+	}
+	return opts.http_client.Do(req)
+}
+
+// response_error gives the message of an error body, or the status when there isn't one
+func response_error(resp *http.Response) error {
+	body := http_db_server.ErrorResponseBody{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Message == "" {
+		return fmt.Errorf("Request failed with status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%s (%d %s)", body.Message, resp.StatusCode, body.Error)
+}
+
+// one_key parses the flags of a command taking a single key, with the value as an optional second argument
+func one_key(flags *flag.FlagSet, args []string, maximum int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() == 0 || flags.NArg() > maximum {
+		return nil, fmt.Errorf("%s takes a key, flags go before it", flags.Name())
+	}
+	return flags.Args(), nil
+}
+
+func get(opts *options, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	args, err := one_key(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	resp, err := opts.do(http.MethodGet, opts.key_url(args[0], url.Values{}), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.New("Key not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return response_error(resp)
+	}
+
+	value, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	record := new_record(args[0], value, resp.Header.Get(http_db_server.ContextHeader))
+	record.Content_type = resp.Header.Get("Content-Type")
+	record.Expires = resp.Header.Get("Expires")
+	for _, id := range strings.Split(resp.Header.Get(http_db_server.ReplicasHeader), ",") {
+		if replica, err := strconv.ParseUint(id, 10, 64); err == nil {
+			record.Replicas = append(record.Replicas, replica)
+		}
+	}
+	return write_record(opts, out, &record)
+}
+
+func put(opts *options, args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	ttl := flags.Int("ttl", 0, "seconds until the value expires")
+	content_type := flags.String("content-type", "", "media type of the value")
+	context := flags.String("context", "", "context of the version being replaced, from a get")
+	args, err := one_key(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+	if len(args) == 2 {
+		value = []byte(args[1])
+	} else if value, err = io.ReadAll(in); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *ttl > 0 {
+		query.Set("ttl", strconv.Itoa(*ttl))
+	}
+	resp, err := opts.do(http.MethodPut, opts.key_url(args[0], query), bytes.NewReader(value), map[string]string{
+		http_db_server.ContextHeader: *context,
+		"Content-Type":               *content_type,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return response_error(resp)
+	}
+
+	record := new_record(args[0], nil, resp.Header.Get(http_db_server.ContextHeader))
+	return write_record(opts, out, &record)
+}
+
+func remove(opts *options, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	context := flags.String("context", "", "context of the version being deleted, from a get")
+	args, err := one_key(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	resp, err := opts.do(http.MethodDelete, opts.key_url(args[0], url.Values{}), nil, map[string]string{
+		http_db_server.ContextHeader: *context,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return response_error(resp)
+	}
+
+	record := new_record(args[0], nil, resp.Header.Get(http_db_server.ContextHeader))
+	record.Deleted = true
+	return write_record(opts, out, &record)
+}
+
+func scan(opts *options, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	prefix := flags.String("prefix", "", "only keys starting with the prefix")
+	start := flags.String("start", "", "first key to list")
+	limit := flags.Int("limit", http_db_server.Default_scan_limit, "keys fetched per page")
+	all := flags.Bool("all", false, "follow the cursor until every key has been listed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	records := []record{}
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("prefix", *prefix)
+		query.Set("limit", strconv.Itoa(*limit))
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		} else if *start != "" {
+			query.Set("start", *start)
+		}
+
+		resp, err := opts.do(http.MethodGet, opts.node+"/v1/scan?"+query.Encode(), nil, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return response_error(resp)
+		}
+		body := http_db_server.ScanResponseBody{}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range body.Items {
+			scanned := new_record(item.Key, item.Value, item.Context)
+			scanned.Content_type = item.Content_type
+			records = append(records, scanned)
+		}
+		cursor = body.Cursor
+		if !*all || cursor == "" {
+			break
+		}
+	}
+	return write_records(opts, out, records)
+}
+
+// watch streams events until the node closes the stream or the process is stopped
+func watch(opts *options, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	key := flags.String("key", "", "key to watch")
+	prefix := flags.String("prefix", "", "prefix of the keys to watch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*key == "") == (*prefix == "") {
+		return errors.New("watch takes exactly one of -key or -prefix")
+	}
+
+	query := url.Values{}
+	if *key != "" {
+		query.Set("key", *key)
+	} else {
+		query.Set("prefix", *prefix)
+	}
+	resp, err := opts.do(http.MethodGet, opts.node+"/v1/watch?"+query.Encode(), nil, map[string]string{
+		"Accept": "text/event-stream",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return response_error(resp)
+	}
+
+	return read_events(resp.Body, func(data []byte) error {
+		event := http_db_server.WatchEventBody{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		watched := new_record(event.Key, event.Value, event.Context)
+		watched.Content_type = event.Content_type
+		watched.Deleted = event.Deleted
+		watched.Time = time.Now().Format(time.RFC3339)
+		return write_event(opts, out, &watched)
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_node() *httptest.Server {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	return httptest.NewServer(http_db_server.NewHttpDBServer(&http_db_server.Config{}, &hr).Handler())
+}
+
+func kdbctl(t *testing.T, node string, output string, consistency string, stdin string, args ...string) (string, error) {
+	out := bytes.Buffer{}
+	opts := options{node: node, output: output, consistency: consistency, http_client: &http.Client{}}
+	err := run(&opts, args, strings.NewReader(stdin), &out)
+	return out.String(), err
+}
+
+func TestKdbctlKeys(t *testing.T) {
+	node := test_node()
+	defer node.Close()
+
+	_, err := kdbctl(t, node.URL, "table", "", "", "get", "bar")
+	assert.Equal(t, "Key not found", err.Error())
+
+	_, err = kdbctl(t, node.URL, "table", "all", "", "put", "bar", "mar")
+	assert.Nil(t, err)
+	_, err = kdbctl(t, node.URL, "table", "", "car", "put", "-content-type", "text/plain", "foo")
+	assert.Nil(t, err)
+
+	out, err := kdbctl(t, node.URL, "json", "all", "", "get", "bar")
+	assert.Nil(t, err)
+	result := record{}
+	assert.Nil(t, json.Unmarshal([]byte(out), &result))
+	assert.Equal(t, "mar", result.Value)
+	assert.Equal(t, 1, result.Clock[0])
+	assert.Equal(t, 3, len(result.Replicas))
+
+	out, err = kdbctl(t, node.URL, "table", "", "", "get", "foo")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "VALUE         car\n")
+	assert.Contains(t, out, "CONTENT TYPE  text/plain\n")
+	assert.Contains(t, out, "CLOCK         0:1\n")
+
+	out, err = kdbctl(t, node.URL, "table", "", "", "scan")
+	assert.Nil(t, err)
+	assert.Equal(t, "KEY  VALUE  CLOCK\nbar  mar    0:1\nfoo  car    0:1\n", out)
+	out, err = kdbctl(t, node.URL, "json", "", "", "scan", "-limit", "1", "-all")
+	assert.Nil(t, err)
+	results := []record{}
+	assert.Nil(t, json.Unmarshal([]byte(out), &results))
+	assert.Equal(t, 2, len(results))
+
+	_, err = kdbctl(t, node.URL, "table", "", "", "delete", "bar")
+	assert.Nil(t, err)
+	_, err = kdbctl(t, node.URL, "table", "", "", "get", "bar")
+	assert.NotNil(t, err)
+
+	_, err = kdbctl(t, node.URL, "table", "most", "", "get", "bar")
+	assert.NotNil(t, err)
+	_, err = kdbctl(t, node.URL, "table", "", "", "get")
+	assert.NotNil(t, err)
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := ": heartbeat\n\nevent: change\ndata: {\"key\":\"bar\"}\n\nevent: change\ndata: {\"key\":\"foo\"}\n\n"
+	keys := []string{}
+	err := read_events(strings.NewReader(stream), func(data []byte) error {
+		event := http_db_server.WatchEventBody{}
+		json.Unmarshal(data, &event)
+		keys = append(keys, event.Key)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bar", "foo"}, keys)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/lucifer1662/distrokdb/node/http_db_server"
+)
+
+// record is what every command prints about a key
+type record struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	//base64 when the value isn't utf8 text
+	Encoding     string      `json:"encoding,omitempty"`
+	Content_type string      `json:"content_type,omitempty"`
+	Deleted      bool        `json:"deleted,omitempty"`
+	Context      string      `json:"context,omitempty"`
+	Clock        map[int]int `json:"clock,omitempty"`
+	Replicas     []uint64    `json:"replicas,omitempty"`
+	Expires      string      `json:"expires,omitempty"`
+	Time         string      `json:"time,omitempty"`
+}
+
+func new_record(key string, value []byte, context string) record {
+	result := record{Key: key, Context: context}
+	if utf8.Valid(value) {
+		result.Value = string(value)
+	} else {
+		result.Value = base64.StdEncoding.EncodeToString(value)
+		result.Encoding = "base64"
+	}
+	if meta, err := http_db_server.DecodeContext(context); err == nil && context != "" {
+		result.Clock = meta.VectorClock.Counts
+	}
+	return result
+}
+
+// format_clock lists the counts by node id, as 0:3 2:1
+func format_clock(clock map[int]int) string {
+	ids := make([]int, 0, len(clock))
+	for id := range clock {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	counts := make([]string, len(ids))
+	for i, id := range ids {
+		counts[i] = strconv.Itoa(id) + ":" + strconv.Itoa(clock[id])
+	}
+	return strings.Join(counts, " ")
+}
+
+func format_replicas(replicas []uint64) string {
+	ids := make([]string, len(replicas))
+	for i := range replicas {
+		ids[i] = strconv.FormatUint(replicas[i], 10)
+	}
+	return strings.Join(ids, ",")
+}
+
+func write_json(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// write_record prints one key as a two column table of its non empty fields
+func write_record(opts *options, out io.Writer, result *record) error {
+	if opts.output == "json" {
+		return write_json(out, result)
+	}
+
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	row := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(table, "%s\t%s\n", name, value)
+		}
+	}
+	row("KEY", result.Key)
+	row("VALUE", result.Value)
+	row("ENCODING", result.Encoding)
+	row("CONTENT TYPE", result.Content_type)
+	if result.Deleted {
+		row("DELETED", "true")
+	}
+	row("CLOCK", format_clock(result.Clock))
+	row("REPLICAS", format_replicas(result.Replicas))
+	row("EXPIRES", result.Expires)
+	row("CONTEXT", result.Context)
+	return table.Flush()
+}
+
+// write_records prints keys as a table with a row per key
+func write_records(opts *options, out io.Writer, results []record) error {
+	if opts.output == "json" {
+		return write_json(out, results)
+	}
+
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "KEY\tVALUE\tCLOCK")
+	for i := range results {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", results[i].Key, results[i].Value, format_clock(results[i].Clock))
+	}
+	return table.Flush()
+}
+
+// write_event prints a watched version as a line, so streams can be piped into other tools
+func write_event(opts *options, out io.Writer, result *record) error {
+	if opts.output == "json" {
+		return json.NewEncoder(out).Encode(result)
+	}
+	value := result.Value
+	if result.Deleted {
+		value = "(deleted)"
+	}
+	_, err := fmt.Fprintf(out, "%s  %s  %s  %s\n", result.Time, result.Key, value, format_clock(result.Clock))
+	return err
+}
+
+// read_events calls on_event with the data of every server sent event in the stream
+func read_events(stream io.Reader, on_event func(data []byte) error) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 4*http_db_server.Max_value_size)
+	data := bytes.Buffer{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() != 0 {
+				if err := on_event(data.Bytes()); err != nil {
+					return err
+				}
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() != 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
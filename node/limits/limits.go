@@ -0,0 +1,137 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Any is a rate limit's client or endpoint matching every client or endpoint
+const Any = "*"
+
+// Idle_bucket_interval is how often token buckets that have refilled are dropped,
+// so clients that have gone away don't keep their buckets
+const Idle_bucket_interval = time.Minute
+
+// RateLimit limits the requests each matching client sends to matching endpoints.
+// Every client gets its own token bucket, a client matching several limits must be allowed by all of them.
+// Buckets are kept by each node for the requests it serves over http, resp and memcache,
+// so a client spreading its requests over several nodes gets the rate from each of them
+type RateLimit struct {
+	//principal the request was authenticated as, or the client's ip without auth, * for every client
+	Client string
+	//keys, batch, scan, watch, changes, ring, buckets, metrics or admin, * for every endpoint sharing one bucket
+	Endpoint            string
+	Requests_per_second float64
+	//requests allowed at once after the client has been idle, at least 1
+	Burst int
+}
+
+type Config struct {
+	Rate_limits []RateLimit `json:",omitempty"`
+	//limits each client's ip before it is authenticated, so clients failing authentication are limited too,
+	//Client is an ip or * for every ip
+	Ip_rate_limits []RateLimit `json:",omitempty"`
+	Quotas         []Quota     `json:",omitempty"`
+	//reads and writes from peers served at once, 0 is unlimited
+	Max_concurrent_rpc int `json:",omitempty"`
+}
+
+type bucket_id struct {
+	limit  int
+	client string
+	//empty when the limit covers every endpoint
+	endpoint string
+}
+
+// Limiter is the token buckets of the rate limits of every client
+type Limiter struct {
+	limits    []RateLimit
+	buckets   map[bucket_id]*TokenBucket
+	pruned_at time.Time
+	lock      sync.Mutex
+	//time buckets are refilled by, replaced in tests
+	now func() time.Time
+}
+
+func NewLimiter(limits []RateLimit) (*Limiter, error) {
+	for i, limit := range limits {
+		if limit.Client == "" || limit.Endpoint == "" {
+			return nil, fmt.Errorf("Rate limit %d needs a client and endpoint, * matches all", i)
+		}
+		if limit.Requests_per_second <= 0 || limit.Burst < 1 {
+			return nil, fmt.Errorf("Rate limit %d needs a positive rate and a burst of at least 1", i)
+		}
+	}
+	return &Limiter{limits: limits, buckets: map[bucket_id]*TokenBucket{}, now: time.Now}, nil
+}
+
+func (limit *RateLimit) matches(client string, endpoint string) bool {
+	return (limit.Client == Any || limit.Client == client) && (limit.Endpoint == Any || limit.Endpoint == endpoint)
+}
+
+// Allow takes a token for a request of the client to the endpoint, when any matching limit has run out
+// nothing is taken and the wait until the request would be allowed is returned
+func (limiter *Limiter) Allow(client string, endpoint string) (bool, time.Duration) {
+	defer limiter.lock.Unlock()
+	limiter.lock.Lock()
+	now := limiter.now()
+	if limiter.pruned_at.IsZero() {
+		limiter.pruned_at = now
+	}
+	if now.Sub(limiter.pruned_at) >= Idle_bucket_interval {
+		limiter.pruned_at = now
+		for id, bucket := range limiter.buckets {
+			if bucket.Full(now) {
+				delete(limiter.buckets, id)
+			}
+		}
+	}
+
+	matched := []*TokenBucket{}
+	wait := time.Duration(0)
+	for i := range limiter.limits {
+		limit := &limiter.limits[i]
+		if !limit.matches(client, endpoint) {
+			continue
+		}
+		id := bucket_id{limit: i, client: client}
+		if limit.Endpoint != Any {
+			id.endpoint = endpoint
+		}
+		bucket, exists := limiter.buckets[id]
+		if !exists {
+			bucket = NewTokenBucket(limit.Requests_per_second, limit.Burst, now)
+			limiter.buckets[id] = bucket
+		}
+		if bucket_wait := bucket.Wait(now); bucket_wait > wait {
+			wait = bucket_wait
+		}
+		matched = append(matched, bucket)
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, bucket := range matched {
+		bucket.Take(now)
+	}
+	return true, 0
+}
+
+// CheckConfig fails for a config the limiter or quota tracker would reject
+func CheckConfig(config *Config) error {
+	if config.Max_concurrent_rpc < 0 {
+		return errors.New("Max_concurrent_rpc can't be negative")
+	}
+	if _, err := NewLimiter(config.Rate_limits); err != nil {
+		return err
+	}
+	if _, err := NewLimiter(config.Ip_rate_limits); err != nil {
+		return fmt.Errorf("Ip rate limits: %w", err)
+	}
+	_, err := NewQuotaTracker(config.Quotas)
+	return err
+}
+
+var ErrQuotaExceeded = errors.New("Quota exceeded")
@@ -0,0 +1,95 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	bucket := NewTokenBucket(2, 2, now)
+	assert.Equal(t, time.Duration(0), bucket.Wait(now))
+	bucket.Take(now)
+	bucket.Take(now)
+	assert.Equal(t, 500*time.Millisecond, bucket.Wait(now))
+	assert.Equal(t, time.Duration(0), bucket.Wait(now.Add(500*time.Millisecond)))
+	assert.False(t, bucket.Full(now.Add(500*time.Millisecond)))
+	assert.True(t, bucket.Full(now.Add(time.Hour)))
+}
+
+func TestLimiter(t *testing.T) {
+	limiter, err := NewLimiter([]RateLimit{
+		{Client: Any, Endpoint: Any, Requests_per_second: 10, Burst: 3},
+		{Client: Any, Endpoint: "scan", Requests_per_second: 1, Burst: 1},
+		{Client: "batch-job", Endpoint: Any, Requests_per_second: 1, Burst: 1},
+	})
+	assert.Nil(t, err)
+	now := time.Unix(1000, 0)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.Allow("alice", "scan")
+	assert.True(t, allowed)
+	allowed, wait := limiter.Allow("alice", "scan")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+	//a denied request takes no tokens from the other limits
+	allowed, _ = limiter.Allow("alice", "keys")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("alice", "keys")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("alice", "keys")
+	assert.False(t, allowed)
+	//every client has its own buckets
+	allowed, _ = limiter.Allow("bob", "keys")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("batch-job", "keys")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("batch-job", "keys")
+	assert.False(t, allowed)
+
+	now = now.Add(Idle_bucket_interval)
+	allowed, _ = limiter.Allow("alice", "scan")
+	assert.True(t, allowed)
+	assert.Equal(t, 2, len(limiter.buckets))
+
+	_, err = NewLimiter([]RateLimit{{Client: Any, Endpoint: Any, Requests_per_second: 10}})
+	assert.NotNil(t, err)
+}
+
+func TestQuotas(t *testing.T) {
+	nodes := hash_ring.Generate_Nodes(3)
+	table := hash_ring.NewInMemoryTable()
+	for i := range nodes {
+		//every node stores locally in the one table
+		nodes[i].SetTable(&table)
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 3, 3, &hash_ring.ConflictResolutionFirstInstance{})
+
+	tracker, err := NewQuotaTracker([]Quota{
+		{Prefix: "users/", Max_keys: 2},
+		{Bucket: "orders", Max_bytes: 8},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, hr.Add("users/1", []byte("mar"), hash_ring.NewValueMeta(hash_ring.NewVectorClock())))
+	assert.Nil(t, hr.Add("users/2", []byte("car"), hash_ring.NewValueMeta(hash_ring.NewVectorClock())))
+	assert.Nil(t, hr.Add("other", []byte("car"), hash_ring.NewValueMeta(hash_ring.NewVectorClock())))
+	tracker.Refresh(&hr, time.Now())
+	assert.Equal(t, []Usage{{Keys: 2, Bytes: 20}, {}}, tracker.Usage())
+
+	assert.True(t, errors.Is(tracker.Admit("users/3", 3), ErrQuotaExceeded))
+	assert.Nil(t, tracker.Admit("other/3", 3))
+	assert.Nil(t, tracker.Admit(hash_ring.Bucket_Key("orders", "1"), 4))
+	//counted until the next refresh
+	assert.True(t, errors.Is(tracker.Admit(hash_ring.Bucket_Key("orders", "2"), 4), ErrQuotaExceeded))
+	tracker.Refresh(&hr, time.Now())
+	assert.Nil(t, tracker.Admit(hash_ring.Bucket_Key("orders", "2"), 4))
+
+	_, err = NewQuotaTracker([]Quota{{Prefix: "users/"}})
+	assert.NotNil(t, err)
+}
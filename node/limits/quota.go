@@ -0,0 +1,148 @@
+package limits
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+// Quota_refresh_interval is how often quota usage is recounted from the local tables
+const Quota_refresh_interval = 30 * time.Second
+
+// Quota bounds the keys of a bucket starting with a prefix stored on each node, counting every replica
+// the node holds. Usage isn't summed across the cluster, each node checks the writes it coordinates over http,
+// resp and memcache against its own usage, so a quota bounds what any one node holds rather than the cluster's total.
+// Deletes are always allowed so a namespace over its quota can be cleaned up
+type Quota struct {
+	//empty for keys outside of buckets
+	Bucket string `json:",omitempty"`
+	//empty for every key of the bucket
+	Prefix string `json:",omitempty"`
+	//bytes of keys, without their bucket, and values, 0 is unlimited
+	Max_bytes int64 `json:",omitempty"`
+	//0 is unlimited
+	Max_keys int `json:",omitempty"`
+}
+
+type Usage struct {
+	Keys  int
+	Bytes int64
+}
+
+// QuotaTracker counts the usage of every quota, recounted by Refresh and raised by every admitted write in between
+type QuotaTracker struct {
+	quotas []Quota
+	usage  []Usage
+	lock   sync.Mutex
+}
+
+func NewQuotaTracker(quotas []Quota) (*QuotaTracker, error) {
+	for i, quota := range quotas {
+		if quota.Bucket != "" {
+			if err := hash_ring.Validate_Bucket_Name(quota.Bucket); err != nil {
+				return nil, fmt.Errorf("Quota %d: %s", i, err.Error())
+			}
+		}
+		if quota.Max_bytes < 0 || quota.Max_keys < 0 || (quota.Max_bytes == 0 && quota.Max_keys == 0) {
+			return nil, fmt.Errorf("Quota %d needs a positive Max_bytes or Max_keys", i)
+		}
+	}
+	return &QuotaTracker{quotas: quotas, usage: make([]Usage, len(quotas))}, nil
+}
+
+func (quota *Quota) matches(bucket string, key string) bool {
+	return bucket == quota.Bucket && strings.HasPrefix(key, quota.Prefix)
+}
+
+func (quota *Quota) exceeded_by(usage Usage) bool {
+	return (quota.Max_bytes != 0 && usage.Bytes > quota.Max_bytes) || (quota.Max_keys != 0 && usage.Keys > quota.Max_keys)
+}
+
+// Admit checks a write of a value to a stored key keeps every matching quota within its bounds,
+// counting the write until the next Refresh
+func (tracker *QuotaTracker) Admit(stored_key string, value_size int) error {
+	defer tracker.lock.Unlock()
+	tracker.lock.Lock()
+	bucket, key := hash_ring.Split_Bucket_Key(stored_key)
+	write := Usage{Keys: 1, Bytes: int64(len(key) + value_size)}
+	matched := []int{}
+	for i := range tracker.quotas {
+		quota := &tracker.quotas[i]
+		if !quota.matches(bucket, key) {
+			continue
+		}
+		if quota.exceeded_by(Usage{tracker.usage[i].Keys + write.Keys, tracker.usage[i].Bytes + write.Bytes}) {
+			if bucket == "" {
+				return fmt.Errorf("%w for keys starting with \"%s\"", ErrQuotaExceeded, quota.Prefix)
+			}
+			return fmt.Errorf("%w for keys starting with \"%s\" in bucket %s", ErrQuotaExceeded, quota.Prefix, bucket)
+		}
+		matched = append(matched, i)
+	}
+	//overwrites are counted as new keys until the next refresh, erring on the side of the quota
+	for _, i := range matched {
+		tracker.usage[i].Keys += write.Keys
+		tracker.usage[i].Bytes += write.Bytes
+	}
+	return nil
+}
+
+// Usage is the last counted usage of each quota, in the order they were configured
+func (tracker *QuotaTracker) Usage() []Usage {
+	defer tracker.lock.Unlock()
+	tracker.lock.Lock()
+	return append([]Usage{}, tracker.usage...)
+}
+
+// Refresh recounts the usage of every quota from the permanent tables held locally,
+// deleted and expired values are not counted
+func (tracker *QuotaTracker) Refresh(ring *hash_ring.Hash_Ring, now time.Time) {
+	usage := make([]Usage, len(tracker.quotas))
+	counted := make(map[hash_ring.KeyValueTable]bool)
+	nodes := ring.Nodes()
+	for i := range nodes {
+		table := nodes[i].GetTable()
+		//only tables holding their values locally can be iterated
+		if !hash_ring.Is_Local_Table(table) || counted[table] {
+			continue
+		}
+		counted[table] = true
+		iter := table.Iter()
+		for stored_key, value, meta := iter.Next(); stored_key != nil; stored_key, value, meta = iter.Next() {
+			if meta.Deleted || meta.Expired(now) {
+				continue
+			}
+			bucket, key := hash_ring.Split_Bucket_Key(*stored_key)
+			for q := range tracker.quotas {
+				if tracker.quotas[q].matches(bucket, key) {
+					usage[q].Keys++
+					usage[q].Bytes += int64(len(key) + len(value))
+				}
+			}
+		}
+	}
+
+	defer tracker.lock.Unlock()
+	tracker.lock.Lock()
+	tracker.usage = usage
+}
+
+// Start_refresher refreshes the tracker from the ring every interval until stop is closed
+func Start_refresher(tracker *QuotaTracker, ring *hash_ring.Hash_Ring, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		tracker.Refresh(ring, time.Now())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				tracker.Refresh(ring, now)
+			}
+		}
+	}()
+}
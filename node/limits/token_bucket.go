@@ -0,0 +1,47 @@
+package limits
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket refills at rate tokens a second up to burst, each request takes one token
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket starts full, so a client's first burst is allowed straight away
+func NewTokenBucket(rate float64, burst int, now time.Time) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (bucket *TokenBucket) refill(now time.Time) {
+	if now.After(bucket.last) {
+		bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+		bucket.last = now
+	}
+}
+
+// Wait is how long until a token is available, 0 when one is available now
+func (bucket *TokenBucket) Wait(now time.Time) time.Duration {
+	bucket.refill(now)
+	if bucket.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second))
+}
+
+// Take takes a token, only call it after Wait returned 0
+func (bucket *TokenBucket) Take(now time.Time) {
+	bucket.refill(now)
+	bucket.tokens--
+}
+
+// Full is whether the bucket has refilled, a full bucket can be dropped and created again when needed
+func (bucket *TokenBucket) Full(now time.Time) bool {
+	bucket.refill(now)
+	return bucket.tokens >= bucket.burst
+}
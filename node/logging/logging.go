@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// RequestIdHeader is the id of an http request, taken from the client when it sends a valid one,
+// and sent back with every response
+const RequestIdHeader = "X-Request-Id"
+
+// RequestIdKey is the attribute holding the request id in log lines
+const RequestIdKey = "request_id"
+
+const max_request_id_length = 64
+
+// Level is the level of every logger made by New, it can be changed while the node is running
+var Level = new(slog.LevelVar)
+
+type Config struct {
+	//debug, info, warn or error, info by default
+	Level string `json:",omitempty"`
+	//text or json, text by default
+	Format string `json:",omitempty"`
+}
+
+func CheckConfig(config *Config) error {
+	if _, err := Parse_Level(config.Level); err != nil {
+		return err
+	}
+	if config.Format != "" && config.Format != "text" && config.Format != "json" {
+		return fmt.Errorf("Unknown log format \"%s\", use text or json", config.Format)
+	}
+	return nil
+}
+
+// Parse_Level parses a level name such as debug or WARN, empty is info
+func Parse_Level(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("Unknown log level \"%s\", use debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// New makes a logger writing to w, setting Level to the level of the config.
+// Lines logged with a context carrying a request id include it, a nil config is the defaults
+func New(config *Config, w io.Writer) (*slog.Logger, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if err := CheckConfig(config); err != nil {
+		return nil, err
+	}
+	level, _ := Parse_Level(config.Level)
+	Level.Set(level)
+
+	options := &slog.HandlerOptions{Level: Level}
+	var handler slog.Handler
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(&request_id_handler{handler}), nil
+}
+
+// request_id_handler adds the request id of the context to each line
+type request_id_handler struct {
+	slog.Handler
+}
+
+func (handler *request_id_handler) Handle(ctx context.Context, record slog.Record) error {
+	if request_id := RequestId(ctx); request_id != "" {
+		record.AddAttrs(slog.String(RequestIdKey, request_id))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler *request_id_handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &request_id_handler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler *request_id_handler) WithGroup(name string) slog.Handler {
+	return &request_id_handler{handler.Handler.WithGroup(name)}
+}
+
+type request_id_key struct{}
+
+// New_Request_Id makes a random id for a request the client didn't name
+func New_Request_Id() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+var ErrInvalidRequestId = errors.New("Request ids are at most 64 letters, digits, '-', '_', '.' or ':'")
+
+// Check_Request_Id rejects ids from clients that would make log lines hard to read or search
+func Check_Request_Id(request_id string) error {
+	if request_id == "" || len(request_id) > max_request_id_length {
+		return ErrInvalidRequestId
+	}
+	for _, c := range request_id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return ErrInvalidRequestId
+		}
+	}
+	return nil
+}
+
+// WithRequestId is the context of the request with the id, empty ids leave the context unchanged
+func WithRequestId(ctx context.Context, request_id string) context.Context {
+	if request_id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, request_id_key{}, request_id)
+}
+
+// RequestId is the id of the request the context belongs to, empty outside of requests
+func RequestId(ctx context.Context) string {
+	request_id, _ := ctx.Value(request_id_key{}).(string)
+	return request_id
+}
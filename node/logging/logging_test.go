@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	defer Level.Set(slog.LevelInfo)
+	var out bytes.Buffer
+	logger, err := New(&Config{Level: "warn", Format: "json"}, &out)
+	assert.Nil(t, err)
+	logger = logger.With("node", 3)
+
+	ctx := WithRequestId(context.Background(), "abc")
+	logger.InfoContext(ctx, "Hidden")
+	logger.WarnContext(ctx, "Shown", "key", "bar")
+	logger.Warn("Outside of a request")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "Shown", line["msg"])
+	assert.Equal(t, "abc", line[RequestIdKey])
+	assert.Equal(t, 3.0, line["node"])
+	assert.False(t, strings.Contains(lines[1], RequestIdKey))
+
+	//the level can be changed while running
+	out.Reset()
+	Level.Set(slog.LevelDebug)
+	logger.DebugContext(ctx, "Now shown")
+	assert.True(t, strings.Contains(out.String(), "Now shown"))
+
+	out.Reset()
+	logger, err = New(nil, &out)
+	assert.Nil(t, err)
+	logger.InfoContext(ctx, "Text")
+	assert.True(t, strings.Contains(out.String(), "msg=Text request_id=abc"))
+	logger.Debug("Hidden")
+	assert.False(t, strings.Contains(out.String(), "Hidden"))
+
+	_, err = New(&Config{Level: "loud"}, &out)
+	assert.NotNil(t, err)
+	_, err = New(&Config{Format: "xml"}, &out)
+	assert.NotNil(t, err)
+}
+
+func TestRequestIds(t *testing.T) {
+	level, err := Parse_Level("DEBUG")
+	assert.Nil(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+	level, _ = Parse_Level("")
+	assert.Equal(t, slog.LevelInfo, level)
+
+	assert.Equal(t, "", RequestId(context.Background()))
+	assert.Equal(t, "", RequestId(WithRequestId(context.Background(), "")))
+
+	request_id := New_Request_Id()
+	assert.Equal(t, 16, len(request_id))
+	assert.NotEqual(t, request_id, New_Request_Id())
+	assert.Nil(t, Check_Request_Id(request_id))
+	assert.Nil(t, Check_Request_Id("client-1:req_2.a"))
+	assert.NotNil(t, Check_Request_Id(""))
+	assert.NotNil(t, Check_Request_Id("bad id"))
+	assert.NotNil(t, Check_Request_Id("line\nbreak"))
+	assert.NotNil(t, Check_Request_Id(strings.Repeat("a", 65)))
+}
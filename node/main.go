@@ -1,24 +1,159 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/lucifer1662/distrokdb/node/auth"
 	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
 	"github.com/lucifer1662/distrokdb/node/http_db_server"
+	"github.com/lucifer1662/distrokdb/node/limits"
+	"github.com/lucifer1662/distrokdb/node/logging"
 	"github.com/lucifer1662/distrokdb/node/manager_server"
+	"github.com/lucifer1662/distrokdb/node/memcache_server"
+	"github.com/lucifer1662/distrokdb/node/metrics"
+	"github.com/lucifer1662/distrokdb/node/resp_server"
+	"github.com/lucifer1662/distrokdb/node/tracing"
 )
 
+const backfill_retry_interval = 5 * time.Second
+const sweep_interval = time.Minute
+
 type DistributedKeyDataBase struct {
-	hr_internal_server   *distributed_hash_ring.DistributedHashRingServer
-	http_external_server *http_db_server.HttpDBServer
+	hr_internal_server       *distributed_hash_ring.DistributedHashRingServer
+	http_external_server     *http_db_server.HttpDBServer
+	resp_external_server     *resp_server.RespServer
+	memcache_external_server *memcache_server.MemcacheServer
+	hr                       *hash_ring.Hash_Ring
+	config                   *manager_server.Config
+	config_path              string
+	replication_status       manager_server.ReplicationStatusResponse
+	quotas                   *limits.QuotaTracker
+	tracer                   *tracing.Tracer
+	logger                   *slog.Logger
+	stop_background          chan struct{}
+	lock                     sync.Mutex
 }
 
 func NewDistributedKeyDataBase(config *manager_server.Config) *DistributedKeyDataBase {
-	hr := distributed_hash_ring.New(config.Hash_ring_config)
+	logger, err := logging.New(config.Logging_config, os.Stderr)
+	if err != nil {
+		logger, _ = logging.New(nil, os.Stderr)
+		logger.Warn("Using default logging", "error", err.Error())
+	}
+	logger = logger.With("node", config.Hash_ring_config.My_id)
+	hr := distributed_hash_ring.New(config.Hash_ring_config, logger)
 
 	db := DistributedKeyDataBase{
-		distributed_hash_ring.NewServer(&hr, config.Hash_ring_config.My_port),
-		http_db_server.NewHttpDBServer(config.Http_config, &hr),
+		hr_internal_server:   distributed_hash_ring.NewServer(hr, config.Hash_ring_config.My_port),
+		http_external_server: http_db_server.NewHttpDBServer(config.Http_config, hr),
+		hr:                   hr,
+		config:               config,
+		logger:               logger,
+		replication_status: manager_server.ReplicationStatusResponse{
+			Epoch:             config.Hash_ring_config.Epoch,
+			Backfill_complete: config.Hash_ring_config.Read_replication_factor == 0,
+		},
+	}
+
+	if config.Slow_log_config != nil {
+		hr.SetSlowLog(hash_ring.NewSlowLog(config.Slow_log_config))
+	}
+	hr.SetHotKeys(hash_ring.NewHotKeys(hash_ring.Default_hot_keys_capacity))
+	db.hr_internal_server.SetLogger(logger)
+	db.http_external_server.SetLogger(logger)
+	hash_ring.Register_table_sizes(metrics.Default, hr)
+
+	db.http_external_server.SetRingConfig(func() *distributed_hash_ring.SharedConfig {
+		defer db.lock.Unlock()
+		db.lock.Lock()
+		return db.config.Hash_ring_config.SharedConfig
+	})
+
+	var authenticator *auth.Auth
+	if config.Auth_config != nil {
+		var err error
+		authenticator, err = auth.New(config.Auth_config)
+		if err != nil {
+			//an auth config that can't be used must not leave the api open
+			logger.Error("Refusing every request", "error", err.Error())
+			authenticator = &auth.Auth{}
+		}
+		db.http_external_server.SetAuth(authenticator)
+	}
+
+	//the same limits and quotas apply over every protocol
+	var limiter, ip_limiter *limits.Limiter
+	if config.Limits_config != nil {
+		var err error
+		limiter, err = limits.NewLimiter(config.Limits_config.Rate_limits)
+		if err != nil {
+			logger.Warn("Not rate limiting", "error", err.Error())
+			limiter = nil
+		}
+		quotas, err := limits.NewQuotaTracker(config.Limits_config.Quotas)
+		if err != nil {
+			logger.Warn("Not enforcing quotas", "error", err.Error())
+			quotas = nil
+		}
+		db.quotas = quotas
+		db.http_external_server.SetLimits(limiter, quotas)
+		ip_limiter, err = limits.NewLimiter(config.Limits_config.Ip_rate_limits)
+		if err != nil {
+			logger.Warn("Not rate limiting ips", "error", err.Error())
+			ip_limiter = nil
+		}
+		db.http_external_server.SetIpLimits(ip_limiter)
+		db.hr_internal_server.SetMaxConcurrentRequests(config.Limits_config.Max_concurrent_rpc)
+	}
+
+	if config.Tracing_config != nil {
+		tracer, err := tracing.NewTracer(config.Tracing_config, strconv.FormatUint(config.Hash_ring_config.My_id, 10))
+		if err != nil {
+			logger.Warn("Not tracing", "error", err.Error())
+		} else {
+			db.tracer = tracer
+		}
+	}
+
+	if config.Resp_config != nil && config.Resp_config.Resp_port != 0 {
+		resp_external_server, err := resp_server.NewRespServer(config.Resp_config, hr)
+		if err != nil {
+			logger.Warn("Not starting resp server", "error", err.Error())
+		} else {
+			if authenticator != nil {
+				resp_external_server.SetAuth(authenticator)
+			}
+			resp_external_server.SetLimits(limiter, db.quotas)
+			resp_external_server.SetIpLimits(ip_limiter)
+			db.resp_external_server = resp_external_server
+		}
+	}
+
+	if config.Memcache_config != nil && config.Memcache_config.Memcache_port != 0 && authenticator != nil {
+		//refused by check_memcache_auth on start up, it would leave every key open
+		logger.Error("Not starting memcache server", "error", ErrMemcacheWithAuth.Error())
+	} else if config.Memcache_config != nil && config.Memcache_config.Memcache_port != 0 {
+		memcache_external_server, err := memcache_server.NewMemcacheServer(config.Memcache_config, hr)
+		if err != nil {
+			logger.Warn("Not starting memcache server", "error", err.Error())
+		} else {
+			memcache_external_server.SetLimits(limiter, db.quotas)
+			memcache_external_server.SetIpLimits(ip_limiter)
+			db.memcache_external_server = memcache_external_server
+		}
+	}
+
+	if !db.replication_status.Backfill_complete {
+		//restarted part way through a back fill
+		go db.backfill(config.Hash_ring_config.Epoch)
 	}
 
 	return &db
@@ -27,10 +162,28 @@ func NewDistributedKeyDataBase(config *manager_server.Config) *DistributedKeyDat
 func (db *DistributedKeyDataBase) Stop() {
 	db.hr_internal_server.Stop()
 	db.http_external_server.Stop()
-
+	if db.resp_external_server != nil {
+		db.resp_external_server.Stop()
+	}
+	if db.memcache_external_server != nil {
+		db.memcache_external_server.Stop()
+	}
+	if db.stop_background != nil {
+		close(db.stop_background)
+		db.stop_background = nil
+	}
+	if db.tracer != nil {
+		tracing.SetTracer(nil)
+		db.tracer.Stop()
+		db.tracer = nil
+	}
 }
 
 func (db *DistributedKeyDataBase) Start() {
+	if db.tracer != nil {
+		db.tracer.Start()
+		tracing.SetTracer(db.tracer)
+	}
 
 	go func() {
 		db.hr_internal_server.Start()
@@ -39,19 +192,202 @@ func (db *DistributedKeyDataBase) Start() {
 	go func() {
 		db.http_external_server.Start()
 	}()
+
+	if db.resp_external_server != nil {
+		go db.resp_external_server.Start()
+	}
+
+	if db.memcache_external_server != nil {
+		go db.memcache_external_server.Start()
+	}
+
+	db.stop_background = make(chan struct{})
+	hash_ring.Start_sweeper(db.hr, sweep_interval, db.stop_background)
+	hash_ring.Start_decay(db.hr.HotKeys(), hash_ring.Hot_keys_decay_interval, db.stop_background)
+	if db.quotas != nil {
+		limits.Start_refresher(db.quotas, db.hr, limits.Quota_refresh_interval, db.stop_background)
+	}
+}
+
+func same_nodes(left []distributed_hash_ring.Node, right []distributed_hash_ring.Node) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Reconfigure applies a config pushed by the cluster manager to the running node.
+// Only the replication factor, quorum sizes and buckets can be changed without a restart.
+func (db *DistributedKeyDataBase) Reconfigure(config *manager_server.Config) error {
+	if config == nil || config.Hash_ring_config == nil || config.Hash_ring_config.SharedConfig == nil {
+		return errors.New("Missing hash ring config")
+	}
+
+	defer db.lock.Unlock()
+	db.lock.Lock()
+
+	new_config := config.Hash_ring_config
+	current_config := db.config.Hash_ring_config
+	if new_config.Epoch <= current_config.Epoch {
+		return fmt.Errorf("Config epoch %d is not newer than current epoch %d", new_config.Epoch, current_config.Epoch)
+	}
+
+	if !same_nodes(new_config.Nodes, current_config.Nodes) {
+		return errors.New("Changing the nodes of the ring requires a restart")
+	}
+
+	if new_config.Partitioner != current_config.Partitioner {
+		return errors.New("Changing the partitioner requires the data to be moved between nodes, and is not supported")
+	}
+
+	//checked first, so a config with bad buckets changes nothing
+	err := db.hr.ValidateBuckets(new_config.Buckets)
+	if err != nil {
+		return err
+	}
+
+	err = db.hr.SetQuorum(new_config.Replication_factor, new_config.Minimum_writes, new_config.Minimum_read, new_config.Read_replication_factor)
+	if err != nil {
+		return err
+	}
+	db.hr.SetBuckets(new_config.Buckets)
+
+	//keep the rest of this node's config, only the shared config changes
+	current_config.SharedConfig = new_config.SharedConfig
+	if db.config_path != "" {
+		err = manager_server.SaveConfig(db.config, db.config_path)
+		if err != nil {
+			db.logger.Error("Failed to save config", "path", db.config_path, "error", err.Error())
+		}
+	}
+
+	db.replication_status = manager_server.ReplicationStatusResponse{
+		Epoch:             new_config.Epoch,
+		Backfill_complete: new_config.Read_replication_factor == 0,
+	}
+	if !db.replication_status.Backfill_complete {
+		go db.backfill(new_config.Epoch)
+	}
+
+	return nil
+}
+
+// backfill copies local values onto any new replicas, retrying until every key is fully
+// replicated or a newer config replaces the one that requested it
+func (db *DistributedKeyDataBase) backfill(epoch uint64) {
+	for {
+		failed_keys := distributed_hash_ring.Backfill(db.hr)
+
+		db.lock.Lock()
+		if db.replication_status.Epoch != epoch {
+			db.lock.Unlock()
+			return
+		}
+		db.replication_status.Failed_keys = failed_keys
+		db.replication_status.Backfill_complete = failed_keys == 0
+		db.lock.Unlock()
+
+		if failed_keys == 0 {
+			return
+		}
+		db.logger.Warn("Back fill failed for some keys, retrying", "epoch", epoch, "failed_keys", failed_keys)
+		time.Sleep(backfill_retry_interval)
+	}
+}
+
+func (db *DistributedKeyDataBase) ReplicationStatus() manager_server.ReplicationStatusResponse {
+	defer db.lock.Unlock()
+	db.lock.Lock()
+	return db.replication_status
+}
+
+var ErrMemcacheWithAuth = errors.New("The memcache protocol can't authenticate clients, remove Memcache_port or Auth_config")
+
+// check_memcache_auth fails when the memcache server would serve every key despite auth being configured
+func check_memcache_auth(config *manager_server.Config) error {
+	if config.Auth_config != nil && config.Memcache_config != nil && config.Memcache_config.Memcache_port != 0 {
+		return ErrMemcacheWithAuth
+	}
+	return nil
+}
+
+// exit_on_error logs an error the node can't start with, then exits
+func exit_on_error(logger *slog.Logger, message string, err error) {
+	if err != nil {
+		logger.Error(message, "error", err.Error())
+		os.Exit(1)
+	}
+}
+
+// Distribution counts the keys stored on this node by range, with the keys most accessed through it
+func (db *DistributedKeyDataBase) Distribution(top_keys int) manager_server.DistributionResponse {
+	return manager_server.DistributionResponse{
+		Physical_id: db.hr.Id(),
+		Ranges:      db.hr.Range_Stats(time.Now()),
+		Hot_keys:    db.hr.HotKeys().Top(top_keys),
+	}
 }
 
 func main() {
-	println("Started")
+	//logs until the node's logging config is read
+	logger, _ := logging.New(nil, os.Stderr)
+	slog.SetDefault(logger)
+	logger.Info("Started")
 
 	config_port := flag.Int("config_port", 8312, "Will listen for a config on this port if no local config.json is found")
-	config, err := manager_server.ReadConfig("./config.json", *config_port)
-	if err != nil {
-		println(err.Error())
-		return
+	flag.Parse()
+
+	config_path := "./config.json"
+	config, err := manager_server.ReadConfig(config_path, *config_port)
+	exit_on_error(logger, "Failed to read config", err)
+
+	exit_on_error(logger, "Invalid partitioner", distributed_hash_ring.CheckPartitioner(config.Hash_ring_config))
+
+	if config.Resp_config != nil {
+		exit_on_error(logger, "Invalid resp config", resp_server.CheckConfig(config.Resp_config))
+	}
+
+	if config.Memcache_config != nil {
+		exit_on_error(logger, "Invalid memcache config", memcache_server.CheckConfig(config.Memcache_config))
+	}
+
+	if config.Auth_config != nil {
+		exit_on_error(logger, "Invalid auth config", auth.CheckConfig(config.Auth_config))
+		exit_on_error(logger, "Invalid memcache config", check_memcache_auth(config))
+	}
+
+	if config.Tracing_config != nil {
+		exit_on_error(logger, "Invalid tracing config", tracing.CheckConfig(config.Tracing_config))
+	}
+
+	if config.Limits_config != nil {
+		exit_on_error(logger, "Invalid limits config", limits.CheckConfig(config.Limits_config))
+	}
+
+	if config.Logging_config != nil {
+		exit_on_error(logger, "Invalid logging config", logging.CheckConfig(config.Logging_config))
+	}
+
+	if config.Slow_log_config != nil {
+		exit_on_error(logger, "Invalid slow log config", hash_ring.CheckSlowLogConfig(config.Slow_log_config))
 	}
 
 	server := NewDistributedKeyDataBase(config)
+	server.config_path = config_path
+	slog.SetDefault(server.logger)
 
 	server.Start()
+
+	//keep listening for new configs from the cluster manager
+	config_server := manager_server.NewServer(*config_port, server)
+	config_server.SetLogger(server.logger)
+	config_server.Start()
+	defer config_server.Stop()
+
+	select {}
 }
@@ -2,20 +2,43 @@ package manager_server
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"net/rpc"
 	"os"
 	"strconv"
 
+	"github.com/lucifer1662/distrokdb/node/auth"
 	"github.com/lucifer1662/distrokdb/node/distributed_hash_ring"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
 	"github.com/lucifer1662/distrokdb/node/http_db_server"
+	"github.com/lucifer1662/distrokdb/node/limits"
+	"github.com/lucifer1662/distrokdb/node/logging"
+	"github.com/lucifer1662/distrokdb/node/memcache_server"
+	"github.com/lucifer1662/distrokdb/node/resp_server"
+	"github.com/lucifer1662/distrokdb/node/tracing"
 )
 
 type Config struct {
 	Hash_ring_config *distributed_hash_ring.InstanceConfig
 	Http_config      *http_db_server.Config
+	//optional, the redis protocol listener is only started when set
+	Resp_config *resp_server.Config `json:",omitempty"`
+	//optional, the memcached protocol listener is only started when set
+	Memcache_config *memcache_server.Config `json:",omitempty"`
+	//optional, requests to the http api are only authenticated when set.
+	//The resp and memcached listeners are not authenticated, they should only be reachable by trusted clients
+	Auth_config *auth.Config `json:",omitempty"`
+	//optional, rate limits and quotas of http requests and the limit of concurrent requests from peers
+	Limits_config *limits.Config `json:",omitempty"`
+	//optional, spans of http requests and the replica requests they make are only exported when set
+	Tracing_config *tracing.Config `json:",omitempty"`
+	//optional, info level text logs to stderr when not set
+	Logging_config *logging.Config `json:",omitempty"`
+	//optional, operations slower than its threshold are only recorded when set
+	Slow_log_config *hash_ring.SlowLogConfig `json:",omitempty"`
 }
 
 func read_config_from_file(path string) (*Config, error) {
@@ -34,7 +57,7 @@ func read_config_from_file(path string) (*Config, error) {
 	return &config, nil
 }
 
-func save_config(config *Config, path string) error {
+func SaveConfig(config *Config, path string) error {
 	bytes, err := json.Marshal(config)
 	if err != nil {
 		return err
@@ -51,36 +74,52 @@ func ReadConfig(path string, port int) (*Config, error) {
 		return config, nil
 	}
 
-	config_server := newServer(port)
+	config_server := NewServer(port, nil)
 
 	config_server.Start()
 	defer config_server.Stop()
 	for {
 		config = <-config_server.config_chan
 		if config != nil {
-			save_config(config, path)
+			SaveConfig(config, path)
 			return config, nil
 		}
 	}
 
 }
 
+// Reconfigurable is a running node that can apply configs pushed by the cluster manager,
+// and report on its data to it
+type Reconfigurable interface {
+	Reconfigure(config *Config) error
+	ReplicationStatus() ReplicationStatusResponse
+	Distribution(top_keys int) DistributionResponse
+}
+
 type ManagerServer struct {
 	config_chan chan *Config
 	rpc_server  *rpc.Server
 	listener    *net.Listener
 	address     string
+	node        Reconfigurable
+	logger      *slog.Logger
 }
 
-func newServer(port int) *ManagerServer {
+// NewServer creates a server that accepts configs from the cluster manager,
+// if node is nil configs are sent on the config channel instead of being applied
+func NewServer(port int, node Reconfigurable) *ManagerServer {
 	rpc_server := rpc.NewServer()
-	s := ManagerServer{make(chan *Config), rpc_server, nil, ":" + strconv.Itoa(port)}
+	s := ManagerServer{make(chan *Config), rpc_server, nil, ":" + strconv.Itoa(port), node, slog.Default()}
 	rpc_server.Register(&s)
 	return &s
 }
 
+func (server *ManagerServer) SetLogger(logger *slog.Logger) {
+	server.logger = logger
+}
+
 type SetConfig struct {
-	config *Config
+	Config *Config
 }
 
 type SetConfigResponse struct {
@@ -91,20 +130,66 @@ type SetConfigResponse struct {
 func (t *ManagerServer) SetConfig(request SetConfig, response *SetConfigResponse) error {
 	var err error
 
-	t.config_chan <- request.config
+	if t.node != nil {
+		err = t.node.Reconfigure(request.Config)
+	} else {
+		t.config_chan <- request.Config
+	}
 
 	response.Success = err == nil
 	if !response.Success {
 		response.Error_message = err.Error()
+		t.logger.Warn("Rejected config from the cluster manager", "error", err.Error())
+	} else if t.node != nil {
+		t.logger.Info("Applied config from the cluster manager", "epoch", request.Config.Hash_ring_config.Epoch)
 	}
 	return err
 }
 
+type ReplicationStatusRequest struct{}
+
+type ReplicationStatusResponse struct {
+	Epoch uint64
+	//true once values have been copied to any replicas added by the config of this epoch
+	Backfill_complete bool
+	Failed_keys       int
+}
+
+func (t *ManagerServer) ReplicationStatus(request ReplicationStatusRequest, response *ReplicationStatusResponse) error {
+	if t.node == nil {
+		return errors.New("Node is not running")
+	}
+	*response = t.node.ReplicationStatus()
+	return nil
+}
+
+type DistributionRequest struct {
+	//number of the most accessed keys to return
+	Top_keys int
+}
+
+type DistributionResponse struct {
+	Physical_id uint64
+	//keys stored on the node by the range of the ring they hash into
+	Ranges []hash_ring.RangeStats
+	//most accessed keys of the reads and writes the node coordinated, as stored with their bucket
+	Hot_keys []hash_ring.HotKey
+}
+
+func (t *ManagerServer) Distribution(request DistributionRequest, response *DistributionResponse) error {
+	if t.node == nil {
+		return errors.New("Node is not running")
+	}
+	*response = t.node.Distribution(request.Top_keys)
+	return nil
+}
+
 func (server *ManagerServer) Start() {
 	listener, e := net.Listen("tcp", server.address)
 	server.listener = &listener
 	if e != nil {
-		log.Fatal("listen error:", e)
+		server.logger.Error("Failed to listen for configs", "address", server.address, "error", e.Error())
+		os.Exit(1)
 	}
 	go server.rpc_server.Accept(*server.listener)
 }
@@ -0,0 +1,223 @@
+package memcache_server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/lucifer1662/distrokdb/node/limits"
+)
+
+const (
+	magic_response = 0x81
+	header_size    = 24
+)
+
+const (
+	opcode_get     = 0x00
+	opcode_set     = 0x01
+	opcode_delete  = 0x04
+	opcode_quit    = 0x07
+	opcode_getq    = 0x09
+	opcode_noop    = 0x0a
+	opcode_version = 0x0b
+	opcode_getk    = 0x0c
+	opcode_getkq   = 0x0d
+	opcode_setq    = 0x11
+	opcode_deleteq = 0x14
+	opcode_quitq   = 0x17
+	opcode_touch   = 0x1c
+)
+
+const (
+	binary_ok              = 0x0000
+	binary_not_found       = 0x0001
+	binary_exists          = 0x0002
+	binary_too_large       = 0x0003
+	binary_invalid         = 0x0004
+	binary_not_stored      = 0x0005
+	binary_unknown_command = 0x0081
+	binary_out_of_memory   = 0x0082
+	binary_internal_error  = 0x0084
+)
+
+var binary_statuses = map[status]uint16{
+	status_stored:     binary_ok,
+	status_not_stored: binary_not_stored,
+	status_exists:     binary_exists,
+	status_not_found:  binary_not_found,
+}
+
+type binary_header struct {
+	opcode        byte
+	key_length    uint16
+	extras_length byte
+	body_length   uint32
+	opaque        uint32
+	cas           uint64
+}
+
+// binary_response is written back with the request's opcode and opaque
+type binary_response struct {
+	status uint16
+	cas    uint64
+	extras []byte
+	key    []byte
+	value  []byte
+}
+
+func write_binary_response(writer *bufio.Writer, request *binary_header, response *binary_response) {
+	header := make([]byte, header_size)
+	header[0] = magic_response
+	header[1] = request.opcode
+	binary.BigEndian.PutUint16(header[2:], uint16(len(response.key)))
+	header[4] = byte(len(response.extras))
+	binary.BigEndian.PutUint16(header[6:], response.status)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(response.extras)+len(response.key)+len(response.value)))
+	binary.BigEndian.PutUint32(header[12:], request.opaque)
+	binary.BigEndian.PutUint64(header[16:], response.cas)
+	writer.Write(header)
+	writer.Write(response.extras)
+	writer.Write(response.key)
+	writer.Write(response.value)
+}
+
+func binary_error(status uint16, message string) *binary_response {
+	return &binary_response{status: status, value: []byte(message)}
+}
+
+// binary_request answers one request of the binary protocol, errors are only returned when the connection must close
+func (server *MemcacheServer) binary_request(reader *bufio.Reader, writer *bufio.Writer) (bool, error) {
+	raw := make([]byte, header_size)
+	if _, err := io.ReadFull(reader, raw); err != nil {
+		return true, err
+	}
+	request := binary_header{
+		opcode:        raw[1],
+		key_length:    binary.BigEndian.Uint16(raw[2:]),
+		extras_length: raw[4],
+		body_length:   binary.BigEndian.Uint32(raw[8:]),
+		opaque:        binary.BigEndian.Uint32(raw[12:]),
+		cas:           binary.BigEndian.Uint64(raw[16:]),
+	}
+
+	if int(request.key_length)+int(request.extras_length) > int(request.body_length) {
+		//the body can't be found, so neither can the next request
+		write_binary_response(writer, &request, binary_error(binary_invalid, "Invalid arguments"))
+		return true, nil
+	}
+	if request.body_length > Max_value_size+Max_key_length+255 {
+		if _, err := reader.Discard(int(request.body_length)); err != nil {
+			return true, err
+		}
+		write_binary_response(writer, &request, binary_error(binary_too_large, "Too large"))
+		return false, nil
+	}
+
+	body := make([]byte, request.body_length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return true, err
+	}
+	extras := body[:request.extras_length]
+	key := string(body[request.extras_length : int(request.extras_length)+int(request.key_length)])
+	value := body[int(request.extras_length)+int(request.key_length):]
+
+	response := server.binary_command(&request, extras, key, value)
+	if response != nil {
+		write_binary_response(writer, &request, response)
+	}
+	quit := request.opcode == opcode_quit || request.opcode == opcode_quitq
+	return quit, nil
+}
+
+// binary_command gives the response to a request, nil when a quiet request has nothing to say
+func (server *MemcacheServer) binary_command(request *binary_header, extras []byte, key string, value []byte) *binary_response {
+	switch request.opcode {
+	case opcode_noop:
+		return &binary_response{}
+	case opcode_version:
+		return &binary_response{value: []byte(Version)}
+	case opcode_quit:
+		return &binary_response{}
+	case opcode_quitq:
+		return nil
+	}
+
+	if len(key) == 0 || len(key) > Max_key_length {
+		return binary_error(binary_invalid, "Invalid arguments")
+	}
+
+	switch request.opcode {
+	case opcode_get, opcode_getq, opcode_getk, opcode_getkq:
+		quiet := request.opcode == opcode_getq || request.opcode == opcode_getkq
+		with_key := request.opcode == opcode_getk || request.opcode == opcode_getkq
+		if len(extras) != 0 || len(value) != 0 {
+			return binary_error(binary_invalid, "Invalid arguments")
+		}
+		found, meta, err := server.get(key)
+		if err != nil {
+			return binary_error(binary_internal_error, err.Error())
+		}
+		if found == nil {
+			if quiet {
+				return nil
+			}
+			return binary_error(binary_not_found, "Not found")
+		}
+		flags := make([]byte, 4)
+		binary.BigEndian.PutUint32(flags, meta.Flags)
+		response := binary_response{cas: Cas_token(meta), extras: flags, value: found}
+		if with_key {
+			response.key = []byte(key)
+		}
+		return &response
+
+	case opcode_set, opcode_setq:
+		if len(extras) != 8 {
+			return binary_error(binary_invalid, "Invalid arguments")
+		}
+		if len(value) > Max_value_size {
+			return binary_error(binary_too_large, "Too large")
+		}
+		flags := binary.BigEndian.Uint32(extras)
+		exptime := int64(binary.BigEndian.Uint32(extras[4:]))
+		result, cas, err := server.store(key, value, flags, exptime, request.cas)
+		if errors.Is(err, limits.ErrQuotaExceeded) {
+			return binary_error(binary_out_of_memory, err.Error())
+		}
+		if err != nil {
+			return binary_error(binary_internal_error, err.Error())
+		}
+		if result == status_stored && request.opcode == opcode_setq {
+			return nil
+		}
+		//clients chain check and sets on the cas of the version they stored
+		return &binary_response{status: binary_statuses[result], cas: cas}
+
+	case opcode_delete, opcode_deleteq:
+		if len(extras) != 0 || len(value) != 0 {
+			return binary_error(binary_invalid, "Invalid arguments")
+		}
+		result, err := server.delete(key, request.cas)
+		if err != nil {
+			return binary_error(binary_internal_error, err.Error())
+		}
+		if result == status_stored && request.opcode == opcode_deleteq {
+			return nil
+		}
+		return &binary_response{status: binary_statuses[result]}
+
+	case opcode_touch:
+		if len(extras) != 4 || len(value) != 0 {
+			return binary_error(binary_invalid, "Invalid arguments")
+		}
+		result, cas, err := server.touch(key, int64(binary.BigEndian.Uint32(extras)))
+		if err != nil {
+			return binary_error(binary_internal_error, err.Error())
+		}
+		return &binary_response{status: binary_statuses[result], cas: cas}
+	}
+
+	return binary_error(binary_unknown_command, "Unknown command")
+}
@@ -0,0 +1,196 @@
+package memcache_server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
+)
+
+// binary protocol requests start with this magic byte, text commands never do
+const magic_request = 0x80
+
+const Version = "distrokdb-1.0"
+
+// MemcacheServer speaks the memcached text and binary protocols, for caching services written against memcached
+type MemcacheServer struct {
+	hr          *hash_ring.Hash_Ring
+	port        int
+	consistency hash_ring.Consistency
+	//nil leaves requests and writes unlimited, see SetLimits and SetIpLimits
+	limiter     *limits.Limiter
+	ip_limiter  *limits.Limiter
+	quotas      *limits.QuotaTracker
+	listener    net.Listener
+	connections map[net.Conn]struct{}
+	stopped     bool
+	lock        sync.Mutex
+}
+
+type Config struct {
+	Memcache_port int
+	//consistency level of commands, one, quorum, all or default for the ring's configured quorums
+	Consistency string
+}
+
+// CheckConfig fails for a config NewMemcacheServer would reject
+func CheckConfig(config *Config) error {
+	_, err := hash_ring.Consistency_By_Name(config.Consistency)
+	return err
+}
+
+func NewMemcacheServer(config *Config, hr *hash_ring.Hash_Ring) (*MemcacheServer, error) {
+	consistency, err := hash_ring.Consistency_By_Name(config.Consistency)
+	if err != nil {
+		return nil, err
+	}
+	return &MemcacheServer{
+		hr:          hr,
+		port:        config.Memcache_port,
+		consistency: consistency,
+		connections: map[net.Conn]struct{}{},
+	}, nil
+}
+
+// SetLimits rate limits each client's requests and checks writes against the quotas, as over http.
+// The protocol has no authentication, so clients are limited by their ip.
+// Either may be nil to leave that unlimited
+func (server *MemcacheServer) SetLimits(limiter *limits.Limiter, quotas *limits.QuotaTracker) {
+	server.limiter = limiter
+	server.quotas = quotas
+}
+
+// SetIpLimits rate limits requests by the client's ip, as the limits before authentication over http
+func (server *MemcacheServer) SetIpLimits(limiter *limits.Limiter) {
+	server.ip_limiter = limiter
+}
+
+func (server *MemcacheServer) Start() {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(server.port))
+	if err != nil {
+		server.hr.Logger().Error("Failed to start memcache server", "port", server.port, "error", err.Error())
+		return
+	}
+	server.Serve(listener)
+}
+
+// Serve accepts connections until Stop is called
+func (server *MemcacheServer) Serve(listener net.Listener) error {
+	server.lock.Lock()
+	if server.stopped {
+		server.lock.Unlock()
+		listener.Close()
+		return nil
+	}
+	server.listener = listener
+	server.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.lock.Lock()
+			stopped := server.stopped
+			server.lock.Unlock()
+			if stopped {
+				return nil
+			}
+			return err
+		}
+
+		server.lock.Lock()
+		server.connections[conn] = struct{}{}
+		server.lock.Unlock()
+		go server.serve_connection(conn)
+	}
+}
+
+func (server *MemcacheServer) Stop() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.stopped = true
+	if server.listener != nil {
+		server.listener.Close()
+	}
+	for conn := range server.connections {
+		conn.Close()
+	}
+}
+
+func (server *MemcacheServer) serve_connection(conn net.Conn) {
+	defer func() {
+		server.lock.Lock()
+		delete(server.connections, conn)
+		server.lock.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	ip := ip_of(conn)
+
+	//each request says which protocol it uses, as memcached allows
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if !server.wait_for_limits(ip, writer) {
+			return
+		}
+
+		var quit bool
+		if first[0] == magic_request {
+			quit, err = server.binary_request(reader, writer)
+		} else {
+			quit, err = server.text_command(reader, writer)
+		}
+		if err != nil {
+			writer.Flush()
+			return
+		}
+
+		//pipelined requests are answered together
+		if reader.Buffered() == 0 || quit {
+			if writer.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+func ip_of(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// wait_for_limits holds back the client's next request until its rate limits allow it. The protocol has no
+// error a client would retry after, so rate limited connections are slowed down instead.
+// False when the server stops while waiting
+func (server *MemcacheServer) wait_for_limits(ip string, writer *bufio.Writer) bool {
+	for _, limiter := range []*limits.Limiter{server.ip_limiter, server.limiter} {
+		if limiter == nil {
+			continue
+		}
+		for allowed, wait := limiter.Allow(ip, "keys"); !allowed; allowed, wait = limiter.Allow(ip, "keys") {
+			//answers to pipelined requests aren't held back with the next one
+			if writer.Flush() != nil {
+				return false
+			}
+			time.Sleep(wait)
+			server.lock.Lock()
+			stopped := server.stopped
+			server.lock.Unlock()
+			if stopped {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package memcache_server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_server(t *testing.T) (*MemcacheServer, net.Conn, *bufio.Reader) {
+	return test_limited_server(t, nil, nil)
+}
+
+func test_limited_server(t *testing.T, limiter *limits.Limiter, quotas *limits.QuotaTracker) (*MemcacheServer, net.Conn, *bufio.Reader) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	server, err := NewMemcacheServer(&Config{}, &hr)
+	assert.Nil(t, err)
+	server.SetLimits(limiter, quotas)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	return server, conn, bufio.NewReader(conn)
+}
+
+// send writes a text command and reads the reply, up to the END of any values
+func send(t *testing.T, conn net.Conn, reader *bufio.Reader, command string) string {
+	_, err := conn.Write([]byte(command))
+	assert.Nil(t, err)
+	reply := ""
+	for {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		reply += line
+		if !strings.HasPrefix(line, "VALUE ") {
+			return reply
+		}
+		length, _ := strconv.Atoi(strings.Fields(line)[3])
+		data := make([]byte, length+2)
+		io.ReadFull(reader, data)
+		reply += string(data)
+	}
+}
+
+func TestTextProtocol(t *testing.T) {
+	server, conn, reader := test_server(t)
+	defer server.Stop()
+
+	assert.Equal(t, "END\r\n", send(t, conn, reader, "get bar\r\n"))
+	assert.Equal(t, "STORED\r\n", send(t, conn, reader, "set bar 5 0 3\r\nmar\r\n"))
+	assert.Equal(t, "VALUE bar 5 3\r\nmar\r\nEND\r\n", send(t, conn, reader, "get bar foo\r\n"))
+
+	gets := send(t, conn, reader, "gets bar\r\n")
+	cas := strings.Fields(gets)[4]
+	assert.Equal(t, "STORED\r\n", send(t, conn, reader, "cas bar 0 0 3 "+cas+"\r\ncar\r\n"))
+	//the token is of the version read, which has since been superseded
+	assert.Equal(t, "EXISTS\r\n", send(t, conn, reader, "cas bar 0 0 3 "+cas+"\r\njar\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", send(t, conn, reader, "cas foo 0 0 3 "+cas+"\r\njar\r\n"))
+	assert.Equal(t, "VALUE bar 0 3\r\ncar\r\nEND\r\n", send(t, conn, reader, "get bar\r\n"))
+
+	assert.Equal(t, "TOUCHED\r\n", send(t, conn, reader, "touch bar -1\r\n"))
+	assert.Equal(t, "END\r\n", send(t, conn, reader, "get bar\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", send(t, conn, reader, "touch bar 10\r\n"))
+
+	//noreply commands send nothing back
+	assert.Equal(t, "VERSION "+Version+"\r\n", send(t, conn, reader, "set foo 0 0 3 noreply\r\njar\r\nversion\r\n"))
+	assert.Equal(t, "DELETED\r\n", send(t, conn, reader, "delete foo\r\n"))
+	assert.Equal(t, "NOT_FOUND\r\n", send(t, conn, reader, "delete foo\r\n"))
+
+	assert.Equal(t, "CLIENT_ERROR bad data chunk\r\n", send(t, conn, reader, "set foo 0 0 1\r\njar\r\n"))
+	assert.Equal(t, "ERROR\r\n", send(t, conn, reader, "flush_all\r\n"))
+}
+
+func binary_request(opcode byte, extras []byte, key string, value []byte, cas uint64) []byte {
+	request := make([]byte, header_size)
+	request[0] = magic_request
+	request[1] = opcode
+	binary.BigEndian.PutUint16(request[2:], uint16(len(key)))
+	request[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(request[8:], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(request[12:], 7)
+	binary.BigEndian.PutUint64(request[16:], cas)
+	request = append(request, extras...)
+	request = append(request, key...)
+	return append(request, value...)
+}
+
+func read_binary_response(t *testing.T, reader *bufio.Reader) (byte, uint16, uint64, []byte) {
+	header := make([]byte, header_size)
+	_, err := io.ReadFull(reader, header)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(magic_response), header[0])
+	assert.Equal(t, uint32(7), binary.BigEndian.Uint32(header[12:]))
+	body := make([]byte, binary.BigEndian.Uint32(header[8:]))
+	io.ReadFull(reader, body)
+	return header[1], binary.BigEndian.Uint16(header[6:]), binary.BigEndian.Uint64(header[16:]), body
+}
+
+func TestBinaryProtocol(t *testing.T) {
+	server, conn, reader := test_server(t)
+	defer server.Stop()
+
+	set_extras := []byte{0, 0, 0, 9, 0, 0, 0, 0}
+	conn.Write(binary_request(opcode_set, set_extras, "bar", []byte("mar"), 0))
+	_, status, set_cas, _ := read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_ok), status)
+
+	conn.Write(binary_request(opcode_getk, nil, "bar", nil, 0))
+	opcode, status, cas, body := read_binary_response(t, reader)
+	assert.Equal(t, byte(opcode_getk), opcode)
+	assert.Equal(t, uint16(binary_ok), status)
+	assert.Equal(t, []byte{0, 0, 0, 9}, body[:4])
+	assert.Equal(t, "barmar", string(body[4:]))
+	//the cas of a set is the one the next read gives
+	assert.Equal(t, cas, set_cas)
+	assert.Equal(t, "VALUE bar 9 3 "+strconv.FormatUint(set_cas, 10)+"\r\nmar\r\nEND\r\n", send(t, conn, reader, "gets bar\r\n"))
+
+	conn.Write(binary_request(opcode_set, set_extras, "bar", []byte("car"), cas))
+	_, status, cas, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_ok), status)
+	//chained on the cas the check and set gave back
+	conn.Write(binary_request(opcode_touch, []byte{0, 0, 0, 0}, "bar", nil, 0))
+	_, status, touch_cas, _ := read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_ok), status)
+	assert.NotEqual(t, cas, touch_cas)
+	conn.Write(binary_request(opcode_set, set_extras, "bar", []byte("car"), touch_cas))
+	_, status, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_ok), status)
+	//the version has moved on from the first set
+	conn.Write(binary_request(opcode_set, set_extras, "bar", []byte("jar"), set_cas))
+	_, status, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_exists), status)
+
+	//quiet misses send nothing, so the noop is the next response
+	conn.Write(append(binary_request(opcode_getkq, nil, "foo", nil, 0), binary_request(opcode_noop, nil, "", nil, 0)...))
+	opcode, _, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, byte(opcode_noop), opcode)
+
+	conn.Write(binary_request(opcode_delete, nil, "bar", nil, 0))
+	_, status, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_ok), status)
+	conn.Write(binary_request(opcode_get, nil, "bar", nil, 0))
+	_, status, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_not_found), status)
+
+	conn.Write(binary_request(0x30, nil, "bar", nil, 0))
+	_, status, _, _ = read_binary_response(t, reader)
+	assert.Equal(t, uint16(binary_unknown_command), status)
+}
+
+func TestCasTokenAndExpiry(t *testing.T) {
+	meta := hash_ring.NewValueMeta(hash_ring.NewVectorClock())
+	empty := Cas_token(meta)
+	assert.NotEqual(t, uint64(0), empty)
+	meta.VectorClock.Add(1)
+	assert.NotEqual(t, empty, Cas_token(meta))
+	assert.Equal(t, Cas_token(meta), Cas_token(meta.Copy()))
+
+	now := time.UnixMilli(1000000000000)
+	assert.Equal(t, int64(0), expires_at(0, now))
+	assert.Equal(t, now.UnixMilli()+10000, expires_at(10, now))
+	assert.Equal(t, int64(2000000000000), expires_at(2000000000, now))
+	assert.Equal(t, now.UnixMilli(), expires_at(-1, now))
+}
+
+func TestLimits(t *testing.T) {
+	limiter, err := limits.NewLimiter([]limits.RateLimit{{Client: limits.Any, Endpoint: "keys", Requests_per_second: 10, Burst: 2}})
+	assert.Nil(t, err)
+	quotas, err := limits.NewQuotaTracker([]limits.Quota{{Prefix: "users/", Max_keys: 1}})
+	assert.Nil(t, err)
+	server, conn, reader := test_limited_server(t, limiter, quotas)
+	defer server.Stop()
+
+	assert.Equal(t, "STORED\r\n", send(t, conn, reader, "set users/1 0 0 3\r\nmar\r\n"))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "set users/2 0 0 3\r\nmar\r\n"), "SERVER_ERROR Quota exceeded"))
+
+	//rate limited requests wait for their turn rather than failing
+	start := time.Now()
+	assert.Equal(t, "END\r\n", send(t, conn, reader, "get users/2\r\n"))
+	assert.Equal(t, "END\r\n", send(t, conn, reader, "get users/2\r\n"))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
@@ -0,0 +1,165 @@
+package memcache_server
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+// Max_relative_expiry is the largest exptime taken as seconds from now, larger ones are unix times as in memcached
+const Max_relative_expiry = 60 * 60 * 24 * 30
+
+const Max_key_length = 250
+
+// Max_value_size is the largest value accepted, the same limit as values over http
+const Max_value_size = 1 << 20
+
+// result of a storage command, shared by the text and binary protocols
+type status int
+
+const (
+	status_stored status = iota
+	status_not_stored
+	status_exists
+	status_not_found
+)
+
+// Cas_token is the memcached cas unique of a version, a hash of its vector clock.
+// A check and set compares it with the current version's token, then writes with AddIf against that version
+func Cas_token(meta *hash_ring.ValueMeta) uint64 {
+	ids := make([]int, 0, len(meta.VectorClock.Counts))
+	for id := range meta.VectorClock.Counts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	hash := fnv.New64a()
+	buffer := make([]byte, 16)
+	for _, id := range ids {
+		binary.BigEndian.PutUint64(buffer, uint64(id))
+		binary.BigEndian.PutUint64(buffer[8:], uint64(meta.VectorClock.Counts[id]))
+		hash.Write(buffer)
+	}
+	token := hash.Sum64()
+	if token == 0 {
+		//0 means no cas in the binary protocol
+		token = 1
+	}
+	return token
+}
+
+// expires_at converts a memcached exptime into unix milliseconds, 0 for never.
+// Negative times and unix times in the past expire the value straight away
+func expires_at(exptime int64, now time.Time) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return now.UnixMilli()
+	case exptime <= Max_relative_expiry:
+		return now.Add(time.Duration(exptime) * time.Second).UnixMilli()
+	default:
+		return exptime * 1000
+	}
+}
+
+func valid_key(key string) bool {
+	if len(key) == 0 || len(key) > Max_key_length {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (server *MemcacheServer) get(key string) ([]byte, *hash_ring.ValueMeta, error) {
+	return server.hr.GetAt(key, server.consistency)
+}
+
+// store is set, or cas when cas is not 0, giving the cas token of the version stored
+func (server *MemcacheServer) store(key string, value []byte, flags uint32, exptime int64, cas uint64) (status, uint64, error) {
+	if server.quotas != nil {
+		if err := server.quotas.Admit(key, len(value)); err != nil {
+			return status_not_stored, 0, err
+		}
+	}
+	current, meta, err := server.get(key)
+	if err != nil {
+		return status_not_stored, 0, err
+	}
+
+	new_meta := meta.Copy()
+	new_meta.ContentType = ""
+	new_meta.Flags = flags
+	new_meta.Expires = expires_at(exptime, time.Now())
+
+	if cas == 0 {
+		err = server.hr.AddAt(key, value, new_meta, server.consistency)
+		return status_stored, server.written_cas(new_meta), err
+	}
+
+	if current == nil {
+		return status_not_found, 0, nil
+	}
+	if Cas_token(meta) != cas {
+		return status_exists, 0, nil
+	}
+	err = server.hr.AddIfAt(key, value, new_meta, server.consistency)
+	var precondition *hash_ring.PreconditionFailedError
+	if errors.As(err, &precondition) {
+		return status_exists, 0, nil
+	}
+	return status_stored, server.written_cas(new_meta), err
+}
+
+// written_cas is the cas token of the version written with the meta, which gets the clock the ring gives it
+func (server *MemcacheServer) written_cas(meta *hash_ring.ValueMeta) uint64 {
+	return Cas_token(server.hr.WrittenMeta(meta))
+}
+
+// delete only deletes the version with the given cas token, unless cas is 0
+func (server *MemcacheServer) delete(key string, cas uint64) (status, error) {
+	current, meta, err := server.get(key)
+	if err != nil {
+		return status_not_found, err
+	}
+	if current == nil {
+		return status_not_found, nil
+	}
+
+	if cas == 0 {
+		return status_stored, server.hr.DeleteAt(key, meta, server.consistency)
+	}
+	if Cas_token(meta) != cas {
+		return status_exists, nil
+	}
+	err = server.hr.DeleteIfAt(key, meta, server.consistency)
+	var precondition *hash_ring.PreconditionFailedError
+	if errors.As(err, &precondition) {
+		return status_exists, nil
+	}
+	return status_stored, err
+}
+
+// touch rewrites the value with its new expiry, as the expiry is replicated with the value,
+// giving the cas token of the version written
+func (server *MemcacheServer) touch(key string, exptime int64) (status, uint64, error) {
+	current, meta, err := server.get(key)
+	if err != nil {
+		return status_not_found, 0, err
+	}
+	if current == nil {
+		return status_not_found, 0, nil
+	}
+	new_meta := meta.Copy()
+	new_meta.Expires = expires_at(exptime, time.Now())
+	err = server.hr.AddAt(key, current, new_meta, server.consistency)
+	return status_stored, server.written_cas(new_meta), err
+}
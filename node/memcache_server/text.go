@@ -0,0 +1,166 @@
+package memcache_server
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var status_replies = map[status]string{
+	status_stored:     "STORED",
+	status_not_stored: "NOT_STORED",
+	status_exists:     "EXISTS",
+	status_not_found:  "NOT_FOUND",
+}
+
+// text_command answers one command of the text protocol, errors are only returned when the connection must close
+func (server *MemcacheServer) text_command(reader *bufio.Reader, writer *bufio.Writer) (bool, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return true, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		writer.WriteString("ERROR\r\n")
+		return false, nil
+	}
+
+	reply := func(message string) {
+		writer.WriteString(message + "\r\n")
+	}
+	//storage commands take noreply as their last argument
+	if fields[0] != "get" && fields[0] != "gets" && fields[len(fields)-1] == "noreply" {
+		fields = fields[:len(fields)-1]
+		reply = func(string) {}
+	}
+
+	switch fields[0] {
+	case "get", "gets":
+		server.text_get(writer, fields[1:], fields[0] == "gets")
+	case "set", "cas":
+		return false, server.text_store(reader, fields, reply)
+	case "delete":
+		//memcached still accepts a trailing time of 0
+		if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && fields[2] != "0") || !valid_key(fields[1]) {
+			writer.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false, nil
+		}
+		result, err := server.delete(fields[1], 0)
+		if err != nil {
+			reply("SERVER_ERROR " + err.Error())
+		} else if result == status_stored {
+			reply("DELETED")
+		} else {
+			reply(status_replies[result])
+		}
+	case "touch":
+		exptime, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if len(fields) != 3 || err != nil || !valid_key(fields[1]) {
+			writer.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false, nil
+		}
+		result, _, err := server.touch(fields[1], exptime)
+		if err != nil {
+			reply("SERVER_ERROR " + err.Error())
+		} else if result == status_not_found {
+			reply("NOT_FOUND")
+		} else {
+			reply("TOUCHED")
+		}
+	case "version":
+		writer.WriteString("VERSION " + Version + "\r\n")
+	case "quit":
+		return true, nil
+	default:
+		writer.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+func (server *MemcacheServer) text_get(writer *bufio.Writer, keys []string, with_cas bool) {
+	if len(keys) == 0 {
+		writer.WriteString("ERROR\r\n")
+		return
+	}
+	for _, key := range keys {
+		if !valid_key(key) {
+			writer.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+
+	for _, key := range keys {
+		value, meta, err := server.get(key)
+		if err != nil {
+			writer.WriteString("SERVER_ERROR " + err.Error() + "\r\n")
+			return
+		}
+		if value == nil {
+			continue
+		}
+		writer.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(meta.Flags), 10) + " " + strconv.Itoa(len(value)))
+		if with_cas {
+			writer.WriteString(" " + strconv.FormatUint(Cas_token(meta), 10))
+		}
+		writer.WriteString("\r\n")
+		writer.Write(value)
+		writer.WriteString("\r\n")
+	}
+	writer.WriteString("END\r\n")
+}
+
+// text_store is set <key> <flags> <exptime> <bytes> and cas, which also takes the <cas unique> from gets
+func (server *MemcacheServer) text_store(reader *bufio.Reader, fields []string, reply func(string)) error {
+	expected_fields := 5
+	if fields[0] == "cas" {
+		expected_fields = 6
+	}
+	if len(fields) != expected_fields || !valid_key(fields[1]) {
+		reply("CLIENT_ERROR bad command line format")
+		return nil
+	}
+	flags, flags_err := strconv.ParseUint(fields[2], 10, 32)
+	exptime, exptime_err := strconv.ParseInt(fields[3], 10, 64)
+	length, length_err := strconv.Atoi(fields[4])
+	cas := uint64(0)
+	var cas_err error
+	if fields[0] == "cas" {
+		cas, cas_err = strconv.ParseUint(fields[5], 10, 64)
+	}
+	if flags_err != nil || exptime_err != nil || length_err != nil || cas_err != nil || length < 0 {
+		reply("CLIENT_ERROR bad command line format")
+		return nil
+	}
+
+	if length > Max_value_size {
+		//the data block is skipped, so the next command can still be read
+		if _, err := reader.Discard(length + 2); err != nil {
+			return err
+		}
+		reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+
+	data := make([]byte, length+2)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return err
+	}
+	if data[length] != '\r' || data[length+1] != '\n' {
+		reply("CLIENT_ERROR bad data chunk")
+		return nil
+	}
+
+	if fields[0] == "cas" && cas == 0 {
+		//0 would otherwise be an unconditional set
+		reply("EXISTS")
+		return nil
+	}
+	result, _, err := server.store(fields[1], data[:length], uint32(flags), exptime, cas)
+	if err != nil {
+		reply("SERVER_ERROR " + err.Error())
+		return nil
+	}
+	reply(status_replies[result])
+	return nil
+}
@@ -0,0 +1,306 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the prometheus text format Write writes
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Latency_buckets are histogram bounds in seconds, from half a millisecond to ten seconds
+var Latency_buckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// sample is one labelled value of a metric
+type sample struct {
+	suffix       string
+	label_names  []string
+	label_values []string
+	value        float64
+}
+
+type collector interface {
+	name() string
+	help() string
+	kind() string
+	collect() []sample
+}
+
+// Registry holds the metrics written in the prometheus text format
+type Registry struct {
+	collectors map[string]collector
+	lock       sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]collector{}}
+}
+
+// Default is the registry metrics are recorded in and served from
+var Default = NewRegistry()
+
+// register adds a metric, replacing any metric already registered with the name
+func (registry *Registry) register(metric collector) {
+	defer registry.lock.Unlock()
+	registry.lock.Lock()
+	registry.collectors[metric.name()] = metric
+}
+
+func (registry *Registry) Unregister(name string) {
+	defer registry.lock.Unlock()
+	registry.lock.Lock()
+	delete(registry.collectors, name)
+}
+
+// labels keys the values of metrics with labels, the values are joined by a byte never used in label values
+func labels_key(label_values []string) string {
+	return strings.Join(label_values, "\xff")
+}
+
+type metric_base struct {
+	metric_name string
+	metric_help string
+	label_names []string
+}
+
+func (base *metric_base) name() string { return base.metric_name }
+func (base *metric_base) help() string { return base.metric_help }
+
+func (base *metric_base) check_labels(label_values []string) {
+	if len(label_values) != len(base.label_names) {
+		panic("Metric " + base.metric_name + " takes " + strconv.Itoa(len(base.label_names)) + " label values")
+	}
+}
+
+// Counter only goes up, a value is kept for every combination of label values
+type Counter struct {
+	metric_base
+	values sync.Map
+}
+
+func (registry *Registry) NewCounter(name string, help string, label_names ...string) *Counter {
+	counter := &Counter{metric_base: metric_base{name, help, label_names}}
+	registry.register(counter)
+	return counter
+}
+
+func (counter *Counter) kind() string { return "counter" }
+
+func (counter *Counter) Inc(label_values ...string) {
+	counter.Add(1, label_values...)
+}
+
+func (counter *Counter) Add(value float64, label_values ...string) {
+	counter.check_labels(label_values)
+	key := labels_key(label_values)
+	bits, loaded := counter.values.Load(key)
+	if !loaded {
+		bits, _ = counter.values.LoadOrStore(key, new(uint64))
+	}
+	for {
+		old := atomic.LoadUint64(bits.(*uint64))
+		if atomic.CompareAndSwapUint64(bits.(*uint64), old, math.Float64bits(math.Float64frombits(old)+value)) {
+			return
+		}
+	}
+}
+
+// Value is the count for the label values, for tests
+func (counter *Counter) Value(label_values ...string) float64 {
+	bits, loaded := counter.values.Load(labels_key(label_values))
+	if !loaded {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(bits.(*uint64)))
+}
+
+func (counter *Counter) collect() []sample {
+	samples := []sample{}
+	counter.values.Range(func(key interface{}, bits interface{}) bool {
+		samples = append(samples, sample{
+			label_names:  counter.label_names,
+			label_values: split_labels_key(key.(string), len(counter.label_names)),
+			value:        math.Float64frombits(atomic.LoadUint64(bits.(*uint64))),
+		})
+		return true
+	})
+	return samples
+}
+
+func split_labels_key(key string, count int) []string {
+	if count == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+// Histogram counts observations into buckets of upper bounds
+type Histogram struct {
+	metric_base
+	bounds []float64
+	series map[string]*histogram_series
+	lock   sync.Mutex
+}
+
+type histogram_series struct {
+	label_values []string
+	//not cumulative, the count of observations above the previous bound up to each bound, then above the last
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (registry *Registry) NewHistogram(name string, help string, bounds []float64, label_names ...string) *Histogram {
+	histogram := &Histogram{metric_base: metric_base{name, help, label_names}, bounds: bounds, series: map[string]*histogram_series{}}
+	registry.register(histogram)
+	return histogram
+}
+
+func (histogram *Histogram) kind() string { return "histogram" }
+
+func (histogram *Histogram) Observe(value float64, label_values ...string) {
+	histogram.check_labels(label_values)
+	key := labels_key(label_values)
+	defer histogram.lock.Unlock()
+	histogram.lock.Lock()
+	series, exists := histogram.series[key]
+	if !exists {
+		series = &histogram_series{label_values: label_values, counts: make([]uint64, len(histogram.bounds)+1)}
+		histogram.series[key] = series
+	}
+	series.counts[sort.SearchFloat64s(histogram.bounds, value)]++
+	series.sum += value
+	series.count++
+}
+
+// Count is the number of observations for the label values, for tests
+func (histogram *Histogram) Count(label_values ...string) uint64 {
+	defer histogram.lock.Unlock()
+	histogram.lock.Lock()
+	if series, exists := histogram.series[labels_key(label_values)]; exists {
+		return series.count
+	}
+	return 0
+}
+
+func (histogram *Histogram) collect() []sample {
+	defer histogram.lock.Unlock()
+	histogram.lock.Lock()
+	samples := []sample{}
+	bucket_label_names := append(append([]string{}, histogram.label_names...), "le")
+	for _, series := range histogram.series {
+		cumulative := uint64(0)
+		for i := range series.counts {
+			cumulative += series.counts[i]
+			le := "+Inf"
+			if i < len(histogram.bounds) {
+				le = format_float(histogram.bounds[i])
+			}
+			samples = append(samples, sample{
+				suffix:       "_bucket",
+				label_names:  bucket_label_names,
+				label_values: append(append([]string{}, series.label_values...), le),
+				value:        float64(cumulative),
+			})
+		}
+		samples = append(samples,
+			sample{suffix: "_sum", label_names: histogram.label_names, label_values: series.label_values, value: series.sum},
+			sample{suffix: "_count", label_names: histogram.label_names, label_values: series.label_values, value: float64(series.count)})
+	}
+	return samples
+}
+
+// GaugeFunc reads its values when written, from a function reporting each value with its label values
+type GaugeFunc struct {
+	metric_base
+	read func(report func(value float64, label_values ...string))
+}
+
+func (registry *Registry) NewGaugeFunc(name string, help string, label_names []string, read func(report func(value float64, label_values ...string))) *GaugeFunc {
+	gauge := &GaugeFunc{metric_base{name, help, label_names}, read}
+	registry.register(gauge)
+	return gauge
+}
+
+func (gauge *GaugeFunc) kind() string { return "gauge" }
+
+func (gauge *GaugeFunc) collect() []sample {
+	samples := []sample{}
+	gauge.read(func(value float64, label_values ...string) {
+		gauge.check_labels(label_values)
+		samples = append(samples, sample{label_names: gauge.label_names, label_values: label_values, value: value})
+	})
+	return samples
+}
+
+func format_float(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var label_escaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+var help_escaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func (s *sample) line(name string) string {
+	builder := strings.Builder{}
+	builder.WriteString(name + s.suffix)
+	if len(s.label_names) != 0 {
+		builder.WriteByte('{')
+		for i := range s.label_names {
+			if i != 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteString(s.label_names[i] + "=\"" + label_escaper.Replace(s.label_values[i]) + "\"")
+		}
+		builder.WriteByte('}')
+	}
+	builder.WriteString(" " + format_float(s.value) + "\n")
+	return builder.String()
+}
+
+// Write writes every metric in the prometheus text format, ordered by name then label values
+func (registry *Registry) Write(w io.Writer) error {
+	registry.lock.Lock()
+	collectors := make([]collector, 0, len(registry.collectors))
+	for _, metric := range registry.collectors {
+		collectors = append(collectors, metric)
+	}
+	registry.lock.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	writer := bufio.NewWriter(w)
+	for _, metric := range collectors {
+		samples := metric.collect()
+		//buckets of a series stay in bound order, as the sort is stable
+		sort.SliceStable(samples, func(i, j int) bool {
+			return labels_key(samples[i].label_values[:len(samples[i].label_names)-bucket_label(&samples[i])]) < labels_key(samples[j].label_values[:len(samples[j].label_names)-bucket_label(&samples[j])])
+		})
+		writer.WriteString("# HELP " + metric.name() + " " + help_escaper.Replace(metric.help()) + "\n")
+		writer.WriteString("# TYPE " + metric.name() + " " + metric.kind() + "\n")
+		for i := range samples {
+			writer.WriteString(samples[i].line(metric.name()))
+		}
+	}
+	return writer.Flush()
+}
+
+// bucket_label is 1 for the le label of histogram buckets, so series are ordered by their own labels
+func bucket_label(s *sample) int {
+	if s.suffix == "_bucket" {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests served", "method")
+	requests.Inc("get")
+	requests.Inc("get")
+	requests.Add(0.5, "put \"quoted\"")
+	latency := registry.NewHistogram("latency_seconds", "Request latency", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+	registry.NewGaugeFunc("table_keys", "Keys\nin tables", []string{"node"}, func(report func(value float64, label_values ...string)) {
+		report(3, "2")
+		report(1, "1")
+	})
+
+	out := strings.Builder{}
+	assert.Nil(t, registry.Write(&out))
+	assert.Equal(t, `# HELP latency_seconds Request latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP requests_total Requests served
+# TYPE requests_total counter
+requests_total{method="get"} 2
+requests_total{method="put \"quoted\""} 0.5
+# HELP table_keys Keys\nin tables
+# TYPE table_keys gauge
+table_keys{node="1"} 1
+table_keys{node="2"} 3
+`, out.String())
+	assert.Equal(t, float64(2), requests.Value("get"))
+	assert.Equal(t, uint64(3), latency.Count())
+
+	//registering a name again replaces it
+	registry.NewCounter("requests_total", "Requests served", "method")
+	out.Reset()
+	registry.Write(&out)
+	assert.NotContains(t, out.String(), "requests_total{")
+	assert.Panics(t, func() { requests.Inc() })
+}
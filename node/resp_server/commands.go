@@ -0,0 +1,472 @@
+package resp_server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+)
+
+// Max_incr_attempts bounds the compare and set retries of INCR when other clients keep writing the key
+const Max_incr_attempts = 16
+
+// key_args is which of a command's arguments are keys, to check the client may use them
+type key_args int
+
+const (
+	keys_none key_args = iota
+	keys_first
+	keys_all
+	//every other argument from the first, for keys followed by their values
+	keys_pairs
+)
+
+type command struct {
+	//counting the command name, maximum_args is -1 for no limit
+	minimum_args int
+	maximum_args int
+	run          func(client *connection, args [][]byte)
+	keys         key_args
+	permission   auth.Permission
+}
+
+var commands = map[string]command{
+	"ping":        {1, 2, ping, keys_none, auth.Permission_read},
+	"echo":        {2, 2, echo, keys_none, auth.Permission_read},
+	"quit":        {1, 1, quit, keys_none, auth.Permission_read},
+	"auth":        {2, 3, auth_command, keys_none, auth.Permission_read},
+	"select":      {2, 2, select_db, keys_none, auth.Permission_read},
+	"command":     {1, -1, command_docs, keys_none, auth.Permission_read},
+	"client":      {2, -1, client_command, keys_none, auth.Permission_read},
+	"consistency": {1, 2, consistency, keys_none, auth.Permission_read},
+	"get":         {2, 2, get, keys_first, auth.Permission_read},
+	"set":         {3, -1, set, keys_first, auth.Permission_write},
+	"del":         {2, -1, del, keys_all, auth.Permission_write},
+	"exists":      {2, -1, exists, keys_all, auth.Permission_read},
+	"mget":        {2, -1, mget, keys_all, auth.Permission_read},
+	"mset":        {3, -1, mset, keys_pairs, auth.Permission_write},
+	"expire":      {3, 3, expire, keys_first, auth.Permission_write},
+	"ttl":         {2, 2, ttl, keys_first, auth.Permission_read},
+	"incr":        {2, 2, incr, keys_first, auth.Permission_write},
+	"incrby":      {3, 3, incrby, keys_first, auth.Permission_write},
+	"decr":        {2, 2, decr, keys_first, auth.Permission_write},
+	"decrby":      {3, 3, decrby, keys_first, auth.Permission_write},
+}
+
+// keys_of gives the arguments of the command that are keys
+func (command *command) keys_of(args [][]byte) [][]byte {
+	switch command.keys {
+	case keys_first:
+		return args[:1]
+	case keys_all:
+		return args
+	case keys_pairs:
+		keys := [][]byte{}
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	}
+	return nil
+}
+
+func (client *connection) ring_error(err error) {
+	if errors.Is(err, hash_ring.ErrQuorumNotMet) || errors.Is(err, hash_ring.ErrNoNodes) {
+		client.reply.error("TRYAGAIN " + err.Error())
+		return
+	}
+	client.reply.error("ERR " + err.Error())
+}
+
+// write_meta is the meta of a value written over the protocol superseding the version read,
+// redis values have no content type or flags and a write clears any expiry unless given a ttl
+func write_meta(read *hash_ring.ValueMeta, ttl time.Duration) *hash_ring.ValueMeta {
+	meta := read.Copy()
+	meta.ContentType = ""
+	meta.Flags = 0
+	meta.Expires = 0
+	if ttl > 0 {
+		meta.ExpireAfter(ttl)
+	}
+	return meta
+}
+
+func ping(client *connection, args [][]byte) {
+	if len(args) == 1 {
+		client.reply.bulk(args[0])
+		return
+	}
+	client.reply.simple("PONG")
+}
+
+func echo(client *connection, args [][]byte) {
+	client.reply.bulk(args[0])
+}
+
+// auth_command takes an api key, optionally after the name of its principal like redis acl users
+func auth_command(client *connection, args [][]byte) {
+	if client.server.auth == nil {
+		client.reply.error("ERR AUTH called without any api keys configured")
+		return
+	}
+	principal, err := client.server.auth.AuthenticateApiKey(string(args[len(args)-1]))
+	if err != nil || (len(args) == 2 && string(args[0]) != principal.Name) {
+		client.reply.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	client.principal = principal
+	client.reply.simple("OK")
+}
+
+func quit(client *connection, args [][]byte) {
+	client.reply.simple("OK")
+	client.quit = true
+}
+
+// select_db only accepts database 0, the ring has a single key space
+func select_db(client *connection, args [][]byte) {
+	if string(args[0]) != "0" {
+		client.reply.error("ERR DB index is out of range")
+		return
+	}
+	client.reply.simple("OK")
+}
+
+// command_docs answers redis-cli's startup COMMAND DOCS with no documentation
+func command_docs(client *connection, args [][]byte) {
+	client.reply.array(0)
+}
+
+// client_command accepts CLIENT SETNAME and the like sent by client libraries on connect
+func client_command(client *connection, args [][]byte) {
+	client.reply.simple("OK")
+}
+
+// consistency gets or sets the consistency level of this connection's commands
+func consistency(client *connection, args [][]byte) {
+	if len(args) == 0 {
+		client.reply.bulk([]byte(client.consistency.String()))
+		return
+	}
+	level, err := hash_ring.Consistency_By_Name(strings.ToLower(string(args[0])))
+	if err != nil {
+		client.reply.error("ERR " + err.Error())
+		return
+	}
+	client.consistency = level
+	client.reply.simple("OK")
+}
+
+func get(client *connection, args [][]byte) {
+	value, _, err := client.server.hr.GetAt(string(args[0]), client.consistency)
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	client.reply.bulk(value)
+}
+
+// set supports EX, PX, NX and XX. NX and XX are compare and sets against the version read,
+// a nil reply when the key exists or doesn't, or was written by someone else in between
+func set(client *connection, args [][]byte) {
+	key := string(args[0])
+	value := args[1]
+	var ttl time.Duration
+	nx, xx := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 == len(args) || ttl != 0 {
+				client.reply.error("ERR syntax error")
+				return
+			}
+			amount, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || amount <= 0 {
+				client.reply.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if strings.ToLower(string(args[i])) == "px" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(amount) * unit
+			i++
+		default:
+			client.reply.error("ERR syntax error")
+			return
+		}
+	}
+	if nx && xx {
+		client.reply.error("ERR syntax error")
+		return
+	}
+	if !client.admit_write(key, len(value)) {
+		return
+	}
+
+	hr := client.server.hr
+	current, meta, err := hr.GetAt(key, client.consistency)
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	if (nx && current != nil) || (xx && current == nil) {
+		client.reply.bulk(nil)
+		return
+	}
+
+	if nx || xx {
+		err = hr.AddIfAt(key, value, write_meta(meta, ttl), client.consistency)
+		var precondition *hash_ring.PreconditionFailedError
+		if errors.As(err, &precondition) {
+			client.reply.bulk(nil)
+			return
+		}
+	} else {
+		err = hr.AddAt(key, value, write_meta(meta, ttl), client.consistency)
+	}
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	client.reply.simple("OK")
+}
+
+func del(client *connection, args [][]byte) {
+	hr := client.server.hr
+	deleted := int64(0)
+	for _, arg := range args {
+		key := string(arg)
+		value, meta, err := hr.GetAt(key, client.consistency)
+		if err == nil && value != nil {
+			err = hr.DeleteAt(key, meta, client.consistency)
+			deleted++
+		}
+		if err != nil {
+			client.ring_error(err)
+			return
+		}
+	}
+	client.reply.integer(deleted)
+}
+
+// multi_get reads the keys in one batch, replying with an error if any key could not be read
+func (client *connection) multi_get(args [][]byte) ([]string, []hash_ring.MultiGetResult, bool) {
+	keys := make([]string, len(args))
+	for i := range args {
+		keys[i] = string(args[i])
+	}
+	results := client.server.hr.MultiGetAt(keys, client.consistency)
+	for i := range results {
+		if results[i].Err != nil {
+			client.ring_error(results[i].Err)
+			return nil, nil, false
+		}
+	}
+	return keys, results, true
+}
+
+// exists counts a key once for every time it is named, as redis does
+func exists(client *connection, args [][]byte) {
+	_, results, ok := client.multi_get(args)
+	if !ok {
+		return
+	}
+	found := int64(0)
+	for i := range results {
+		if results[i].Value != nil {
+			found++
+		}
+	}
+	client.reply.integer(found)
+}
+
+func mget(client *connection, args [][]byte) {
+	_, results, ok := client.multi_get(args)
+	if !ok {
+		return
+	}
+	client.reply.array(len(results))
+	for i := range results {
+		client.reply.bulk(results[i].Value)
+	}
+}
+
+func mset(client *connection, args [][]byte) {
+	if len(args)%2 != 0 {
+		client.reply.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	//a key given twice takes its last value, writing both would leave siblings with the same clock
+	last := map[string]int{}
+	key_args := [][]byte{}
+	value_args := [][]byte{}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		if index, ok := last[key]; ok {
+			value_args[index] = args[i+1]
+			continue
+		}
+		last[key] = len(key_args)
+		key_args = append(key_args, args[i])
+		value_args = append(value_args, args[i+1])
+	}
+	for i := range key_args {
+		if !client.admit_write(string(key_args[i]), len(value_args[i])) {
+			return
+		}
+	}
+
+	keys, results, ok := client.multi_get(key_args)
+	if !ok {
+		return
+	}
+	metas := make([]*hash_ring.ValueMeta, len(results))
+	for i := range results {
+		metas[i] = write_meta(results[i].Meta, 0)
+	}
+	for _, err := range client.server.hr.MultiAddAt(keys, value_args, metas, client.consistency) {
+		if err != nil {
+			client.ring_error(err)
+			return
+		}
+	}
+	client.reply.simple("OK")
+}
+
+// expire rewrites the value with its new expiry, as the expiry is replicated with the value
+func expire(client *connection, args [][]byte) {
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		client.reply.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	hr := client.server.hr
+	key := string(args[0])
+	value, meta, err := hr.GetAt(key, client.consistency)
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	if value == nil {
+		client.reply.integer(0)
+		return
+	}
+
+	if seconds <= 0 {
+		err = hr.DeleteAt(key, meta, client.consistency)
+	} else {
+		new_meta := meta.Copy()
+		new_meta.ExpireAfter(time.Duration(seconds) * time.Second)
+		err = hr.AddAt(key, value, new_meta, client.consistency)
+	}
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	client.reply.integer(1)
+}
+
+// ttl is -2 for a missing key and -1 for a key that doesn't expire
+func ttl(client *connection, args [][]byte) {
+	value, meta, err := client.server.hr.GetAt(string(args[0]), client.consistency)
+	if err != nil {
+		client.ring_error(err)
+		return
+	}
+	switch {
+	case value == nil:
+		client.reply.integer(-2)
+	case meta.Expires == 0:
+		client.reply.integer(-1)
+	default:
+		remaining := meta.Expires - time.Now().UnixMilli()
+		//rounded up, a key about to expire still has a second left
+		client.reply.integer((remaining + 999) / 1000)
+	}
+}
+
+func incr(client *connection, args [][]byte) {
+	increment_by(client, string(args[0]), 1)
+}
+
+func decr(client *connection, args [][]byte) {
+	increment_by(client, string(args[0]), -1)
+}
+
+func incrby(client *connection, args [][]byte) {
+	amount, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		client.reply.error("ERR value is not an integer or out of range")
+		return
+	}
+	increment_by(client, string(args[0]), amount)
+}
+
+func decrby(client *connection, args [][]byte) {
+	amount, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || amount == math.MinInt64 {
+		client.reply.error("ERR value is not an integer or out of range")
+		return
+	}
+	increment_by(client, string(args[0]), -amount)
+}
+
+// increment_by is a compare and set loop, retried when another client changes the key in between.
+// As with AddIf this is only as atomic as the quorums, see Hash_Ring.AddIf
+func increment_by(client *connection, key string, amount int64) {
+	hr := client.server.hr
+	for attempt := 0; attempt < Max_incr_attempts; attempt++ {
+		value, meta, err := hr.GetAt(key, client.consistency)
+		if err != nil {
+			client.ring_error(err)
+			return
+		}
+
+		number := int64(0)
+		if value != nil {
+			number, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				client.reply.error("ERR value is not an integer or out of range")
+				return
+			}
+		}
+		if (amount > 0 && number > math.MaxInt64-amount) || (amount < 0 && number < math.MinInt64-amount) {
+			client.reply.error("ERR increment or decrement would overflow")
+			return
+		}
+		number += amount
+		if attempt == 0 && !client.admit_write(key, len(strconv.FormatInt(number, 10))) {
+			return
+		}
+
+		//keeps the expiry, as redis does
+		new_meta := meta.Copy()
+		new_meta.ContentType = ""
+		if value == nil {
+			new_meta.Expires = 0
+		}
+		err = hr.AddIfAt(key, []byte(strconv.FormatInt(number, 10)), new_meta, client.consistency)
+		var precondition *hash_ring.PreconditionFailedError
+		if errors.As(err, &precondition) {
+			continue
+		}
+		if err != nil {
+			client.ring_error(err)
+			return
+		}
+		client.reply.integer(number)
+		return
+	}
+	client.reply.error("ERR too many concurrent writes to the key")
+}
@@ -0,0 +1,114 @@
+package resp_server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Max_bulk_size is the largest argument accepted, the same limit as values over http
+const Max_bulk_size = 1 << 20
+
+const max_arguments = 1024 * 1024
+
+var ErrProtocol = errors.New("Protocol error")
+
+func read_line(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func read_length(reader *bufio.Reader, prefix byte, maximum int) (int, error) {
+	line, err := read_line(reader)
+	if err != nil {
+		return 0, err
+	}
+	if len(line) == 0 || line[0] != prefix {
+		return 0, ErrProtocol
+	}
+	length, err := strconv.Atoi(line[1:])
+	if err != nil || length < 0 || length > maximum {
+		return 0, ErrProtocol
+	}
+	return length, nil
+}
+
+// read_command reads one command, either an array of bulk strings or an inline command as typed into telnet
+func read_command(reader *bufio.Reader) ([][]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] != '*' {
+		line, err := read_line(reader)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for i := range fields {
+			args[i] = []byte(fields[i])
+		}
+		return args, nil
+	}
+
+	count, err := read_length(reader, '*', max_arguments)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, count)
+	for i := range args {
+		length, err := read_length(reader, '$', Max_bulk_size)
+		if err != nil {
+			return nil, err
+		}
+		//the argument followed by \r\n
+		arg := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		if arg[length] != '\r' || arg[length+1] != '\n' {
+			return nil, ErrProtocol
+		}
+		args[i] = arg[:length]
+	}
+	return args, nil
+}
+
+// reply writes RESP2 replies, buffered until the connection has no more pipelined commands
+type reply struct {
+	writer *bufio.Writer
+}
+
+func (r *reply) simple(message string) {
+	r.writer.WriteString("+" + message + "\r\n")
+}
+
+func (r *reply) error(message string) {
+	r.writer.WriteString("-" + message + "\r\n")
+}
+
+func (r *reply) integer(number int64) {
+	r.writer.WriteString(":" + strconv.FormatInt(number, 10) + "\r\n")
+}
+
+// bulk writes a nil bulk string when value is nil
+func (r *reply) bulk(value []byte) {
+	if value == nil {
+		r.writer.WriteString("$-1\r\n")
+		return
+	}
+	r.writer.WriteString("$" + strconv.Itoa(len(value)) + "\r\n")
+	r.writer.Write(value)
+	r.writer.WriteString("\r\n")
+}
+
+func (r *reply) array(length int) {
+	r.writer.WriteString("*" + strconv.Itoa(length) + "\r\n")
+}
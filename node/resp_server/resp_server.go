@@ -0,0 +1,253 @@
+package resp_server
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
+)
+
+// RespServer speaks the redis protocol, so redis-cli and redis client libraries can use the ring
+type RespServer struct {
+	hr          *hash_ring.Hash_Ring
+	port        int
+	consistency hash_ring.Consistency
+	//nil lets every client use every key
+	auth *auth.Auth
+	//nil leaves commands and writes unlimited, see SetLimits and SetIpLimits
+	limiter     *limits.Limiter
+	ip_limiter  *limits.Limiter
+	quotas      *limits.QuotaTracker
+	listener    net.Listener
+	connections map[net.Conn]struct{}
+	stopped     bool
+	lock        sync.Mutex
+}
+
+type Config struct {
+	Resp_port int
+	//consistency level of commands, one, quorum, all or default for the ring's configured quorums
+	Consistency string
+}
+
+// CheckConfig fails for a config NewRespServer would reject
+func CheckConfig(config *Config) error {
+	_, err := hash_ring.Consistency_By_Name(config.Consistency)
+	return err
+}
+
+func NewRespServer(config *Config, hr *hash_ring.Hash_Ring) (*RespServer, error) {
+	consistency, err := hash_ring.Consistency_By_Name(config.Consistency)
+	if err != nil {
+		return nil, err
+	}
+	return &RespServer{
+		hr:          hr,
+		port:        config.Resp_port,
+		consistency: consistency,
+		connections: map[net.Conn]struct{}{},
+	}, nil
+}
+
+// SetAuth makes clients AUTH with an api key, and checks its principal may use each key of a command
+func (server *RespServer) SetAuth(authenticator *auth.Auth) {
+	server.auth = authenticator
+}
+
+// SetLimits rate limits every client's commands and checks writes against the quotas, as over http.
+// Clients are limited as the principal they authenticated as, or by their ip without auth.
+// Either may be nil to leave that unlimited
+func (server *RespServer) SetLimits(limiter *limits.Limiter, quotas *limits.QuotaTracker) {
+	server.limiter = limiter
+	server.quotas = quotas
+}
+
+// SetIpLimits rate limits commands by the client's ip before checking they are authenticated, nil leaves them unlimited
+func (server *RespServer) SetIpLimits(limiter *limits.Limiter) {
+	server.ip_limiter = limiter
+}
+
+func (server *RespServer) Start() {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(server.port))
+	if err != nil {
+		server.hr.Logger().Error("Failed to start resp server", "port", server.port, "error", err.Error())
+		return
+	}
+	server.Serve(listener)
+}
+
+// Serve accepts connections until Stop is called
+func (server *RespServer) Serve(listener net.Listener) error {
+	server.lock.Lock()
+	if server.stopped {
+		server.lock.Unlock()
+		listener.Close()
+		return nil
+	}
+	server.listener = listener
+	server.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.lock.Lock()
+			stopped := server.stopped
+			server.lock.Unlock()
+			if stopped {
+				return nil
+			}
+			return err
+		}
+
+		server.lock.Lock()
+		server.connections[conn] = struct{}{}
+		server.lock.Unlock()
+		go server.serve_connection(conn)
+	}
+}
+
+func (server *RespServer) Stop() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.stopped = true
+	if server.listener != nil {
+		server.listener.Close()
+	}
+	for conn := range server.connections {
+		conn.Close()
+	}
+}
+
+// connection is the state of one client, which may change its consistency level
+type connection struct {
+	server      *RespServer
+	reply       reply
+	consistency hash_ring.Consistency
+	principal   *auth.Principal
+	ip          string
+	quit        bool
+}
+
+func (server *RespServer) serve_connection(conn net.Conn) {
+	defer func() {
+		server.lock.Lock()
+		delete(server.connections, conn)
+		server.lock.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	client := connection{
+		server:      server,
+		reply:       reply{bufio.NewWriter(conn)},
+		consistency: server.consistency,
+		ip:          conn.RemoteAddr().String(),
+	}
+	if host, _, err := net.SplitHostPort(client.ip); err == nil {
+		client.ip = host
+	}
+
+	for !client.quit {
+		args, err := read_command(reader)
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				client.reply.error("ERR Protocol error")
+				client.reply.writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		client.execute(args)
+
+		//pipelined commands are answered together
+		if reader.Buffered() == 0 || client.quit {
+			if client.reply.writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+func (client *connection) execute(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	command, ok := commands[name]
+	if !ok {
+		client.reply.error("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	if len(args) < command.minimum_args || (command.maximum_args >= 0 && len(args) > command.maximum_args) {
+		client.reply.error("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	//limited by ip before authenticating, so clients failing to AUTH are limited too
+	if !client.allow(client.server.ip_limiter, client.ip, &command) || !client.authorize(name, &command, args[1:]) {
+		return
+	}
+	rate_limited_as := client.ip
+	if client.principal != nil {
+		rate_limited_as = client.principal.Name
+	}
+	if !client.allow(client.server.limiter, rate_limited_as, &command) {
+		return
+	}
+	command.run(client, args[1:])
+}
+
+// allow replies with an error when the rate limits of the client have run out,
+// commands with keys are limited as the keys endpoint over http and the rest as other
+func (client *connection) allow(limiter *limits.Limiter, rate_limited_as string, command *command) bool {
+	if limiter == nil {
+		return true
+	}
+	endpoint := "other"
+	if command.keys != keys_none {
+		endpoint = "keys"
+	}
+	allowed, wait := limiter.Allow(rate_limited_as, endpoint)
+	if !allowed {
+		client.reply.error("ERR too many requests, retry after " + strconv.Itoa(int(math.Ceil(wait.Seconds()))) + " seconds")
+	}
+	return allowed
+}
+
+// admit_write checks a write of a value to a key is within its quotas, replying with an error if not
+func (client *connection) admit_write(key string, value_size int) bool {
+	if client.server.quotas == nil {
+		return true
+	}
+	if err := client.server.quotas.Admit(key, value_size); err != nil {
+		client.reply.error("ERR " + err.Error())
+		return false
+	}
+	return true
+}
+
+// authorize replies with an error unless the client may run the command on its keys
+func (client *connection) authorize(name string, command *command, args [][]byte) bool {
+	authenticator := client.server.auth
+	if authenticator == nil || name == "auth" || name == "quit" {
+		return true
+	}
+	if client.principal == nil {
+		client.reply.error("NOAUTH Authentication required.")
+		return false
+	}
+	for _, key := range command.keys_of(args) {
+		bucket, bucket_key := hash_ring.Split_Bucket_Key(string(key))
+		if !authenticator.Allowed(client.principal, command.permission, bucket, bucket_key) {
+			client.reply.error("NOPERM this user has no permissions to access one of the keys used as arguments")
+			return false
+		}
+	}
+	return true
+}
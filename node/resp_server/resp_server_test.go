@@ -0,0 +1,195 @@
+package resp_server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lucifer1662/distrokdb/node/auth"
+	"github.com/lucifer1662/distrokdb/node/hash_ring"
+	"github.com/lucifer1662/distrokdb/node/limits"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_server(t *testing.T) (*RespServer, net.Conn, *bufio.Reader) {
+	return test_configured_server(t, func(*RespServer) {})
+}
+
+// test_configured_server lets auth and limits be set before the server starts serving
+func test_configured_server(t *testing.T, configure func(*RespServer)) (*RespServer, net.Conn, *bufio.Reader) {
+	nodes := hash_ring.Generate_Nodes(3)
+	for i := range nodes {
+		table := hash_ring.NewInMemoryTable()
+		temp_table := hash_ring.NewInMemoryTable()
+		nodes[i].SetTable(&table)
+		nodes[i].SetTemporaryTable(&temp_table)
+	}
+	hr := hash_ring.New(nodes, 3, 2, 2, &hash_ring.ConflictResolutionFirstInstance{})
+	server, err := NewRespServer(&Config{Consistency: "quorum"}, &hr)
+	assert.Nil(t, err)
+	configure(server)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	return server, conn, bufio.NewReader(conn)
+}
+
+// send writes the command as an array of bulk strings and reads back the whole reply
+func send(t *testing.T, conn net.Conn, reader *bufio.Reader, args ...string) string {
+	request := reply{bufio.NewWriter(conn)}
+	request.array(len(args))
+	for _, arg := range args {
+		request.bulk([]byte(arg))
+	}
+	assert.Nil(t, request.writer.Flush())
+	return read_reply(t, reader)
+}
+
+func read_reply(t *testing.T, reader *bufio.Reader) string {
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	switch line[0] {
+	case '$':
+		if line == "$-1\r\n" {
+			return line
+		}
+		value, _ := reader.ReadString('\n')
+		return line + value
+	case '*':
+		reply := line
+		count := 0
+		for _, digit := range strings.TrimSpace(line[1:]) {
+			count = count*10 + int(digit-'0')
+		}
+		for i := 0; i < count; i++ {
+			reply += read_reply(t, reader)
+		}
+		return reply
+	}
+	return line
+}
+
+func TestRespStrings(t *testing.T) {
+	server, conn, reader := test_server(t)
+	defer server.Stop()
+
+	assert.Equal(t, "+PONG\r\n", send(t, conn, reader, "PING"))
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "GET", "bar"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "bar", "mar"))
+	assert.Equal(t, "$3\r\nmar\r\n", send(t, conn, reader, "GET", "bar"))
+
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "SET", "bar", "car", "NX"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "bar", "car", "XX"))
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "SET", "foo", "car", "XX"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "foo", "jar", "NX"))
+
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "MSET", "a", "1", "b", "2", "a", "3"))
+	assert.Equal(t, "*3\r\n$1\r\n3\r\n$1\r\n2\r\n$-1\r\n", send(t, conn, reader, "MGET", "a", "b", "c"))
+	assert.Equal(t, ":3\r\n", send(t, conn, reader, "EXISTS", "a", "b", "c", "a"))
+
+	assert.Equal(t, ":2\r\n", send(t, conn, reader, "DEL", "a", "b", "c"))
+	assert.Equal(t, ":0\r\n", send(t, conn, reader, "EXISTS", "a"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "a", "again"))
+	assert.Equal(t, "$5\r\nagain\r\n", send(t, conn, reader, "GET", "a"))
+
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n", send(t, conn, reader, "GET"))
+	assert.Equal(t, "-ERR unknown command 'FLUSHALL'\r\n", send(t, conn, reader, "FLUSHALL"))
+}
+
+func TestRespIncrAndExpire(t *testing.T) {
+	server, conn, reader := test_server(t)
+	defer server.Stop()
+
+	assert.Equal(t, ":1\r\n", send(t, conn, reader, "INCR", "counter"))
+	assert.Equal(t, ":11\r\n", send(t, conn, reader, "INCRBY", "counter", "10"))
+	assert.Equal(t, ":9\r\n", send(t, conn, reader, "DECRBY", "counter", "2"))
+	assert.Equal(t, ":8\r\n", send(t, conn, reader, "DECR", "counter"))
+	send(t, conn, reader, "SET", "bar", "mar")
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", send(t, conn, reader, "INCR", "bar"))
+
+	assert.Equal(t, ":-1\r\n", send(t, conn, reader, "TTL", "counter"))
+	assert.Equal(t, ":-2\r\n", send(t, conn, reader, "TTL", "missing"))
+	assert.Equal(t, ":1\r\n", send(t, conn, reader, "EXPIRE", "counter", "100"))
+	assert.Equal(t, ":100\r\n", send(t, conn, reader, "TTL", "counter"))
+	//incrementing keeps the expiry
+	assert.Equal(t, ":9\r\n", send(t, conn, reader, "INCR", "counter"))
+	assert.Equal(t, ":100\r\n", send(t, conn, reader, "TTL", "counter"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "counter", "1", "EX", "50"))
+	assert.Equal(t, ":50\r\n", send(t, conn, reader, "TTL", "counter"))
+	assert.Equal(t, ":1\r\n", send(t, conn, reader, "EXPIRE", "counter", "0"))
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "GET", "counter"))
+	assert.Equal(t, ":0\r\n", send(t, conn, reader, "EXPIRE", "counter", "10"))
+}
+
+func TestRespInlineAndConsistency(t *testing.T) {
+	server, conn, reader := test_server(t)
+	defer server.Stop()
+
+	conn.Write([]byte("SET bar mar\r\nGET bar\r\n"))
+	assert.Equal(t, "+OK\r\n", read_reply(t, reader))
+	assert.Equal(t, "$3\r\nmar\r\n", read_reply(t, reader))
+
+	assert.Equal(t, "$6\r\nquorum\r\n", send(t, conn, reader, "CONSISTENCY"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "CONSISTENCY", "ALL"))
+	assert.Equal(t, "$3\r\nmar\r\n", send(t, conn, reader, "GET", "bar"))
+	assert.Equal(t, "-ERR Unknown consistency level \"most\"\r\n", send(t, conn, reader, "CONSISTENCY", "most"))
+
+	_, err := NewRespServer(&Config{Consistency: "most"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestRespAuth(t *testing.T) {
+	digest := sha256.Sum256([]byte("secret"))
+	authenticator, err := auth.New(&auth.Config{
+		Api_keys: []auth.ApiKey{{Principal: "alice", Sha256: hex.EncodeToString(digest[:])}},
+		Rules: []auth.Rule{
+			{Principal: "alice", Prefix: "users/", Permissions: []string{"read", "write"}},
+			{Principal: "alice", Bucket: "orders", Permissions: []string{"read"}},
+		},
+	})
+	assert.Nil(t, err)
+	server, conn, reader := test_configured_server(t, func(server *RespServer) { server.SetAuth(authenticator) })
+	defer server.Stop()
+
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n", send(t, conn, reader, "GET", "users/1"))
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n", send(t, conn, reader, "PING"))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "AUTH", "guess"), "-WRONGPASS"))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "AUTH", "bob", "secret"), "-WRONGPASS"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "AUTH", "alice", "secret"))
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "AUTH", "secret"))
+
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "users/1", "mar"))
+	assert.Equal(t, "$3\r\nmar\r\n", send(t, conn, reader, "GET", "users/1"))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "GET", "orders/1"), "-NOPERM"))
+	//every key of a command is checked
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "MSET", "users/2", "car", "orders/1", "car"), "-NOPERM"))
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "GET", "users/2"))
+
+	//keys of buckets are checked against the bucket's rules
+	bucket_key := hash_ring.Bucket_Key("orders", "1")
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "GET", bucket_key))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "SET", bucket_key, "car"), "-NOPERM"))
+}
+
+func TestRespLimits(t *testing.T) {
+	limiter, err := limits.NewLimiter([]limits.RateLimit{{Client: limits.Any, Endpoint: "keys", Requests_per_second: 0.01, Burst: 3}})
+	assert.Nil(t, err)
+	quotas, err := limits.NewQuotaTracker([]limits.Quota{{Prefix: "users/", Max_keys: 1}})
+	assert.Nil(t, err)
+	server, conn, reader := test_configured_server(t, func(server *RespServer) { server.SetLimits(limiter, quotas) })
+	defer server.Stop()
+
+	assert.Equal(t, "+OK\r\n", send(t, conn, reader, "SET", "users/1", "mar"))
+	assert.True(t, strings.HasPrefix(send(t, conn, reader, "SET", "users/2", "mar"), "-ERR Quota exceeded"))
+	assert.Equal(t, "$-1\r\n", send(t, conn, reader, "GET", "users/2"))
+	assert.Equal(t, "-ERR too many requests, retry after 100 seconds\r\n", send(t, conn, reader, "GET", "users/1"))
+	//commands without keys aren't limited as keys
+	assert.Equal(t, "+PONG\r\n", send(t, conn, reader, "PING"))
+}
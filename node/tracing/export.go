@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FileExporter appends spans to a file as json lines, one span a line
+type FileExporter struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+type FileSpan struct {
+	Trace_id   string            `json:"trace_id"`
+	Span_id    string            `json:"span_id"`
+	Parent_id  string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Start      time.Time         `json:"start"`
+	Duration   float64           `json:"duration_ms"`
+	Service    string            `json:"service"`
+	Instance   string            `json:"instance,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func (kind Kind) String() string {
+	switch kind {
+	case Kind_server:
+		return "server"
+	case Kind_client:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+func parent_hex(parent SpanId) string {
+	if parent == (SpanId{}) {
+		return ""
+	}
+	return hex.EncodeToString(parent[:])
+}
+
+func (exporter *FileExporter) Export(resource Resource, spans []*SpanData) error {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, span := range spans {
+		encoder.Encode(FileSpan{
+			Trace_id:   hex.EncodeToString(span.Trace_id[:]),
+			Span_id:    hex.EncodeToString(span.Span_id[:]),
+			Parent_id:  parent_hex(span.Parent_id),
+			Name:       span.Name,
+			Kind:       span.Kind.String(),
+			Start:      span.Start,
+			Duration:   float64(span.End.Sub(span.Start)) / float64(time.Millisecond),
+			Service:    resource.Service_name,
+			Instance:   resource.Instance_id,
+			Attributes: span.Attributes,
+			Error:      span.Error,
+		})
+	}
+	defer exporter.lock.Unlock()
+	exporter.lock.Lock()
+	_, err := exporter.file.Write(buffer.Bytes())
+	return err
+}
+
+// OtlpExporter posts spans to a collector in the OTLP/HTTP json encoding
+type OtlpExporter struct {
+	endpoint    string
+	http_client *http.Client
+}
+
+func NewOtlpExporter(endpoint string) *OtlpExporter {
+	return &OtlpExporter{endpoint: endpoint, http_client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type otlp_value struct {
+	String_value string `json:"stringValue"`
+}
+
+type otlp_attribute struct {
+	Key   string     `json:"key"`
+	Value otlp_value `json:"value"`
+}
+
+type otlp_status struct {
+	//2 is an error
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlp_span struct {
+	Trace_id       string           `json:"traceId"`
+	Span_id        string           `json:"spanId"`
+	Parent_span_id string           `json:"parentSpanId,omitempty"`
+	Name           string           `json:"name"`
+	Kind           int              `json:"kind"`
+	Start          string           `json:"startTimeUnixNano"`
+	End            string           `json:"endTimeUnixNano"`
+	Attributes     []otlp_attribute `json:"attributes,omitempty"`
+	Status         otlp_status      `json:"status"`
+}
+
+type otlp_scope_spans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlp_span `json:"spans"`
+}
+
+type otlp_resource_spans struct {
+	Resource struct {
+		Attributes []otlp_attribute `json:"attributes"`
+	} `json:"resource"`
+	Scope_spans []otlp_scope_spans `json:"scopeSpans"`
+}
+
+type otlp_request struct {
+	Resource_spans []otlp_resource_spans `json:"resourceSpans"`
+}
+
+func otlp_attributes(attributes map[string]string) []otlp_attribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]otlp_attribute, len(keys))
+	for i, key := range keys {
+		list[i] = otlp_attribute{key, otlp_value{attributes[key]}}
+	}
+	return list
+}
+
+func otlp_body(resource Resource, spans []*SpanData) otlp_request {
+	resource_attributes := map[string]string{"service.name": resource.Service_name}
+	if resource.Instance_id != "" {
+		resource_attributes["service.instance.id"] = resource.Instance_id
+	}
+	scope := otlp_scope_spans{Spans: make([]otlp_span, len(spans))}
+	scope.Scope.Name = "github.com/lucifer1662/distrokdb/node/tracing"
+	for i, span := range spans {
+		scope.Spans[i] = otlp_span{
+			Trace_id:       hex.EncodeToString(span.Trace_id[:]),
+			Span_id:        hex.EncodeToString(span.Span_id[:]),
+			Parent_span_id: parent_hex(span.Parent_id),
+			Name:           span.Name,
+			//otlp numbers kinds from 1, internal
+			Kind:       int(span.Kind) + 1,
+			Start:      strconv.FormatInt(span.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: otlp_attributes(span.Attributes),
+		}
+		if span.Error != "" {
+			scope.Spans[i].Status = otlp_status{Code: 2, Message: span.Error}
+		}
+	}
+	resource_spans := otlp_resource_spans{Scope_spans: []otlp_scope_spans{scope}}
+	resource_spans.Resource.Attributes = otlp_attributes(resource_attributes)
+	return otlp_request{[]otlp_resource_spans{resource_spans}}
+}
+
+func (exporter *OtlpExporter) Export(resource Resource, spans []*SpanData) error {
+	body, err := json.Marshal(otlp_body(resource, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := exporter.http_client.Post(exporter.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Collector answered %d", resp.StatusCode)
+	}
+	return nil
+}
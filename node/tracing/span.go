@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries the trace context of http requests, as in the W3C trace context spec
+const TraceparentHeader = "traceparent"
+
+type TraceId [16]byte
+type SpanId [8]byte
+
+// SpanContext is what is passed between nodes to continue a trace
+type SpanContext struct {
+	Trace_id TraceId
+	Span_id  SpanId
+	//unsampled traces are still passed on, so the nodes they reach don't start traces of their own
+	Sampled bool
+}
+
+func (span_context SpanContext) Valid() bool {
+	return span_context.Trace_id != TraceId{} && span_context.Span_id != SpanId{}
+}
+
+// Traceparent formats the context as a traceparent header, version 00
+func (span_context SpanContext) Traceparent() string {
+	flags := "00"
+	if span_context.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(span_context.Trace_id[:]) + "-" + hex.EncodeToString(span_context.Span_id[:]) + "-" + flags
+}
+
+// Parse_Traceparent reads a traceparent header, later versions are read as version 00 as the spec requires
+func Parse_Traceparent(header string) (SpanContext, error) {
+	span_context := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return span_context, errors.New("Traceparent is not version-trace_id-span_id-flags")
+	}
+	trace_id, err := hex.DecodeString(parts[1])
+	if err != nil || len(trace_id) != len(span_context.Trace_id) {
+		return span_context, errors.New("Traceparent has a bad trace id")
+	}
+	span_id, err := hex.DecodeString(parts[2])
+	if err != nil || len(span_id) != len(span_context.Span_id) {
+		return span_context, errors.New("Traceparent has a bad span id")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return span_context, errors.New("Traceparent has bad flags")
+	}
+	copy(span_context.Trace_id[:], trace_id)
+	copy(span_context.Span_id[:], span_id)
+	span_context.Sampled = flags[0]&1 == 1
+	if !span_context.Valid() {
+		return span_context, errors.New("Traceparent ids can't be all zeros")
+	}
+	return span_context, nil
+}
+
+type Kind int
+
+const (
+	Kind_internal Kind = iota
+	//handles a request from a client or another node
+	Kind_server
+	//a request to another node
+	Kind_client
+)
+
+// Span times an operation of a trace, a nil span records nothing so callers needn't check tracing is on
+type Span struct {
+	tracer     *Tracer
+	context    SpanContext
+	parent     SpanId
+	name       string
+	kind       Kind
+	start      time.Time
+	attributes map[string]string
+	error      string
+	ended      bool
+	lock       sync.Mutex
+}
+
+func new_id(id []byte) {
+	//crypto/rand never fails on supported platforms
+	rand.Read(id)
+}
+
+func (span *Span) Context() SpanContext {
+	if span == nil {
+		return SpanContext{}
+	}
+	return span.context
+}
+
+func (span *Span) SetAttribute(key string, value string) {
+	if span == nil || !span.context.Sampled {
+		return
+	}
+	defer span.lock.Unlock()
+	span.lock.Lock()
+	//the attributes are handed to the exporter once ended
+	if !span.ended {
+		span.attributes[key] = value
+	}
+}
+
+// SetError marks the span as failed, nil errors are ignored
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil || !span.context.Sampled {
+		return
+	}
+	defer span.lock.Unlock()
+	span.lock.Lock()
+	if !span.ended {
+		span.error = err.Error()
+	}
+}
+
+// End records the span, only the first call counts
+func (span *Span) End() {
+	if span == nil || !span.context.Sampled {
+		return
+	}
+	span.lock.Lock()
+	if span.ended {
+		span.lock.Unlock()
+		return
+	}
+	span.ended = true
+	data := SpanData{
+		Trace_id:   span.context.Trace_id,
+		Span_id:    span.context.Span_id,
+		Parent_id:  span.parent,
+		Name:       span.name,
+		Kind:       span.kind,
+		Start:      span.start,
+		End:        time.Now(),
+		Attributes: span.attributes,
+		Error:      span.error,
+	}
+	span.lock.Unlock()
+	span.tracer.record(&data)
+}
+
+type span_key struct{}
+
+// remote_key holds the context of a span on another node, the parent of the first span started here
+type remote_key struct{}
+
+// SpanFromContext is the span of the context, nil when there is none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(span_key{}).(*Span)
+	return span
+}
+
+// ContextWithRemote continues the trace of a traceparent sent by a client or another node,
+// a missing or malformed traceparent leaves the context unchanged
+func ContextWithRemote(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	span_context, err := Parse_Traceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remote_key{}, span_context)
+}
+
+// Traceparent is the traceparent to send with requests made in the context, empty without a trace
+func Traceparent(ctx context.Context) string {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.context.Traceparent()
+	}
+	if remote, has_remote := ctx.Value(remote_key{}).(SpanContext); has_remote {
+		return remote.Traceparent()
+	}
+	return ""
+}
+
+// Start starts a span as a child of the context's span, or of the remote span it continues.
+// Without a tracer the context is returned with a nil span
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	tracer := Current()
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: tracer, name: name, kind: kind, start: time.Now(), attributes: map[string]string{}}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.Trace_id = parent.context.Trace_id
+		span.context.Sampled = parent.context.Sampled
+		span.parent = parent.context.Span_id
+	} else if remote, has_remote := ctx.Value(remote_key{}).(SpanContext); has_remote {
+		span.context.Trace_id = remote.Trace_id
+		span.context.Sampled = remote.Sampled
+		span.parent = remote.Span_id
+	} else {
+		new_id(span.context.Trace_id[:])
+		span.context.Sampled = tracer.sample()
+	}
+	new_id(span.context.Span_id[:])
+	return context.WithValue(ctx, span_key{}, span), span
+}
@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Export_interval is how often ended spans are exported, unless a batch fills first
+const Export_interval = 5 * time.Second
+
+// Export_batch_size is the most spans exported at once
+const Export_batch_size = 512
+
+// Max_queued_spans bounds the spans waiting to be exported, spans ended while it is full are dropped
+// rather than slowing requests down
+const Max_queued_spans = 4096
+
+// SpanData is an ended span
+type SpanData struct {
+	Trace_id   TraceId
+	Span_id    SpanId
+	Parent_id  SpanId
+	Name       string
+	Kind       Kind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	//empty when the span succeeded
+	Error string
+}
+
+// Exporter sends ended spans somewhere they can be looked at
+type Exporter interface {
+	Export(resource Resource, spans []*SpanData) error
+}
+
+// Resource is the process spans were recorded by
+type Resource struct {
+	Service_name string
+	Instance_id  string
+}
+
+type Config struct {
+	//defaults to distrokdb
+	Service_name string `json:",omitempty"`
+	//fraction of requests without a sampled traceparent that are traced, between 0 and 1.
+	//Requests whose traceparent is sampled are always traced
+	Sample_ratio float64
+	//appends spans as json lines
+	File string `json:",omitempty"`
+	//OTLP/HTTP json endpoint of a collector, such as http://localhost:4318/v1/traces
+	Otlp_endpoint string `json:",omitempty"`
+}
+
+// Tracer samples traces and exports their spans in the background
+type Tracer struct {
+	resource     Resource
+	sample_ratio float64
+	exporters    []Exporter
+	queue        chan *SpanData
+	dropped      uint64
+	stop         chan struct{}
+	stopped      sync.WaitGroup
+}
+
+func CheckConfig(config *Config) error {
+	if config.Sample_ratio < 0 || config.Sample_ratio > 1 {
+		return errors.New("Sample_ratio must be between 0 and 1")
+	}
+	if config.File == "" && config.Otlp_endpoint == "" {
+		return errors.New("Tracing needs a File or Otlp_endpoint to export spans to")
+	}
+	return nil
+}
+
+func NewTracer(config *Config, instance_id string) (*Tracer, error) {
+	if err := CheckConfig(config); err != nil {
+		return nil, err
+	}
+	tracer := Tracer{
+		resource:     Resource{Service_name: config.Service_name, Instance_id: instance_id},
+		sample_ratio: config.Sample_ratio,
+		queue:        make(chan *SpanData, Max_queued_spans),
+		stop:         make(chan struct{}),
+	}
+	if tracer.resource.Service_name == "" {
+		tracer.resource.Service_name = "distrokdb"
+	}
+	if config.File != "" {
+		exporter, err := NewFileExporter(config.File)
+		if err != nil {
+			return nil, err
+		}
+		tracer.exporters = append(tracer.exporters, exporter)
+	}
+	if config.Otlp_endpoint != "" {
+		tracer.exporters = append(tracer.exporters, NewOtlpExporter(config.Otlp_endpoint))
+	}
+	return &tracer, nil
+}
+
+// NewTracerWithExporter traces every request, exporting to the exporter, for tests
+func NewTracerWithExporter(exporter Exporter) *Tracer {
+	return &Tracer{
+		resource:     Resource{Service_name: "distrokdb"},
+		sample_ratio: 1,
+		exporters:    []Exporter{exporter},
+		queue:        make(chan *SpanData, Max_queued_spans),
+		stop:         make(chan struct{}),
+	}
+}
+
+func (tracer *Tracer) sample() bool {
+	return tracer.sample_ratio >= 1 || (tracer.sample_ratio > 0 && rand.Float64() < tracer.sample_ratio)
+}
+
+func (tracer *Tracer) record(span *SpanData) {
+	select {
+	case tracer.queue <- span:
+	default:
+		atomic.AddUint64(&tracer.dropped, 1)
+	}
+}
+
+func (tracer *Tracer) export(batch []*SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+	for _, exporter := range tracer.exporters {
+		if err := exporter.Export(tracer.resource, batch); err != nil {
+			slog.Warn("Failed to export spans", "spans", len(batch), "error", err.Error())
+		}
+	}
+	if dropped := atomic.SwapUint64(&tracer.dropped, 0); dropped != 0 {
+		slog.Warn("Dropped spans, the export queue was full", "spans", dropped)
+	}
+}
+
+// Start exports spans until Stop is called
+func (tracer *Tracer) Start() {
+	tracer.stopped.Add(1)
+	go func() {
+		defer tracer.stopped.Done()
+		ticker := time.NewTicker(Export_interval)
+		defer ticker.Stop()
+		batch := []*SpanData{}
+		for {
+			select {
+			case span := <-tracer.queue:
+				batch = append(batch, span)
+				if len(batch) == Export_batch_size {
+					tracer.export(batch)
+					batch = []*SpanData{}
+				}
+			case <-ticker.C:
+				tracer.export(batch)
+				batch = []*SpanData{}
+			case <-tracer.stop:
+				//spans already ended are still exported
+				for len(tracer.queue) != 0 {
+					batch = append(batch, <-tracer.queue)
+				}
+				tracer.export(batch)
+				return
+			}
+		}
+	}()
+}
+
+// Stop exports the spans that have ended and stops exporting
+func (tracer *Tracer) Stop() {
+	close(tracer.stop)
+	tracer.stopped.Wait()
+}
+
+var current atomic.Value
+
+type tracer_holder struct {
+	tracer *Tracer
+}
+
+// SetTracer makes the tracer record the spans of this process, nil turns tracing off
+func SetTracer(tracer *Tracer) {
+	current.Store(tracer_holder{tracer})
+}
+
+// Current is the tracer spans are recorded with, nil when tracing is off
+func Current() *Tracer {
+	holder, _ := current.Load().(tracer_holder)
+	return holder.tracer
+}
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memory_exporter struct {
+	spans []*SpanData
+	lock  sync.Mutex
+}
+
+func (exporter *memory_exporter) Export(resource Resource, spans []*SpanData) error {
+	defer exporter.lock.Unlock()
+	exporter.lock.Lock()
+	exporter.spans = append(exporter.spans, spans...)
+	return nil
+}
+
+func TestTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	span_context, err := Parse_Traceparent(header)
+	assert.Nil(t, err)
+	assert.True(t, span_context.Sampled)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(span_context.Trace_id[:]))
+	assert.Equal(t, header, span_context.Traceparent())
+
+	for _, bad := range []string{"", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4bf92f35-00f067aa0ba902b7-01", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"} {
+		_, err := Parse_Traceparent(bad)
+		assert.NotNil(t, err, bad)
+	}
+	//later versions may add fields
+	_, err = Parse_Traceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.Nil(t, err)
+}
+
+func TestSpans(t *testing.T) {
+	ctx, span := Start(context.Background(), "untraced", Kind_internal)
+	assert.Nil(t, span)
+	assert.Equal(t, "", Traceparent(ctx))
+
+	exporter := &memory_exporter{}
+	tracer := NewTracerWithExporter(exporter)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+	tracer.Start()
+
+	ctx = ContextWithRemote(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(ctx, "GET keys", Kind_server)
+	_, child := Start(ctx, "replica get", Kind_client)
+	child.SetAttribute("kdb.hinted", "false")
+	child.End()
+	child.SetAttribute("kdb.hinted", "true")
+	parent.End()
+	parent.End()
+
+	//a client that didn't sample its trace isn't traced here either
+	ctx = ContextWithRemote(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4737-00f067aa0ba902b7-00")
+	ctx, unsampled := Start(ctx, "GET keys", Kind_server)
+	assert.False(t, unsampled.Context().Sampled)
+	assert.Equal(t, "-00", Traceparent(ctx)[len(Traceparent(ctx))-3:])
+	unsampled.End()
+	tracer.Stop()
+
+	assert.Equal(t, 2, len(exporter.spans))
+	assert.Equal(t, "replica get", exporter.spans[0].Name)
+	assert.Equal(t, map[string]string{"kdb.hinted": "false"}, exporter.spans[0].Attributes)
+	assert.Equal(t, parent.Context().Span_id, exporter.spans[0].Parent_id)
+	assert.Equal(t, parent.Context().Trace_id, exporter.spans[0].Trace_id)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(exporter.spans[1].Trace_id[:]))
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(exporter.spans[1].Parent_id[:]))
+}
+
+func TestExporters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	var posted otlp_request
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&posted)
+	}))
+	defer collector.Close()
+
+	tracer, err := NewTracer(&Config{Sample_ratio: 1, File: path, Otlp_endpoint: collector.URL}, "3")
+	assert.Nil(t, err)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+	tracer.Start()
+	_, span := Start(context.Background(), "GET keys", Kind_server)
+	span.SetError(os.ErrNotExist)
+	span.End()
+	tracer.Stop()
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	assert.True(t, scanner.Scan())
+	var line FileSpan
+	assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+	assert.Equal(t, "GET keys", line.Name)
+	assert.Equal(t, "server", line.Kind)
+	assert.Equal(t, "3", line.Instance)
+	assert.Equal(t, os.ErrNotExist.Error(), line.Error)
+	assert.False(t, scanner.Scan())
+
+	assert.Equal(t, 1, len(posted.Resource_spans))
+	assert.Equal(t, []otlp_attribute{{"service.instance.id", otlp_value{"3"}}, {"service.name", otlp_value{"distrokdb"}}}, posted.Resource_spans[0].Resource.Attributes)
+	otlp_span := posted.Resource_spans[0].Scope_spans[0].Spans[0]
+	assert.Equal(t, line.Trace_id, otlp_span.Trace_id)
+	assert.Equal(t, 2, otlp_span.Kind)
+	assert.Equal(t, 2, otlp_span.Status.Code)
+
+	_, err = NewTracer(&Config{Sample_ratio: 2, File: path}, "3")
+	assert.NotNil(t, err)
+	_, err = NewTracer(&Config{Sample_ratio: 1}, "3")
+	assert.NotNil(t, err)
+}